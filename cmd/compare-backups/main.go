@@ -0,0 +1,35 @@
+// compare-backups prints the objects added, removed and modified between two backups as JSON, see resourcesets.CompareBackups
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	From string
+	To   string
+)
+
+func main() {
+	flag.StringVar(&From, "from", "", "Path to the older backup file or dir")
+	flag.StringVar(&To, "to", "", "Path to the newer backup file or dir")
+	flag.Parse()
+
+	if From == "" || To == "" {
+		logrus.Fatalf("--from and --to are required")
+	}
+	diff, err := resourcesets.CompareBackups(From, To)
+	if err != nil {
+		logrus.Fatalf("Error comparing %v and %v: %v", From, To, err)
+	}
+	diffBytes, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		logrus.Fatalf("Error converting diff to JSON: %v", err)
+	}
+	fmt.Println(string(diffBytes))
+}
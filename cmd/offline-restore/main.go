@@ -0,0 +1,45 @@
+// offline-restore restores a backup file of the operator into a cluster without the operator, see restore.OfflineRestore
+package main
+
+import (
+	"flag"
+
+	"github.com/rancher/backup-restore-operator/pkg/controllers/restore"
+	"github.com/rancher/wrangler/pkg/kubeconfig"
+	"github.com/rancher/wrangler/pkg/ratelimit"
+	"github.com/rancher/wrangler/pkg/signals"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	KubeConfig string
+	Options    restore.OfflineRestoreOptions
+	Debug      bool
+)
+
+func main() {
+	flag.StringVar(&KubeConfig, "kubeconfig", "", "Path to the kubeconfig of the cluster to restore into")
+	flag.StringVar(&Options.BackupPath, "backup-path", "", "Path to the backup file, .tar.gz or .tar.gz.enc")
+	flag.StringVar(&Options.EncryptionConfigPath, "encryption-config", "", "Path to the encryption config the backup was encrypted with")
+	flag.IntVar(&Options.BatchSize, "batch-size", 0, "Number of objects of the same resource restored at the same time")
+	flag.BoolVar(&Options.IgnoreErrors, "ignore-errors", false, "Continue with the namespaced resources if restoring cluster scoped ones failed")
+	flag.BoolVar(&Debug, "debug", false, "Log at debug level")
+	flag.Parse()
+
+	if Debug {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+	if Options.BackupPath == "" {
+		logrus.Fatalf("--backup-path is required")
+	}
+	ctx := signals.SetupSignalContext()
+	restKubeConfig, err := kubeconfig.GetNonInteractiveClientConfig(KubeConfig).ClientConfig()
+	if err != nil {
+		logrus.Fatalf("failed to find kubeconfig: %v", err)
+	}
+	restKubeConfig.RateLimiter = ratelimit.None
+
+	if err := restore.OfflineRestore(ctx, restKubeConfig, Options); err != nil {
+		logrus.Fatalf("Error restoring %v: %v", Options.BackupPath, err)
+	}
+}
@@ -6,6 +6,7 @@ replace k8s.io/client-go => k8s.io/client-go v0.21.2
 
 require (
 	github.com/minio/minio-go/v6 v6.0.57
+	github.com/prometheus/client_golang v1.0.0
 	github.com/rancher/lasso v0.0.0-20210616224652-fc3ebd901c08
 	github.com/rancher/wrangler v0.8.9
 	github.com/robfig/cron v1.2.0
@@ -9,24 +9,33 @@ import (
 	"flag"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
 	"github.com/rancher/backup-restore-operator/pkg/controllers/backup"
 	"github.com/rancher/backup-restore-operator/pkg/controllers/restore"
 	"github.com/rancher/backup-restore-operator/pkg/generated/controllers/resources.cattle.io"
+	"github.com/rancher/backup-restore-operator/pkg/metrics"
+	"github.com/rancher/backup-restore-operator/pkg/objectstore"
 	"github.com/rancher/backup-restore-operator/pkg/util"
 	lasso "github.com/rancher/lasso/pkg/client"
 	"github.com/rancher/lasso/pkg/mapper"
 	v1core "github.com/rancher/wrangler/pkg/generated/controllers/core"
 	"github.com/rancher/wrangler/pkg/kubeconfig"
 	"github.com/rancher/wrangler/pkg/ratelimit"
+	"github.com/rancher/wrangler/pkg/schemes"
 	"github.com/rancher/wrangler/pkg/signals"
 	"github.com/rancher/wrangler/pkg/start"
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
@@ -41,6 +50,16 @@ var (
 	OperatorPVEnabled               string
 	OperatorS3BackupStorageLocation string
 	ChartNamespace                  string
+	BackupIgnoreAnnotation          string
+	EncryptionProviderTimeout       string
+	EncryptionProviderRetries       string
+	APIRetries                      string
+	APIRetryDelay                   string
+	MetricsAddress                  = ":8080"
+	DefaultEncryptionConfig         string
+	MaxConcurrentBackups            int
+	CheckpointDir                   string
+	LogLevel                        string
 )
 
 type objectStore struct {
@@ -52,14 +71,34 @@ type objectStore struct {
 	BucketName                string `json:"bucketName"`
 	Region                    string `json:"region"`
 	Folder                    string `json:"folder"`
+	ServerSideEncryption      string `json:"serverSideEncryption"`
+	KMSKeyID                  string `json:"kmsKeyID"`
 }
 
 func init() {
 	flag.StringVar(&KubeConfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
+	flag.IntVar(&MaxConcurrentBackups, "max-concurrent-backups", 0, "Number of backups that can run at the same time, 0 doesn't limit them. Defaults to MAX_CONCURRENT_BACKUPS")
 	flag.Parse()
+	if limit := os.Getenv("MAX_CONCURRENT_BACKUPS"); limit != "" && MaxConcurrentBackups == 0 {
+		var err error
+		if MaxConcurrentBackups, err = strconv.Atoi(limit); err != nil {
+			logrus.Fatalf("Invalid MAX_CONCURRENT_BACKUPS %v, must be a number", limit)
+		}
+	}
 	OperatorPVEnabled = os.Getenv("DEFAULT_PERSISTENCE_ENABLED")
 	OperatorS3BackupStorageLocation = os.Getenv("DEFAULT_S3_BACKUP_STORAGE_LOCATION")
 	ChartNamespace = os.Getenv("CHART_NAMESPACE")
+	BackupIgnoreAnnotation = os.Getenv("BACKUP_IGNORE_ANNOTATION")
+	DefaultEncryptionConfig = os.Getenv("DEFAULT_ENCRYPTION_CONFIG_SECRET_NAME")
+	EncryptionProviderTimeout = os.Getenv("ENCRYPTION_PROVIDER_TIMEOUT_SECONDS")
+	EncryptionProviderRetries = os.Getenv("ENCRYPTION_PROVIDER_RETRIES")
+	APIRetries = os.Getenv("API_RETRIES")
+	APIRetryDelay = os.Getenv("API_RETRY_DELAY_SECONDS")
+	CheckpointDir = os.Getenv("CHECKPOINT_DIR")
+	LogLevel = os.Getenv("LOG_LEVEL")
+	if address := os.Getenv("METRICS_ADDRESS"); address != "" {
+		MetricsAddress = address
+	}
 }
 
 func main() {
@@ -68,7 +107,15 @@ func main() {
 	var defaultMountPath string
 
 	logrus.Info("Starting controller")
+	util.OperatorVersion = Version
 	logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true, ForceColors: true, TimestampFormat: LogFormat})
+	if LogLevel != "" {
+		level, err := logrus.ParseLevel(LogLevel)
+		if err != nil {
+			logrus.Fatalf("Invalid LOG_LEVEL %v: %v", LogLevel, err)
+		}
+		logrus.SetLevel(level)
+	}
 	ctx := signals.SetupSignalContext()
 	restKubeConfig, err := kubeconfig.GetNonInteractiveClientConfig(KubeConfig).ClientConfig()
 	if err != nil {
@@ -106,6 +153,10 @@ func main() {
 	if err != nil {
 		logrus.Fatalf("Error generating dynamic client: %s", err.Error())
 	}
+	metadataInterface, err := metadata.NewForConfig(restKubeConfig)
+	if err != nil {
+		logrus.Fatalf("Error generating metadata client: %s", err.Error())
+	}
 	sharedClientFactory, err := lasso.NewSharedClientFactoryForConfig(restKubeConfig)
 	if err != nil {
 		logrus.Fatalf("Error generating shared client factory: %s", err.Error())
@@ -159,23 +210,85 @@ func main() {
 			BucketName:                objStoreWithStrSkipVerify.BucketName,
 			Region:                    objStoreWithStrSkipVerify.Region,
 			Folder:                    objStoreWithStrSkipVerify.Folder,
+			ServerSideEncryption:      objStoreWithStrSkipVerify.ServerSideEncryption,
+			KMSKeyID:                  objStoreWithStrSkipVerify.KMSKeyID,
 		}
 		if objStoreWithStrSkipVerify.InsecureTLSSkipVerify == "true" {
 			defaultS3.InsecureTLSSkipVerify = true
 		}
+		if _, err := objectstore.ServerSideEncryption(defaultS3); err != nil {
+			logrus.Fatalf("Invalid default s3 details: %v", err)
+		}
 	}
 
 	util.ChartNamespace = ChartNamespace
 	logrus.Infof("Secrets containing encryption config files must be stored in the namespace %v", ChartNamespace)
+	if BackupIgnoreAnnotation != "" {
+		util.BackupIgnoreAnnotation = BackupIgnoreAnnotation
+	}
+	logrus.Infof("Objects with the annotation %v set to true are not backed up", util.BackupIgnoreAnnotation)
+	if DefaultEncryptionConfig != "" {
+		util.DefaultEncryptionConfigSecretName = DefaultEncryptionConfig
+		logrus.Infof("Backups without an encryption config are encrypted with the default encryption config %v", DefaultEncryptionConfig)
+	}
+	if EncryptionProviderTimeout != "" {
+		timeoutSeconds, err := strconv.Atoi(EncryptionProviderTimeout)
+		if err != nil || timeoutSeconds < 1 {
+			logrus.Fatalf("Invalid encryption provider timeout %v, must be a positive number of seconds", EncryptionProviderTimeout)
+		}
+		util.EncryptionProviderTimeout = time.Duration(timeoutSeconds) * time.Second
+	}
+	if EncryptionProviderRetries != "" {
+		retries, err := strconv.Atoi(EncryptionProviderRetries)
+		if err != nil || retries < 1 {
+			logrus.Fatalf("Invalid encryption provider retries %v, must be a positive number", EncryptionProviderRetries)
+		}
+		util.EncryptionProviderRetries = retries
+	}
+	if APIRetries != "" {
+		retries, err := strconv.Atoi(APIRetries)
+		if err != nil || retries < 1 {
+			logrus.Fatalf("Invalid API retries %v, must be a positive number", APIRetries)
+		}
+		util.APIRetries = retries
+	}
+	if APIRetryDelay != "" {
+		delaySeconds, err := strconv.Atoi(APIRetryDelay)
+		if err != nil || delaySeconds < 1 {
+			logrus.Fatalf("Invalid API retry delay %v, must be a positive number of seconds", APIRetryDelay)
+		}
+		util.APIRetryDelay = time.Duration(delaySeconds) * time.Second
+	}
+
+	if MaxConcurrentBackups < 0 {
+		logrus.Fatalf("Invalid max concurrent backups %v, must be 0 or more", MaxConcurrentBackups)
+	}
+	if MaxConcurrentBackups > 0 {
+		util.MaxConcurrentBackups = MaxConcurrentBackups
+		logrus.Infof("At most %v backups run at the same time", MaxConcurrentBackups)
+	}
+
+	if CheckpointDir != "" {
+		util.CheckpointDir = CheckpointDir
+		logrus.Infof("Checkpoints of backups are kept in %v", CheckpointDir)
+	}
+
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: k8sclient.CoreV1().Events("")})
+	recorder := eventBroadcaster.NewRecorder(schemes.All, corev1.EventSource{Component: "backup-restore-operator"})
+
+	go metrics.Serve(MetricsAddress)
 
 	backup.Register(ctx, backups.Resources().V1().Backup(),
 		backups.Resources().V1().ResourceSet(),
 		core.Core().V1().Secret(),
 		core.Core().V1().Namespace(),
-		clientSet, dynamicInterace, defaultMountPath, defaultS3)
+		core.Core().V1().ConfigMap(),
+		clientSet, dynamicInterace, metadataInterface, recorder, defaultMountPath, defaultS3)
 	restore.Register(ctx, backups.Resources().V1().Restore(),
 		backups.Resources().V1().Backup(),
 		core.Core().V1().Secret(),
+		core.Core().V1().ConfigMap(),
 		k8sclient.CoordinationV1().Leases(ChartNamespace),
 		clientSet, dynamicInterace, sharedClientFactory, restmapper, defaultMountPath, defaultS3)
 
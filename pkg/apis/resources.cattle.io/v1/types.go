@@ -10,9 +10,11 @@ var (
 	BackupConditionUploaded     = "Uploaded"
 	BackupConditionReconciling  = "Reconciling"
 	BackupConditionStalled      = "Stalled"
+	BackupConditionWaiting      = "Waiting"
 	RestoreConditionReconciling = "Reconciling"
 	RestoreConditionStalled     = "Stalled"
 	RestoreConditionReady       = "Ready"
+	RestoreConditionValidated   = "Validated"
 )
 
 // +genclient
@@ -33,6 +35,171 @@ type BackupSpec struct {
 	EncryptionConfigSecretName string           `json:"encryptionConfigSecretName,omitempty"`
 	Schedule                   string           `json:"schedule,omitempty"`
 	RetentionCount             int64            `json:"retentionCount,omitempty"`
+	// RetentionMaxAge deletes the backups older than this duration, example "168h", in addition to the ones beyond
+	// RetentionCount. The newest backup is always kept
+	RetentionMaxAge string `json:"retentionMaxAge,omitempty"`
+	// FieldProjections limit the objects of a kind to the listed fields, projected objects can't be restored
+	FieldProjections []FieldProjection `json:"fieldProjections,omitempty"`
+	// IncludeNamespaces limits the namespaced objects of the backup, and the Namespaces, to these namespaces, whatever the
+	// ResourceSet selects. ExcludeNamespaces are never backed up, they win over IncludeNamespaces
+	IncludeNamespaces []string `json:"includeNamespaces,omitempty"`
+	ExcludeNamespaces []string `json:"excludeNamespaces,omitempty"`
+	// PruneFields are dot separated paths removed from every object before it's written, in addition to metadata.managedFields
+	// and the status of workloads.
+	// Keys containing dots are written in brackets, example metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]
+	PruneFields []string `json:"pruneFields,omitempty"`
+	// ArtifactNameTemplate is used to name the backup files, supported tokens are {backup}, {resourceSet}, {clusterID},
+	// {timestamp} and {uuid}. It must contain {backup} and either {timestamp} or {uuid}. Defaults to {backup}-{clusterID}-{timestamp}
+	ArtifactNameTemplate string `json:"artifactNameTemplate,omitempty"`
+	// IncludeOperatorConfig adds all Backup and ResourceSet CRs and the encryption configs they use to the backup
+	IncludeOperatorConfig bool `json:"includeOperatorConfig,omitempty"`
+	// RunReport writes a ConfigMap with the result of every run of this backup
+	RunReport *RunReport `json:"runReport,omitempty"`
+	// ConsistencyMode is either list (default) or watch, watch makes all resources of the backup consistent with each other
+	ConsistencyMode string `json:"consistencyMode,omitempty"`
+	// ResourceSetSource loads the ResourceSet from a ConfigMap or a file instead of the ResourceSet CR named ResourceSetName
+	ResourceSetSource *ResourceSetSource `json:"resourceSetSource,omitempty"`
+	// SkipObjectsOnEncryptionFailure skips the objects the encryption provider fails on, by default the backup fails
+	SkipObjectsOnEncryptionFailure bool `json:"skipObjectsOnEncryptionFailure,omitempty"`
+	// RecordChanges marks every object in the manifest of the backup as new, changed or unchanged since the previous
+	// backup of this Backup CR, based on the resourceVersions recorded in the previous manifest
+	RecordChanges bool `json:"recordChanges,omitempty"`
+	// SkipControllerOwnedObjects skips objects whose managedFields only list field managers of controllers
+	SkipControllerOwnedObjects *ControllerOwnedObjectsFilter `json:"skipControllerOwnedObjects,omitempty"`
+	// EstimateOnly counts the objects matched by the ResourceSet and sets the estimate in the status, nothing is backed up
+	EstimateOnly bool `json:"estimateOnly,omitempty"`
+	// Trigger runs the backup whenever objects of the given kinds change, in addition to the schedule if there is one
+	Trigger *BackupTrigger `json:"trigger,omitempty"`
+	// DisableEncryption stores the backup unencrypted even if EncryptionConfigSecretName or the operator's default
+	// encryption config is set. Without it, a backup without EncryptionConfigSecretName uses the default
+	DisableEncryption bool `json:"disableEncryption,omitempty"`
+	// StreamArtifact writes the files of the backup straight into the compressed artifact instead of a temporary directory
+	// that is compressed at the end
+	StreamArtifact bool `json:"streamArtifact,omitempty"`
+	// CaptureEvents adds the events of the backed up objects to the backup for post-incident analysis, they are never restored
+	CaptureEvents *EventCapture `json:"captureEvents,omitempty"`
+	// QuietPeriod checks that the Deployments and StatefulSets of the backup aren't rolling out before backing them up
+	QuietPeriod *QuietPeriod `json:"quietPeriod,omitempty"`
+	// ExclusionFile excludes the objects matching the rules of a file maintained outside of the Backup, read at every run
+	ExclusionFile *ExclusionFileSource `json:"exclusionFile,omitempty"`
+	// RBACSummary adds a report of the permissions of every subject of the backed up RoleBindings and ClusterRoleBindings
+	// to the backup, as rbac-summary.txt
+	RBACSummary bool `json:"rbacSummary,omitempty"`
+	// ReproducibleArtifact gives every file of the artifact the same time and owner, so backups of an unchanged cluster
+	// are identical byte for byte. Encrypted backups and streamed backups with shards still differ between runs
+	ReproducibleArtifact bool `json:"reproducibleArtifact,omitempty"`
+	// FileMode is the octal permission of backup files stored on the persistent volume, example "0640", defaults to 0600
+	FileMode string `json:"fileMode,omitempty"`
+	// RecordTrustBundles records the fingerprints of the ClusterTrustBundles and of the cluster's root CA in the manifest,
+	// so a restore can warn about trust roots missing in the target cluster
+	RecordTrustBundles bool `json:"recordTrustBundles,omitempty"`
+	// NamespaceBundles adds a manifest per namespace to the backup, so a restore can restore a single namespace with NamespaceBundle
+	NamespaceBundles bool `json:"namespaceBundles,omitempty"`
+	// Checkpoint keeps the list of every gathered resource in a working dir, so a backup interrupted by a restart of the
+	// operator resumes the gather instead of listing everything again
+	Checkpoint bool `json:"checkpoint,omitempty"`
+	// Parallelism is the number of resources of a selector gathered at the same time, defaults to 5
+	Parallelism int `json:"parallelism,omitempty"`
+	// ListPageSize is the number of objects fetched per list call, smaller pages use less memory on the apiserver.
+	// Defaults to 200
+	ListPageSize int64 `json:"listPageSize,omitempty"`
+	// FailurePolicy is either Abort (default) or Continue, Continue backs up the other resources when gathering one fails
+	// and records the failed ones in the status
+	FailurePolicy string `json:"failurePolicy,omitempty"`
+	// Incremental only writes the objects whose resourceVersion changed since the last full backup of this Backup CR, the
+	// manifest lists every object and refers to the full backup for the unchanged ones
+	Incremental bool `json:"incremental,omitempty"`
+	// FullBackupInterval is the number of incremental backups taken after a full backup before the next full one, defaults to 6
+	FullBackupInterval int `json:"fullBackupInterval,omitempty"`
+	// ResourceTimeoutSeconds limits the time spent gathering the objects of a single resource, 0 doesn't limit it
+	ResourceTimeoutSeconds int `json:"resourceTimeoutSeconds,omitempty"`
+	// MaxObjectsPerResource fails the backup if a resource has more objects, 0 doesn't limit it. With FailurePolicy Continue
+	// the resource is left out and recorded in the status instead
+	MaxObjectsPerResource int64 `json:"maxObjectsPerResource,omitempty"`
+	// MaxTotalSizeBytes fails the backup once the objects written exceed this size before compression, 0 doesn't limit it.
+	// With FailurePolicy Continue the objects past the limit are left out and their resources recorded in the status instead
+	MaxTotalSizeBytes int64 `json:"maxTotalSizeBytes,omitempty"`
+	// SinceTime only backs up objects created at or after this time, CRDs, Namespaces and objects without a
+	// creationTimestamp are always backed up
+	SinceTime *metav1.Time `json:"sinceTime,omitempty"`
+	// PerObjectCompression gzips every object whose JSON is larger than this many bytes into a .json.gz file before it is
+	// encrypted, 0 doesn't compress objects. Objects of sharded resources are never compressed on their own
+	PerObjectCompression int64 `json:"perObjectCompression,omitempty"`
+}
+
+// ExclusionFileSource holds an exclusion file with a group/resource/namespace/name glob pattern per line, exactly one of
+// ConfigMapName and ObjectKey must be set
+type ExclusionFileSource struct {
+	ConfigMapName string `json:"configMapName,omitempty"`
+	// ConfigMapNamespace defaults to the chart's namespace
+	ConfigMapNamespace string `json:"configMapNamespace,omitempty"`
+	// ConfigMapKey defaults to backupignore
+	ConfigMapKey string `json:"configMapKey,omitempty"`
+	// ObjectKey is an object in the S3 bucket the backup is stored in, relative to its folder
+	ObjectKey string `json:"objectKey,omitempty"`
+}
+
+// QuietPeriod waits for workloads that are rolling out, workloads that don't settle in time are recorded in the status
+// of the backup and backed up as they are
+type QuietPeriod struct {
+	// TimeoutSeconds is how long the backup waits for workloads to settle, at most 600. 0 doesn't wait and only records them
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+}
+
+// EventCapture selects the events captured along with the objects of a backup, by the namespace of the events
+type EventCapture struct {
+	Namespaces []string `json:"namespaces"`
+	// Kinds limits the capture to events of objects of these kinds
+	Kinds []string `json:"kinds,omitempty"`
+	// MaxEventsPerObject is the number of events kept per object, the newest are kept. Defaults to 10
+	MaxEventsPerObject int `json:"maxEventsPerObject,omitempty"`
+}
+
+type BackupTrigger struct {
+	Resources []TriggerResource `json:"resources"`
+	// DebounceSeconds is how long the objects must stay unchanged before the backup runs, so a burst of changes
+	// runs a single backup. Defaults to 30
+	DebounceSeconds int `json:"debounceSeconds,omitempty"`
+}
+
+type TriggerResource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// Namespace limits the watch to a single namespace
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ControllerOwnedObjectsFilter decides which objects were generated by controllers, by their field managers
+type ControllerOwnedObjectsFilter struct {
+	// ControllerManagers are prefixes of field manager names of controllers, by default the kubernetes controllers
+	// kube-controller-manager, kube-scheduler and kubelet
+	ControllerManagers []string `json:"controllerManagers,omitempty"`
+}
+
+// ResourceSetSource holds a ResourceSet as YAML or JSON, exactly one of ConfigMapName and File must be set
+type ResourceSetSource struct {
+	ConfigMapName string `json:"configMapName,omitempty"`
+	// ConfigMapNamespace defaults to the chart's namespace
+	ConfigMapNamespace string `json:"configMapNamespace,omitempty"`
+	// ConfigMapKey defaults to resourceset.yaml
+	ConfigMapKey string `json:"configMapKey,omitempty"`
+	// File is the path of a file mounted into the operator's container
+	File string `json:"file,omitempty"`
+}
+
+type RunReport struct {
+	// Namespace of the report ConfigMaps, defaults to the chart's namespace
+	Namespace string `json:"namespace,omitempty"`
+	// RetentionCount is the number of report ConfigMaps kept for the backup, defaults to 10
+	RetentionCount int64 `json:"retentionCount,omitempty"`
+}
+
+type FieldProjection struct {
+	// Group is empty for core resources
+	Group string `json:"group,omitempty"`
+	Kind  string `json:"kind"`
+	// Fields are dot separated paths to keep, example "spec.replicas", apiVersion, kind, name and namespace are always kept
+	Fields []string `json:"fields"`
 }
 
 type BackupStatus struct {
@@ -44,6 +211,46 @@ type BackupStatus struct {
 	BackupType         string                              `json:"backupType"`
 	Filename           string                              `json:"filename"`
 	Summary            string                              `json:"summary"`
+	// ObjectCount is the number of objects written by the last backup
+	ObjectCount int64 `json:"objectCount,omitempty"`
+	// SkippedObjectCounts is the number of objects per resource not backed up because of the backup ignore annotation
+	// or a failure of the encryption provider
+	SkippedObjectCounts map[string]int64 `json:"skippedObjectCounts,omitempty"`
+	// Estimate is set by backups with EstimateOnly
+	Estimate *BackupEstimate `json:"estimate,omitempty"`
+	// UnsettledWorkloads are the Deployments and StatefulSets that were still rolling out when the last backup was taken,
+	// only set for backups with a QuietPeriod
+	UnsettledWorkloads []string `json:"unsettledWorkloads,omitempty"`
+	// ServerSideEncryption is the SSE mode the last backup was uploaded with, empty for backups without SSE or not on S3
+	ServerSideEncryption string `json:"serverSideEncryption,omitempty"`
+	// CatalogEntryID is the ID of the last backup in the catalog ConfigMap, a Restore can reference it with catalogEntry
+	CatalogEntryID string `json:"catalogEntryID,omitempty"`
+	// FailedResources maps every resource that couldn't be gathered by the last backup to its error, only set for backups
+	// with FailurePolicy Continue
+	FailedResources map[string]string `json:"failedResources,omitempty"`
+	// TruncatedResources maps every resource left out or cut short by maxObjectsPerResource or maxTotalSizeBytes in the
+	// last backup to the reason, only set for backups with FailurePolicy Continue
+	TruncatedResources map[string]string `json:"truncatedResources,omitempty"`
+	// LastFullBackup is the filename of the full backup the incremental backups of this Backup CR derive from
+	LastFullBackup string `json:"lastFullBackup,omitempty"`
+	// IncrementalsSinceFullBackup is the number of incremental backups taken since LastFullBackup
+	IncrementalsSinceFullBackup int `json:"incrementalsSinceFullBackup,omitempty"`
+	// ObservedTrigger is the value of the resources.cattle.io/trigger annotation the last on-demand backup ran for
+	ObservedTrigger string `json:"observedTrigger,omitempty"`
+	// LastOnDemandSnapshotTS is the time of the last backup run by the trigger annotation, LastSnapshotTS is set too
+	LastOnDemandSnapshotTS string `json:"lastOnDemandSnapshotTs,omitempty"`
+	// ConsecutiveFailures is the number of times the backup failed since it last succeeded, each failure doubles the
+	// delay before it's retried
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+}
+
+// BackupEstimate is an upper bound of what a backup would contain, names and namespace regexps of the ResourceSet are not
+// applied when counting
+type BackupEstimate struct {
+	// ObjectCounts is the number of objects per resource
+	ObjectCounts map[string]int64 `json:"objectCounts,omitempty"`
+	// SizeBytes is the size of the backup before compression, extrapolated from the first object of every resource
+	SizeBytes int64 `json:"sizeBytes"`
 }
 
 // +genclient
@@ -60,8 +267,13 @@ type ResourceSet struct {
 
 // regex+list = OR //separate fields :AND
 type ResourceSelector struct {
-	APIVersion         string                `json:"apiVersion"`
-	Kinds              []string              `json:"kinds,omitempty"`
+	// APIVersion is required unless APIGroupRegexp is set
+	APIVersion string `json:"apiVersion,omitempty"`
+	// APIGroupRegexp selects every group served by the cluster whose name matches it instead of the group of APIVersion,
+	// each at its preferred version or, with VersionPolicy Highest, at its highest version. The core group is never matched
+	APIGroupRegexp string   `json:"apiGroupRegexp,omitempty"`
+	Kinds          []string `json:"kinds,omitempty"`
+	// KindsRegexp, ResourceNameRegexp and NamespaceRegexp match the whole value, "." matches everything
 	KindsRegexp        string                `json:"kindsRegexp,omitempty"`
 	ResourceNames      []string              `json:"resourceNames,omitempty"`
 	ResourceNameRegexp string                `json:"resourceNameRegexp,omitempty"`
@@ -69,6 +281,22 @@ type ResourceSelector struct {
 	NamespaceRegexp    string                `json:"namespaceRegexp,omitempty"`
 	LabelSelectors     *metav1.LabelSelector `json:"labelSelectors,omitempty"`
 	ExcludeKinds       []string              `json:"excludeKinds,omitempty"`
+	// FieldSelectors are passed to the list calls as field selectors, example "status.phase=Running". All resources support
+	// metadata.name and metadata.namespace, other fields depend on the resource. Resources of aggregated APIs rejecting
+	// field selectors on metadata.name and metadata.namespace are matched against them after listing
+	FieldSelectors []string `json:"fieldSelectors,omitempty"`
+	// Shards splits the objects of every matched resource across this many files, by a hash of their namespace and name
+	Shards int `json:"shards,omitempty"`
+	// PreferredVersionOnly gathers the group of apiVersion at the preferred version reported by discovery instead,
+	// it's the same as VersionPolicy Preferred
+	PreferredVersionOnly bool `json:"preferredVersionOnly,omitempty"`
+	// VersionPolicy picks the single version the group of apiVersion is gathered at: Pinned (default) uses the version of
+	// apiVersion, Preferred the preferred version reported by discovery and Highest the highest version served
+	VersionPolicy string `json:"versionPolicy,omitempty"`
+	// PruneFields are removed from the objects of this selector in addition to the pruneFields of the backup
+	PruneFields []string `json:"pruneFields,omitempty"`
+	// KeepFields are kept in the objects of this selector even if the backup or the defaults prune them, example metadata.managedFields
+	KeepFields []string `json:"keepFields,omitempty"`
 }
 
 type ControllerReference struct {
@@ -92,6 +320,11 @@ type S3ObjectStore struct {
 	BucketName                string `json:"bucketName"`
 	Region                    string `json:"region"`
 	Folder                    string `json:"folder"`
+	// ServerSideEncryption asks the object store to encrypt uploaded backups, SSE-S3 with keys managed by the store or
+	// SSE-KMS with KMSKeyID. This is independent of the encryption config of the backup. Empty uploads without SSE
+	ServerSideEncryption string `json:"serverSideEncryption,omitempty"`
+	// KMSKeyID is the ID or ARN of the KMS key for SSE-KMS
+	KMSKeyID string `json:"kmsKeyID,omitempty"`
 }
 
 // +genclient
@@ -115,6 +348,64 @@ type RestoreSpec struct {
 
 	// When set to true, the controller ignores any errors during the restore process
 	IgnoreErrors bool `json:"ignoreErrors,omitempty"`
+
+	// When set to true, namespaced resources are restored into a temporary namespace that is deleted after verifying them,
+	// nothing outside that namespace is restored or pruned
+	ValidateOnly bool `json:"validateOnly,omitempty"`
+	// RestoreOperatorConfig recreates the Backup, ResourceSet and encryption config CRs saved in the backup before restoring anything else
+	RestoreOperatorConfig bool `json:"restoreOperatorConfig,omitempty"`
+	// BatchSize is the number of objects of the same resource restored in parallel, defaults to 1
+	BatchSize int `json:"batchSize,omitempty"`
+	// RestoreAutoGeneratedObjects restores objects the cluster creates on its own, like the kube-root-ca.crt ConfigMap of every namespace.
+	// These are skipped by default
+	RestoreAutoGeneratedObjects bool `json:"restoreAutoGeneratedObjects,omitempty"`
+	// AutoGeneratedObjects are skipped in addition to the default ones
+	AutoGeneratedObjects []AutoGeneratedObject `json:"autoGeneratedObjects,omitempty"`
+	// Incremental compares every object with the one in the cluster and skips it if they already match, so running
+	// the same restore again only updates what changed since
+	Incremental bool `json:"incremental,omitempty"`
+	// RestoreScope is one of all, owners or dependents. Owners restores only objects without ownerReferences and lets controllers
+	// recreate their dependents, dependents restores only objects with ownerReferences whose owners exist in the cluster. Defaults to all
+	RestoreScope string `json:"restoreScope,omitempty"`
+	// Stamp labels and annotates every object the restore creates or updates
+	Stamp *RestoreStamp `json:"stamp,omitempty"`
+	// GroupVersionMappings restore the objects of a group version from the backup with another group version the target
+	// cluster serves, example from networking.k8s.io/v1beta1 to networking.k8s.io/v1
+	GroupVersionMappings []GroupVersionMapping `json:"groupVersionMappings,omitempty"`
+	// NamespaceMapping restores the namespaced objects of a namespace from the backup into another namespace, keyed by the
+	// namespace in the backup. Target namespaces are created if needed, and nothing is pruned
+	NamespaceMapping map[string]string `json:"namespaceMapping,omitempty"`
+	// ConflictPolicy is what happens to objects that already exist, one of skip, overwrite or adopt. Overwrite replaces
+	// them with the backup, adopt patches the fields of the backup into them and labels them. Defaults to overwrite
+	ConflictPolicy string `json:"conflictPolicy,omitempty"`
+	// NamespaceBundle restores only the objects of this namespace and the Namespace itself, the backup must be taken with
+	// NamespaceBundles. Cluster scoped objects the namespace depends on are logged, and nothing is pruned
+	NamespaceBundle string `json:"namespaceBundle,omitempty"`
+	// CatalogEntry restores the backup with this ID in the backup catalog, it sets backupFilename and, for backups
+	// stored in S3 and a restore without a storageLocation, the storage location
+	CatalogEntry string `json:"catalogEntry,omitempty"`
+}
+
+type GroupVersionMapping struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RestoreStamp marks restored objects, keys left empty use the defaults
+type RestoreStamp struct {
+	// LabelKey is set to the name of the Restore CR, defaults to resources.cattle.io/restored-by
+	LabelKey string `json:"labelKey,omitempty"`
+	// AnnotationKey is set to the backup filename, defaults to resources.cattle.io/restored-from
+	AnnotationKey string `json:"annotationKey,omitempty"`
+	// TimestampAnnotationKey is set to the time of the restore, defaults to resources.cattle.io/restored-at
+	TimestampAnnotationKey string `json:"timestampAnnotationKey,omitempty"`
+}
+
+// AutoGeneratedObject matches objects by kind and either a regex for their name, the kind of their owner or both
+type AutoGeneratedObject struct {
+	Kind       string `json:"kind"`
+	NameRegexp string `json:"nameRegexp,omitempty"`
+	OwnerKind  string `json:"ownerKind,omitempty"`
 }
 
 type RestoreStatus struct {
@@ -123,4 +414,16 @@ type RestoreStatus struct {
 	ObservedGeneration  int64                               `json:"observedGeneration"`
 	BackupSource        string                              `json:"backupSource"`
 	Summary             string                              `json:"summary"`
+	// ObjectCounts is the number of restored objects that were created, updated, or left unchanged because they
+	// already matched the backup
+	ObjectCounts map[string]int64 `json:"objectCounts,omitempty"`
+	// Conflicts lists the first 100 objects of the backup that already existed and what the restore did with them
+	Conflicts []RestoreConflict `json:"conflicts,omitempty"`
+	// MissingTrustRoots are the certificates recorded by the backup that no ClusterTrustBundle or root CA of this cluster has
+	MissingTrustRoots []string `json:"missingTrustRoots,omitempty"`
+}
+
+type RestoreConflict struct {
+	Object string `json:"object"`
+	Action string `json:"action"`
 }
@@ -26,6 +26,22 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoGeneratedObject) DeepCopyInto(out *AutoGeneratedObject) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoGeneratedObject.
+func (in *AutoGeneratedObject) DeepCopy() *AutoGeneratedObject {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoGeneratedObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Backup) DeepCopyInto(out *Backup) {
 	*out = *in
@@ -54,6 +70,29 @@ func (in *Backup) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupEstimate) DeepCopyInto(out *BackupEstimate) {
+	*out = *in
+	if in.ObjectCounts != nil {
+		in, out := &in.ObjectCounts, &out.ObjectCounts
+		*out = make(map[string]int64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupEstimate.
+func (in *BackupEstimate) DeepCopy() *BackupEstimate {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupEstimate)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BackupList) DeepCopyInto(out *BackupList) {
 	*out = *in
@@ -95,6 +134,67 @@ func (in *BackupSpec) DeepCopyInto(out *BackupSpec) {
 		*out = new(StorageLocation)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.FieldProjections != nil {
+		in, out := &in.FieldProjections, &out.FieldProjections
+		*out = make([]FieldProjection, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.IncludeNamespaces != nil {
+		in, out := &in.IncludeNamespaces, &out.IncludeNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExcludeNamespaces != nil {
+		in, out := &in.ExcludeNamespaces, &out.ExcludeNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PruneFields != nil {
+		in, out := &in.PruneFields, &out.PruneFields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RunReport != nil {
+		in, out := &in.RunReport, &out.RunReport
+		*out = new(RunReport)
+		**out = **in
+	}
+	if in.ResourceSetSource != nil {
+		in, out := &in.ResourceSetSource, &out.ResourceSetSource
+		*out = new(ResourceSetSource)
+		**out = **in
+	}
+	if in.SkipControllerOwnedObjects != nil {
+		in, out := &in.SkipControllerOwnedObjects, &out.SkipControllerOwnedObjects
+		*out = new(ControllerOwnedObjectsFilter)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Trigger != nil {
+		in, out := &in.Trigger, &out.Trigger
+		*out = new(BackupTrigger)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CaptureEvents != nil {
+		in, out := &in.CaptureEvents, &out.CaptureEvents
+		*out = new(EventCapture)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.QuietPeriod != nil {
+		in, out := &in.QuietPeriod, &out.QuietPeriod
+		*out = new(QuietPeriod)
+		**out = **in
+	}
+	if in.ExclusionFile != nil {
+		in, out := &in.ExclusionFile, &out.ExclusionFile
+		*out = new(ExclusionFileSource)
+		**out = **in
+	}
+	if in.SinceTime != nil {
+		in, out := &in.SinceTime, &out.SinceTime
+		*out = (*in).DeepCopy()
+	}
 	return
 }
 
@@ -116,6 +216,37 @@ func (in *BackupStatus) DeepCopyInto(out *BackupStatus) {
 		*out = make([]genericcondition.GenericCondition, len(*in))
 		copy(*out, *in)
 	}
+	if in.SkippedObjectCounts != nil {
+		in, out := &in.SkippedObjectCounts, &out.SkippedObjectCounts
+		*out = make(map[string]int64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Estimate != nil {
+		in, out := &in.Estimate, &out.Estimate
+		*out = new(BackupEstimate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UnsettledWorkloads != nil {
+		in, out := &in.UnsettledWorkloads, &out.UnsettledWorkloads
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.FailedResources != nil {
+		in, out := &in.FailedResources, &out.FailedResources
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.TruncatedResources != nil {
+		in, out := &in.TruncatedResources, &out.TruncatedResources
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	return
 }
 
@@ -129,6 +260,48 @@ func (in *BackupStatus) DeepCopy() *BackupStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupTrigger) DeepCopyInto(out *BackupTrigger) {
+	*out = *in
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]TriggerResource, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupTrigger.
+func (in *BackupTrigger) DeepCopy() *BackupTrigger {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupTrigger)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ControllerOwnedObjectsFilter) DeepCopyInto(out *ControllerOwnedObjectsFilter) {
+	*out = *in
+	if in.ControllerManagers != nil {
+		in, out := &in.ControllerManagers, &out.ControllerManagers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControllerOwnedObjectsFilter.
+func (in *ControllerOwnedObjectsFilter) DeepCopy() *ControllerOwnedObjectsFilter {
+	if in == nil {
+		return nil
+	}
+	out := new(ControllerOwnedObjectsFilter)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ControllerReference) DeepCopyInto(out *ControllerReference) {
 	*out = *in
@@ -145,6 +318,101 @@ func (in *ControllerReference) DeepCopy() *ControllerReference {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EventCapture) DeepCopyInto(out *EventCapture) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Kinds != nil {
+		in, out := &in.Kinds, &out.Kinds
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EventCapture.
+func (in *EventCapture) DeepCopy() *EventCapture {
+	if in == nil {
+		return nil
+	}
+	out := new(EventCapture)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExclusionFileSource) DeepCopyInto(out *ExclusionFileSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExclusionFileSource.
+func (in *ExclusionFileSource) DeepCopy() *ExclusionFileSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ExclusionFileSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FieldProjection) DeepCopyInto(out *FieldProjection) {
+	*out = *in
+	if in.Fields != nil {
+		in, out := &in.Fields, &out.Fields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FieldProjection.
+func (in *FieldProjection) DeepCopy() *FieldProjection {
+	if in == nil {
+		return nil
+	}
+	out := new(FieldProjection)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GroupVersionMapping) DeepCopyInto(out *GroupVersionMapping) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupVersionMapping.
+func (in *GroupVersionMapping) DeepCopy() *GroupVersionMapping {
+	if in == nil {
+		return nil
+	}
+	out := new(GroupVersionMapping)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuietPeriod) DeepCopyInto(out *QuietPeriod) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuietPeriod.
+func (in *QuietPeriod) DeepCopy() *QuietPeriod {
+	if in == nil {
+		return nil
+	}
+	out := new(QuietPeriod)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ResourceSelector) DeepCopyInto(out *ResourceSelector) {
 	*out = *in
@@ -173,6 +441,21 @@ func (in *ResourceSelector) DeepCopyInto(out *ResourceSelector) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.FieldSelectors != nil {
+		in, out := &in.FieldSelectors, &out.FieldSelectors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PruneFields != nil {
+		in, out := &in.PruneFields, &out.PruneFields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.KeepFields != nil {
+		in, out := &in.KeepFields, &out.KeepFields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -257,6 +540,22 @@ func (in *ResourceSetList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceSetSource) DeepCopyInto(out *ResourceSetSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceSetSource.
+func (in *ResourceSetSource) DeepCopy() *ResourceSetSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceSetSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Restore) DeepCopyInto(out *Restore) {
 	*out = *in
@@ -285,6 +584,22 @@ func (in *Restore) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreConflict) DeepCopyInto(out *RestoreConflict) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreConflict.
+func (in *RestoreConflict) DeepCopy() *RestoreConflict {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreConflict)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RestoreList) DeepCopyInto(out *RestoreList) {
 	*out = *in
@@ -331,6 +646,28 @@ func (in *RestoreSpec) DeepCopyInto(out *RestoreSpec) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.AutoGeneratedObjects != nil {
+		in, out := &in.AutoGeneratedObjects, &out.AutoGeneratedObjects
+		*out = make([]AutoGeneratedObject, len(*in))
+		copy(*out, *in)
+	}
+	if in.Stamp != nil {
+		in, out := &in.Stamp, &out.Stamp
+		*out = new(RestoreStamp)
+		**out = **in
+	}
+	if in.GroupVersionMappings != nil {
+		in, out := &in.GroupVersionMappings, &out.GroupVersionMappings
+		*out = make([]GroupVersionMapping, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceMapping != nil {
+		in, out := &in.NamespaceMapping, &out.NamespaceMapping
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	return
 }
 
@@ -344,6 +681,22 @@ func (in *RestoreSpec) DeepCopy() *RestoreSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreStamp) DeepCopyInto(out *RestoreStamp) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreStamp.
+func (in *RestoreStamp) DeepCopy() *RestoreStamp {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreStamp)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RestoreStatus) DeepCopyInto(out *RestoreStatus) {
 	*out = *in
@@ -352,6 +705,23 @@ func (in *RestoreStatus) DeepCopyInto(out *RestoreStatus) {
 		*out = make([]genericcondition.GenericCondition, len(*in))
 		copy(*out, *in)
 	}
+	if in.ObjectCounts != nil {
+		in, out := &in.ObjectCounts, &out.ObjectCounts
+		*out = make(map[string]int64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Conflicts != nil {
+		in, out := &in.Conflicts, &out.Conflicts
+		*out = make([]RestoreConflict, len(*in))
+		copy(*out, *in)
+	}
+	if in.MissingTrustRoots != nil {
+		in, out := &in.MissingTrustRoots, &out.MissingTrustRoots
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -365,6 +735,22 @@ func (in *RestoreStatus) DeepCopy() *RestoreStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RunReport) DeepCopyInto(out *RunReport) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RunReport.
+func (in *RunReport) DeepCopy() *RunReport {
+	if in == nil {
+		return nil
+	}
+	out := new(RunReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *S3ObjectStore) DeepCopyInto(out *S3ObjectStore) {
 	*out = *in
@@ -401,3 +787,19 @@ func (in *StorageLocation) DeepCopy() *StorageLocation {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TriggerResource) DeepCopyInto(out *TriggerResource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TriggerResource.
+func (in *TriggerResource) DeepCopy() *TriggerResource {
+	if in == nil {
+		return nil
+	}
+	out := new(TriggerResource)
+	in.DeepCopyInto(out)
+	return out
+}
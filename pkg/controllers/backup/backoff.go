@@ -0,0 +1,74 @@
+package backup
+
+import (
+	"sync"
+	"time"
+)
+
+// a failing backup is retried after failureBackoffBase, doubled with every consecutive failure up to failureBackoffMax
+const (
+	failureBackoffBase = 10 * time.Second
+	failureBackoffMax  = 15 * time.Minute
+)
+
+// failureBackoffs holds the time every failing backup is retried at, so the status update of a failure or a scheduled
+// run doesn't run it again before
+type failureBackoffs struct {
+	sync.Mutex
+	backoffs map[string]failureBackoff
+}
+
+type failureBackoff struct {
+	retryAt time.Time
+	// generation is the generation of the backup that failed, editing the spec ends the backoff
+	generation int64
+}
+
+func newFailureBackoffs() *failureBackoffs {
+	return &failureBackoffs{backoffs: make(map[string]failureBackoff)}
+}
+
+func failureBackoffDelay(failures int) time.Duration {
+	delay := failureBackoffBase
+	for i := 1; i < failures && delay < failureBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > failureBackoffMax {
+		delay = failureBackoffMax
+	}
+	return delay
+}
+
+// failed starts the backoff of a backup after its consecutive failures and returns the delay until it's retried
+func (f *failureBackoffs) failed(name string, generation int64, failures int) time.Duration {
+	f.Lock()
+	defer f.Unlock()
+	delay := failureBackoffDelay(failures)
+	f.backoffs[name] = failureBackoff{retryAt: time.Now().Add(delay), generation: generation}
+	return delay
+}
+
+// remaining returns the time left until a failed backup is retried, 0 if it can run
+func (f *failureBackoffs) remaining(name string, generation int64) time.Duration {
+	f.Lock()
+	defer f.Unlock()
+	backoff, ok := f.backoffs[name]
+	if !ok {
+		return 0
+	}
+	if backoff.generation != generation {
+		delete(f.backoffs, name)
+		return 0
+	}
+	if remaining := time.Until(backoff.retryAt); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// forget ends the backoff of a backup that succeeded or was deleted
+func (f *failureBackoffs) forget(name string) {
+	f.Lock()
+	defer f.Unlock()
+	delete(f.backoffs, name)
+}
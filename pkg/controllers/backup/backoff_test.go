@@ -0,0 +1,97 @@
+package backup
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFailureBackoffDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 10 * time.Second},
+		{failures: 1, want: 10 * time.Second},
+		{failures: 2, want: 20 * time.Second},
+		{failures: 4, want: 80 * time.Second},
+		{failures: 7, want: 640 * time.Second},
+		{failures: 8, want: failureBackoffMax},
+		{failures: 100, want: failureBackoffMax},
+	}
+	for _, tt := range tests {
+		if got := failureBackoffDelay(tt.failures); got != tt.want {
+			t.Errorf("failureBackoffDelay(%v) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestFailingBackupRequeueDelayGrows(t *testing.T) {
+	// the ResourceSet is missing, so every run fails
+	backups := newFakeBackups(&v1.Backup{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Generation: 1},
+		Spec:       v1.BackupSpec{ResourceSetName: "missing", Schedule: "@every 1h"},
+	})
+	h, recorder, _ := newTestHandler(t, backups)
+	lastEnqueued := func() time.Duration {
+		if len(backups.enqueued) == 0 {
+			t.Fatalf("backup wasn't enqueued")
+		}
+		return backups.enqueued[len(backups.enqueued)-1].after
+	}
+
+	var delays []time.Duration
+	for failures := 1; failures <= 9; failures++ {
+		if _, err := reconcile(t, h, recorder, "nightly"); err == nil {
+			t.Fatalf("run %v succeeded without its ResourceSet", failures)
+		}
+		delay := lastEnqueued()
+		delays = append(delays, delay)
+		backup, _ := backups.Get("nightly", metav1.GetOptions{})
+		if backup.Status.ConsecutiveFailures != failures {
+			t.Errorf("consecutiveFailures after %v failures = %v", failures, backup.Status.ConsecutiveFailures)
+		}
+
+		// the status update of the failure is processed before the backoff is over, and doesn't run the backup
+		if reasons, err := reconcile(t, h, recorder, "nightly"); err != nil || len(reasons) != 0 {
+			t.Fatalf("backup ran during its backoff: %v, %v", reasons, err)
+		}
+		if remaining := lastEnqueued(); remaining <= 0 || remaining > delay {
+			t.Errorf("backup in backoff enqueued after %v, want at most %v", remaining, delay)
+		}
+		if backup, _ := backups.Get("nightly", metav1.GetOptions{}); backup.Status.ConsecutiveFailures != failures {
+			t.Errorf("reconcile during the backoff counted as a failure")
+		}
+		// the backoff is over
+		h.backoffs.backoffs["nightly"] = failureBackoff{retryAt: time.Now(), generation: 1}
+	}
+	for i := 1; i < len(delays); i++ {
+		if delays[i] < delays[i-1] || (delays[i] == delays[i-1] && delays[i] != failureBackoffMax) {
+			t.Errorf("requeue delays = %v, want them to grow up to %v", delays, failureBackoffMax)
+			break
+		}
+	}
+	if delays[len(delays)-1] != failureBackoffMax {
+		t.Errorf("requeue delay after %v failures = %v, want the cap %v", len(delays), delays[len(delays)-1], failureBackoffMax)
+	}
+
+	// the run after the fix resets the count
+	backup, _ := backups.Get("nightly", metav1.GetOptions{})
+	backup.Spec.ResourceSetName = "rancher"
+	backup.Generation++
+	backups.Update(backup)
+	if _, err := reconcile(t, h, recorder, "nightly"); err != nil {
+		t.Fatalf("run after the fix error: %v", err)
+	}
+	if backup, _ := backups.Get("nightly", metav1.GetOptions{}); backup.Status.ConsecutiveFailures != 0 {
+		t.Errorf("consecutiveFailures after a success = %v, want 0", backup.Status.ConsecutiveFailures)
+	}
+	if _, ok := h.backoffs.backoffs["nightly"]; ok {
+		t.Errorf("backoff kept after a success")
+	}
+	if next := lastEnqueued(); next < 59*time.Minute || next > time.Hour {
+		t.Errorf("backup enqueued after %v following a success, want the next scheduled run", next)
+	}
+}
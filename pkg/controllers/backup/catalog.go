@@ -0,0 +1,106 @@
+package backup
+
+import (
+	"encoding/json"
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// catalogObjectStore is the object store the artifact of the backup was uploaded to, nil for artifacts on the PV
+func (h *handler) catalogObjectStore(backup *v1.Backup) *v1.S3ObjectStore {
+	if backup.Status.StorageLocation != util.S3Backup {
+		return nil
+	}
+	if backup.Spec.StorageLocation != nil && backup.Spec.StorageLocation.S3 != nil {
+		return backup.Spec.StorageLocation.S3
+	}
+	return h.defaultS3BackupLocation
+}
+
+// addToCatalog adds the artifact of the completed backup to the catalog, and removes the entries of artifacts that the
+// retention policy of the backup deleted. Like the run report, the catalog is informational, so errors are only logged
+func (h *handler) addToCatalog(backup *v1.Backup, report *runReport) {
+	objectStore := h.catalogObjectStore(backup)
+	entry := util.CatalogEntry{
+		ID:              backup.Status.CatalogEntryID,
+		BackupName:      backup.Name,
+		Filename:        backup.Status.Filename,
+		Timestamp:       backup.Status.LastSnapshotTS,
+		Size:            report.artifactSize,
+		Checksum:        report.artifactChecksum,
+		Encrypted:       encryptionConfigSecretName(backup) != "",
+		StorageLocation: backup.Status.StorageLocation,
+		S3:              objectStore,
+	}
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		logrus.Errorf("Error adding backup %v to the catalog: %v", entry.Filename, err)
+		return
+	}
+	retentionCount := 0
+	if backup.Spec.Schedule != "" || backup.Spec.Trigger != nil {
+		retentionCount = int(backup.Spec.RetentionCount)
+	}
+	maxAge := retentionMaxAge(backup)
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		catalog, err := h.configMaps.Get(util.ChartNamespace, util.CatalogConfigMapName, k8sv1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = h.configMaps.Create(&corev1.ConfigMap{
+				ObjectMeta: k8sv1.ObjectMeta{Name: util.CatalogConfigMapName, Namespace: util.ChartNamespace},
+				Data:       map[string]string{entry.ID: string(entryBytes)},
+			})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if catalog.Data == nil {
+			catalog.Data = make(map[string]string)
+		}
+		catalog.Data[entry.ID] = string(entryBytes)
+		if retentionCount > 0 {
+			pruneCatalog(catalog.Data, entry, retentionCount, maxAge)
+		}
+		_, err = h.configMaps.Update(catalog)
+		return err
+	})
+	if err != nil {
+		logrus.Errorf("Error adding backup %v to the catalog: %v", entry.Filename, err)
+		return
+	}
+	logrus.Infof("Added backup %v to the catalog as %v", entry.Filename, entry.ID)
+}
+
+// pruneCatalog applies the retention policy of the backup CR to its entries in the storage location of the added entry
+func pruneCatalog(data map[string]string, added util.CatalogEntry, retentionCount int, maxAge time.Duration) {
+	addedLocation := util.CatalogEntryID(added.StorageLocation, added.S3, "")
+	var entries []backupInfo
+	for id, entryJSON := range data {
+		var entry util.CatalogEntry
+		if err := json.Unmarshal([]byte(entryJSON), &entry); err != nil {
+			logrus.Warnf("Ignoring invalid catalog entry %v: %v", id, err)
+			continue
+		}
+		if entry.BackupName != added.BackupName || util.CatalogEntryID(entry.StorageLocation, entry.S3, "") != addedLocation {
+			continue
+		}
+		timestamp, err := time.Parse(time.RFC3339, entry.Timestamp)
+		if err != nil {
+			logrus.Warnf("Ignoring catalog entry %v with invalid timestamp %v", id, entry.Timestamp)
+			continue
+		}
+		entries = append(entries, backupInfo{filename: id, creationTimestamp: timestamp})
+	}
+	for _, entry := range expiredBackups(entries, retentionCount, maxAge, time.Now()) {
+		logrus.Infof("Removing catalog entry %v to follow retention policy of max %v backups for at most %v", entry.filename, retentionCount, maxAge)
+		delete(data, entry.filename)
+	}
+}
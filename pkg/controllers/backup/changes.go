@@ -0,0 +1,102 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/objectstore"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"github.com/sirupsen/logrus"
+)
+
+// recordChanges classifies the objects in the manifest against the previous backup of the Backup CR. Failing to read
+// the previous backup doesn't fail the backup, its manifest just doesn't record any changes
+func (h *handler) recordChanges(backup *v1.Backup, manifest *resourcesets.Manifest) {
+	if backup.Status.Filename == "" {
+		logrus.Infof("No previous backup for backup CR %v, recording all objects as new", backup.Name)
+		manifest.ClassifyChanges(&resourcesets.Manifest{})
+		return
+	}
+	previous, err := h.readManifest(backup, backup.Status.Filename)
+	if err != nil {
+		logrus.Warnf("Not recording changes for backup CR %v: error reading manifest of previous backup %v: %v", backup.Name, backup.Status.Filename, err)
+		return
+	}
+	manifest.ClassifyChanges(previous)
+}
+
+// readManifest reads the manifest of an earlier backup of the Backup CR, stored in the location of its last backup
+func (h *handler) readManifest(backup *v1.Backup, filename string) (*resourcesets.Manifest, error) {
+	switch backup.Status.StorageLocation {
+	case util.PVBackup:
+		return readManifestFromTarGzip(filepath.Join(h.defaultBackupMountPath, filename))
+	case util.S3Backup:
+		objectStore := h.defaultS3BackupLocation
+		if backup.Spec.StorageLocation != nil && backup.Spec.StorageLocation.S3 != nil {
+			objectStore = backup.Spec.StorageLocation.S3
+		}
+		if objectStore == nil {
+			return nil, fmt.Errorf("no S3 storage location")
+		}
+		s3Client, err := objectstore.GetS3Client(h.ctx, objectStore, h.dynamicClient)
+		if err != nil {
+			return nil, err
+		}
+		prefix := filename
+		if objectStore.Folder != "" {
+			prefix = strings.Trim(fmt.Sprintf("%s/%s", strings.TrimRight(objectStore.Folder, "/"), prefix), "/")
+		}
+		backupFilePath, err := objectstore.DownloadFromS3WithPrefix(s3Client, prefix, objectStore.BucketName)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(backupFilePath)
+		return readManifestFromTarGzip(backupFilePath)
+	default:
+		return nil, fmt.Errorf("unknown storage location %v", backup.Status.StorageLocation)
+	}
+}
+
+func readManifestFromTarGzip(tarGzFilePath string) (*resourcesets.Manifest, error) {
+	r, err := os.Open(tarGzFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tarball := tar.NewReader(gz)
+	for {
+		tarContent, err := tarball.Next()
+		if err == io.EOF {
+			// backups taken by older versions of the operator have no manifest
+			return nil, fmt.Errorf("backup has no %v", resourcesets.ManifestFileName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if tarContent.Name != resourcesets.ManifestFileName {
+			continue
+		}
+		manifestBytes, err := ioutil.ReadAll(tarball)
+		if err != nil {
+			return nil, err
+		}
+		manifest := &resourcesets.Manifest{}
+		if err := json.Unmarshal(manifestBytes, manifest); err != nil {
+			return nil, err
+		}
+		return manifest, nil
+	}
+}
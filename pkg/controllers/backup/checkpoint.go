@@ -0,0 +1,51 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage/value"
+)
+
+// checkpoint dirs don't start with tmpBackupDirPrefix, so removeOrphanedWorkingDirs keeps them across restarts
+const checkpointDirPrefix = "backup-restore-checkpoint-"
+
+func checkpointDir(backupName string) string {
+	dir := util.CheckpointDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, checkpointDirPrefix+backupName)
+}
+
+// openCheckpoint opens the checkpoint of the backup CR. Its fingerprint covers everything that changes which objects
+// are gathered and how they are encrypted, a checkpoint of an earlier spec or ResourceSet is never resumed
+func openCheckpoint(backup *v1.Backup, resourceSet *v1.ResourceSet, transformerMap map[schema.GroupResource]value.Transformer) (*resourcesets.Checkpoint, error) {
+	fingerprintBytes, err := json.Marshal(struct {
+		Generation        int64                 `json:"generation"`
+		ResourceSelectors []v1.ResourceSelector `json:"resourceSelectors"`
+		ConsistencyMode   string                `json:"consistencyMode"`
+		EncryptionConfig  string                `json:"encryptionConfig"`
+	}{backup.Generation, resourceSet.ResourceSelectors, backup.Spec.ConsistencyMode, encryptionConfigSecretName(backup)})
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := sha256.Sum256(fingerprintBytes)
+	return resourcesets.OpenCheckpoint(checkpointDir(backup.Name), hex.EncodeToString(fingerprint[:]), transformerMap)
+}
+
+// removeCheckpoint deletes the checkpoint once the backup completed or the backup CR is deleted
+func removeCheckpoint(backupName string) {
+	dir := checkpointDir(backupName)
+	if err := os.RemoveAll(dir); err != nil {
+		logrus.Warnf("Error removing checkpoint %v of backup CR %v: %v", dir, backupName, err)
+	}
+}
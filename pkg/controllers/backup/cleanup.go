@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rancher/backup-restore-operator/pkg/objectstore"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// all working dirs of a backup are created in os.TempDir with one of these prefixes
+	tmpBackupDirPrefix = "backup-restore-operator-"
+	tmpUploadDirPrefix = "uploadpath"
+)
+
+// removeOrphanedWorkingDirs deletes the working dirs left behind when the operator restarts in the middle of a backup.
+// It is called from Register before the controllers start, so none of these dirs can belong to a backup in progress.
+// A backup that was interrupted never got its status updated, so OnBackupChange processes it again once the controllers start
+func removeOrphanedWorkingDirs() {
+	tmpDir := os.TempDir()
+	files, err := ioutil.ReadDir(tmpDir)
+	if err != nil {
+		logrus.Warnf("Error reading temp dir %v to find orphaned backup dirs: %v", tmpDir, err)
+		return
+	}
+	var removed int
+	var reclaimedBytes int64
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		if !strings.HasPrefix(file.Name(), tmpBackupDirPrefix) && !strings.HasPrefix(file.Name(), tmpUploadDirPrefix) {
+			continue
+		}
+		orphanedDir := filepath.Join(tmpDir, file.Name())
+		size := dirSize(orphanedDir)
+		if err := os.RemoveAll(orphanedDir); err != nil {
+			logrus.Warnf("Error removing orphaned backup dir %v: %v", orphanedDir, err)
+			continue
+		}
+		logrus.Infof("Removed orphaned backup dir %v", orphanedDir)
+		removed++
+		reclaimedBytes += size
+	}
+	if removed > 0 {
+		logrus.Infof("Removed %v orphaned backup dirs, reclaimed %v bytes", removed, reclaimedBytes)
+	}
+}
+
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// removePartialArtifacts deletes the artifacts a backup interrupted by a restart of the operator left on the persistent
+// volume. Like removeOrphanedWorkingDirs it runs before the controllers start, the backup is taken again from scratch
+func removePartialArtifacts(backupMountPath string) {
+	if backupMountPath == "" {
+		return
+	}
+	files, err := ioutil.ReadDir(backupMountPath)
+	if err != nil {
+		logrus.Warnf("Error reading backup dir %v to find partial backups: %v", backupMountPath, err)
+		return
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), objectstore.PartialFileSuffix) {
+			continue
+		}
+		partialArtifact := filepath.Join(backupMountPath, file.Name())
+		if err := os.Remove(partialArtifact); err != nil {
+			logrus.Warnf("Error removing partial backup %v: %v", partialArtifact, err)
+			continue
+		}
+		logrus.Infof("Removed partial backup %v of an interrupted backup", partialArtifact)
+	}
+}
@@ -0,0 +1,139 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/rancher/backup-restore-operator/pkg/objectstore"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+)
+
+const testResourceCount = 6
+
+// writeTestResources writes a file for each of the first count resources of a backup into backupPath
+func writeTestResources(t *testing.T, backupPath string, count int) {
+	for i := 0; i < count; i++ {
+		path := fmt.Sprintf("widgets-%d.example.com#v1/default/widget.json", i)
+		if err := resourcesets.DirWriter(backupPath).WriteFile(path, []byte(`{"kind":"Widget"}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func artifactFiles(t *testing.T, path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("artifact %v is truncated: %v", path, err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			files = append(files, hdr.Name)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestBackupInterruptedByRestart(t *testing.T) {
+	defer func(tmpDir string) { os.Setenv("TMPDIR", tmpDir) }(os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", t.TempDir())
+	mountPath := t.TempDir()
+	const artifact = "nightly-c1d2e3f4-2020-09-15T21-27-06Z.tar.gz"
+
+	// the operator restarts after half the resources were written and compressed
+	workingDir, err := ioutil.TempDir("", tmpBackupDirPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestResources(t, workingDir, testResourceCount/2)
+	if err := ioutil.WriteFile(filepath.Join(mountPath, artifact+objectstore.PartialFileSuffix), []byte{0x1f, 0x8b}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint := checkpointDir("nightly")
+	if err := os.MkdirAll(checkpoint, 0700); err != nil {
+		t.Fatal(err)
+	}
+	storage := objectstore.NewLocalBackend(mountPath)
+	if keys, err := storage.List(""); err != nil || len(keys) != 0 {
+		t.Errorf("backups listed before the restart = %v, %v, want none", keys, err)
+	}
+
+	// startup of the operator
+	removeOrphanedWorkingDirs()
+	removePartialArtifacts(mountPath)
+	if _, err := os.Stat(workingDir); !os.IsNotExist(err) {
+		t.Errorf("working dir of the interrupted backup wasn't removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(mountPath, artifact+objectstore.PartialFileSuffix)); !os.IsNotExist(err) {
+		t.Errorf("partial artifact of the interrupted backup wasn't removed: %v", err)
+	}
+	if _, err := os.Stat(checkpoint); err != nil {
+		t.Errorf("checkpoint of the interrupted backup was removed, the gather can't resume: %v", err)
+	}
+
+	// the backup is reconciled again and completes
+	workingDir, err = ioutil.TempDir("", tmpBackupDirPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestResources(t, workingDir, testResourceCount)
+	if err := CreateTarAndGzip(workingDir, storage, artifact, "nightly", false); err != nil {
+		t.Fatalf("CreateTarAndGzip() error: %v", err)
+	}
+	keys, err := storage.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{artifact}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("backups listed after the retry = %v, want %v", keys, want)
+	}
+	var want []string
+	for i := 0; i < testResourceCount; i++ {
+		want = append(want, fmt.Sprintf("widgets-%d.example.com#v1/default/widget.json", i))
+	}
+	if got := artifactFiles(t, storage.Path(artifact)); !reflect.DeepEqual(got, want) {
+		t.Errorf("files of the completed backup = %v, want %v", got, want)
+	}
+}
+
+func TestCreateTarAndGzipLeavesNoPartialArtifact(t *testing.T) {
+	mountPath := t.TempDir()
+	backupPath := t.TempDir()
+	writeTestResources(t, backupPath, testResourceCount)
+	// the gather is cut short while compressing
+	if err := os.Symlink(filepath.Join(backupPath, "missing"), filepath.Join(backupPath, "unreadable.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateTarAndGzip(backupPath, objectstore.NewLocalBackend(mountPath), "nightly.tar.gz", "nightly", false); err == nil {
+		t.Fatalf("CreateTarAndGzip() of an unreadable file succeeded")
+	}
+	files, err := ioutil.ReadDir(mountPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		t.Errorf("failed backup left %v behind", file.Name())
+	}
+}
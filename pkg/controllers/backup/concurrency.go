@@ -0,0 +1,61 @@
+package backup
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rancher/backup-restore-operator/pkg/metrics"
+)
+
+// backups waiting for a slot check again after this interval
+const backupSlotRetryInterval = 15 * time.Second
+
+// backupSlots limits the number of backups running at the same time across all Backup CRs, with a limit of 0 every
+// backup runs right away
+type backupSlots struct {
+	sync.Mutex
+	slots   chan struct{}
+	waiting map[string]bool
+}
+
+func newBackupSlots(limit int) *backupSlots {
+	s := &backupSlots{waiting: make(map[string]bool)}
+	if limit > 0 {
+		s.slots = make(chan struct{}, limit)
+	}
+	return s
+}
+
+// tryAcquire takes a slot for the backup, or records it as waiting if all slots are taken. A backup that got a slot
+// must release it once it's done
+func (s *backupSlots) tryAcquire(name string) bool {
+	if s.slots == nil {
+		return true
+	}
+	s.Lock()
+	defer s.Unlock()
+	select {
+	case s.slots <- struct{}{}:
+		delete(s.waiting, name)
+		metrics.SetBackupsWaiting(len(s.waiting))
+		return true
+	default:
+		s.waiting[name] = true
+		metrics.SetBackupsWaiting(len(s.waiting))
+		return false
+	}
+}
+
+func (s *backupSlots) release() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// forget stops counting a deleted backup as waiting
+func (s *backupSlots) forget(name string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.waiting, name)
+	metrics.SetBackupsWaiting(len(s.waiting))
+}
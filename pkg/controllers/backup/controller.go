@@ -2,17 +2,21 @@ package backup
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
 	backupControllers "github.com/rancher/backup-restore-operator/pkg/generated/controllers/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/metrics"
+	"github.com/rancher/backup-restore-operator/pkg/objectstore"
 	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
 	"github.com/rancher/backup-restore-operator/pkg/util"
 	"github.com/rancher/wrangler/pkg/condition"
@@ -21,12 +25,15 @@ import (
 	"github.com/robfig/cron"
 	"github.com/sirupsen/logrus"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apiserver/pkg/storage/value"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 )
 
@@ -36,14 +43,33 @@ type handler struct {
 	resourceSets            backupControllers.ResourceSetController
 	secrets                 v1core.SecretController
 	namespaces              v1core.NamespaceController
+	configMaps              v1core.ConfigMapController
 	discoveryClient         discovery.DiscoveryInterface
 	dynamicClient           dynamic.Interface
+	metadataClient          metadata.Interface
 	defaultBackupMountPath  string
 	defaultS3BackupLocation *v1.S3ObjectStore
 	kubeSystemNS            string
+	triggers                *triggers
+	slots                   *backupSlots
+	backoffs                *failureBackoffs
+	recorder                record.EventRecorder
 }
 
-const DefaultRetentionCount = 10
+const (
+	DefaultRetentionCount = 10
+	// maxParallelism limits the load a single backup puts on the apiserver
+	maxParallelism = 50
+	// larger pages hold too many objects in memory at once
+	maxListPageSize = 10000
+)
+
+// Reasons of the events recorded on Backup CRs
+const (
+	eventReasonBackupStarted   = "BackupStarted"
+	eventReasonBackupCompleted = "BackupCompleted"
+	eventReasonBackupFailed    = "BackupFailed"
+)
 
 func Register(
 	ctx context.Context,
@@ -51,8 +77,11 @@ func Register(
 	resourceSets backupControllers.ResourceSetController,
 	secrets v1core.SecretController,
 	namespaces v1core.NamespaceController,
+	configMaps v1core.ConfigMapController,
 	clientSet *clientset.Clientset,
 	dynamicInterface dynamic.Interface,
+	metadataInterface metadata.Interface,
+	recorder record.EventRecorder,
 	defaultLocalBackupLocation string,
 	defaultS3 *v1.S3ObjectStore) {
 
@@ -62,8 +91,14 @@ func Register(
 		resourceSets:            resourceSets,
 		secrets:                 secrets,
 		namespaces:              namespaces,
+		configMaps:              configMaps,
 		discoveryClient:         clientSet.Discovery(),
 		dynamicClient:           dynamicInterface,
+		metadataClient:          metadataInterface,
+		triggers:                newTriggers(),
+		slots:                   newBackupSlots(util.MaxConcurrentBackups),
+		backoffs:                newFailureBackoffs(),
+		recorder:                recorder,
 		defaultBackupMountPath:  defaultLocalBackupLocation,
 		defaultS3BackupLocation: defaultS3,
 	}
@@ -81,12 +116,25 @@ func Register(
 		logrus.Fatalf("Error getting namespace kube-system %v", err)
 	}
 	controller.kubeSystemNS = string(kubeSystemNS.UID)
+	removeOrphanedWorkingDirs()
+	removePartialArtifacts(controller.defaultBackupMountPath)
 	// Register handlers
 	backups.OnChange(ctx, "backups", controller.OnBackupChange)
+	secrets.OnChange(ctx, "backup-encryption-configs", controller.OnEncryptionConfigChange)
 }
 
-func (h *handler) OnBackupChange(_ string, backup *v1.Backup) (*v1.Backup, error) {
+func (h *handler) OnBackupChange(key string, backup *v1.Backup) (*v1.Backup, error) {
 	if backup == nil || backup.DeletionTimestamp != nil {
+		h.triggers.stop(key)
+		h.slots.forget(key)
+		h.backoffs.forget(key)
+		removeCheckpoint(key)
+		metrics.DeleteBackup(key)
+		return backup, nil
+	}
+	if remaining := h.backoffs.remaining(backup.Name, backup.Generation); remaining > 0 {
+		logrus.Debugf("Backup CR %v failed %v times in a row, retrying in %v", backup.Name, backup.Status.ConsecutiveFailures, remaining.Round(time.Second))
+		h.backups.EnqueueAfter(backup.Name, remaining)
 		return backup, nil
 	}
 	logrus.Infof("Processing backup %v", backup.Name)
@@ -94,24 +142,32 @@ func (h *handler) OnBackupChange(_ string, backup *v1.Backup) (*v1.Backup, error
 	if err := h.validateBackupSpec(backup); err != nil {
 		return h.setReconcilingCondition(backup, err)
 	}
+	h.trackScheduledBackup(backup)
 
-	if backup.Status.LastSnapshotTS != "" {
+	if backup.Spec.EstimateOnly {
+		return h.estimateBackup(backup)
+	}
+
+	if err := h.triggers.ensure(h, backup); err != nil {
+		return h.setReconcilingCondition(backup, err)
+	}
+	triggered, triggerSeq := h.triggers.pending(backup.Name)
+	onDemand := onDemandTrigger(backup)
+	if onDemand != "" {
+		logrus.Infof("Backup CR %v has trigger annotation %v, running backup", backup.Name, onDemand)
+	}
+
+	if backup.Status.LastSnapshotTS != "" && !triggered && onDemand == "" {
 		if backup.Spec.Schedule == "" {
 			// Backup CR was meant for one-time backup, and the backup has been completed. Probably here from UpdateStatus call
 			logrus.Infof("Backup CR %v has been processed for one-time backup, returning", backup.Name)
 			// This could also mean backup CR was updated from recurring to one-time, in which case observedGeneration needs to be updated
-			updBackupStatus := false
-			if backup.Generation != backup.Status.ObservedGeneration {
-				backup.Status.ObservedGeneration = backup.Generation
-				updBackupStatus = true
-			}
 			// check if the backup-type needs to be changed too
-			if backup.Status.BackupType != "One-time" {
-				backup.Status.BackupType = "One-time"
-				updBackupStatus = true
-			}
-			if updBackupStatus {
-				return h.backups.UpdateStatus(backup)
+			if backup.Generation != backup.Status.ObservedGeneration || backup.Status.BackupType != "One-time" {
+				return h.updateBackupStatus(backup.Name, func(backup *v1.Backup) {
+					backup.Status.ObservedGeneration = backup.Generation
+					backup.Status.BackupType = "One-time"
+				})
 			}
 			return backup, nil
 		}
@@ -119,16 +175,16 @@ func (h *handler) OnBackupChange(_ string, backup *v1.Backup) (*v1.Backup, error
 			currTime := time.Now().Format(time.RFC3339)
 			logrus.Infof("Next snapshot is scheduled for: %v, current time: %v", backup.Status.NextSnapshotAt, currTime)
 
-			nextSnapshotTime, err := time.Parse(time.RFC3339, backup.Status.NextSnapshotAt)
+			after, err := untilNextSnapshot(backup, time.Now())
 			if err != nil {
 				return h.setReconcilingCondition(backup, err)
 			}
-			if nextSnapshotTime.After(time.Now()) {
-				after := nextSnapshotTime.Sub(time.Now())
+			if after > 0 {
 				h.backups.EnqueueAfter(backup.Name, after)
 				if backup.Generation != backup.Status.ObservedGeneration {
-					backup.Status.ObservedGeneration = backup.Generation
-					return h.backups.UpdateStatus(backup)
+					return h.updateBackupStatus(backup.Name, func(backup *v1.Backup) {
+						backup.Status.ObservedGeneration = backup.Generation
+					})
 				}
 				return backup, nil
 			}
@@ -138,21 +194,49 @@ func (h *handler) OnBackupChange(_ string, backup *v1.Backup) (*v1.Backup, error
 		}
 	}
 
+	if !h.slots.tryAcquire(backup.Name) {
+		return h.setWaitingCondition(backup)
+	}
+	defer h.slots.release()
+	condition.Cond(v1.BackupConditionWaiting).SetStatusBool(backup, false)
+
+	// resolve the encryption config before anything is written, so a misconfigured backup fails without partial work
+	var err error
+	transformerMap := make(map[schema.GroupResource]value.Transformer)
+	if name := encryptionConfigSecretName(backup); name != "" {
+		logrus.Infof("Processing encryption config %v for backup CR %v", name, backup.Name)
+		transformerMap, err = util.GetEncryptionTransformers(name, h.secrets)
+		if err != nil {
+			return h.setReconcilingCondition(backup, err)
+		}
+		if err := util.ProbeEncryptionTransformers(transformerMap); err != nil {
+			if !backup.Spec.SkipObjectsOnEncryptionFailure {
+				return h.setReconcilingCondition(backup, err)
+			}
+			logrus.Warnf("Backup CR %v skips the objects the encryption provider fails on: %v", backup.Name, err)
+		}
+	}
+
 	backupFileName, err := h.generateBackupFilename(backup)
 	if err != nil {
 		return h.setReconcilingCondition(backup, err)
 	}
 	logrus.Infof("For backup CR %v, filename: %v", backup.Name, backupFileName)
+	report := newRunReport(backup, backupFileName)
 
 	// create a temp dir to write all backup files to, delete this before returning.
 	// empty dir param in ioutil.TempDir defaults to os.TempDir
-	tmpBackupPath, err := ioutil.TempDir("", backupFileName)
+	tmpBackupPath, err := ioutil.TempDir("", tmpBackupDirPrefix+backupFileName)
 	if err != nil {
 		return h.setReconcilingCondition(backup, fmt.Errorf("error creating temp dir: %v", err))
 	}
 	logrus.Infof("Temporary backup path for storing all contents for backup CR %v is %v", backup.Name, tmpBackupPath)
 
-	if err := h.performBackup(backup, tmpBackupPath, backupFileName); err != nil {
+	h.recorder.Eventf(backup, corev1.EventTypeNormal, eventReasonBackupStarted, "Started backup %v", report.artifactName)
+	if err := h.performBackup(backup, tmpBackupPath, backupFileName, transformerMap, report); err != nil {
+		metrics.IncBackupFailures(backup.Name)
+		h.recorder.Eventf(backup, corev1.EventTypeWarning, eventReasonBackupFailed, "Backup %v failed: %v", report.artifactName, err)
+		h.writeRunReport(backup, report, err)
 		removeDirErr := os.RemoveAll(tmpBackupPath)
 		if removeDirErr != nil {
 			return h.setReconcilingCondition(backup, errors.New(err.Error()+removeDirErr.Error()))
@@ -163,24 +247,31 @@ func (h *handler) OnBackupChange(_ string, backup *v1.Backup) (*v1.Backup, error
 	if err := os.RemoveAll(tmpBackupPath); err != nil {
 		return h.setReconcilingCondition(backup, err)
 	}
+	if backup.Spec.Checkpoint {
+		removeCheckpoint(backup.Name)
+	}
 	// check for retention
 	var cronSchedule cron.Schedule
-	if backup.Spec.Schedule != "" {
+	if backup.Spec.Schedule != "" || backup.Spec.Trigger != nil {
 		if err := h.deleteBackupsFollowingRetentionPolicy(backup); err != nil {
+			h.recorder.Eventf(backup, corev1.EventTypeWarning, eventReasonBackupFailed, "Error applying the retention policy after backup %v: %v", report.artifactName, err)
+			h.writeRunReport(backup, report, err)
 			return h.setReconcilingCondition(backup, err)
 		}
+	}
+	if backup.Spec.Schedule != "" {
 		cronSchedule, err = cron.ParseStandard(backup.Spec.Schedule)
 		if err != nil {
 			return h.setReconcilingCondition(backup, err)
 		}
 	}
 	storageLocationType := backup.Status.StorageLocation
-	updateErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		var err error
-		backup, err = h.backups.Get(backup.Name, k8sv1.GetOptions{})
-		if err != nil {
-			return err
-		}
+	skippedObjectCounts := backup.Status.SkippedObjectCounts
+	failedResources := backup.Status.FailedResources
+	truncatedResources := backup.Status.TruncatedResources
+	incrementals := backup.Status.IncrementalsSinceFullBackup + 1
+	serverSideEncryption := backup.Status.ServerSideEncryption
+	updatedBackup, updateErr := h.updateBackupStatus(backup.Name, func(backup *v1.Backup) {
 		// reset conditions to remove the reconciling condition, because as per kstatus lib its presence is considered an error
 		backup.Status.Conditions = []genericcondition.GenericCondition{}
 
@@ -190,97 +281,249 @@ func (h *handler) OnBackupChange(_ string, backup *v1.Backup) (*v1.Backup, error
 
 		backup.Status.LastSnapshotTS = time.Now().Format(time.RFC3339)
 		if cronSchedule != nil {
-			nextBackupAt := cronSchedule.Next(time.Now())
-			backup.Status.NextSnapshotAt = nextBackupAt.Format(time.RFC3339)
-			after := nextBackupAt.Sub(time.Now())
-			h.backups.EnqueueAfter(backup.Name, after)
+			h.backups.EnqueueAfter(backup.Name, scheduleNextSnapshot(backup, cronSchedule, time.Now()))
 			backup.Status.BackupType = "Recurring"
+		} else if backup.Spec.Trigger != nil {
+			backup.Status.BackupType = "Triggered"
 		} else {
 			backup.Status.BackupType = "One-time"
 		}
 		backup.Status.ObservedGeneration = backup.Generation
 		backup.Status.StorageLocation = storageLocationType
+		backup.Status.ObjectCount = int64(report.objectCount)
+		backup.Status.SkippedObjectCounts = skippedObjectCounts
+		backup.Status.FailedResources = failedResources
+		backup.Status.TruncatedResources = truncatedResources
+		backup.Status.ServerSideEncryption = serverSideEncryption
 		backup.Status.Filename = backupFileName + ".tar.gz"
-		if backup.Spec.EncryptionConfigSecretName != "" {
+		if encryptionConfigSecretName(backup) != "" {
 			backup.Status.Filename += ".enc"
 		}
-		_, err = h.backups.UpdateStatus(backup)
-		return err
+		backup.Status.LastFullBackup, backup.Status.IncrementalsSinceFullBackup = "", 0
+		if report.baseBackup != "" {
+			backup.Status.LastFullBackup, backup.Status.IncrementalsSinceFullBackup = report.baseBackup, incrementals
+		} else if backup.Spec.Incremental {
+			backup.Status.LastFullBackup = backup.Status.Filename
+		}
+		backup.Status.CatalogEntryID = util.CatalogEntryID(storageLocationType, h.catalogObjectStore(backup), backup.Status.Filename)
+		backup.Status.ConsecutiveFailures = 0
+		if onDemand != "" {
+			backup.Status.ObservedTrigger = onDemand
+			backup.Status.LastOnDemandSnapshotTS = backup.Status.LastSnapshotTS
+		}
 	})
 	if updateErr != nil {
+		h.writeRunReport(backup, report, updateErr)
 		return h.setReconcilingCondition(backup, updateErr)
 	}
+	backup = updatedBackup
+	h.backoffs.forget(backup.Name)
+	h.recorder.Eventf(backup, corev1.EventTypeNormal, eventReasonBackupCompleted, "Completed backup %v with %v objects in %v", report.artifactName,
+		report.objectCount, time.Since(report.startTime).Round(time.Second))
+	metrics.ObserveBackup(backup.Name, time.Since(report.startTime), report.objectCount, report.artifactSize)
+	h.writeRunReport(backup, report, nil)
+	h.addToCatalog(backup, report)
+	if triggered {
+		h.triggers.done(backup.Name, triggerSeq)
+	}
 	logrus.Infof("Done with backup")
 	return backup, err
 }
 
-func (h *handler) performBackup(backup *v1.Backup, tmpBackupPath, backupFileName string) error {
-	var err error
-	transformerMap := make(map[schema.GroupResource]value.Transformer)
-	if backup.Spec.EncryptionConfigSecretName != "" {
-		logrus.Infof("Processing encryption config %v for backup CR %v", backup.Spec.EncryptionConfigSecretName, backup.Name)
-		transformerMap, err = util.GetEncryptionTransformers(backup.Spec.EncryptionConfigSecretName, h.secrets)
-		if err != nil {
-			return err
-		}
-	}
-
+func (h *handler) performBackup(backup *v1.Backup, tmpBackupPath, backupFileName string, transformerMap map[schema.GroupResource]value.Transformer,
+	report *runReport) error {
 	logrus.Infof("Using resourceSet %v for gathering resources for backup CR %v", backup.Spec.ResourceSetName, backup.Name)
-	resourceSetTemplate, err := h.resourceSets.Get(backup.Spec.ResourceSetName, k8sv1.GetOptions{})
+	resourceSetTemplate, err := h.getResourceSet(backup)
 	if err != nil {
 		return err
 	}
 
+	// set again by the upload, backups stored on the PV have no SSE
+	backup.Status.ServerSideEncryption = ""
 	logrus.Infof("Gathering resources for backup CR %v", backup.Name)
 	rh := resourcesets.ResourceHandler{
-		DiscoveryClient: h.discoveryClient,
-		DynamicClient:   h.dynamicClient,
-		TransformerMap:  transformerMap,
+		DiscoveryClient:                h.discoveryClient,
+		DynamicClient:                  h.dynamicClient,
+		TransformerMap:                 transformerMap,
+		FieldProjections:               backup.Spec.FieldProjections,
+		PruneFields:                    backup.Spec.PruneFields,
+		IncludeNamespaces:              backup.Spec.IncludeNamespaces,
+		ExcludeNamespaces:              backup.Spec.ExcludeNamespaces,
+		ConsistencyMode:                backup.Spec.ConsistencyMode,
+		SkipObjectsOnEncryptionFailure: backup.Spec.SkipObjectsOnEncryptionFailure,
+		Parallelism:                    backup.Spec.Parallelism,
+		PageSize:                       backup.Spec.ListPageSize,
+		FailurePolicy:                  backup.Spec.FailurePolicy,
+		ResourceTimeout:                time.Duration(backup.Spec.ResourceTimeoutSeconds) * time.Second,
+		MaxObjectsPerResource:          backup.Spec.MaxObjectsPerResource,
+		MaxTotalSizeBytes:              backup.Spec.MaxTotalSizeBytes,
+		PerObjectCompression:           backup.Spec.PerObjectCompression,
+		Base:                           h.incrementalBase(backup),
+	}
+	if backup.Spec.SinceTime != nil {
+		rh.SinceTime = backup.Spec.SinceTime.Time
+		rh.Manifest.SinceTime = &rh.SinceTime
+	}
+	rh.Manifest.IncludeNamespaces = backup.Spec.IncludeNamespaces
+	rh.Manifest.ExcludeNamespaces = backup.Spec.ExcludeNamespaces
+	rh.Manifest.Unencrypted = encryptionConfigSecretName(backup) == ""
+	if rh.Base != nil && rh.Base.Unencrypted != rh.Manifest.Unencrypted {
+		// a restore decrypts the objects of the incremental backup and of its full backup with the same config
+		logrus.Infof("Taking a full backup for backup CR %v, encryption changed since full backup %v", backup.Name, backup.Status.LastFullBackup)
+		rh.Base = nil
+	}
+	if rh.Base != nil {
+		logrus.Infof("Taking an incremental backup for backup CR %v from full backup %v", backup.Name, backup.Status.LastFullBackup)
+		rh.Manifest.BaseBackup = backup.Status.LastFullBackup
+		report.baseBackup = backup.Status.LastFullBackup
+	}
+	if filter := backup.Spec.SkipControllerOwnedObjects; filter != nil {
+		rh.ControllerManagers = resourcesets.DefaultControllerManagers
+		if len(filter.ControllerManagers) > 0 {
+			rh.ControllerManagers = filter.ControllerManagers
+		}
+	}
+	if backup.Spec.Checkpoint {
+		rh.Checkpoint, err = openCheckpoint(backup, resourceSetTemplate, transformerMap)
+		if err != nil {
+			return err
+		}
+	}
+	if backup.Spec.ExclusionFile != nil {
+		rh.Exclusions, err = h.loadExclusions(backup)
+		if err != nil {
+			return fmt.Errorf("error loading exclusion file: %v", err)
+		}
+	}
+	gzipFile := backupFileName + ".tar.gz"
+	if encryptionConfigSecretName(backup) != "" {
+		gzipFile += ".enc"
+	}
+	var w resourcesets.FileWriter = resourcesets.DirWriter(tmpBackupPath)
+	var artifact *streamedArtifact
+	if backup.Spec.StreamArtifact {
+		artifact, err = h.newStreamedArtifact(backup, gzipFile)
+		if err != nil {
+			return err
+		}
+		defer artifact.cleanup()
+		w = artifact.writer
+		rh.Writer = artifact.writer
 	}
 	err = rh.GatherResources(h.ctx, resourceSetTemplate.ResourceSelectors)
 	if err != nil {
 		return err
 	}
+	backup.Status.FailedResources = rh.FailedResources
+	var failedResources []string
+	for resource, failure := range rh.FailedResources {
+		failedResources = append(failedResources, fmt.Sprintf("%v not backed up: %v", resource, failure))
+	}
+	sort.Strings(failedResources)
+	report.warnings = append(report.warnings, failedResources...)
+	for _, resource := range rh.RemovedResources {
+		report.warnings = append(report.warnings, fmt.Sprintf("%v not backed up: removed during the backup", resource))
+	}
+	if backup.Spec.QuietPeriod != nil {
+		unsettled, err := h.waitForQuietPeriod(backup, &rh, resourceSetTemplate.ResourceSelectors)
+		if err != nil {
+			return err
+		}
+		for _, workload := range unsettled {
+			logrus.Warnf("Backup CR %v captures %v while it is rolling out", backup.Name, workload)
+		}
+		backup.Status.UnsettledWorkloads = unsettled
+		report.warnings = append(report.warnings, unsettled...)
+	}
 
 	logrus.Infof("Finished gathering resources for backup CR %v, writing to temp location", backup.Name)
+	if backup.Spec.RBACSummary {
+		if err := rh.WriteRBACSummary(tmpBackupPath); err != nil {
+			return err
+		}
+	}
 	err = rh.WriteBackupObjects(tmpBackupPath)
 	if err != nil {
 		return err
 	}
+	backup.Status.TruncatedResources = rh.TruncatedResources
+	var truncatedResources []string
+	for resource, reason := range rh.TruncatedResources {
+		truncatedResources = append(truncatedResources, fmt.Sprintf("%v truncated: %v", resource, reason))
+	}
+	sort.Strings(truncatedResources)
+	report.warnings = append(report.warnings, truncatedResources...)
+	if backup.Spec.CaptureEvents != nil {
+		if err := rh.WriteEvents(h.ctx, tmpBackupPath, backup.Spec.CaptureEvents); err != nil {
+			return err
+		}
+	}
+	if backup.Spec.NamespaceBundles {
+		if err := rh.WriteNamespaceBundles(tmpBackupPath); err != nil {
+			return err
+		}
+	}
+	if backup.Spec.RecordChanges {
+		h.recordChanges(backup, &rh.Manifest)
+	}
+	if backup.Spec.RecordTrustBundles {
+		rh.Manifest.TrustBundles, err = resourcesets.GatherTrustBundles(h.ctx, h.discoveryClient, h.dynamicClient)
+		if err != nil {
+			return fmt.Errorf("error recording trust bundles: %v", err)
+		}
+	}
+	if err := resourcesets.WriteManifest(w, &rh.Manifest); err != nil {
+		return err
+	}
+	report.addManifest(&rh.Manifest)
+	backup.Status.SkippedObjectCounts = rh.SkippedObjectCounts
+	if backup.Spec.IncludeOperatorConfig {
+		logrus.Infof("Saving operator config for backup CR %v", backup.Name)
+		bundle, err := h.gatherOperatorConfig(backup, transformerMap)
+		if err != nil {
+			return err
+		}
+		if err := resourcesets.WriteOperatorConfig(w, bundle); err != nil {
+			return err
+		}
+	}
 
 	logrus.Infof("Saving resourceSet used for backup CR %v", backup.Name)
 	filters, err := json.Marshal(resourceSetTemplate)
 	if err != nil {
 		return err
 	}
-	filtersPath := filepath.Join(tmpBackupPath, "filters")
-	err = os.MkdirAll(filtersPath, os.ModePerm)
-	if err != nil {
+	if err := w.WriteFile(filepath.Join("filters", "filters.json"), filters); err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(filepath.Join(filtersPath, "filters.json"), filters, os.ModePerm)
-	if err != nil {
+	if err := h.writeBackupMetadata(w, backup, filters, report); err != nil {
 		return err
 	}
 
 	condition.Cond(v1.BackupConditionReady).SetStatusBool(backup, true)
 
-	gzipFile := backupFileName + ".tar.gz"
-	if backup.Spec.EncryptionConfigSecretName != "" {
-		gzipFile += ".enc"
+	if artifact != nil {
+		return artifact.finish(h, backup, report)
+	}
+	if err := resourcesets.VerifyBackup(tmpBackupPath); err != nil {
+		return fmt.Errorf("error verifying backup before compressing it: %v", err)
 	}
 	storageLocation := backup.Spec.StorageLocation
 	if storageLocation == nil {
 		logrus.Infof("No storage location specified, checking for default PVC and S3")
 		// use the default location that the controller is configured with
 		if h.defaultBackupMountPath != "" {
-			if err := CreateTarAndGzip(tmpBackupPath, h.defaultBackupMountPath, gzipFile, backup.Name); err != nil {
+			if err := CreateTarAndGzip(tmpBackupPath, objectstore.NewLocalBackend(h.defaultBackupMountPath), gzipFile, backup.Name, backup.Spec.ReproducibleArtifact); err != nil {
 				return err
 			}
+			if err := setArtifactFileMode(backup, filepath.Join(h.defaultBackupMountPath, gzipFile)); err != nil {
+				return err
+			}
+			report.recordArtifact(filepath.Join(h.defaultBackupMountPath, gzipFile))
 			backup.Status.StorageLocation = util.PVBackup
 		} else if h.defaultS3BackupLocation != nil {
 			// not checking for nil, since if this wasn't provided, the default local location would get used
-			if err := h.uploadToS3(backup, h.defaultS3BackupLocation, tmpBackupPath, gzipFile); err != nil {
+			if err := h.uploadToS3(backup, h.defaultS3BackupLocation, tmpBackupPath, gzipFile, report); err != nil {
 				return err
 			}
 			backup.Status.StorageLocation = util.S3Backup
@@ -289,7 +532,7 @@ func (h *handler) performBackup(backup *v1.Backup, tmpBackupPath, backupFileName
 		}
 	} else if storageLocation.S3 != nil {
 		backup.Status.StorageLocation = util.S3Backup
-		if err := h.uploadToS3(backup, storageLocation.S3, tmpBackupPath, gzipFile); err != nil {
+		if err := h.uploadToS3(backup, storageLocation.S3, tmpBackupPath, gzipFile, report); err != nil {
 			return err
 		}
 	}
@@ -306,44 +549,175 @@ func (h *handler) validateBackupSpec(backup *v1.Backup) error {
 			backup.Spec.RetentionCount = DefaultRetentionCount
 		}
 	}
-	return nil
+	if backup.Spec.Trigger != nil {
+		if len(backup.Spec.Trigger.Resources) == 0 {
+			return fmt.Errorf("trigger must list at least one resource to watch")
+		}
+		if backup.Spec.RetentionCount == 0 {
+			backup.Spec.RetentionCount = DefaultRetentionCount
+		}
+	}
+	if backup.Spec.Parallelism < 0 || backup.Spec.Parallelism > maxParallelism {
+		return fmt.Errorf("parallelism must be between 0 and %v", maxParallelism)
+	}
+	if backup.Spec.ListPageSize < 0 || backup.Spec.ListPageSize > maxListPageSize {
+		return fmt.Errorf("listPageSize must be between 0 and %v", maxListPageSize)
+	}
+	if backup.Spec.RetentionMaxAge != "" {
+		maxAge, err := time.ParseDuration(backup.Spec.RetentionMaxAge)
+		if err != nil || maxAge <= 0 {
+			return fmt.Errorf("invalid retentionMaxAge %v, must be a positive duration like 168h", backup.Spec.RetentionMaxAge)
+		}
+	}
+	if backup.Spec.QuietPeriod != nil && (backup.Spec.QuietPeriod.TimeoutSeconds < 0 || backup.Spec.QuietPeriod.TimeoutSeconds > maxQuietPeriodTimeoutSeconds) {
+		return fmt.Errorf("quietPeriod timeoutSeconds must be between 0 and %v", maxQuietPeriodTimeoutSeconds)
+	}
+	if backup.Spec.CaptureEvents != nil && len(backup.Spec.CaptureEvents.Namespaces) == 0 {
+		return fmt.Errorf("captureEvents must list at least one namespace to capture events from")
+	}
+	switch backup.Spec.ConsistencyMode {
+	case "", resourcesets.ConsistencyModeList, resourcesets.ConsistencyModeWatch:
+	default:
+		return fmt.Errorf("invalid consistencyMode %v, must be %v or %v", backup.Spec.ConsistencyMode, resourcesets.ConsistencyModeList, resourcesets.ConsistencyModeWatch)
+	}
+	for _, field := range backup.Spec.PruneFields {
+		if err := resourcesets.ValidatePruneField(field); err != nil {
+			return fmt.Errorf("invalid pruneField %v: %v", field, err)
+		}
+	}
+	if _, err := artifactFileMode(backup); err != nil {
+		return err
+	}
+	if backup.Spec.ResourceTimeoutSeconds < 0 {
+		return fmt.Errorf("resourceTimeoutSeconds can't be negative")
+	}
+	if backup.Spec.FullBackupInterval < 0 {
+		return fmt.Errorf("fullBackupInterval can't be negative")
+	}
+	if backup.Spec.MaxObjectsPerResource < 0 {
+		return fmt.Errorf("maxObjectsPerResource can't be negative")
+	}
+	if backup.Spec.MaxTotalSizeBytes < 0 {
+		return fmt.Errorf("maxTotalSizeBytes can't be negative")
+	}
+	if backup.Spec.PerObjectCompression < 0 {
+		return fmt.Errorf("perObjectCompression can't be negative")
+	}
+	switch backup.Spec.FailurePolicy {
+	case "", resourcesets.FailurePolicyAbort, resourcesets.FailurePolicyContinue:
+	default:
+		return fmt.Errorf("invalid failurePolicy %v, must be %v or %v", backup.Spec.FailurePolicy, resourcesets.FailurePolicyAbort, resourcesets.FailurePolicyContinue)
+	}
+	if backup.Spec.StorageLocation != nil && backup.Spec.StorageLocation.S3 != nil {
+		if _, err := objectstore.ServerSideEncryption(backup.Spec.StorageLocation.S3); err != nil {
+			return err
+		}
+	}
+	return validateArtifactNameTemplate(backup, h.kubeSystemNS)
+}
+
+// encryptionConfigSecretName returns the encryption config the backup uses, with the backup's own config taking precedence
+// over the operator's default. An empty name means the backup isn't encrypted, the transformers, the manifest and the
+// .enc suffix of the artifact all follow it
+func encryptionConfigSecretName(backup *v1.Backup) string {
+	if backup.Spec.DisableEncryption {
+		return ""
+	}
+	if backup.Spec.EncryptionConfigSecretName != "" {
+		return backup.Spec.EncryptionConfigSecretName
+	}
+	return util.DefaultEncryptionConfigSecretName
 }
 
 func (h *handler) generateBackupFilename(backup *v1.Backup) (string, error) {
 	currSnapshotTS := time.Now().Format(time.RFC3339)
 	// on OS X writing file with `:` converts colon to forward slash
 	currTSForFilename := strings.Replace(currSnapshotTS, ":", "-", -1)
-	backupFileName := fmt.Sprintf("%s-%s-%s", backup.Name, h.kubeSystemNS, currTSForFilename)
+	backupFileName := renderArtifactName(backup, h.kubeSystemNS, currTSForFilename)
 	return backupFileName, nil
 }
 
+// setWaitingCondition marks a backup that waits for other backups to finish, it's retried until it gets a slot
+func (h *handler) setWaitingCondition(backup *v1.Backup) (*v1.Backup, error) {
+	logrus.Infof("Backup CR %v is waiting, %v backups are already running", backup.Name, util.MaxConcurrentBackups)
+	h.backups.EnqueueAfter(backup.Name, backupSlotRetryInterval)
+	if condition.Cond(v1.BackupConditionWaiting).IsTrue(backup) {
+		// updating the status again would process the backup right away instead of after the retry interval
+		return backup, nil
+	}
+	return h.updateBackupStatus(backup.Name, func(backup *v1.Backup) {
+		condition.Cond(v1.BackupConditionWaiting).SetStatusBool(backup, true)
+		condition.Cond(v1.BackupConditionWaiting).Message(backup, "Waiting for other backups to finish")
+	})
+}
+
+// setReconcilingCondition records the error on the backup and retries it after a backoff growing with its consecutive
+// failures. The status update processes the backup right away, it's skipped until the backoff is over
+//
 // https://github.com/kubernetes-sigs/cli-utils/tree/master/pkg/kstatus
 // Reconciling and Stalled conditions are present and with a value of true whenever something unusual happens.
 func (h *handler) setReconcilingCondition(backup *v1.Backup, originalErr error) (*v1.Backup, error) {
-	if !condition.Cond(v1.BackupConditionReconciling).IsUnknown(backup) && condition.Cond(v1.BackupConditionReconciling).GetReason(backup) == "Error" {
-		reconcileMsg := condition.Cond(v1.BackupConditionReconciling).GetMessage(backup)
-		if strings.Contains(reconcileMsg, originalErr.Error()) {
-			// no need to update object status again, because if another UpdateStatus is called without needing it, controller will
-			// process the same object immediately without its default backoff
-			return backup, originalErr
-		}
+	failures := backup.Status.ConsecutiveFailures + 1
+	delay := h.backoffs.failed(backup.Name, backup.Generation, failures)
+	logrus.Warnf("Backup CR %v failed %v times in a row, retrying in %v", backup.Name, failures, delay)
+	h.backups.EnqueueAfter(backup.Name, delay)
+	_, err := h.updateBackupStatus(backup.Name, func(updBackup *v1.Backup) {
+		condition.Cond(v1.BackupConditionReconciling).SetStatusBool(updBackup, true)
+		condition.Cond(v1.BackupConditionReconciling).SetError(updBackup, "", originalErr)
+		condition.Cond(v1.BackupConditionReady).Message(updBackup, "Retrying")
+		updBackup.Status.ConsecutiveFailures = failures
+	})
+	if err != nil {
+		return backup, errors.New(originalErr.Error() + err.Error())
 	}
+	return backup, originalErr
+}
+
+// updateBackupStatus applies update to the latest version of the backup and writes its status. The spec can be edited
+// while a backup runs, so on a conflict the backup is fetched and updated again
+func (h *handler) updateBackupStatus(name string, update func(backup *v1.Backup)) (*v1.Backup, error) {
+	var updated *v1.Backup
 	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		var err error
-		updBackup, err := h.backups.Get(backup.Name, k8sv1.GetOptions{})
+		backup, err := h.backups.Get(name, k8sv1.GetOptions{})
 		if err != nil {
 			return err
 		}
-
-		condition.Cond(v1.BackupConditionReconciling).SetStatusBool(updBackup, true)
-		condition.Cond(v1.BackupConditionReconciling).SetError(updBackup, "", originalErr)
-		condition.Cond(v1.BackupConditionReady).Message(updBackup, "Retrying")
-
-		_, err = h.backups.UpdateStatus(updBackup)
+		update(backup)
+		updated, err = h.backups.UpdateStatus(backup)
 		return err
 	})
+	return updated, err
+}
+
+// trackScheduledBackup records the last successful run of the backup for the readiness probe, a backup that never ran
+// counts from its creation
+func (h *handler) trackScheduledBackup(backup *v1.Backup) {
+	lastSuccess := backup.CreationTimestamp.Time
+	if backup.Status.LastSnapshotTS != "" {
+		if lastSnapshot, err := time.Parse(time.RFC3339, backup.Status.LastSnapshotTS); err == nil {
+			lastSuccess = lastSnapshot
+		}
+	}
+	if err := metrics.SetScheduledBackup(backup.Name, backup.Spec.Schedule, lastSuccess); err != nil {
+		logrus.Warnf("Not tracking backup %v for the readiness probe: %v", backup.Name, err)
+	}
+}
+
+// writeBackupMetadata records the versions of the cluster and the operator, a backup of a cluster that can't report its
+// version is still taken without it
+func (h *handler) writeBackupMetadata(w resourcesets.FileWriter, backup *v1.Backup, filters []byte, report *runReport) error {
+	metadata := &resourcesets.BackupMetadata{
+		OperatorVersion: util.OperatorVersion,
+		StartedAt:       report.startTime.Format(time.RFC3339),
+		CompletedAt:     time.Now().Format(time.RFC3339),
+		ResourceSetHash: fmt.Sprintf("%x", sha256.Sum256(filters)),
+		Encrypted:       encryptionConfigSecretName(backup) != "",
+	}
+	serverVersion, err := h.discoveryClient.ServerVersion()
 	if err != nil {
-		return backup, errors.New(originalErr.Error() + err.Error())
+		logrus.Warnf("Error getting the Kubernetes version for the metadata of backup CR %v: %v", backup.Name, err)
+	} else {
+		metadata.KubernetesVersion = serverVersion.GitVersion
 	}
-	return backup, originalErr
+	return resourcesets.WriteBackupMetadata(w, metadata)
 }
@@ -0,0 +1,410 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	backupControllers "github.com/rancher/backup-restore-operator/pkg/generated/controllers/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	v1core "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+// fakeBackups stores Backup CRs in memory for the handler, only the calls the handler makes are implemented. Enqueued
+// backups are recorded in enqueued, with the delay they were enqueued after
+type fakeBackups struct {
+	backupControllers.BackupController
+	lock     sync.Mutex
+	backups  map[string]*v1.Backup
+	enqueued []enqueuedBackup
+	// updateStatusErrs are returned by the next UpdateStatus calls instead of updating the status
+	updateStatusErrs []error
+}
+
+type enqueuedBackup struct {
+	name  string
+	after time.Duration
+}
+
+func newFakeBackups(backups ...*v1.Backup) *fakeBackups {
+	f := &fakeBackups{backups: make(map[string]*v1.Backup)}
+	for _, backup := range backups {
+		f.backups[backup.Name] = backup.DeepCopy()
+	}
+	return f
+}
+
+func (f *fakeBackups) Get(name string, options metav1.GetOptions) (*v1.Backup, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	backup, ok := f.backups[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Group: "resources.cattle.io", Resource: "backups"}, name)
+	}
+	return backup.DeepCopy(), nil
+}
+
+func (f *fakeBackups) Update(backup *v1.Backup) (*v1.Backup, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.backups[backup.Name] = backup.DeepCopy()
+	return backup, nil
+}
+
+func (f *fakeBackups) UpdateStatus(backup *v1.Backup) (*v1.Backup, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if len(f.updateStatusErrs) > 0 {
+		err := f.updateStatusErrs[0]
+		f.updateStatusErrs = f.updateStatusErrs[1:]
+		return nil, err
+	}
+	stored, ok := f.backups[backup.Name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Group: "resources.cattle.io", Resource: "backups"}, backup.Name)
+	}
+	stored.Status = *backup.Status.DeepCopy()
+	return stored.DeepCopy(), nil
+}
+
+func (f *fakeBackups) Enqueue(name string) {
+	f.EnqueueAfter(name, 0)
+}
+
+func (f *fakeBackups) EnqueueAfter(name string, duration time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.enqueued = append(f.enqueued, enqueuedBackup{name: name, after: duration})
+}
+
+func (f *fakeBackups) Cache() backupControllers.BackupCache {
+	return fakeBackupCache{backups: f}
+}
+
+type fakeBackupCache struct {
+	backupControllers.BackupCache
+	backups *fakeBackups
+}
+
+func (c fakeBackupCache) Get(name string) (*v1.Backup, error) {
+	return c.backups.Get(name, metav1.GetOptions{})
+}
+
+func (c fakeBackupCache) List(selector labels.Selector) ([]*v1.Backup, error) {
+	c.backups.lock.Lock()
+	defer c.backups.lock.Unlock()
+	var backups []*v1.Backup
+	for _, backup := range c.backups.backups {
+		if selector.Matches(labels.Set(backup.Labels)) {
+			backups = append(backups, backup.DeepCopy())
+		}
+	}
+	return backups, nil
+}
+
+// fakeSecrets serves the secrets by namespace/name, only Get is implemented
+type fakeSecrets struct {
+	v1core.SecretController
+	secrets map[string]*corev1.Secret
+}
+
+func (f fakeSecrets) Get(namespace, name string, options metav1.GetOptions) (*corev1.Secret, error) {
+	secret, ok := f.secrets[namespace+"/"+name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+	}
+	return secret.DeepCopy(), nil
+}
+
+// fakeConfigMaps stores config maps by namespace/name, only the calls of the catalog are implemented
+type fakeConfigMaps struct {
+	v1core.ConfigMapController
+	configMaps map[string]*corev1.ConfigMap
+}
+
+func (f *fakeConfigMaps) Get(namespace, name string, options metav1.GetOptions) (*corev1.ConfigMap, error) {
+	configMap, ok := f.configMaps[namespace+"/"+name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, name)
+	}
+	return configMap.DeepCopy(), nil
+}
+
+func (f *fakeConfigMaps) Create(configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	f.configMaps[configMap.Namespace+"/"+configMap.Name] = configMap.DeepCopy()
+	return configMap, nil
+}
+
+func (f *fakeConfigMaps) Update(configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	return f.Create(configMap)
+}
+
+// fakeResourceSets serves the ResourceSet CRs of the handler by name, only Get is implemented
+type fakeResourceSets struct {
+	backupControllers.ResourceSetController
+	resourceSets map[string]*v1.ResourceSet
+}
+
+func (f fakeResourceSets) Get(name string, options metav1.GetOptions) (*v1.ResourceSet, error) {
+	resourceSet, ok := f.resourceSets[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Group: "resources.cattle.io", Resource: "resourcesets"}, name)
+	}
+	return resourceSet.DeepCopy(), nil
+}
+
+// testConfigMapsResources are the resources of the cluster of newTestHandler
+var testConfigMapsResources = []*metav1.APIResourceList{{
+	GroupVersion: "v1",
+	APIResources: []metav1.APIResource{{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: metav1.Verbs{"list", "get", "watch"}}},
+}}
+
+// newTestHandler returns a handler running the backups against a fake cluster with the config map default/settings,
+// backups use ResourceSet "rancher" and are stored in a temp dir as the default location. Events are recorded by recorder
+func newTestHandler(t *testing.T, backups *fakeBackups) (*handler, *record.FakeRecorder, *dynamicfake.FakeDynamicClient) {
+	settings := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}}
+	settings.SetNamespace("default")
+	settings.SetName("settings")
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{{Version: "v1", Resource: "configmaps"}: "ConfigMapList"}, settings)
+	recorder := record.NewFakeRecorder(100)
+	h := &handler{
+		ctx:     context.Background(),
+		backups: backups,
+		resourceSets: fakeResourceSets{resourceSets: map[string]*v1.ResourceSet{"rancher": {
+			ObjectMeta:        metav1.ObjectMeta{Name: "rancher"},
+			ResourceSelectors: []v1.ResourceSelector{{APIVersion: "v1", Kinds: []string{"configmaps"}}},
+		}}},
+		configMaps:             &fakeConfigMaps{configMaps: make(map[string]*corev1.ConfigMap)},
+		discoveryClient:        &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{Resources: testConfigMapsResources}},
+		dynamicClient:          dynamicClient,
+		defaultBackupMountPath: t.TempDir(),
+		kubeSystemNS:           "c1d2e3f4",
+		triggers:               newTriggers(),
+		slots:                  newBackupSlots(1),
+		backoffs:               newFailureBackoffs(),
+		recorder:               recorder,
+	}
+	return h, recorder, dynamicClient
+}
+
+// reconcile runs OnBackupChange for the stored backup like the informer does, and returns the reasons of the events recorded
+func reconcile(t *testing.T, h *handler, recorder *record.FakeRecorder, name string) ([]string, error) {
+	backup, err := h.backups.Get(name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = h.OnBackupChange(name, backup)
+	var reasons []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			reasons = append(reasons, strings.Fields(event)[1])
+		default:
+			return reasons, err
+		}
+	}
+}
+
+func TestEncryptionConfigSecretName(t *testing.T) {
+	tests := []struct {
+		name          string
+		spec          v1.BackupSpec
+		defaultConfig string
+		want          string
+	}{
+		{name: "no config", spec: v1.BackupSpec{}, want: ""},
+		{name: "own config", spec: v1.BackupSpec{EncryptionConfigSecretName: "own"}, want: "own"},
+		{name: "default config", spec: v1.BackupSpec{}, defaultConfig: "default", want: "default"},
+		{name: "own config over default", spec: v1.BackupSpec{EncryptionConfigSecretName: "own"}, defaultConfig: "default", want: "own"},
+		{name: "disableEncryption with own config", spec: v1.BackupSpec{EncryptionConfigSecretName: "own", DisableEncryption: true}, want: ""},
+		{name: "disableEncryption with default config", spec: v1.BackupSpec{DisableEncryption: true}, defaultConfig: "default", want: ""},
+	}
+	defer func(defaultConfig string) { util.DefaultEncryptionConfigSecretName = defaultConfig }(util.DefaultEncryptionConfigSecretName)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			util.DefaultEncryptionConfigSecretName = tt.defaultConfig
+			if got := encryptionConfigSecretName(&v1.Backup{Spec: tt.spec}); got != tt.want {
+				t.Errorf("encryptionConfigSecretName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateBackupSpecAllowsUnencryptedBackupWithConfig(t *testing.T) {
+	spec := v1.BackupSpec{ResourceSetName: "rancher", EncryptionConfigSecretName: "own", DisableEncryption: true}
+	h := &handler{kubeSystemNS: "c1d2e3f4"}
+	if err := h.validateBackupSpec(&v1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "backup"}, Spec: spec}); err != nil {
+		t.Errorf("validateBackupSpec() of unencrypted backup with encryption config: %v", err)
+	}
+}
+
+// versionlessDiscovery fails to report the version of the cluster
+type versionlessDiscovery struct {
+	discovery.DiscoveryInterface
+}
+
+func (versionlessDiscovery) ServerVersion() (*version.Info, error) {
+	return nil, errors.New("the server is currently unable to handle the request")
+}
+
+func TestWriteBackupMetadata(t *testing.T) {
+	defer func(operatorVersion string) { util.OperatorVersion = operatorVersion }(util.OperatorVersion)
+	util.OperatorVersion = "v1.2.0"
+	filters := []byte(`{"resourceSelectors":[{"apiVersion":"v1","kindsRegexp":"."}]}`)
+	startTime := time.Date(2020, 9, 15, 21, 27, 6, 0, time.UTC)
+	tests := []struct {
+		name          string
+		discovery     discovery.DiscoveryInterface
+		spec          v1.BackupSpec
+		wantK8s       string
+		wantEncrypted bool
+	}{
+		{
+			name:      "unencrypted",
+			discovery: &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{}, FakedServerVersion: &version.Info{GitVersion: "v1.21.2"}},
+			wantK8s:   "v1.21.2",
+		},
+		{
+			name:          "encrypted",
+			discovery:     &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{}, FakedServerVersion: &version.Info{GitVersion: "v1.20.8+rke2r1"}},
+			spec:          v1.BackupSpec{EncryptionConfigSecretName: "encryptionconfig"},
+			wantK8s:       "v1.20.8+rke2r1",
+			wantEncrypted: true,
+		},
+		{
+			name:      "cluster version unknown",
+			discovery: versionlessDiscovery{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backupPath := t.TempDir()
+			h := &handler{discoveryClient: tt.discovery}
+			backup := &v1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "nightly"}, Spec: tt.spec}
+			if err := h.writeBackupMetadata(resourcesets.DirWriter(backupPath), backup, filters, &runReport{startTime: startTime}); err != nil {
+				t.Fatalf("writeBackupMetadata() error: %v", err)
+			}
+			data, err := ioutil.ReadFile(filepath.Join(backupPath, resourcesets.BackupMetadataFileName))
+			if err != nil {
+				t.Fatalf("backup has no %v: %v", resourcesets.BackupMetadataFileName, err)
+			}
+			var metadata resourcesets.BackupMetadata
+			if err := json.Unmarshal(data, &metadata); err != nil {
+				t.Fatalf("%v isn't JSON: %v", resourcesets.BackupMetadataFileName, err)
+			}
+			if metadata.KubernetesVersion != tt.wantK8s {
+				t.Errorf("kubernetesVersion = %q, want %q", metadata.KubernetesVersion, tt.wantK8s)
+			}
+			if metadata.OperatorVersion != "v1.2.0" {
+				t.Errorf("operatorVersion = %q, want v1.2.0", metadata.OperatorVersion)
+			}
+			if metadata.StartedAt != "2020-09-15T21:27:06Z" {
+				t.Errorf("startedAt = %q, want 2020-09-15T21:27:06Z", metadata.StartedAt)
+			}
+			if completedAt, err := time.Parse(time.RFC3339, metadata.CompletedAt); err != nil || completedAt.Before(startTime) {
+				t.Errorf("completedAt = %q, want an RFC3339 time after startedAt", metadata.CompletedAt)
+			}
+			if want := fmt.Sprintf("%x", sha256.Sum256(filters)); metadata.ResourceSetHash != want {
+				t.Errorf("resourceSetHash = %q, want %q", metadata.ResourceSetHash, want)
+			}
+			if metadata.Encrypted != tt.wantEncrypted {
+				t.Errorf("encrypted = %v, want %v", metadata.Encrypted, tt.wantEncrypted)
+			}
+		})
+	}
+}
+
+func TestUpdateBackupStatusRetriesOnConflict(t *testing.T) {
+	backupsResource := schema.GroupResource{Group: "resources.cattle.io", Resource: "backups"}
+	backups := newFakeBackups(&v1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "nightly"}, Spec: v1.BackupSpec{ResourceSetName: "rancher"}})
+	backups.updateStatusErrs = []error{apierrors.NewConflict(backupsResource, "nightly", errors.New("the object has been modified"))}
+	h := &handler{backups: backups}
+
+	var seen []string
+	updated, err := h.updateBackupStatus("nightly", func(backup *v1.Backup) {
+		seen = append(seen, backup.Spec.ResourceSetName)
+		if len(seen) == 1 {
+			// the spec is edited while the backup runs
+			edited := backup.DeepCopy()
+			edited.Spec.ResourceSetName = "rancher-edited"
+			backups.Update(edited)
+		}
+		backup.Status.Summary = "Completed"
+	})
+	if err != nil {
+		t.Fatalf("updateBackupStatus() error: %v", err)
+	}
+	if want := []string{"rancher", "rancher-edited"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("update called with specs %v, want %v", seen, want)
+	}
+	stored, _ := backups.Get("nightly", metav1.GetOptions{})
+	if updated.Status.Summary != "Completed" || stored.Status.Summary != "Completed" {
+		t.Errorf("status after the retry = %q, stored %q, want Completed", updated.Status.Summary, stored.Status.Summary)
+	}
+	if stored.Spec.ResourceSetName != "rancher-edited" {
+		t.Errorf("spec after the status update = %v, want the edit kept", stored.Spec.ResourceSetName)
+	}
+
+	var conflicts []error
+	for i := 0; i < 10; i++ {
+		conflicts = append(conflicts, apierrors.NewConflict(backupsResource, "nightly", errors.New("the object has been modified")))
+	}
+	backups.updateStatusErrs = conflicts
+	if _, err := h.updateBackupStatus("nightly", func(backup *v1.Backup) {}); !apierrors.IsConflict(err) {
+		t.Errorf("updateBackupStatus() with persistent conflicts error = %v, want a conflict", err)
+	}
+	backups.updateStatusErrs = []error{apierrors.NewBadRequest("invalid status")}
+	calls := 0
+	if _, err := h.updateBackupStatus("nightly", func(backup *v1.Backup) { calls++ }); !apierrors.IsBadRequest(err) || calls != 1 {
+		t.Errorf("updateBackupStatus() with a bad request = %v after %v calls, want it returned without a retry", err, calls)
+	}
+}
+
+func TestRBACSummaryIsOptIn(t *testing.T) {
+	backups := newFakeBackups(
+		&v1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "plain"}, Spec: v1.BackupSpec{ResourceSetName: "rancher"}},
+		&v1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "audited"}, Spec: v1.BackupSpec{ResourceSetName: "rancher", RBACSummary: true}},
+	)
+	h, recorder, _ := newTestHandler(t, backups)
+	for name, want := range map[string]bool{"plain": false, "audited": true} {
+		if _, err := reconcile(t, h, recorder, name); err != nil {
+			t.Fatalf("backup %v failed: %v", name, err)
+		}
+		artifacts, err := filepath.Glob(filepath.Join(h.defaultBackupMountPath, name+"-*.tar.gz"))
+		if err != nil || len(artifacts) != 1 {
+			t.Fatalf("artifacts of backup %v = %v, %v, want one", name, artifacts, err)
+		}
+		var hasSummary bool
+		for _, file := range artifactFiles(t, artifacts[0]) {
+			hasSummary = hasSummary || filepath.Base(file) == resourcesets.RBACSummaryFileName
+		}
+		if hasSummary != want {
+			t.Errorf("artifact of backup %v has an RBAC summary = %v, want %v", name, hasSummary, want)
+		}
+	}
+}
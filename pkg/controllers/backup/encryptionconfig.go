@@ -0,0 +1,64 @@
+package backup
+
+import (
+	"fmt"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const eventReasonEncryptionConfigInvalid = "EncryptionConfigInvalid"
+
+// OnEncryptionConfigChange validates an encryption config secret as soon as it changes, so a broken key rotation is reported
+// on the Backups that use it before their next run fails. The config is parsed and every provider is probed
+func (h *handler) OnEncryptionConfigChange(key string, secret *corev1.Secret) (*corev1.Secret, error) {
+	if secret == nil || secret.DeletionTimestamp != nil || secret.Namespace != util.ChartNamespace {
+		return secret, nil
+	}
+	backups, err := h.backupsUsingEncryptionConfig(secret.Name)
+	if err != nil || len(backups) == 0 {
+		return secret, err
+	}
+	if err := h.validateEncryptionConfig(secret.Name); err != nil {
+		logrus.Errorf("Encryption config %v used by %v backups is invalid: %v", secret.Name, len(backups), err)
+		for _, backup := range backups {
+			h.recorder.Eventf(backup, corev1.EventTypeWarning, eventReasonEncryptionConfigInvalid,
+				"Encryption config %v changed and is invalid, the next backup will fail: %v", secret.Name, err)
+		}
+		return secret, nil
+	}
+	logrus.Infof("Validated changed encryption config %v", secret.Name)
+	for _, backup := range backups {
+		if backup.Status.ConsecutiveFailures > 0 {
+			// the backup may have failed because of the previous config, retry it right away
+			h.backoffs.forget(backup.Name)
+			h.backups.Enqueue(backup.Name)
+		}
+	}
+	return secret, nil
+}
+
+func (h *handler) backupsUsingEncryptionConfig(secretName string) ([]*v1.Backup, error) {
+	backups, err := h.backups.Cache().List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("error listing backups using encryption config %v: %v", secretName, err)
+	}
+	var using []*v1.Backup
+	for _, backup := range backups {
+		if encryptionConfigSecretName(backup) == secretName {
+			using = append(using, backup)
+		}
+	}
+	return using, nil
+}
+
+func (h *handler) validateEncryptionConfig(secretName string) error {
+	transformerMap, err := util.GetEncryptionTransformers(secretName, h.secrets)
+	if err != nil {
+		return err
+	}
+	return util.ProbeEncryptionTransformers(transformerMap)
+}
@@ -0,0 +1,103 @@
+package backup
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const testEncryptionConfig = `apiVersion: apiserver.config.k8s.io/v1
+kind: EncryptionConfiguration
+resources:
+  - resources:
+      - secrets
+    providers:
+      - aescbc:
+          keys:
+            - name: key1
+              secret: YmFja3VwLXJlc3RvcmUtb3BlcmF0b3ItdGVzdC1rZXk=
+`
+
+func TestOnEncryptionConfigChange(t *testing.T) {
+	defer func(namespace string) { util.ChartNamespace = namespace }(util.ChartNamespace)
+	util.ChartNamespace = "cattle-resources-system"
+	tests := []struct {
+		name         string
+		config       string
+		failures     int
+		wantEvent    string
+		wantEnqueued bool
+	}{
+		{name: "valid config", config: testEncryptionConfig},
+		{name: "valid config after failed backups", config: testEncryptionConfig, failures: 2, wantEnqueued: true},
+		{
+			name:      "unknown provider",
+			config:    strings.Replace(testEncryptionConfig, "aescbc:", "rot13:", 1),
+			wantEvent: "Warning EncryptionConfigInvalid Encryption config encryptionconfig changed and is invalid",
+		},
+		{
+			name:      "key of the wrong length",
+			config:    strings.Replace(testEncryptionConfig, "YmFja3VwLXJlc3RvcmUtb3BlcmF0b3ItdGVzdC1rZXk=", "c2hvcnQ=", 1),
+			failures:  2,
+			wantEvent: "Warning EncryptionConfigInvalid Encryption config encryptionconfig changed and is invalid",
+		},
+		{
+			name:      "not yaml",
+			config:    "providers: [",
+			wantEvent: "Warning EncryptionConfigInvalid Encryption config encryptionconfig changed and is invalid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "encryptionconfig", Namespace: util.ChartNamespace},
+				Data:       map[string][]byte{"encryption-provider-config.yaml": []byte(tt.config)},
+			}
+			using := &v1.Backup{
+				ObjectMeta: metav1.ObjectMeta{Name: "nightly"},
+				Spec:       v1.BackupSpec{EncryptionConfigSecretName: "encryptionconfig"},
+				Status:     v1.BackupStatus{ConsecutiveFailures: tt.failures},
+			}
+			other := &v1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "unencrypted"}, Status: v1.BackupStatus{ConsecutiveFailures: tt.failures}}
+			backups := newFakeBackups(using, other)
+			recorder := record.NewFakeRecorder(10)
+			h := &handler{
+				backups:  backups,
+				secrets:  fakeSecrets{secrets: map[string]*corev1.Secret{util.ChartNamespace + "/encryptionconfig": secret}},
+				recorder: recorder,
+				backoffs: newFailureBackoffs(),
+			}
+			if _, err := h.OnEncryptionConfigChange(util.ChartNamespace+"/encryptionconfig", secret); err != nil {
+				t.Fatalf("OnEncryptionConfigChange() error: %v", err)
+			}
+
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			if tt.wantEvent == "" && len(events) > 0 {
+				t.Errorf("OnEncryptionConfigChange() recorded events %q for a valid config", events)
+			}
+			if tt.wantEvent != "" && (len(events) != 1 || !strings.HasPrefix(events[0], tt.wantEvent)) {
+				t.Errorf("OnEncryptionConfigChange() recorded events %q, want one event on backup nightly starting with %q", events, tt.wantEvent)
+			}
+			var enqueued []string
+			for _, e := range backups.enqueued {
+				enqueued = append(enqueued, e.name)
+			}
+			var wantEnqueued []string
+			if tt.wantEnqueued {
+				wantEnqueued = []string{"nightly"}
+			}
+			if !reflect.DeepEqual(enqueued, wantEnqueued) {
+				t.Errorf("OnEncryptionConfigChange() enqueued %v, want %v", enqueued, wantEnqueued)
+			}
+		})
+	}
+}
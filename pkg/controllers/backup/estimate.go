@@ -0,0 +1,44 @@
+package backup
+
+import (
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/rancher/wrangler/pkg/condition"
+	"github.com/rancher/wrangler/pkg/genericcondition"
+	"github.com/sirupsen/logrus"
+)
+
+// estimateBackup sets the estimate of what the backup would contain in its status, without writing or uploading anything
+func (h *handler) estimateBackup(backup *v1.Backup) (*v1.Backup, error) {
+	if backup.Status.Estimate != nil && backup.Status.ObservedGeneration == backup.Generation {
+		return backup, nil
+	}
+	logrus.Infof("Estimating backup CR %v", backup.Name)
+	resourceSetTemplate, err := h.getResourceSet(backup)
+	if err != nil {
+		return h.setReconcilingCondition(backup, err)
+	}
+	rh := resourcesets.ResourceHandler{
+		DiscoveryClient: h.discoveryClient,
+		DynamicClient:   h.dynamicClient,
+		MetadataClient:  h.metadataClient,
+		PageSize:        backup.Spec.ListPageSize,
+	}
+	estimate, err := rh.EstimateBackup(h.ctx, resourceSetTemplate.ResourceSelectors)
+	if err != nil {
+		return h.setReconcilingCondition(backup, err)
+	}
+	logrus.Infof("Backup CR %v would contain about %v bytes before compression", backup.Name, estimate.SizeBytes)
+
+	updatedBackup, updateErr := h.updateBackupStatus(backup.Name, func(backup *v1.Backup) {
+		backup.Status.Conditions = []genericcondition.GenericCondition{}
+		condition.Cond(v1.BackupConditionReady).SetStatusBool(backup, true)
+		condition.Cond(v1.BackupConditionReady).Message(backup, "Estimated")
+		backup.Status.Estimate = estimate
+		backup.Status.ObservedGeneration = backup.Generation
+	})
+	if updateErr != nil {
+		return h.setReconcilingCondition(backup, updateErr)
+	}
+	return updatedBackup, nil
+}
@@ -0,0 +1,74 @@
+package backup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/objectstore"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"github.com/sirupsen/logrus"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const defaultExclusionFileConfigMapKey = "backupignore"
+
+// loadExclusions reads the exclusion file of the backup from a ConfigMap or the object store of the backup
+func (h *handler) loadExclusions(backup *v1.Backup) ([]resourcesets.ExclusionRule, error) {
+	source := backup.Spec.ExclusionFile
+	switch {
+	case source.ConfigMapName != "" && source.ObjectKey != "":
+		return nil, fmt.Errorf("exclusionFile can only have one of configMapName and objectKey")
+	case source.ConfigMapName != "":
+		namespace := source.ConfigMapNamespace
+		if namespace == "" {
+			namespace = util.ChartNamespace
+		}
+		key := source.ConfigMapKey
+		if key == "" {
+			key = defaultExclusionFileConfigMapKey
+		}
+		logrus.Infof("Reading exclusion file for backup CR %v from key %v of configMap %v/%v", backup.Name, key, namespace, source.ConfigMapName)
+		configMap, err := h.configMaps.Get(namespace, source.ConfigMapName, k8sv1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		data, ok := configMap.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("configMap %v/%v has no key %v", namespace, source.ConfigMapName, key)
+		}
+		return resourcesets.ParseExclusions(fmt.Sprintf("configMap %v/%v", namespace, source.ConfigMapName), []byte(data))
+	case source.ObjectKey != "":
+		objectStore := h.defaultS3BackupLocation
+		if backup.Spec.StorageLocation != nil && backup.Spec.StorageLocation.S3 != nil {
+			objectStore = backup.Spec.StorageLocation.S3
+		}
+		if objectStore == nil {
+			return nil, fmt.Errorf("exclusionFile objectKey needs the backup to be stored in S3")
+		}
+		s3Client, err := objectstore.GetS3Client(h.ctx, objectStore, h.dynamicClient)
+		if err != nil {
+			return nil, err
+		}
+		objectKey := source.ObjectKey
+		if objectStore.Folder != "" {
+			objectKey = strings.Trim(fmt.Sprintf("%s/%s", strings.TrimRight(objectStore.Folder, "/"), objectKey), "/")
+		}
+		logrus.Infof("Reading exclusion file for backup CR %v from object %v of bucket %v", backup.Name, objectKey, objectStore.BucketName)
+		filePath, err := objectstore.DownloadFromS3WithPrefix(s3Client, objectKey, objectStore.BucketName)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(filePath)
+		data, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		return resourcesets.ParseExclusions(fmt.Sprintf("object %v", objectKey), data)
+	default:
+		return nil, fmt.Errorf("exclusionFile must have one of configMapName and objectKey")
+	}
+}
@@ -0,0 +1,42 @@
+package backup
+
+import (
+	"path"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/sirupsen/logrus"
+)
+
+const DefaultFullBackupInterval = 6
+
+func fullBackupInterval(backup *v1.Backup) int {
+	if backup.Spec.FullBackupInterval > 0 {
+		return backup.Spec.FullBackupInterval
+	}
+	return DefaultFullBackupInterval
+}
+
+// incrementalBase returns the manifest of the full backup an incremental backup derives from, nil if this run has to be
+// a full backup. Failing to read the full backup doesn't fail the backup, it's taken as a full backup instead
+func (h *handler) incrementalBase(backup *v1.Backup) *resourcesets.Manifest {
+	if !backup.Spec.Incremental || backup.Status.LastFullBackup == "" {
+		return nil
+	}
+	if backup.Status.IncrementalsSinceFullBackup >= fullBackupInterval(backup) {
+		logrus.Infof("Taking a full backup for backup CR %v after %v incremental backups", backup.Name, backup.Status.IncrementalsSinceFullBackup)
+		return nil
+	}
+	base, err := h.readManifest(backup, backup.Status.LastFullBackup)
+	if err != nil {
+		logrus.Warnf("Taking a full backup for backup CR %v: error reading manifest of full backup %v: %v", backup.Name, backup.Status.LastFullBackup, err)
+		return nil
+	}
+	return base
+}
+
+// isIncrementalBase returns true for the full backup the incremental backups of the Backup CR derive from, the retention
+// policy keeps it as long as it is the base
+func isIncrementalBase(backup *v1.Backup, filename string) bool {
+	return backup.Spec.Incremental && backup.Status.LastFullBackup != "" && path.Base(filename) == backup.Status.LastFullBackup
+}
@@ -0,0 +1,79 @@
+package backup
+
+import (
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIncrementalBase(t *testing.T) {
+	const fullBackup = "nightly-c1d2e3f4-2020-09-15T21-27-06Z.tar.gz"
+	dir := t.TempDir()
+	artifact, err := resourcesets.NewArtifactWriter(filepath.Join(dir, fullBackup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := &resourcesets.Manifest{Entries: []resourcesets.ManifestEntry{{Path: "secrets.#v1/default/token.json", ResourceVersion: "42"}}}
+	if err := resourcesets.WriteManifest(artifact, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := artifact.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		spec     v1.BackupSpec
+		status   v1.BackupStatus
+		wantBase bool
+	}{
+		{
+			name:   "not incremental",
+			status: v1.BackupStatus{LastFullBackup: fullBackup},
+		},
+		{
+			name: "first backup",
+			spec: v1.BackupSpec{Incremental: true},
+		},
+		{
+			name:     "within the full backup interval",
+			spec:     v1.BackupSpec{Incremental: true},
+			status:   v1.BackupStatus{LastFullBackup: fullBackup, IncrementalsSinceFullBackup: DefaultFullBackupInterval - 1},
+			wantBase: true,
+		},
+		{
+			name:   "full backup interval reached",
+			spec:   v1.BackupSpec{Incremental: true},
+			status: v1.BackupStatus{LastFullBackup: fullBackup, IncrementalsSinceFullBackup: DefaultFullBackupInterval},
+		},
+		{
+			name:     "custom full backup interval",
+			spec:     v1.BackupSpec{Incremental: true, FullBackupInterval: 10},
+			status:   v1.BackupStatus{LastFullBackup: fullBackup, IncrementalsSinceFullBackup: DefaultFullBackupInterval},
+			wantBase: true,
+		},
+		{
+			name:   "full backup is gone",
+			spec:   v1.BackupSpec{Incremental: true},
+			status: v1.BackupStatus{LastFullBackup: "nightly-c1d2e3f4-2020-09-14T21-27-06Z.tar.gz"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &handler{defaultBackupMountPath: dir}
+			backup := &v1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "nightly"}, Spec: tt.spec, Status: tt.status}
+			backup.Status.StorageLocation = util.PVBackup
+			base := h.incrementalBase(backup)
+			if (base != nil) != tt.wantBase {
+				t.Fatalf("incrementalBase() = %v, want a base = %v", base, tt.wantBase)
+			}
+			if base != nil && (len(base.Entries) != 1 || base.Entries[0].ResourceVersion != "42") {
+				t.Errorf("incrementalBase() entries = %v, want the entries of the full backup %v", base.Entries, manifest.Entries)
+			}
+		})
+	}
+}
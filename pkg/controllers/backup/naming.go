@@ -0,0 +1,102 @@
+package backup
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// Tokens that can be used in Spec.ArtifactNameTemplate
+const (
+	backupNameToken  = "{backup}"
+	resourceSetToken = "{resourceSet}"
+	clusterIDToken   = "{clusterID}"
+	timestampToken   = "{timestamp}"
+	uuidToken        = "{uuid}"
+
+	// DefaultArtifactNameTemplate produces the same filenames as older versions of the operator
+	DefaultArtifactNameTemplate = backupNameToken + "-" + clusterIDToken + "-" + timestampToken
+	maxArtifactNameLength       = 200
+)
+
+var (
+	artifactNameTokenRegexp = regexp.MustCompile(`{[^{}]*}`)
+	// names must be usable both as a filename and an s3 object key
+	safeArtifactNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+	// matches timestamps generated by generateBackupFilename, example 2020-09-15T21-27-06Z or 2020-09-15T21-27-06-07-00
+	artifactTimestampRegexp = `[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}-[0-9]{2}-[0-9]{2}(Z|[+-][0-9]{2}-[0-9]{2})`
+	artifactUUIDRegexp      = `[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`
+)
+
+func artifactNameTemplate(backup *v1.Backup) string {
+	if backup.Spec.ArtifactNameTemplate == "" {
+		return DefaultArtifactNameTemplate
+	}
+	return backup.Spec.ArtifactNameTemplate
+}
+
+func validateArtifactNameTemplate(backup *v1.Backup, clusterID string) error {
+	template := artifactNameTemplate(backup)
+	for _, token := range artifactNameTokenRegexp.FindAllString(template, -1) {
+		switch token {
+		case backupNameToken, resourceSetToken, clusterIDToken, timestampToken, uuidToken:
+		default:
+			return fmt.Errorf("invalid artifactNameTemplate %v: unknown token %v", template, token)
+		}
+	}
+	// retention finds the artifacts of a backup by name, without the backup name it would delete the artifacts of other
+	// backups stored in the same location
+	if !strings.Contains(template, backupNameToken) {
+		return fmt.Errorf("invalid artifactNameTemplate %v: it must contain %v", template, backupNameToken)
+	}
+	// every run of a backup must produce a different name, otherwise it overwrites the previous artifact
+	if !strings.Contains(template, timestampToken) && !strings.Contains(template, uuidToken) {
+		return fmt.Errorf("invalid artifactNameTemplate %v: it must contain %v or %v", template, timestampToken, uuidToken)
+	}
+	name := renderArtifactName(backup, clusterID, "2006-01-02T15-04-05Z")
+	if len(name) > maxArtifactNameLength {
+		return fmt.Errorf("invalid artifactNameTemplate %v: generated name %v is longer than %v characters", template, name, maxArtifactNameLength)
+	}
+	if !safeArtifactNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid artifactNameTemplate %v: generated name %v can only contain alphanumeric characters, '.', '_' and '-'", template, name)
+	}
+	return nil
+}
+
+func renderArtifactName(backup *v1.Backup, clusterID, timestamp string) string {
+	return strings.NewReplacer(
+		backupNameToken, backup.Name,
+		resourceSetToken, backup.Spec.ResourceSetName,
+		clusterIDToken, clusterID,
+		timestampToken, timestamp,
+		uuidToken, string(uuid.NewUUID()),
+	).Replace(artifactNameTemplate(backup))
+}
+
+// artifactNameRegexp matches the names of all artifacts created for the backup, without the file extension
+func artifactNameRegexp(backup *v1.Backup, clusterID string) string {
+	template := artifactNameTemplate(backup)
+	var pattern strings.Builder
+	lastIndex := 0
+	for _, loc := range artifactNameTokenRegexp.FindAllStringIndex(template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(template[lastIndex:loc[0]]))
+		switch template[loc[0]:loc[1]] {
+		case backupNameToken:
+			pattern.WriteString(regexp.QuoteMeta(backup.Name))
+		case resourceSetToken:
+			pattern.WriteString(regexp.QuoteMeta(backup.Spec.ResourceSetName))
+		case clusterIDToken:
+			pattern.WriteString(regexp.QuoteMeta(clusterID))
+		case timestampToken:
+			pattern.WriteString(artifactTimestampRegexp)
+		case uuidToken:
+			pattern.WriteString(artifactUUIDRegexp)
+		}
+		lastIndex = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[lastIndex:]))
+	return pattern.String()
+}
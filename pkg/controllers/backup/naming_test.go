@@ -0,0 +1,95 @@
+package backup
+
+import (
+	"regexp"
+	"testing"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestArtifactNameRegexp(t *testing.T) {
+	const clusterID = "c1d2e3f4"
+	tests := []struct {
+		name      string
+		template  string
+		matches   []string
+		noMatches []string
+	}{
+		{
+			name:    "default template",
+			matches: []string{"nightly-c1d2e3f4-2020-09-15T21-27-06Z", "nightly-c1d2e3f4-2020-09-15T21-27-06-07-00"},
+			noMatches: []string{
+				"nightly-other-2020-09-15T21-27-06Z",
+				"nightly-weekly-c1d2e3f4-2020-09-15T21-27-06Z",
+				"nightly-c1d2e3f4-2020-09-15",
+			},
+		},
+		{
+			name:      "all tokens",
+			template:  "{resourceSet}.{backup}.{clusterID}.{timestamp}.{uuid}",
+			matches:   []string{"rancher.nightly.c1d2e3f4.2020-09-15T21-27-06Z.0b7e1c2a-4d3f-4e5a-9b8c-7d6e5f4a3b2c"},
+			noMatches: []string{"rancher.nightly.c1d2e3f4.2020-09-15T21-27-06Z.not-a-uuid", "rancherXnightly.c1d2e3f4.2020-09-15T21-27-06Z.0b7e1c2a-4d3f-4e5a-9b8c-7d6e5f4a3b2c"},
+		},
+		{
+			name:      "uuid only",
+			template:  "snapshot-{backup}-{uuid}",
+			matches:   []string{"snapshot-nightly-0b7e1c2a-4d3f-4e5a-9b8c-7d6e5f4a3b2c"},
+			noMatches: []string{"snapshot-nightly-2020-09-15T21-27-06Z", "snapshot-weekly-0b7e1c2a-4d3f-4e5a-9b8c-7d6e5f4a3b2c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backup := &v1.Backup{
+				ObjectMeta: metav1.ObjectMeta{Name: "nightly"},
+				Spec:       v1.BackupSpec{ResourceSetName: "rancher", ArtifactNameTemplate: tt.template},
+			}
+			re := regexp.MustCompile("^" + artifactNameRegexp(backup, clusterID) + "$")
+			for _, name := range tt.matches {
+				if !re.MatchString(name) {
+					t.Errorf("artifactNameRegexp() = %v doesn't match %v", re, name)
+				}
+			}
+			for _, name := range tt.noMatches {
+				if re.MatchString(name) {
+					t.Errorf("artifactNameRegexp() = %v matches %v", re, name)
+				}
+			}
+			if rendered := renderArtifactName(backup, clusterID, "2020-09-15T21-27-06Z"); !re.MatchString(rendered) {
+				t.Errorf("artifactNameRegexp() = %v doesn't match the rendered name %v", re, rendered)
+			}
+		})
+	}
+}
+
+func TestBackupFileRegexpEncryption(t *testing.T) {
+	backup := &v1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "nightly"}}
+	name := "nightly-c1d2e3f4-2020-09-15T21-27-06Z"
+	if re := backupFileRegexp(backup, "c1d2e3f4", false); !re.MatchString(name+".tar.gz") || re.MatchString(name+".tar.gz.enc") {
+		t.Errorf("backupFileRegexp() of an unencrypted backup = %v", re)
+	}
+	if re := backupFileRegexp(backup, "c1d2e3f4", true); !re.MatchString(name+".tar.gz.enc") || re.MatchString(name+".tar.gz") {
+		t.Errorf("backupFileRegexp() of an encrypted backup = %v", re)
+	}
+}
+
+func TestValidateArtifactNameTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		wantErr  bool
+	}{
+		{template: ""},
+		{template: "{backup}-{uuid}"},
+		{template: "{backup}-{timestamp}-{cluster}", wantErr: true},
+		{template: "{backup}", wantErr: true},
+		{template: "{uuid}", wantErr: true},
+		{template: "snapshot-{clusterID}-{timestamp}", wantErr: true},
+		{template: "{backup}/{timestamp}", wantErr: true},
+	}
+	for _, tt := range tests {
+		backup := &v1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "nightly"}, Spec: v1.BackupSpec{ArtifactNameTemplate: tt.template}}
+		if err := validateArtifactNameTemplate(backup, "c1d2e3f4"); (err != nil) != tt.wantErr {
+			t.Errorf("validateArtifactNameTemplate(%q) error = %v, wantErr %v", tt.template, err, tt.wantErr)
+		}
+	}
+}
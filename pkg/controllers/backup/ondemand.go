@@ -0,0 +1,18 @@
+package backup
+
+import (
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+)
+
+// onDemandTriggerAnnotation runs a backup right away when set on a Backup CR, any value works but a timestamp is the
+// usual choice. Each value runs a single backup, set a new one to run again
+const onDemandTriggerAnnotation = "resources.cattle.io/trigger"
+
+// onDemandTrigger returns the value of the trigger annotation if no backup ran for it yet, empty otherwise
+func onDemandTrigger(backup *v1.Backup) string {
+	value := backup.Annotations[onDemandTriggerAnnotation]
+	if value == "" || value == backup.Status.ObservedTrigger {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,47 @@
+package backup
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestOnDemandTrigger(t *testing.T) {
+	backups := newFakeBackups(&v1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "nightly"}, Spec: v1.BackupSpec{ResourceSetName: "rancher"}})
+	h, recorder, _ := newTestHandler(t, backups)
+	completed := []string{eventReasonBackupStarted, eventReasonBackupCompleted}
+
+	if reasons, err := reconcile(t, h, recorder, "nightly"); err != nil || !reflect.DeepEqual(reasons, completed) {
+		t.Fatalf("first run = %v, %v, want %v", reasons, err, completed)
+	}
+	if reasons, err := reconcile(t, h, recorder, "nightly"); err != nil || len(reasons) != 0 {
+		t.Fatalf("completed one-time backup ran again: %v, %v", reasons, err)
+	}
+
+	backup, _ := backups.Get("nightly", metav1.GetOptions{})
+	lastSnapshot := backup.Status.LastSnapshotTS
+	backup.Annotations = map[string]string{onDemandTriggerAnnotation: "2021-05-10T12:00:00Z"}
+	backups.Update(backup)
+	if reasons, err := reconcile(t, h, recorder, "nightly"); err != nil || !reflect.DeepEqual(reasons, completed) {
+		t.Fatalf("run for the trigger = %v, %v, want %v", reasons, err, completed)
+	}
+	backup, _ = backups.Get("nightly", metav1.GetOptions{})
+	if backup.Status.ObservedTrigger != "2021-05-10T12:00:00Z" {
+		t.Errorf("observedTrigger = %q, want the annotation", backup.Status.ObservedTrigger)
+	}
+	if backup.Status.LastOnDemandSnapshotTS == "" || backup.Status.LastOnDemandSnapshotTS != backup.Status.LastSnapshotTS {
+		t.Errorf("lastOnDemandSnapshotTs = %q, want the last snapshot %q", backup.Status.LastOnDemandSnapshotTS, backup.Status.LastSnapshotTS)
+	}
+	if lastSnapshot == "" {
+		t.Errorf("first run didn't set lastSnapshotTs")
+	}
+
+	// the same value doesn't run again, the status update and any later change of the backup are processed too
+	for i := 0; i < 3; i++ {
+		if reasons, err := reconcile(t, h, recorder, "nightly"); err != nil || len(reasons) != 0 {
+			t.Fatalf("trigger ran again on reconcile %v: %v, %v", i, reasons, err)
+		}
+	}
+}
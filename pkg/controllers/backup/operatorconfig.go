@@ -0,0 +1,61 @@
+package backup
+
+import (
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"github.com/sirupsen/logrus"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage/value"
+)
+
+// gatherOperatorConfig collects all Backup and ResourceSet CRs and the encryption config secrets they reference.
+// The secrets are only added if the backup's encryption config has a provider for secrets to wrap them with,
+// restoring the bundle then needs just that one encryption config to be created manually
+func (h *handler) gatherOperatorConfig(backup *v1.Backup, transformerMap map[schema.GroupResource]value.Transformer) (*resourcesets.OperatorConfigBundle, error) {
+	bundle := &resourcesets.OperatorConfigBundle{}
+
+	backups, err := h.backups.List(k8sv1.ListOptions{})
+	if err != nil {
+		return bundle, err
+	}
+	encryptionConfigNames := make(map[string]bool)
+	for _, b := range backups.Items {
+		b.ObjectMeta = resourcesets.CleanObjectMeta(b.ObjectMeta)
+		bundle.Backups = append(bundle.Backups, b)
+		if name := encryptionConfigSecretName(&b); name != "" {
+			encryptionConfigNames[name] = true
+		}
+	}
+
+	resourceSets, err := h.resourceSets.List(k8sv1.ListOptions{})
+	if err != nil {
+		return bundle, err
+	}
+	for _, rs := range resourceSets.Items {
+		rs.ObjectMeta = resourcesets.CleanObjectMeta(rs.ObjectMeta)
+		bundle.ResourceSets = append(bundle.ResourceSets, rs)
+	}
+
+	transformer := transformerMap[resourcesets.SecretsGroupResource]
+	if transformer == nil {
+		if len(encryptionConfigNames) > 0 {
+			logrus.Warnf("Not adding encryption configs to operator config of backup CR %v, its encryption config has no provider for secrets to wrap them with", backup.Name)
+		}
+		return bundle, nil
+	}
+	for name := range encryptionConfigNames {
+		secret, err := h.secrets.Get(util.ChartNamespace, name, k8sv1.GetOptions{})
+		if err != nil {
+			return bundle, err
+		}
+		secret.ObjectMeta = resourcesets.CleanObjectMeta(secret.ObjectMeta)
+		wrapped, err := resourcesets.WrapSecret(secret, transformer)
+		if err != nil {
+			return bundle, err
+		}
+		bundle.EncryptionConfigs = append(bundle.EncryptionConfigs, wrapped)
+	}
+	return bundle, nil
+}
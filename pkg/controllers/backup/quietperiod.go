@@ -0,0 +1,128 @@
+package backup
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/sirupsen/logrus"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	maxQuietPeriodTimeoutSeconds = 600
+	quietPeriodPollInterval      = 5 * time.Second
+)
+
+// workloads whose rollout is checked by the quiet period
+var rolloutResources = map[string]bool{
+	"deployments":  true,
+	"statefulsets": true,
+}
+
+type unsettledWorkload struct {
+	gvr       schema.GroupVersionResource
+	kind      string
+	namespace string
+	name      string
+}
+
+func (w unsettledWorkload) String() string {
+	return fmt.Sprintf("%v %v/%v", w.kind, w.namespace, w.name)
+}
+
+// waitForQuietPeriod waits up to the timeout of the quiet period for the gathered Deployments and StatefulSets to finish
+// rolling out, and gathers the resources again once they did. It returns the workloads still rolling out, the backup
+// is taken anyway and they are recorded as warnings
+func (h *handler) waitForQuietPeriod(backup *v1.Backup, rh *resourcesets.ResourceHandler, resourceSelectors []v1.ResourceSelector) ([]string, error) {
+	unsettled := unsettledWorkloads(rh)
+	timeout := time.Duration(backup.Spec.QuietPeriod.TimeoutSeconds) * time.Second
+	if len(unsettled) == 0 || timeout == 0 {
+		return workloadNames(unsettled), nil
+	}
+
+	logrus.Infof("Waiting up to %v for %v workloads of backup CR %v to finish rolling out", timeout, len(unsettled), backup.Name)
+	deadline := time.Now().Add(timeout)
+	for len(unsettled) > 0 && time.Now().Before(deadline) {
+		select {
+		case <-h.ctx.Done():
+			return nil, h.ctx.Err()
+		case <-time.After(quietPeriodPollInterval):
+		}
+		var stillUnsettled []unsettledWorkload
+		for _, workload := range unsettled {
+			obj, err := h.dynamicClient.Resource(workload.gvr).Namespace(workload.namespace).Get(h.ctx, workload.name, k8sv1.GetOptions{})
+			if err != nil {
+				// a workload deleted in the meantime no longer needs to settle
+				logrus.Debugf("Error getting %v while waiting for it to settle: %v", workload, err)
+				continue
+			}
+			if isRollingOut(*obj) {
+				stillUnsettled = append(stillUnsettled, workload)
+			}
+		}
+		unsettled = stillUnsettled
+	}
+	if len(unsettled) > 0 {
+		return workloadNames(unsettled), nil
+	}
+
+	logrus.Infof("Workloads of backup CR %v settled, gathering resources again", backup.Name)
+	// the checkpointed lists are from before the rollouts settled
+	rh.Checkpoint = nil
+	if err := rh.GatherResources(h.ctx, resourceSelectors); err != nil {
+		return nil, err
+	}
+	return workloadNames(unsettledWorkloads(rh)), nil
+}
+
+func unsettledWorkloads(rh *resourcesets.ResourceHandler) []unsettledWorkload {
+	var unsettled []unsettledWorkload
+	for gvResource, resObjects := range rh.GVResourceToObjects {
+		if gvResource.GroupVersion.Group != "apps" || !rolloutResources[gvResource.Name] {
+			continue
+		}
+		for _, resObj := range resObjects {
+			if !isRollingOut(resObj) {
+				continue
+			}
+			unsettled = append(unsettled, unsettledWorkload{
+				gvr:       gvResource.GroupVersion.WithResource(gvResource.Name),
+				kind:      resObj.GetKind(),
+				namespace: resObj.GetNamespace(),
+				name:      resObj.GetName(),
+			})
+		}
+	}
+	return unsettled
+}
+
+// isRollingOut returns true if the workload controller hasn't observed the latest spec yet, or not all replicas run it
+func isRollingOut(resObj unstructured.Unstructured) bool {
+	observedGeneration, _, _ := unstructured.NestedInt64(resObj.Object, "status", "observedGeneration")
+	if resObj.GetGeneration() != observedGeneration {
+		return true
+	}
+	replicas, found, _ := unstructured.NestedInt64(resObj.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+	updatedReplicas, _, _ := unstructured.NestedInt64(resObj.Object, "status", "updatedReplicas")
+	return updatedReplicas < replicas
+}
+
+func workloadNames(workloads []unsettledWorkload) []string {
+	if len(workloads) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(workloads))
+	for _, workload := range workloads {
+		names = append(names, workload.String())
+	}
+	sort.Strings(names)
+	return names
+}
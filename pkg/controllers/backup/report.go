@@ -0,0 +1,141 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	runReportLabel                 = "resources.cattle.io/backup-report"
+	DefaultRunReportRetentionCount = 10
+)
+
+// runReport is the result of a single run of a backup, written to a ConfigMap if the backup has Spec.RunReport set
+type runReport struct {
+	startTime      time.Time
+	artifactName   string
+	objectCount    int
+	resourceCounts map[string]int
+	failure        error
+	// warnings don't fail the run, like workloads that were rolling out during the backup
+	warnings []string
+	// size and sha256 of the artifact, for its catalog entry
+	artifactSize     int64
+	artifactChecksum string
+	// baseBackup is the full backup an incremental backup derives from, empty for full backups
+	baseBackup string
+}
+
+func newRunReport(backup *v1.Backup, backupFileName string) *runReport {
+	artifactName := backupFileName + ".tar.gz"
+	if encryptionConfigSecretName(backup) != "" {
+		artifactName += ".enc"
+	}
+	return &runReport{
+		startTime:      time.Now(),
+		artifactName:   artifactName,
+		resourceCounts: make(map[string]int),
+	}
+}
+
+// recordArtifact records the size and checksum of the completed artifact, a failure only leaves them out of the catalog
+func (r *runReport) recordArtifact(path string) {
+	size, checksum, err := util.FileChecksum(path)
+	if err != nil {
+		logrus.Warnf("Error computing checksum of backup artifact %v: %v", path, err)
+		return
+	}
+	r.artifactSize = size
+	r.artifactChecksum = checksum
+}
+
+func (r *runReport) addManifest(manifest *resourcesets.Manifest) {
+	for _, entry := range manifest.Entries {
+		r.objectCount++
+		r.resourceCounts[entry.Resource+"."+entry.Group]++
+	}
+}
+
+func (r *runReport) data(completionTime time.Time) map[string]string {
+	phase := "Completed"
+	var failures string
+	if r.failure != nil {
+		phase = "Failed"
+		failures = r.failure.Error()
+	}
+	resourceCounts, _ := json.Marshal(r.resourceCounts)
+	return map[string]string{
+		"phase":          phase,
+		"startTime":      r.startTime.Format(time.RFC3339),
+		"completionTime": completionTime.Format(time.RFC3339),
+		"duration":       completionTime.Sub(r.startTime).Round(time.Second).String(),
+		"artifactName":   r.artifactName,
+		"objectCount":    strconv.Itoa(r.objectCount),
+		"resourceCounts": string(resourceCounts),
+		"failures":       failures,
+		"warnings":       strings.Join(r.warnings, "\n"),
+	}
+}
+
+// writeRunReport creates the report ConfigMap for this run and deletes the oldest ones of the backup beyond the retention count.
+// A report is informational only, so errors are logged instead of failing the backup
+func (h *handler) writeRunReport(backup *v1.Backup, report *runReport, failure error) {
+	if backup.Spec.RunReport == nil {
+		return
+	}
+	report.failure = failure
+	namespace := backup.Spec.RunReport.Namespace
+	if namespace == "" {
+		namespace = util.ChartNamespace
+	}
+	completionTime := time.Now()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: k8sv1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-report-%d", backup.Name, completionTime.Unix()),
+			Namespace: namespace,
+			Labels:    map[string]string{runReportLabel: backup.Name},
+		},
+		Data: report.data(completionTime),
+	}
+	if _, err := h.configMaps.Create(configMap); err != nil {
+		logrus.Errorf("Error writing run report for backup CR %v: %v", backup.Name, err)
+		return
+	}
+	logrus.Infof("Wrote run report %v/%v for backup CR %v", namespace, configMap.Name, backup.Name)
+
+	retentionCount := int(backup.Spec.RunReport.RetentionCount)
+	if retentionCount == 0 {
+		retentionCount = DefaultRunReportRetentionCount
+	}
+	reports, err := h.configMaps.List(namespace, k8sv1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{runReportLabel: backup.Name}).String(),
+	})
+	if err != nil {
+		logrus.Errorf("Error listing run reports for backup CR %v: %v", backup.Name, err)
+		return
+	}
+	if len(reports.Items) <= retentionCount {
+		return
+	}
+	sort.Slice(reports.Items, func(i, j int) bool {
+		return reports.Items[j].CreationTimestamp.Before(&reports.Items[i].CreationTimestamp)
+	})
+	for _, oldReport := range reports.Items[retentionCount:] {
+		logrus.Infof("Deleting run report %v/%v to follow retention policy of max %v reports", namespace, oldReport.Name, retentionCount)
+		if err := h.configMaps.Delete(namespace, oldReport.Name, &k8sv1.DeleteOptions{}); err != nil {
+			logrus.Errorf("Error deleting run report %v/%v: %v", namespace, oldReport.Name, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"github.com/sirupsen/logrus"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const defaultResourceSetConfigMapKey = "resourceset.yaml"
+
+// getResourceSet returns the ResourceSet of the backup, from the ResourceSet CRD or from the backup's ResourceSetSource.
+// A ConfigMap or file can be used when the ResourceSet CRD doesn't exist yet, for example while bootstrapping a cluster
+func (h *handler) getResourceSet(backup *v1.Backup) (*v1.ResourceSet, error) {
+	var resourceSet *v1.ResourceSet
+	source := backup.Spec.ResourceSetSource
+	switch {
+	case source == nil:
+		var err error
+		resourceSet, err = h.resourceSets.Get(backup.Spec.ResourceSetName, k8sv1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+	case source.ConfigMapName != "" && source.File != "":
+		return nil, fmt.Errorf("resourceSetSource can only have one of configMapName and file")
+	case source.ConfigMapName != "":
+		namespace := source.ConfigMapNamespace
+		if namespace == "" {
+			namespace = util.ChartNamespace
+		}
+		key := source.ConfigMapKey
+		if key == "" {
+			key = defaultResourceSetConfigMapKey
+		}
+		logrus.Infof("Reading resourceSet for backup CR %v from key %v of configMap %v/%v", backup.Name, key, namespace, source.ConfigMapName)
+		configMap, err := h.configMaps.Get(namespace, source.ConfigMapName, k8sv1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		data, ok := configMap.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("configMap %v/%v has no key %v", namespace, source.ConfigMapName, key)
+		}
+		if resourceSet, err = decodeResourceSet([]byte(data)); err != nil {
+			return nil, fmt.Errorf("error decoding resourceSet from configMap %v/%v: %v", namespace, source.ConfigMapName, err)
+		}
+	case source.File != "":
+		logrus.Infof("Reading resourceSet for backup CR %v from file %v", backup.Name, source.File)
+		data, err := ioutil.ReadFile(source.File)
+		if err != nil {
+			return nil, err
+		}
+		if resourceSet, err = decodeResourceSet(data); err != nil {
+			return nil, fmt.Errorf("error decoding resourceSet from file %v: %v", source.File, err)
+		}
+	default:
+		return nil, fmt.Errorf("resourceSetSource must have one of configMapName and file")
+	}
+
+	if resourceSet.Name == "" {
+		resourceSet.Name = backup.Spec.ResourceSetName
+	}
+	if err := validateResourceSet(resourceSet); err != nil {
+		return nil, fmt.Errorf("invalid resourceSet %v: %v", resourceSet.Name, err)
+	}
+	return resourceSet, nil
+}
+
+func decodeResourceSet(data []byte) (*v1.ResourceSet, error) {
+	resourceSet := &v1.ResourceSet{}
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), len(data)).Decode(resourceSet); err != nil {
+		return nil, err
+	}
+	return resourceSet, nil
+}
+
+// validateResourceSet checks what the ResourceSet CRD validates, ResourceSets from other sources never went through that,
+// and the regexes and label selectors that would otherwise only fail while gathering resources
+func validateResourceSet(resourceSet *v1.ResourceSet) error {
+	if len(resourceSet.ResourceSelectors) == 0 {
+		return fmt.Errorf("resourceSelectors are required")
+	}
+	for i, selector := range resourceSet.ResourceSelectors {
+		if selector.APIGroupRegexp != "" {
+			if selector.APIVersion != "" {
+				return fmt.Errorf("resourceSelectors[%v] can only have one of apiVersion and apiGroupRegexp", i)
+			}
+			if selector.VersionPolicy == resourcesets.VersionPolicyPinned {
+				return fmt.Errorf("resourceSelectors[%v]: versionPolicy %v needs an apiVersion", i, resourcesets.VersionPolicyPinned)
+			}
+		} else if _, err := resourcesets.NormalizeAPIVersion(selector.APIVersion); err != nil {
+			return fmt.Errorf("resourceSelectors[%v]: %v", i, err)
+		}
+		if err := resourcesets.ValidateVersionPolicy(selector.VersionPolicy); err != nil {
+			return fmt.Errorf("resourceSelectors[%v]: %v", i, err)
+		}
+		for _, field := range []struct{ name, re string }{
+			{"apiGroupRegexp", selector.APIGroupRegexp},
+			{"kindsRegexp", selector.KindsRegexp},
+			{"resourceNameRegexp", selector.ResourceNameRegexp},
+			{"namespaceRegexp", selector.NamespaceRegexp},
+		} {
+			if _, err := regexp.Compile(field.re); err != nil {
+				return fmt.Errorf("resourceSelectors[%v].%v %v is an invalid regexp: %v", i, field.name, field.re, err)
+			}
+		}
+		if selector.LabelSelectors != nil {
+			if _, err := k8sv1.LabelSelectorAsSelector(selector.LabelSelectors); err != nil {
+				return fmt.Errorf("resourceSelector %v has an invalid labelSelector: %v", i, err)
+			}
+		}
+		for _, field := range selector.PruneFields {
+			if err := resourcesets.ValidatePruneField(field); err != nil {
+				return fmt.Errorf("resourceSelectors[%v].pruneFields %v is invalid: %v", i, field, err)
+			}
+		}
+		for _, fieldSelector := range selector.FieldSelectors {
+			if _, err := fields.ParseSelector(fieldSelector); err != nil {
+				return fmt.Errorf("resourceSelector %v has an invalid fieldSelector %v: %v", i, fieldSelector, err)
+			}
+		}
+	}
+	return nil
+}
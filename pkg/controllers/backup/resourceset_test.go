@@ -0,0 +1,26 @@
+package backup
+
+import (
+	"testing"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+)
+
+func TestValidateResourceSetFieldSelectors(t *testing.T) {
+	tests := []struct {
+		fieldSelectors []string
+		wantErr        bool
+	}{
+		{fieldSelectors: []string{"status.phase=Running"}},
+		{fieldSelectors: []string{"status.phase!=Failed", "spec.nodeName=node-1"}},
+		{fieldSelectors: []string{"status.phase==Running,metadata.namespace=default"}},
+		{fieldSelectors: []string{"status.phase"}, wantErr: true},
+		{fieldSelectors: []string{"status.phase=Running", "spec.nodeName"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		resourceSet := &v1.ResourceSet{ResourceSelectors: []v1.ResourceSelector{{APIVersion: "v1", Kinds: []string{"pods"}, FieldSelectors: tt.fieldSelectors}}}
+		if err := validateResourceSet(resourceSet); (err != nil) != tt.wantErr {
+			t.Errorf("validateResourceSet() with field selectors %q error = %v, wantErr %v", tt.fieldSelectors, err, tt.wantErr)
+		}
+	}
+}
@@ -2,8 +2,7 @@ package backup
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
+	"path"
 	"regexp"
 	"sort"
 	"strings"
@@ -20,63 +19,93 @@ type backupInfo struct {
 	creationTimestamp time.Time
 }
 
+// expiredBackups returns the backups beyond the retention count or older than maxAge, a maxAge of 0 doesn't expire backups
+// by age. The newest backup is the one just created, it is never expired
+func expiredBackups(backups []backupInfo, retentionCount int, maxAge time.Duration, now time.Time) []backupInfo {
+	sort.Slice(backups, func(i, j int) bool {
+		return !backups[i].creationTimestamp.Before(backups[j].creationTimestamp)
+	})
+	var expired []backupInfo
+	for i, b := range backups {
+		if i == 0 {
+			continue
+		}
+		if i >= retentionCount || (maxAge > 0 && now.Sub(b.creationTimestamp) > maxAge) {
+			expired = append(expired, b)
+		}
+	}
+	return expired
+}
+
+// retentionMaxAge returns the parsed RetentionMaxAge, it was validated by validateBackupSpec
+func retentionMaxAge(backup *v1.Backup) time.Duration {
+	if backup.Spec.RetentionMaxAge == "" {
+		return 0
+	}
+	maxAge, _ := time.ParseDuration(backup.Spec.RetentionMaxAge)
+	return maxAge
+}
+
 func (h *handler) deleteBackupsFollowingRetentionPolicy(backup *v1.Backup) error {
 	retentionCount := int(backup.Spec.RetentionCount)
 	if backup.Spec.StorageLocation == nil {
 		if h.defaultBackupMountPath != "" {
-			return h.deleteBackupsFromMountPath(retentionCount, h.defaultBackupMountPath, backup.Name, backup.Spec.EncryptionConfigSecretName != "")
+			return h.deleteBackupsFromStorage(backup, retentionCount, objectstore.NewLocalBackend(h.defaultBackupMountPath), encryptionConfigSecretName(backup) != "")
 		} else if h.defaultS3BackupLocation != nil {
 			// not checking for nil, since if this wasn't provided, the default local location would get used
 			s3Client, err := objectstore.GetS3Client(h.ctx, h.defaultS3BackupLocation, h.dynamicClient)
 			if err != nil {
 				return err
 			}
-			return h.deleteS3Backups(backup, h.defaultS3BackupLocation, s3Client, retentionCount, backup.Spec.EncryptionConfigSecretName != "")
+			return h.deleteS3Backups(backup, h.defaultS3BackupLocation, s3Client, retentionCount, encryptionConfigSecretName(backup) != "")
 		}
 	} else if backup.Spec.StorageLocation.S3 != nil {
 		s3Client, err := objectstore.GetS3Client(h.ctx, backup.Spec.StorageLocation.S3, h.dynamicClient)
 		if err != nil {
 			return err
 		}
-		return h.deleteS3Backups(backup, backup.Spec.StorageLocation.S3, s3Client, retentionCount, backup.Spec.EncryptionConfigSecretName != "")
+		return h.deleteS3Backups(backup, backup.Spec.StorageLocation.S3, s3Client, retentionCount, encryptionConfigSecretName(backup) != "")
 	}
 	return nil
 }
 
-func (h *handler) deleteBackupsFromMountPath(retentionCount int, backupLocation, name string, encrypted bool) error {
-	var fileMatchPattern string
-	if encrypted {
-		fileMatchPattern = filepath.Join(backupLocation, fmt.Sprintf("%s-%s*.tar.gz.enc", name, h.kubeSystemNS))
-	} else {
-		fileMatchPattern = filepath.Join(backupLocation, fmt.Sprintf("%s-%s*.tar.gz", name, h.kubeSystemNS))
-	}
-	logrus.Infof("Finding files starting with %v", fileMatchPattern)
-	fileMatches, err := filepath.Glob(fileMatchPattern)
+func (h *handler) deleteBackupsFromStorage(backup *v1.Backup, retentionCount int, storage objectstore.StorageBackend, encrypted bool) error {
+	re := backupFileRegexp(backup, h.kubeSystemNS, encrypted)
+	logrus.Infof("Finding backups matching %v", re.String())
+	keys, err := storage.List("")
 	if err != nil {
 		return err
 	}
-	if len(fileMatches) <= retentionCount {
+	var fileMatches []string
+	for _, key := range keys {
+		if re.MatchString(key) {
+			fileMatches = append(fileMatches, key)
+		}
+	}
+	maxAge := retentionMaxAge(backup)
+	if len(fileMatches) <= retentionCount && maxAge == 0 {
 		return nil
 	}
 	var backupFiles []backupInfo
 	for _, file := range fileMatches {
-		fileInfo, err := os.Stat(file)
+		objectInfo, err := storage.Stat(file)
 		if err != nil {
 			logrus.Errorf("Error getting file information for %v: %v", file, err)
 			continue
 		}
 		b := backupInfo{
-			filename:          fileInfo.Name(),
-			creationTimestamp: fileInfo.ModTime(),
+			filename:          objectInfo.Key,
+			creationTimestamp: objectInfo.LastModified,
 		}
 		backupFiles = append(backupFiles, b)
 	}
-	sort.Slice(backupFiles, func(i, j int) bool {
-		return !backupFiles[i].creationTimestamp.Before(backupFiles[j].creationTimestamp)
-	})
-	for _, file := range backupFiles[retentionCount:] {
-		logrus.Infof("File %v was created at %v, deleting it to follow backup's policy of retaining %v backups", file.filename, file.creationTimestamp, retentionCount)
-		if err := os.Remove(filepath.Join(backupLocation, file.filename)); err != nil {
+	for _, file := range expiredBackups(backupFiles, retentionCount, maxAge, time.Now()) {
+		if isIncrementalBase(backup, file.filename) {
+			logrus.Infof("Keeping file %v, it is the base of the incremental backups of backup CR %v", file.filename, backup.Name)
+			continue
+		}
+		logrus.Infof("File %v was created at %v, deleting it to follow backup's policy of retaining %v backups for at most %v", file.filename, file.creationTimestamp, retentionCount, maxAge)
+		if err := storage.Delete(file.filename); err != nil {
 			return err
 		}
 	}
@@ -98,23 +127,15 @@ func (h *handler) deleteS3Backups(backup *v1.Backup, s3 *v1.S3ObjectStore, svc *
 		isRecursive = true
 	}
 	objectCh := svc.ListObjects(s3.BucketName, prefix, isRecursive, doneCh)
-	// default-backup-([a-z0-9-]).*([tar]).gz
-	// default-test-ecm-backup-24e1b8ce-1f00-4bbe-94bb-248ad7606dc8-([0-9-#]).*tar.gz$ OR
-	// default-test-ecm-backup-24e1b8ce-1f00-4bbe-94bb-248ad7606dc8-([0-9-#]).*tar.gz.enc$
-	var re *regexp.Regexp
-	if encrypted {
-		re = regexp.MustCompile(fmt.Sprintf("%s-%s-([0-9-#]).*tar.gz.enc$", backup.Name, h.kubeSystemNS))
-	} else {
-		re = regexp.MustCompile(fmt.Sprintf("%s-%s-([0-9-#]).*tar.gz$", backup.Name, h.kubeSystemNS))
-	}
+	re := backupFileRegexp(backup, h.kubeSystemNS, encrypted)
 	var backupFiles []backupInfo
 	for object := range objectCh {
 		if object.Err != nil {
 			logrus.Error("error to fetch s3 file:", object.Err)
 			return object.Err
 		}
-		// only parse backup file names that matches backup format
-		if re.MatchString(object.Key) {
+		// only parse backup file names that matches backup format, the folder is not part of the generated name
+		if re.MatchString(path.Base(object.Key)) {
 			filename := object.Key
 
 			if len(s3.Folder) != 0 {
@@ -130,14 +151,16 @@ func (h *handler) deleteS3Backups(backup *v1.Backup, s3 *v1.S3ObjectStore, svc *
 			backupFiles = append(backupFiles, b)
 		}
 	}
-	if len(backupFiles) <= retentionCount {
+	maxAge := retentionMaxAge(backup)
+	if len(backupFiles) <= retentionCount && maxAge == 0 {
 		return nil
 	}
-	sort.Slice(backupFiles, func(i, j int) bool {
-		return !backupFiles[i].creationTimestamp.Before(backupFiles[j].creationTimestamp)
-	})
-	for _, backupFile := range backupFiles[retentionCount:] {
-		logrus.Infof("Deleting s3 backup file [%s] to follow retention policy of max %v backups", backupFile.filename, retentionCount)
+	for _, backupFile := range expiredBackups(backupFiles, retentionCount, maxAge, time.Now()) {
+		if isIncrementalBase(backup, backupFile.filename) {
+			logrus.Infof("Keeping s3 backup file [%s], it is the base of the incremental backups of backup CR %v", backupFile.filename, backup.Name)
+			continue
+		}
+		logrus.Infof("Deleting s3 backup file [%s] to follow retention policy of max %v backups for at most %v", backupFile.filename, retentionCount, maxAge)
 		err := svc.RemoveObject(s3.BucketName, backupFile.filename)
 		if err != nil {
 			logrus.Errorf("Error detected during deletion: %v", err)
@@ -147,3 +170,13 @@ func (h *handler) deleteS3Backups(backup *v1.Backup, s3 *v1.S3ObjectStore, svc *
 	}
 	return nil
 }
+
+// backupFileRegexp matches the backup files created for this backup CR with its current ArtifactNameTemplate
+// example with the default template: ^default-test-ecm-backup-24e1b8ce-1f00-4bbe-94bb-248ad7606dc8-<timestamp>\.tar\.gz$
+func backupFileRegexp(backup *v1.Backup, clusterID string, encrypted bool) *regexp.Regexp {
+	suffix := `\.tar\.gz$`
+	if encrypted {
+		suffix = `\.tar\.gz\.enc$`
+	}
+	return regexp.MustCompile("^" + artifactNameRegexp(backup, clusterID) + suffix)
+}
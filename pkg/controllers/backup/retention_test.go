@@ -0,0 +1,114 @@
+package backup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/objectstore"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExpiredBackups(t *testing.T) {
+	now := time.Date(2021, 5, 10, 12, 0, 0, 0, time.UTC)
+	backup := func(name string, age time.Duration) backupInfo {
+		return backupInfo{filename: name, creationTimestamp: now.Add(-age)}
+	}
+	tests := []struct {
+		name           string
+		backups        []backupInfo
+		retentionCount int
+		maxAge         time.Duration
+		want           []string
+	}{
+		{
+			name:           "beyond the retention count",
+			backups:        []backupInfo{backup("b", 2*time.Hour), backup("a", 3*time.Hour), backup("d", 0), backup("c", time.Hour)},
+			retentionCount: 2,
+			want:           []string{"b", "a"},
+		},
+		{
+			name:           "within the retention count",
+			backups:        []backupInfo{backup("a", time.Hour), backup("b", 0)},
+			retentionCount: 2,
+		},
+		{
+			name:           "older than the max age",
+			backups:        []backupInfo{backup("a", 48*time.Hour), backup("b", 12*time.Hour), backup("c", 0)},
+			retentionCount: 10,
+			maxAge:         24 * time.Hour,
+			want:           []string{"a"},
+		},
+		{
+			name:           "count and max age together",
+			backups:        []backupInfo{backup("a", 48*time.Hour), backup("b", 2*time.Hour), backup("c", time.Hour), backup("d", 0)},
+			retentionCount: 2,
+			maxAge:         24 * time.Hour,
+			want:           []string{"b", "a"},
+		},
+		{
+			name:           "the newest backup is never expired",
+			backups:        []backupInfo{backup("a", 48*time.Hour)},
+			retentionCount: 1,
+			maxAge:         time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, b := range expiredBackups(tt.backups, tt.retentionCount, tt.maxAge, now) {
+				got = append(got, b.filename)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expiredBackups() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteBackupsFromStorageSharedLocation(t *testing.T) {
+	const clusterID = "c1d2e3f4"
+	dir := t.TempDir()
+	now := time.Now()
+	files := map[string]time.Duration{
+		"nightly-c1d2e3f4-2020-09-15T21-27-06Z.tar.gz":        3 * time.Hour,
+		"nightly-c1d2e3f4-2020-09-16T21-27-06Z.tar.gz":        2 * time.Hour,
+		"nightly-c1d2e3f4-2020-09-17T21-27-06Z.tar.gz":        time.Hour,
+		"nightly-weekly-c1d2e3f4-2020-09-14T21-27-06Z.tar.gz": 4 * time.Hour,
+		"nightly-weekly-c1d2e3f4-2020-09-15T21-27-06Z.tar.gz": 3 * time.Hour,
+		"weekly-nightly-c1d2e3f4-2020-09-15T21-27-06Z.tar.gz": 3 * time.Hour,
+	}
+	for name, age := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := &handler{kubeSystemNS: clusterID}
+	nightly := &v1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "nightly"}, Spec: v1.BackupSpec{RetentionCount: 1}}
+	if err := h.deleteBackupsFromStorage(nightly, 1, objectstore.NewLocalBackend(dir), false); err != nil {
+		t.Fatalf("deleteBackupsFromStorage() error: %v", err)
+	}
+
+	got, err := objectstore.NewLocalBackend(dir).List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"nightly-c1d2e3f4-2020-09-17T21-27-06Z.tar.gz",
+		"nightly-weekly-c1d2e3f4-2020-09-14T21-27-06Z.tar.gz",
+		"nightly-weekly-c1d2e3f4-2020-09-15T21-27-06Z.tar.gz",
+		"weekly-nightly-c1d2e3f4-2020-09-15T21-27-06Z.tar.gz",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("files left after the retention of backup nightly = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,27 @@
+package backup
+
+import (
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/robfig/cron"
+)
+
+// untilNextSnapshot returns the time left until the next run of a recurring backup, 0 if it's due
+func untilNextSnapshot(backup *v1.Backup, now time.Time) (time.Duration, error) {
+	nextSnapshotTime, err := time.Parse(time.RFC3339, backup.Status.NextSnapshotAt)
+	if err != nil {
+		return 0, err
+	}
+	if nextSnapshotTime.After(now) {
+		return nextSnapshotTime.Sub(now), nil
+	}
+	return 0, nil
+}
+
+// scheduleNextSnapshot sets the time of the next run of a recurring backup that ran at now, and returns the delay until then
+func scheduleNextSnapshot(backup *v1.Backup, schedule cron.Schedule, now time.Time) time.Duration {
+	nextBackupAt := schedule.Next(now)
+	backup.Status.NextSnapshotAt = nextBackupAt.Format(time.RFC3339)
+	return nextBackupAt.Sub(now)
+}
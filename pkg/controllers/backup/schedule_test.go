@@ -0,0 +1,48 @@
+package backup
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/robfig/cron"
+)
+
+func TestScheduledBackupRuns(t *testing.T) {
+	schedule, err := cron.ParseStandard("*/30 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Date(2021, 5, 10, 10, 7, 0, 0, time.UTC)
+	backup := &v1.Backup{Spec: v1.BackupSpec{Schedule: "*/30 * * * *"}}
+	var runs []time.Time
+	for len(runs) < 3 {
+		if backup.Status.LastSnapshotTS != "" {
+			// a status update wakes the backup up before its next run, it must only be enqueued again
+			early := clock.Add(-time.Minute)
+			if after, err := untilNextSnapshot(backup, early); err != nil || after != time.Minute {
+				t.Fatalf("untilNextSnapshot() a minute before the next run = %v, %v, want 1m0s", after, err)
+			}
+			if after, err := untilNextSnapshot(backup, clock); err != nil || after != 0 {
+				t.Fatalf("untilNextSnapshot() at the next run = %v, %v, want 0s", after, err)
+			}
+		}
+		runs = append(runs, clock)
+		backup.Status.LastSnapshotTS = clock.Format(time.RFC3339)
+		// the backup is enqueued after the returned delay, so the fake clock advances by it
+		clock = clock.Add(scheduleNextSnapshot(backup, schedule, clock))
+	}
+
+	want := []time.Time{
+		time.Date(2021, 5, 10, 10, 7, 0, 0, time.UTC),
+		time.Date(2021, 5, 10, 10, 30, 0, 0, time.UTC),
+		time.Date(2021, 5, 10, 11, 0, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(runs, want) {
+		t.Fatalf("scheduled backup ran at %v, want %v", runs, want)
+	}
+	if interval := runs[2].Sub(runs[1]); interval != 30*time.Minute {
+		t.Errorf("interval between scheduled runs = %v, want 30m0s", interval)
+	}
+}
@@ -0,0 +1,117 @@
+package backup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/objectstore"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"github.com/sirupsen/logrus"
+)
+
+// streamedArtifact is the destination of a backup with StreamArtifact. Backups on the PV are written in place,
+// backups for S3 are written to a temp dir and uploaded once complete
+type streamedArtifact struct {
+	writer      *resourcesets.ArtifactWriter
+	path        string
+	tmpDir      string
+	objectStore *v1.S3ObjectStore
+	objectName  string
+	done        bool
+}
+
+func (h *handler) newStreamedArtifact(backup *v1.Backup, gzipFile string) (*streamedArtifact, error) {
+	artifact := &streamedArtifact{}
+	storageLocation := backup.Spec.StorageLocation
+	if storageLocation == nil {
+		if h.defaultBackupMountPath != "" {
+			artifact.path = filepath.Join(h.defaultBackupMountPath, gzipFile)
+		} else if h.defaultS3BackupLocation != nil {
+			artifact.objectStore = h.defaultS3BackupLocation
+		} else {
+			return nil, fmt.Errorf("backup %v needs to specify S3 details, or configure storage location at the operator level", backup.Name)
+		}
+	} else if storageLocation.S3 != nil {
+		artifact.objectStore = storageLocation.S3
+	} else {
+		return nil, fmt.Errorf("backup %v needs to specify S3 details in its storage location", backup.Name)
+	}
+
+	if artifact.objectStore != nil {
+		tmpDir, err := ioutil.TempDir("", tmpUploadDirPrefix)
+		if err != nil {
+			return nil, err
+		}
+		artifact.tmpDir = tmpDir
+		artifact.path = filepath.Join(tmpDir, gzipFile)
+		artifact.objectName = gzipFile
+		if artifact.objectStore.Folder != "" {
+			// we need to avoid both "//" inside the path and all leading and trailing "/"
+			artifact.objectName = strings.Trim(fmt.Sprintf("%s/%s", strings.TrimRight(artifact.objectStore.Folder, "/"), gzipFile), "/")
+		}
+	}
+
+	logrus.Infof("Streaming backup CR %v into %v", backup.Name, artifact.path)
+	writer, err := resourcesets.NewArtifactWriter(partialArtifactPath(artifact.path))
+	if err != nil {
+		artifact.cleanup()
+		return nil, err
+	}
+	writer.Reproducible = backup.Spec.ReproducibleArtifact
+	artifact.writer = writer
+	return artifact, nil
+}
+
+// finish completes the artifact and uploads it if it's for S3
+func (a *streamedArtifact) finish(h *handler, backup *v1.Backup, report *runReport) error {
+	if err := a.writer.Close(); err != nil {
+		return fmt.Errorf("error completing backup tar gzip file: %v", err)
+	}
+	if err := completeArtifact(a.path); err != nil {
+		return err
+	}
+	report.recordArtifact(a.path)
+	if a.objectStore == nil {
+		if err := setArtifactFileMode(backup, a.path); err != nil {
+			return err
+		}
+		backup.Status.StorageLocation = util.PVBackup
+		a.done = true
+		return nil
+	}
+	s3Client, err := objectstore.GetS3Client(h.ctx, a.objectStore, h.dynamicClient)
+	if err != nil {
+		return err
+	}
+	sse, err := objectstore.ServerSideEncryption(a.objectStore)
+	if err != nil {
+		return err
+	}
+	if err := objectstore.UploadBackupFile(s3Client, a.objectStore.BucketName, a.objectName, a.path, sse); err != nil {
+		return err
+	}
+	backup.Status.StorageLocation = util.S3Backup
+	backup.Status.ServerSideEncryption = a.objectStore.ServerSideEncryption
+	a.done = true
+	return nil
+}
+
+// cleanup removes the temp dir of S3 backups, and the incomplete artifact of a failed backup
+func (a *streamedArtifact) cleanup() {
+	if !a.done {
+		if a.writer != nil {
+			a.writer.Close()
+		}
+		if a.path != "" {
+			os.Remove(partialArtifactPath(a.path))
+		}
+	}
+	if a.tmpDir != "" {
+		os.RemoveAll(a.tmpDir)
+	}
+}
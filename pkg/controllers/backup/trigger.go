@@ -0,0 +1,158 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+const defaultTriggerDebounceSeconds = 30
+
+// triggers runs the informers for the Backup CRs with a Trigger. A change marks the backup as pending once the debounce
+// period passed without further changes, and enqueues it so OnBackupChange runs it
+type triggers struct {
+	sync.Mutex
+	running map[string]*trigger
+	// pendingSeq counts the changes of every backup since its last triggered run completed
+	pendingSeq map[string]int
+}
+
+type trigger struct {
+	spec     string
+	started  time.Time
+	stopCh   chan struct{}
+	debounce *time.Timer
+}
+
+func newTriggers() *triggers {
+	return &triggers{
+		running:    make(map[string]*trigger),
+		pendingSeq: make(map[string]int),
+	}
+}
+
+// ensure starts the informers for the backup's trigger, restarting them if the trigger changed, and stops them if it was removed
+func (t *triggers) ensure(h *handler, backup *v1.Backup) error {
+	if backup.Spec.Trigger == nil {
+		t.stop(backup.Name)
+		return nil
+	}
+	specBytes, err := json.Marshal(backup.Spec.Trigger)
+	if err != nil {
+		return err
+	}
+	t.Lock()
+	running, ok := t.running[backup.Name]
+	t.Unlock()
+	if ok && running.spec == string(specBytes) {
+		return nil
+	}
+	t.stop(backup.Name)
+
+	debounce := time.Duration(backup.Spec.Trigger.DebounceSeconds) * time.Second
+	if debounce <= 0 {
+		debounce = defaultTriggerDebounceSeconds * time.Second
+	}
+	tr := &trigger{spec: string(specBytes), started: time.Now(), stopCh: make(chan struct{})}
+	name := backup.Name
+	tr.debounce = time.AfterFunc(debounce, func() {
+		t.Lock()
+		t.pendingSeq[name]++
+		t.Unlock()
+		logrus.Infof("Objects watched by the trigger of backup CR %v changed, running backup", name)
+		h.backups.Enqueue(name)
+	})
+	tr.debounce.Stop()
+	onChange := func() { tr.debounce.Reset(debounce) }
+
+	for _, resource := range backup.Spec.Trigger.Resources {
+		gvr, err := h.triggerResource(resource)
+		if err != nil {
+			close(tr.stopCh)
+			return err
+		}
+		informer := dynamicinformer.NewFilteredDynamicInformer(h.dynamicClient, gvr, resource.Namespace, 0, cache.Indexers{}, nil)
+		informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				// the initial list adds every existing object, these are no changes
+				if u, ok := obj.(*unstructured.Unstructured); ok && u.GetCreationTimestamp().Time.Before(tr.started) {
+					return
+				}
+				onChange()
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldU, oldOk := oldObj.(*unstructured.Unstructured)
+				newU, newOk := newObj.(*unstructured.Unstructured)
+				if oldOk && newOk && oldU.GetResourceVersion() == newU.GetResourceVersion() {
+					return
+				}
+				onChange()
+			},
+			DeleteFunc: func(obj interface{}) { onChange() },
+		})
+		go informer.Informer().Run(tr.stopCh)
+	}
+	logrus.Infof("Watching %v resources to trigger backup CR %v", len(backup.Spec.Trigger.Resources), backup.Name)
+
+	t.Lock()
+	t.running[backup.Name] = tr
+	t.Unlock()
+	return nil
+}
+
+func (t *triggers) stop(name string) {
+	t.Lock()
+	defer t.Unlock()
+	tr, ok := t.running[name]
+	if !ok {
+		return
+	}
+	tr.debounce.Stop()
+	close(tr.stopCh)
+	delete(t.running, name)
+}
+
+// pending returns true if the trigger of the backup fired since its last triggered run, along with the change count
+// to pass to done once the backup completed
+func (t *triggers) pending(name string) (bool, int) {
+	t.Lock()
+	defer t.Unlock()
+	seq := t.pendingSeq[name]
+	return seq > 0, seq
+}
+
+// done clears the pending backup, unless the trigger fired again while it was running
+func (t *triggers) done(name string, seq int) {
+	t.Lock()
+	defer t.Unlock()
+	if t.pendingSeq[name] == seq {
+		delete(t.pendingSeq, name)
+	}
+}
+
+func (h *handler) triggerResource(resource v1.TriggerResource) (schema.GroupVersionResource, error) {
+	gv, err := schema.ParseGroupVersion(resource.APIVersion)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	resources, err := h.discoveryClient.ServerResourcesForGroupVersion(resource.APIVersion)
+	if err != nil {
+		return schema.GroupVersionResource{}, fmt.Errorf("error getting resources of trigger apiVersion %v: %v", resource.APIVersion, err)
+	}
+	for _, res := range resources.APIResources {
+		// subresources like pods/status share the kind of their resource
+		if res.Kind == resource.Kind && !strings.Contains(res.Name, "/") {
+			return gv.WithResource(res.Name), nil
+		}
+	}
+	return schema.GroupVersionResource{}, fmt.Errorf("no resource found for trigger kind %v in apiVersion %v", resource.Kind, resource.APIVersion)
+}
@@ -9,51 +9,68 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
 	"github.com/rancher/backup-restore-operator/pkg/objectstore"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/rancher/backup-restore-operator/pkg/util"
 	"github.com/sirupsen/logrus"
 )
 
-func (h *handler) uploadToS3(backup *v1.Backup, objectStore *v1.S3ObjectStore, tmpBackupPath, gzipFile string) error {
-	tmpBackupGzipFilepath, err := ioutil.TempDir("", "uploadpath")
+func (h *handler) uploadToS3(backup *v1.Backup, objectStore *v1.S3ObjectStore, tmpBackupPath, gzipFile string, report *runReport) error {
+	tmpBackupGzipFilepath, err := ioutil.TempDir("", tmpUploadDirPrefix)
 	if err != nil {
 		return err
 	}
 	if objectStore.Folder != "" {
-		if err := os.MkdirAll(filepath.Join(tmpBackupGzipFilepath, objectStore.Folder), os.ModePerm); err != nil {
+		if err := os.MkdirAll(filepath.Join(tmpBackupGzipFilepath, objectStore.Folder), util.BackupDirMode); err != nil {
 			return removeTempUploadDir(tmpBackupGzipFilepath, err)
 		}
 		// we need to avoid both "//" inside the path and all leading and trailing "/"
 		gzipFile = fmt.Sprintf("%s/%s", strings.TrimRight(objectStore.Folder, "/"), gzipFile)
 		gzipFile = strings.Trim(gzipFile, "/")
 	}
-	if err := CreateTarAndGzip(tmpBackupPath, tmpBackupGzipFilepath, gzipFile, backup.Name); err != nil {
+	if err := CreateTarAndGzip(tmpBackupPath, objectstore.NewLocalBackend(tmpBackupGzipFilepath), gzipFile, backup.Name, backup.Spec.ReproducibleArtifact); err != nil {
 		return removeTempUploadDir(tmpBackupGzipFilepath, err)
 	}
+	report.recordArtifact(filepath.Join(tmpBackupGzipFilepath, gzipFile))
 	s3Client, err := objectstore.GetS3Client(h.ctx, objectStore, h.dynamicClient)
 	if err != nil {
 		return removeTempUploadDir(tmpBackupGzipFilepath, err)
 	}
-	if err := objectstore.UploadBackupFile(s3Client, objectStore.BucketName, gzipFile, filepath.Join(tmpBackupGzipFilepath, gzipFile)); err != nil {
+	sse, err := objectstore.ServerSideEncryption(objectStore)
+	if err != nil {
+		return removeTempUploadDir(tmpBackupGzipFilepath, err)
+	}
+	if err := objectstore.UploadBackupFile(s3Client, objectStore.BucketName, gzipFile, filepath.Join(tmpBackupGzipFilepath, gzipFile), sse); err != nil {
 		return removeTempUploadDir(tmpBackupGzipFilepath, err)
 	}
+	backup.Status.ServerSideEncryption = objectStore.ServerSideEncryption
 	return os.RemoveAll(tmpBackupGzipFilepath)
 }
 
-func CreateTarAndGzip(backupPath, targetGzipPath, targetGzipFile, backupCRName string) error {
+// CreateTarAndGzip compresses the backup dir into key of the storage, reproducible artifacts have the same time and owner
+// on every header
+func CreateTarAndGzip(backupPath string, storage objectstore.StorageBackend, key, backupCRName string, reproducible bool) error {
 	logrus.Infof("Compressing backup CR %v", backupCRName)
-	gzipFile, err := os.Create(filepath.Join(targetGzipPath, targetGzipFile))
-	if err != nil {
-		return fmt.Errorf("error creating backup tar gzip file: %v", err)
-	}
-	// writes to gw will be compressed and written to gzipFile
-	gw := gzip.NewWriter(gzipFile)
-	defer gw.Close()
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTarGzip(backupPath, pw, reproducible))
+	}()
+	err := storage.Put(key, pr)
+	// unblocks writeTarGzip if Put returned before reading everything
+	pr.Close()
+	return err
+}
+
+func writeTarGzip(backupPath string, out io.Writer, reproducible bool) error {
+	// writes to gw will be compressed and written to out
+	gw := gzip.NewWriter(out)
 	// writes to tw will be written to gw
 	tw := tar.NewWriter(gw)
-	defer tw.Close()
 
 	walkFunc := func(currPath string, info os.FileInfo, err error) error {
 		if currPath == backupPath {
@@ -73,6 +90,12 @@ func CreateTarAndGzip(backupPath, targetGzipPath, targetGzipFile, backupCRName s
 			return fmt.Errorf("error getting relative path for %v: %v", info.Name(), err)
 		}
 		hdr.Name = filepath.Join(relativePath)
+		if reproducible {
+			hdr.ModTime = resourcesets.ReproducibleModTime
+			hdr.AccessTime = time.Time{}
+			hdr.ChangeTime = time.Time{}
+			hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		}
 		if err := tw.WriteHeader(hdr); err != nil {
 			return fmt.Errorf("error writing header for %v: %v", info.Name(), err)
 		}
@@ -88,7 +111,53 @@ func CreateTarAndGzip(backupPath, targetGzipPath, targetGzipFile, backupCRName s
 		}
 		return fInfo.Close()
 	}
-	return filepath.Walk(backupPath, walkFunc)
+	if err := filepath.Walk(backupPath, walkFunc); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// partialArtifactPath is where a streamed artifact is written until it's complete, like the files of a LocalBackend
+func partialArtifactPath(artifactPath string) string {
+	return artifactPath + objectstore.PartialFileSuffix
+}
+
+// completeArtifact renames the partial artifact to its final name
+func completeArtifact(artifactPath string) error {
+	if err := os.Rename(partialArtifactPath(artifactPath), artifactPath); err != nil {
+		return fmt.Errorf("error completing backup tar gzip file: %v", err)
+	}
+	return nil
+}
+
+// artifactFileMode returns the permission of the backup file on the persistent volume, util.BackupFileMode by default
+func artifactFileMode(backup *v1.Backup) (os.FileMode, error) {
+	if backup.Spec.FileMode == "" {
+		return util.BackupFileMode, nil
+	}
+	mode, err := strconv.ParseUint(backup.Spec.FileMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid fileMode %v, must be octal permissions like 0640", backup.Spec.FileMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// setArtifactFileMode applies the fileMode of the backup, the file is created with util.BackupFileMode
+func setArtifactFileMode(backup *v1.Backup, artifactPath string) error {
+	if backup.Spec.FileMode == "" {
+		return nil
+	}
+	mode, err := artifactFileMode(backup)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(artifactPath, mode); err != nil {
+		return fmt.Errorf("error setting fileMode of backup file %v: %v", artifactPath, err)
+	}
+	return nil
 }
 
 func removeTempUploadDir(tmpBackupGzipFilepath string, originalErr error) error {
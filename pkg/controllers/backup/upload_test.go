@@ -0,0 +1,68 @@
+package backup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/objectstore"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+)
+
+func TestArtifactFileMode(t *testing.T) {
+	tests := []struct {
+		fileMode string
+		want     os.FileMode
+		wantErr  bool
+	}{
+		{fileMode: "", want: util.BackupFileMode},
+		{fileMode: "0640", want: 0640},
+		{fileMode: "600", want: 0600},
+		{fileMode: "0800", wantErr: true},
+		{fileMode: "01777", wantErr: true},
+		{fileMode: "rw-r-----", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := artifactFileMode(&v1.Backup{Spec: v1.BackupSpec{FileMode: tt.fileMode}})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("artifactFileMode(%q) error = %v, wantErr %v", tt.fileMode, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("artifactFileMode(%q) = %v, want %v", tt.fileMode, got, tt.want)
+		}
+	}
+}
+
+func TestArtifactPermissions(t *testing.T) {
+	backupPath := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(backupPath, "secrets.#v1"), util.BackupDirMode); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(backupPath, "secrets.#v1", "creds.json"), []byte(`{"kind":"Secret"}`), util.BackupFileMode); err != nil {
+		t.Fatal(err)
+	}
+	for _, fileMode := range []string{"", "0640"} {
+		t.Run("fileMode="+fileMode, func(t *testing.T) {
+			backup := &v1.Backup{Spec: v1.BackupSpec{FileMode: fileMode}}
+			dir := t.TempDir()
+			const key = "nightly-c1d2e3f4-2020-09-15T21-27-06Z.tar.gz"
+			if err := CreateTarAndGzip(backupPath, objectstore.NewLocalBackend(dir), key, "nightly", false); err != nil {
+				t.Fatalf("CreateTarAndGzip() error: %v", err)
+			}
+			if err := setArtifactFileMode(backup, filepath.Join(dir, key)); err != nil {
+				t.Fatalf("setArtifactFileMode() error: %v", err)
+			}
+			info, err := os.Stat(filepath.Join(dir, key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := artifactFileMode(backup)
+			if info.Mode().Perm() != want {
+				t.Errorf("backup file has permissions %v, want %v", info.Mode().Perm(), want)
+			}
+		})
+	}
+}
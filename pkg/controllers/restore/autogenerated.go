@@ -0,0 +1,70 @@
+package restore
+
+import (
+	"fmt"
+	"regexp"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// defaultAutoGeneratedObjects are created by kubernetes itself, restoring them would bring back data of the old cluster
+var defaultAutoGeneratedObjects = []v1.AutoGeneratedObject{
+	// the CA bundle published into every namespace by the root-ca-cert-publisher controller
+	{Kind: "ConfigMap", NameRegexp: `^kube-root-ca\.crt$`},
+	// endpointslices of services are managed by the endpointslice controller
+	{Kind: "EndpointSlice", OwnerKind: "Service"},
+}
+
+// removeAutoGeneratedObjects drops auto-generated objects from the objects to restore. They are still part of the backup,
+// so they don't get pruned either
+func removeAutoGeneratedObjects(objFromBackupCR ObjectsFromBackupCR, autoGeneratedObjects []v1.AutoGeneratedObject) error {
+	matchers := append(defaultAutoGeneratedObjects, autoGeneratedObjects...)
+	nameRegexps := make(map[string]*regexp.Regexp)
+	for _, matcher := range matchers {
+		if matcher.NameRegexp == "" {
+			continue
+		}
+		re, err := regexp.Compile(matcher.NameRegexp)
+		if err != nil {
+			return fmt.Errorf("invalid nameRegexp %v for auto-generated %v objects: %v", matcher.NameRegexp, matcher.Kind, err)
+		}
+		nameRegexps[matcher.NameRegexp] = re
+	}
+
+	for _, resourceInfoToData := range []map[objInfo]unstructured.Unstructured{objFromBackupCR.clusterscopedResourceInfoToData, objFromBackupCR.namespacedResourceInfoToData} {
+		for info, data := range resourceInfoToData {
+			for _, matcher := range matchers {
+				if isAutoGenerated(data, matcher, nameRegexps[matcher.NameRegexp]) {
+					logrus.Infof("Skip restoring auto-generated %v %v", data.GetKind(), info.ConfigPath)
+					delete(resourceInfoToData, info)
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func isAutoGenerated(obj unstructured.Unstructured, matcher v1.AutoGeneratedObject, nameRegexp *regexp.Regexp) bool {
+	if obj.GetKind() != matcher.Kind {
+		return false
+	}
+	if matcher.NameRegexp == "" && matcher.OwnerKind == "" {
+		// a kind alone would skip every object of that kind
+		return false
+	}
+	if nameRegexp != nil && !nameRegexp.MatchString(obj.GetName()) {
+		return false
+	}
+	if matcher.OwnerKind != "" {
+		for _, owner := range obj.GetOwnerReferences() {
+			if owner.Kind == matcher.OwnerKind {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package restore
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func testAutoGeneratedObject(kind, name, ownerKind string) unstructured.Unstructured {
+	obj := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": kind}}
+	obj.SetNamespace("team-a")
+	obj.SetName(name)
+	if ownerKind != "" {
+		obj.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "v1", Kind: ownerKind, Name: "owner", UID: "1234"}})
+	}
+	return obj
+}
+
+func TestIsAutoGenerated(t *testing.T) {
+	tests := []struct {
+		obj     unstructured.Unstructured
+		matcher v1.AutoGeneratedObject
+		want    bool
+	}{
+		{obj: testAutoGeneratedObject("ConfigMap", "kube-root-ca.crt", ""), matcher: defaultAutoGeneratedObjects[0], want: true},
+		{obj: testAutoGeneratedObject("ConfigMap", "kube-root-ca.crt.bak", ""), matcher: defaultAutoGeneratedObjects[0]},
+		{obj: testAutoGeneratedObject("ConfigMap", "my-kube-root-ca.crt", ""), matcher: defaultAutoGeneratedObjects[0]},
+		{obj: testAutoGeneratedObject("ConfigMap", "kube-root-caXcrt", ""), matcher: defaultAutoGeneratedObjects[0]},
+		{obj: testAutoGeneratedObject("Secret", "kube-root-ca.crt", ""), matcher: defaultAutoGeneratedObjects[0]},
+		{obj: testAutoGeneratedObject("EndpointSlice", "web-x7k2p", "Service"), matcher: defaultAutoGeneratedObjects[1], want: true},
+		{obj: testAutoGeneratedObject("EndpointSlice", "web-static", ""), matcher: defaultAutoGeneratedObjects[1]},
+		{obj: testAutoGeneratedObject("EndpointSlice", "web-x7k2p", "Deployment"), matcher: defaultAutoGeneratedObjects[1]},
+		{
+			obj:     testAutoGeneratedObject("Secret", "sh.helm.release.v1.web.v1", "Deployment"),
+			matcher: v1.AutoGeneratedObject{Kind: "Secret", NameRegexp: `^sh\.helm\.`, OwnerKind: "Deployment"},
+			want:    true,
+		},
+		{
+			obj:     testAutoGeneratedObject("Secret", "sh.helm.release.v1.web.v1", ""),
+			matcher: v1.AutoGeneratedObject{Kind: "Secret", NameRegexp: `^sh\.helm\.`, OwnerKind: "Deployment"},
+		},
+		{obj: testAutoGeneratedObject("Secret", "token", ""), matcher: v1.AutoGeneratedObject{Kind: "Secret"}},
+	}
+	for _, tt := range tests {
+		var nameRegexp *regexp.Regexp
+		if tt.matcher.NameRegexp != "" {
+			nameRegexp = regexp.MustCompile(tt.matcher.NameRegexp)
+		}
+		if got := isAutoGenerated(tt.obj, tt.matcher, nameRegexp); got != tt.want {
+			t.Errorf("isAutoGenerated(%v %v owned by %v, %+v) = %v, want %v", tt.obj.GetKind(), tt.obj.GetName(),
+				tt.obj.GetOwnerReferences(), tt.matcher, got, tt.want)
+		}
+	}
+}
+
+func TestRemoveAutoGeneratedObjects(t *testing.T) {
+	endpointSlicesGVR := schema.GroupVersionResource{Group: "discovery.k8s.io", Version: "v1", Resource: "endpointslices"}
+	cr := testObjectsFromBackup([]string{"team-a/kube-root-ca.crt", "team-a/settings", "team-b/kube-root-ca.crt"}, []string{"team-a"})
+	for _, obj := range []unstructured.Unstructured{
+		testAutoGeneratedObject("EndpointSlice", "web-x7k2p", "Service"),
+		testAutoGeneratedObject("EndpointSlice", "web-static", ""),
+		testAutoGeneratedObject("Secret", "sh.helm.release.v1.web.v1", ""),
+	} {
+		gvr := endpointSlicesGVR
+		if obj.GetKind() == "Secret" {
+			gvr = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+		}
+		info := objInfo{Name: obj.GetName(), Namespace: obj.GetNamespace(), GVR: gvr, ConfigPath: gvr.Resource + "/" + obj.GetName()}
+		cr.namespacedResourceInfoToData[info] = obj
+	}
+	for info := range cr.namespacedResourceInfoToData {
+		cr.resourcesFromBackup[info.ConfigPath] = true
+	}
+	inBackup := len(cr.resourcesFromBackup)
+
+	custom := []v1.AutoGeneratedObject{{Kind: "Secret", NameRegexp: `^sh\.helm\.release\.`}}
+	if err := removeAutoGeneratedObjects(cr, custom); err != nil {
+		t.Fatalf("removeAutoGeneratedObjects() error: %v", err)
+	}
+	var restored []string
+	for info := range cr.namespacedResourceInfoToData {
+		restored = append(restored, info.Namespace+"/"+info.Name)
+	}
+	sort.Strings(restored)
+	if want := []string{"team-a/settings", "team-a/web-static"}; !reflect.DeepEqual(restored, want) {
+		t.Errorf("objects restored = %v, want %v", restored, want)
+	}
+	if len(cr.clusterscopedResourceInfoToData) != 1 {
+		t.Errorf("namespaces restored = %v, want team-a", cr.clusterscopedResourceInfoToData)
+	}
+	if len(cr.resourcesFromBackup) != inBackup {
+		t.Errorf("%v objects of the backup left after removing auto-generated ones, want all %v so they aren't pruned", len(cr.resourcesFromBackup), inBackup)
+	}
+
+	if err := removeAutoGeneratedObjects(cr, []v1.AutoGeneratedObject{{Kind: "Secret", NameRegexp: "sh.helm("}}); err == nil {
+		t.Errorf("removeAutoGeneratedObjects() with an invalid nameRegexp succeeded")
+	}
+}
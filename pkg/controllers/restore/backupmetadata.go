@@ -0,0 +1,48 @@
+package restore
+
+import (
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// checkBackupMetadata warns when the backup was taken on a different Kubernetes minor version or with a different major
+// version of the operator. The restore continues, objects may still need a groupVersionMapping. Backups taken before the
+// metadata file was added have none
+func (h *handler) checkBackupMetadata(metadata *resourcesets.BackupMetadata) {
+	if metadata == nil {
+		return
+	}
+	if metadata.KubernetesVersion != "" {
+		serverVersion, err := h.discoveryClient.ServerVersion()
+		if err != nil {
+			logrus.Warnf("Error getting the Kubernetes version to compare with the backup: %v", err)
+		} else if !sameMinorVersion(metadata.KubernetesVersion, serverVersion.GitVersion) {
+			logrus.Warnf("Backup was taken on Kubernetes %v, this cluster runs %v", metadata.KubernetesVersion, serverVersion.GitVersion)
+		}
+	}
+	if metadata.OperatorVersion != "" && util.OperatorVersion != "" && !sameMajorVersion(metadata.OperatorVersion, util.OperatorVersion) {
+		logrus.Warnf("Backup was taken with operator version %v, this operator is version %v", metadata.OperatorVersion, util.OperatorVersion)
+	}
+}
+
+// sameMinorVersion is true unless both versions parse and their major or minor differ
+func sameMinorVersion(a, b string) bool {
+	va, errA := version.ParseGeneric(a)
+	vb, errB := version.ParseGeneric(b)
+	if errA != nil || errB != nil {
+		return true
+	}
+	return va.Major() == vb.Major() && va.Minor() == vb.Minor()
+}
+
+// sameMajorVersion is true unless both versions parse and their major differs, so development builds never warn
+func sameMajorVersion(a, b string) bool {
+	va, errA := version.ParseGeneric(a)
+	vb, errB := version.ParseGeneric(b)
+	if errA != nil || errB != nil {
+		return true
+	}
+	return va.Major() == vb.Major()
+}
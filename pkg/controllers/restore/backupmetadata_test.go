@@ -0,0 +1,25 @@
+package restore
+
+import "testing"
+
+func TestBackupMetadataVersions(t *testing.T) {
+	tests := []struct {
+		backup, current string
+		wantSameMinor   bool
+		wantSameMajor   bool
+	}{
+		{backup: "v1.21.2", current: "v1.21.5", wantSameMinor: true, wantSameMajor: true},
+		{backup: "v1.20.8+rke2r1", current: "v1.20.8+k3s1", wantSameMinor: true, wantSameMajor: true},
+		{backup: "v1.20.8", current: "v1.21.2", wantSameMajor: true},
+		{backup: "v1.2.0", current: "v2.0.0"},
+		{backup: "dev", current: "v2.0.0", wantSameMinor: true, wantSameMajor: true},
+	}
+	for _, tt := range tests {
+		if got := sameMinorVersion(tt.backup, tt.current); got != tt.wantSameMinor {
+			t.Errorf("sameMinorVersion(%q, %q) = %v, want %v", tt.backup, tt.current, got, tt.wantSameMinor)
+		}
+		if got := sameMajorVersion(tt.backup, tt.current); got != tt.wantSameMajor {
+			t.Errorf("sameMajorVersion(%q, %q) = %v, want %v", tt.backup, tt.current, got, tt.wantSameMajor)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package restore
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/sirupsen/logrus"
+)
+
+// backupFetcher returns the fetchBackup of backups stored in objStore, or on the default PV if objStore is nil
+func (h *handler) backupFetcher(objStore *v1.S3ObjectStore) func(filename string) (string, func(), error) {
+	return func(filename string) (string, func(), error) {
+		if objStore == nil {
+			return filepath.Join(h.defaultBackupMountPath, filename), func() {}, nil
+		}
+		backupFilePath, err := h.downloadFromS3(filename, objStore)
+		if err != nil {
+			return "", func() {}, err
+		}
+		return backupFilePath, func() { os.Remove(backupFilePath) }, nil
+	}
+}
+
+// addBaseBackupFiles adds the objects of the InBase entries of an incremental backup, read from its full backup, to the
+// files of the incremental backup as if they were stored in it. Objects of the full backup without an entry in the
+// incremental backup were deleted in between and aren't restored
+func (h *handler) addBaseBackupFiles(manifest *resourcesets.Manifest, tarContents []*tar.Header, tarData map[string][]byte,
+	cr *ObjectsFromBackupCR) ([]*tar.Header, error) {
+	if cr.fetchBackup == nil {
+		return nil, fmt.Errorf("incremental backup requires its full backup %v, which can't be read from this location", manifest.BaseBackup)
+	}
+	logrus.Infof("Reading unchanged objects of incremental backup from full backup %v", manifest.BaseBackup)
+	baseFilePath, cleanup, err := cr.fetchBackup(manifest.BaseBackup)
+	if err != nil {
+		return nil, fmt.Errorf("error getting full backup %v of incremental backup: %v", manifest.BaseBackup, err)
+	}
+	defer cleanup()
+	baseFiles, err := readBaseBackupObjects(baseFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading full backup %v of incremental backup: %v", manifest.BaseBackup, err)
+	}
+	for _, entry := range manifest.Entries {
+		if !entry.InBase {
+			continue
+		}
+		// the full backup may have stored the object compressed
+		name := entry.Path
+		data, ok := baseFiles[name]
+		if !ok {
+			name = entry.Path + resourcesets.CompressedObjectSuffix
+			data, ok = baseFiles[name]
+		}
+		if !ok {
+			return nil, fmt.Errorf("%v listed in the backup manifest is missing from full backup %v", entry.Path, manifest.BaseBackup)
+		}
+		tarContents = append(tarContents, &tar.Header{Name: name, Typeflag: tar.TypeReg})
+		tarData[name] = data
+	}
+	return tarContents, nil
+}
+
+// readBaseBackupObjects returns the file of every object in a full backup by its path, objects of shards are returned as
+// if they were stored in their own file. The files are verified against the manifest of the full backup
+func readBaseBackupObjects(tarGzFilePath string) (map[string][]byte, error) {
+	r, err := os.Open(tarGzFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tarball := tar.NewReader(gz)
+	files := make(map[string][]byte)
+	for {
+		tarContent, err := tarball.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if tarContent.Typeflag != tar.TypeReg {
+			continue
+		}
+		if files[tarContent.Name], err = ioutil.ReadAll(tarball); err != nil {
+			return nil, err
+		}
+	}
+
+	manifestBytes, ok := files[resourcesets.ManifestFileName]
+	if !ok {
+		return nil, fmt.Errorf("backup has no %v", resourcesets.ManifestFileName)
+	}
+	var manifest resourcesets.Manifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("error unmarshaling backup manifest file: %v", err)
+	}
+	if err := manifest.Verify(files); err != nil {
+		return nil, err
+	}
+	for shardPath := range manifest.ShardPaths() {
+		var shard []resourcesets.ShardedObject
+		if err := json.Unmarshal(files[shardPath], &shard); err != nil {
+			return nil, fmt.Errorf("error unmarshaling backup shard %v: %v", shardPath, err)
+		}
+		for _, obj := range shard {
+			files[path.Join(path.Dir(shardPath), obj.Namespace, obj.Name+".json")] = obj.Data
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,77 @@
+package restore
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// sortByRestoreTier orders a wave by restore tier and then by path, so Namespaces are restored before the other cluster
+// scoped objects and every restore of the same backup restores in the same order
+func sortByRestoreTier(objects []restoreObj) {
+	tiers := make(map[string]int, len(objects))
+	for _, obj := range objects {
+		var data unstructured.Unstructured
+		if obj.Data != nil {
+			data = *obj.Data
+		}
+		tiers[obj.ResourceConfigPath] = resourcesets.RestoreTierOrder(resourcesets.RestoreTier(obj.GVR.Group, obj.GVR.Resource, obj.Namespace != "", data))
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		if tiers[objects[i].ResourceConfigPath] != tiers[objects[j].ResourceConfigPath] {
+			return tiers[objects[i].ResourceConfigPath] < tiers[objects[j].ResourceConfigPath]
+		}
+		return objects[i].ResourceConfigPath < objects[j].ResourceConfigPath
+	})
+}
+
+// batchByGVR groups the objects by GroupVersionResource and splits every group into batches of at most batchSize objects,
+// so custom resources of different versions of a CRD never end up in the same batch
+func batchByGVR(objects []restoreObj, batchSize int) [][]restoreObj {
+	var gvrs []schema.GroupVersionResource
+	objectsForGVR := make(map[schema.GroupVersionResource][]restoreObj)
+	for _, obj := range objects {
+		if _, ok := objectsForGVR[obj.GVR]; !ok {
+			gvrs = append(gvrs, obj.GVR)
+		}
+		objectsForGVR[obj.GVR] = append(objectsForGVR[obj.GVR], obj)
+	}
+	var batches [][]restoreObj
+	for _, gvr := range gvrs {
+		gvrObjects := objectsForGVR[gvr]
+		for len(gvrObjects) > batchSize {
+			batches = append(batches, gvrObjects[:batchSize])
+			gvrObjects = gvrObjects[batchSize:]
+		}
+		batches = append(batches, gvrObjects)
+	}
+	return batches
+}
+
+// restoreBatch restores all objects of a batch in parallel and returns the ones that were restored successfully
+func (h *handler) restoreBatch(batch []restoreObj, objFromBackupCR ObjectsFromBackupCR, crdsWithSubStatus []string) ([]restoreObj, []error) {
+	errs := make([]error, len(batch))
+	var wg sync.WaitGroup
+	for i := range batch {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = h.restoreFromGraph(batch[i], objFromBackupCR, crdsWithSubStatus)
+		}(i)
+	}
+	wg.Wait()
+
+	var restored []restoreObj
+	var errList []error
+	for i, err := range errs {
+		if err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		restored = append(restored, batch[i])
+	}
+	return restored, errList
+}
@@ -0,0 +1,67 @@
+package restore
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestBatchByGVR(t *testing.T) {
+	widgetsV1 := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	widgetsV2 := schema.GroupVersionResource{Group: "example.com", Version: "v2", Resource: "widgets"}
+	secrets := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	obj := func(gvr schema.GroupVersionResource, name string) restoreObj {
+		return restoreObj{Name: name, GVR: gvr}
+	}
+	tests := []struct {
+		name      string
+		objects   []restoreObj
+		batchSize int
+		want      [][]string
+	}{
+		{
+			name:      "versions of a resource are never batched together",
+			objects:   []restoreObj{obj(widgetsV1, "a"), obj(widgetsV2, "b"), obj(widgetsV1, "c")},
+			batchSize: 10,
+			want:      [][]string{{"a", "c"}, {"b"}},
+		},
+		{
+			name:      "groups larger than the batch size are split",
+			objects:   []restoreObj{obj(secrets, "a"), obj(secrets, "b"), obj(secrets, "c"), obj(widgetsV1, "d"), obj(secrets, "e")},
+			batchSize: 2,
+			want:      [][]string{{"a", "b"}, {"c", "e"}, {"d"}},
+		},
+		{
+			name:      "batch size of one",
+			objects:   []restoreObj{obj(secrets, "a"), obj(secrets, "b")},
+			batchSize: 1,
+			want:      [][]string{{"a"}, {"b"}},
+		},
+		{
+			name:      "group of exactly the batch size",
+			objects:   []restoreObj{obj(secrets, "a"), obj(secrets, "b")},
+			batchSize: 2,
+			want:      [][]string{{"a", "b"}},
+		},
+		{
+			name:      "no objects",
+			batchSize: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+			for _, batch := range batchByGVR(tt.objects, tt.batchSize) {
+				var names []string
+				for _, obj := range batch {
+					names = append(names, obj.Name)
+				}
+				got = append(got, names)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batchByGVR() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
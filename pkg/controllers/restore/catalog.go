@@ -0,0 +1,52 @@
+package restore
+
+import (
+	"encoding/json"
+	"fmt"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"github.com/sirupsen/logrus"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// resolveCatalogEntry sets the backup file and storage location of the restore from its catalog entry. A storage location
+// set on the restore takes precedence, for example when the credentials of the object store changed since the backup
+func (h *handler) resolveCatalogEntry(restore *v1.Restore) (*util.CatalogEntry, error) {
+	catalog, err := h.configMaps.Get(util.ChartNamespace, util.CatalogConfigMapName, k8sv1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting backup catalog: %v", err)
+	}
+	entryJSON, ok := catalog.Data[restore.Spec.CatalogEntry]
+	if !ok {
+		return nil, fmt.Errorf("catalog entry %v not found in backup catalog %v/%v", restore.Spec.CatalogEntry, util.ChartNamespace, util.CatalogConfigMapName)
+	}
+	entry := &util.CatalogEntry{}
+	if err := json.Unmarshal([]byte(entryJSON), entry); err != nil {
+		return nil, fmt.Errorf("error reading catalog entry %v: %v", restore.Spec.CatalogEntry, err)
+	}
+	if restore.Spec.BackupFilename != "" && restore.Spec.BackupFilename != entry.Filename {
+		return nil, fmt.Errorf("backupFilename %v doesn't match the file %v of catalog entry %v", restore.Spec.BackupFilename, entry.Filename, entry.ID)
+	}
+	logrus.Infof("Catalog entry %v is backup %v of backup CR %v taken at %v", entry.ID, entry.Filename, entry.BackupName, entry.Timestamp)
+	restore.Spec.BackupFilename = entry.Filename
+	if restore.Spec.StorageLocation == nil && entry.S3 != nil {
+		restore.Spec.StorageLocation = &v1.StorageLocation{S3: entry.S3}
+	}
+	return entry, nil
+}
+
+// verifyChecksum compares the downloaded artifact with the checksum recorded in its catalog entry
+func verifyChecksum(backupFilePath string, entry *util.CatalogEntry) error {
+	if entry == nil || entry.Checksum == "" {
+		return nil
+	}
+	_, checksum, err := util.FileChecksum(backupFilePath)
+	if err != nil {
+		return fmt.Errorf("error computing checksum of backup %v: %v", entry.Filename, err)
+	}
+	if checksum != entry.Checksum {
+		return fmt.Errorf("checksum %v of backup %v doesn't match checksum %v of catalog entry %v", checksum, entry.Filename, entry.Checksum, entry.ID)
+	}
+	return nil
+}
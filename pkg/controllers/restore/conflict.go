@@ -0,0 +1,137 @@
+package restore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/sirupsen/logrus"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	ConflictPolicySkip      = "skip"
+	ConflictPolicyOverwrite = "overwrite"
+	ConflictPolicyAdopt     = "adopt"
+
+	restoreActionSkipped = "skipped"
+	restoreActionAdopted = "adopted"
+
+	// adoptedByLabel links live objects patched by a restore with the adopt policy to that restore
+	adoptedByLabel = "resources.cattle.io/adopted-by"
+	// only the first conflicts are listed in the status, all of them are counted in ObjectCounts
+	maxReportedConflicts = 100
+)
+
+// conflictResolver decides what happens to objects of the backup that already exist in the cluster, and records the
+// action taken for each of them. Objects of a batch are restored in parallel
+type conflictResolver struct {
+	sync.Mutex
+	policy      string
+	restoreName string
+	conflicts   []v1.RestoreConflict
+}
+
+func newConflictResolver(restore *v1.Restore) (*conflictResolver, error) {
+	switch restore.Spec.ConflictPolicy {
+	case "", ConflictPolicySkip, ConflictPolicyOverwrite, ConflictPolicyAdopt:
+	default:
+		return nil, fmt.Errorf("invalid conflictPolicy %v, must be %v, %v or %v", restore.Spec.ConflictPolicy, ConflictPolicySkip,
+			ConflictPolicyOverwrite, ConflictPolicyAdopt)
+	}
+	policy := restore.Spec.ConflictPolicy
+	if policy == "" {
+		policy = ConflictPolicyOverwrite
+	}
+	return &conflictResolver{policy: policy, restoreName: restore.Name}, nil
+}
+
+func (c *conflictResolver) record(configPath, action string) {
+	logrus.Infof("%v already exists, %v", configPath, action)
+	c.Lock()
+	defer c.Unlock()
+	if len(c.conflicts) < maxReportedConflicts {
+		c.conflicts = append(c.conflicts, v1.RestoreConflict{Object: configPath, Action: action})
+	}
+}
+
+func (c *conflictResolver) get() []v1.RestoreConflict {
+	c.Lock()
+	defer c.Unlock()
+	return append([]v1.RestoreConflict(nil), c.conflicts...)
+}
+
+// adopt patches the live object to match the backup. Server fields aren't part of the patch, and neither is the status
+// of resources without a status subresource. Fields the backup doesn't have are kept, so defaults and fields allocated
+// by the cluster, which are often immutable, stay as they are
+func (c *conflictResolver) adopt(ctx context.Context, dr dynamic.ResourceInterface, obj, liveObj *unstructured.Unstructured, hasStatusSubresource bool,
+	stamp *restoreStamp) error {
+	adopted := obj.DeepCopy()
+	stamp.apply(adopted)
+	labels := adopted.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[adoptedByLabel] = c.restoreName
+	adopted.SetLabels(labels)
+
+	desired, err := normalizeForComparison(adopted, hasStatusSubresource)
+	if err != nil {
+		return err
+	}
+	live, err := normalizeForComparison(liveObj, hasStatusSubresource)
+	if err != nil {
+		return err
+	}
+	patch := mergePatch(live, desired)
+	status, hasStatus := patch["status"]
+	delete(patch, "status")
+	if len(patch) > 0 {
+		if err := applyMergePatch(ctx, dr, obj.GetName(), patch); err != nil {
+			return err
+		}
+	}
+	if hasStatusSubresource && hasStatus {
+		if err := applyMergePatch(ctx, dr, obj.GetName(), map[string]interface{}{"status": status}, "status"); err != nil {
+			return fmt.Errorf("err patching status %v", err)
+		}
+	}
+	return nil
+}
+
+func applyMergePatch(ctx context.Context, dr dynamic.ResourceInterface, name string, patch map[string]interface{}, subresources ...string) error {
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	_, err = dr.Patch(ctx, name, types.MergePatchType, patchBytes, k8sv1.PatchOptions{}, subresources...)
+	return err
+}
+
+// mergePatch returns the JSON merge patch setting every field of desired that differs from live. Nested objects are
+// patched field by field, lists are replaced as a whole
+func mergePatch(live, desired map[string]interface{}) map[string]interface{} {
+	patch := make(map[string]interface{})
+	for key, desiredValue := range desired {
+		liveValue, ok := live[key]
+		if ok && reflect.DeepEqual(liveValue, desiredValue) {
+			continue
+		}
+		desiredMap, desiredIsMap := desiredValue.(map[string]interface{})
+		liveMap, liveIsMap := liveValue.(map[string]interface{})
+		if desiredIsMap && liveIsMap {
+			if nested := mergePatch(liveMap, desiredMap); len(nested) > 0 {
+				patch[key] = nested
+			}
+			continue
+		}
+		patch[key] = desiredValue
+	}
+	return patch
+}
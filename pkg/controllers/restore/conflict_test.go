@@ -0,0 +1,59 @@
+package restore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		live    map[string]interface{}
+		desired map[string]interface{}
+		want    map[string]interface{}
+	}{
+		{
+			name:    "equal objects",
+			live:    map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(2)}},
+			desired: map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(2)}},
+			want:    map[string]interface{}{},
+		},
+		{
+			name:    "changed and added fields",
+			live:    map[string]interface{}{"data": map[string]interface{}{"a": "1", "b": "2"}},
+			desired: map[string]interface{}{"data": map[string]interface{}{"a": "1", "b": "3", "c": "4"}},
+			want:    map[string]interface{}{"data": map[string]interface{}{"b": "3", "c": "4"}},
+		},
+		{
+			name:    "fields only in live are left alone",
+			live:    map[string]interface{}{"metadata": map[string]interface{}{"uid": "1234", "name": "web"}},
+			desired: map[string]interface{}{"metadata": map[string]interface{}{"name": "web"}},
+			want:    map[string]interface{}{},
+		},
+		{
+			name:    "lists are replaced as a whole",
+			live:    map[string]interface{}{"spec": map[string]interface{}{"finalizers": []interface{}{"a", "b"}}},
+			desired: map[string]interface{}{"spec": map[string]interface{}{"finalizers": []interface{}{"a"}}},
+			want:    map[string]interface{}{"spec": map[string]interface{}{"finalizers": []interface{}{"a"}}},
+		},
+		{
+			name:    "object replacing a value of another type",
+			live:    map[string]interface{}{"spec": "none"},
+			desired: map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1)}},
+			want:    map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1)}},
+		},
+		{
+			name:    "field missing from live",
+			live:    map[string]interface{}{},
+			desired: map[string]interface{}{"data": map[string]interface{}{"a": "1"}},
+			want:    map[string]interface{}{"data": map[string]interface{}{"a": "1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergePatch(tt.live, tt.desired); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergePatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
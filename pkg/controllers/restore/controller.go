@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
 	restoreControllers "github.com/rancher/backup-restore-operator/pkg/generated/controllers/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
 	"github.com/rancher/backup-restore-operator/pkg/util"
 	lasso "github.com/rancher/lasso/pkg/client"
 	"github.com/rancher/wrangler/pkg/condition"
@@ -53,6 +55,7 @@ type handler struct {
 	restores                restoreControllers.RestoreController
 	backups                 restoreControllers.BackupController
 	secrets                 v1core.SecretController
+	configMaps              v1core.ConfigMapController
 	discoveryClient         discovery.DiscoveryInterface
 	apiClient               clientset.Interface
 	dynamicClient           dynamic.Interface
@@ -69,6 +72,20 @@ type ObjectsFromBackupCR struct {
 	namespacedResourceInfoToData    map[objInfo]unstructured.Unstructured
 	resourcesFromBackup             map[string]bool
 	backupResourceSet               v1.ResourceSet
+	operatorConfig                  *resourcesets.OperatorConfigBundle
+	backupMetadata                  *resourcesets.BackupMetadata
+	incremental                     bool
+	stamp                           *restoreStamp
+	restoreCounts                   *restoreCounts
+	conflicts                       *conflictResolver
+	trustBundles                    []resourcesets.TrustBundle
+	includeNamespaces               []string
+	excludeNamespaces               []string
+	sinceTime                       time.Time
+	namespaceBundle                 string
+	namespaceManifest               *resourcesets.NamespaceManifest
+	// fetchBackup makes another backup from the same location available as a local file, for the base of an incremental backup
+	fetchBackup func(filename string) (string, func(), error)
 }
 
 type objInfo struct {
@@ -91,6 +108,7 @@ func Register(
 	restores restoreControllers.RestoreController,
 	backups restoreControllers.BackupController,
 	secrets v1core.SecretController,
+	configMaps v1core.ConfigMapController,
 	leaseClient coordinationclientv1.LeaseInterface,
 	clientSet *clientset.Clientset,
 	dynamicInterface dynamic.Interface,
@@ -104,6 +122,7 @@ func Register(
 		restores:                restores,
 		backups:                 backups,
 		secrets:                 secrets,
+		configMaps:              configMaps,
 		dynamicClient:           dynamicInterface,
 		discoveryClient:         clientSet.Discovery(),
 		apiClient:               clientSet,
@@ -137,6 +156,16 @@ func (h *handler) OnRestoreChange(_ string, restore *v1.Restore) (*v1.Restore, e
 	defer h.Unlock(*leaseHolderName(restore))
 
 	logrus.Infof("Processing Restore CR %v", restore.Name)
+	var catalogEntry *util.CatalogEntry
+	if restore.Spec.CatalogEntry != "" {
+		var err error
+		if catalogEntry, err = h.resolveCatalogEntry(restore); err != nil {
+			return h.setReconcilingCondition(restore, err)
+		}
+	}
+	if restore.Spec.BackupFilename == "" {
+		return h.setReconcilingCondition(restore, fmt.Errorf("restore must set backupFilename or catalogEntry"))
+	}
 	var backupSource string
 	backupName := restore.Spec.BackupFilename
 	logrus.Infof("Restoring from backup %v", restore.Spec.BackupFilename)
@@ -146,19 +175,32 @@ func (h *handler) OnRestoreChange(_ string, restore *v1.Restore) (*v1.Restore, e
 	var crdsWithSubStatus []string
 	var toRestore []restoreObj
 	numOwnerReferences := make(map[string]int)
+	conflicts, err := newConflictResolver(restore)
+	if err != nil {
+		return h.setReconcilingCondition(restore, err)
+	}
 	objFromBackupCR := ObjectsFromBackupCR{
 		crdInfoToData:                   make(map[objInfo]unstructured.Unstructured),
 		clusterscopedResourceInfoToData: make(map[objInfo]unstructured.Unstructured),
 		namespacedResourceInfoToData:    make(map[objInfo]unstructured.Unstructured),
 		resourcesFromBackup:             make(map[string]bool),
 		backupResourceSet:               v1.ResourceSet{},
+		incremental:                     restore.Spec.Incremental,
+		stamp:                           newRestoreStamp(restore),
+		restoreCounts:                   newRestoreCounts(),
+		conflicts:                       conflicts,
+		namespaceBundle:                 restore.Spec.NamespaceBundle,
 	}
 
 	transformerMap := make(map[schema.GroupResource]value.Transformer)
-	var err error
-	if restore.Spec.EncryptionConfigSecretName != "" {
-		logrus.Infof("Processing encryption config %v for restore CR %v", restore.Spec.EncryptionConfigSecretName, restore.Name)
-		transformerMap, err = util.GetEncryptionTransformers(restore.Spec.EncryptionConfigSecretName, h.secrets)
+	encryptionConfigSecretName := restore.Spec.EncryptionConfigSecretName
+	if encryptionConfigSecretName == "" && strings.HasSuffix(restore.Spec.BackupFilename, ".enc") {
+		// encrypted backups without their own encryption config were encrypted with the operator's default
+		encryptionConfigSecretName = util.DefaultEncryptionConfigSecretName
+	}
+	if encryptionConfigSecretName != "" {
+		logrus.Infof("Processing encryption config %v for restore CR %v", encryptionConfigSecretName, restore.Name)
+		transformerMap, err = util.GetEncryptionTransformers(encryptionConfigSecretName, h.secrets)
 		if err != nil {
 			logrus.Errorf("Error processing encryption config: %v", err)
 			return h.setReconcilingCondition(restore, err)
@@ -169,10 +211,15 @@ func (h *handler) OnRestoreChange(_ string, restore *v1.Restore) (*v1.Restore, e
 	var foundBackup bool
 	if backupLocation == nil {
 		if h.defaultS3BackupLocation != nil {
-			backupFilePath, err := h.downloadFromS3(restore, h.defaultS3BackupLocation)
+			objFromBackupCR.fetchBackup = h.backupFetcher(h.defaultS3BackupLocation)
+			backupFilePath, err := h.downloadFromS3(restore.Spec.BackupFilename, h.defaultS3BackupLocation)
 			if err != nil {
 				return h.setReconcilingCondition(restore, err)
 			}
+			if err := verifyChecksum(backupFilePath, catalogEntry); err != nil {
+				os.Remove(backupFilePath)
+				return h.setReconcilingCondition(restore, err)
+			}
 			if err = h.LoadFromTarGzip(backupFilePath, transformerMap, &objFromBackupCR); err != nil {
 				return h.setReconcilingCondition(restore, err)
 			}
@@ -184,7 +231,11 @@ func (h *handler) OnRestoreChange(_ string, restore *v1.Restore) (*v1.Restore, e
 			foundBackup = true
 			backupSource = util.S3Backup
 		} else if h.defaultBackupMountPath != "" {
+			objFromBackupCR.fetchBackup = h.backupFetcher(nil)
 			backupFilePath := filepath.Join(h.defaultBackupMountPath, backupName)
+			if err := verifyChecksum(backupFilePath, catalogEntry); err != nil {
+				return h.setReconcilingCondition(restore, err)
+			}
 			if err = h.LoadFromTarGzip(backupFilePath, transformerMap, &objFromBackupCR); err != nil {
 				return h.setReconcilingCondition(restore, err)
 			}
@@ -192,10 +243,15 @@ func (h *handler) OnRestoreChange(_ string, restore *v1.Restore) (*v1.Restore, e
 			backupSource = util.PVBackup
 		}
 	} else if backupLocation.S3 != nil {
-		backupFilePath, err := h.downloadFromS3(restore, restore.Spec.StorageLocation.S3)
+		objFromBackupCR.fetchBackup = h.backupFetcher(restore.Spec.StorageLocation.S3)
+		backupFilePath, err := h.downloadFromS3(restore.Spec.BackupFilename, restore.Spec.StorageLocation.S3)
 		if err != nil {
 			return h.setReconcilingCondition(restore, err)
 		}
+		if err := verifyChecksum(backupFilePath, catalogEntry); err != nil {
+			os.Remove(backupFilePath)
+			return h.setReconcilingCondition(restore, err)
+		}
 		if err = h.LoadFromTarGzip(backupFilePath, transformerMap, &objFromBackupCR); err != nil {
 			return h.setReconcilingCondition(restore, err)
 		}
@@ -211,6 +267,45 @@ func (h *handler) OnRestoreChange(_ string, restore *v1.Restore) (*v1.Restore, e
 		return h.setReconcilingCondition(restore, fmt.Errorf("Backup location not specified on the restore CR, and not configured at the operator level"))
 	}
 
+	missingTrustRoots, err := h.checkTrustBundles(objFromBackupCR.trustBundles)
+	if err != nil {
+		return h.setReconcilingCondition(restore, err)
+	}
+
+	h.checkBackupMetadata(objFromBackupCR.backupMetadata)
+
+	if err := applyNamespaceBundle(&objFromBackupCR); err != nil {
+		return h.setReconcilingCondition(restore, err)
+	}
+
+	if err := h.remapGroupVersions(restore.Spec.GroupVersionMappings, objFromBackupCR); err != nil {
+		return h.setReconcilingCondition(restore, err)
+	}
+
+	if err := applyNamespaceMapping(restore.Spec.NamespaceMapping, objFromBackupCR); err != nil {
+		return h.setReconcilingCondition(restore, err)
+	}
+
+	if !restore.Spec.RestoreAutoGeneratedObjects {
+		if err := removeAutoGeneratedObjects(objFromBackupCR, restore.Spec.AutoGeneratedObjects); err != nil {
+			return h.setReconcilingCondition(restore, err)
+		}
+	}
+
+	if err := h.applyRestoreScope(restore.Spec.RestoreScope, objFromBackupCR, created); err != nil {
+		return h.setReconcilingCondition(restore, err)
+	}
+
+	if restore.Spec.RestoreOperatorConfig {
+		if err := h.restoreOperatorConfig(objFromBackupCR.operatorConfig, transformerMap); err != nil {
+			return h.setReconcilingCondition(restore, fmt.Errorf("error restoring operator config: %v", err))
+		}
+	}
+
+	if restore.Spec.ValidateOnly {
+		return h.validateRestore(restore, objFromBackupCR, backupSource)
+	}
+
 	// first stop the controllers
 	h.scaleDownControllersFromResourceSet(objFromBackupCR)
 
@@ -230,7 +325,7 @@ func (h *handler) OnRestoreChange(_ string, restore *v1.Restore) (*v1.Restore, e
 
 	logrus.Infof("Starting to restore clusterscoped resources for restore CR %v", restore.Name)
 	// then restore clusterscoped resources, by first generating dependency graph for cluster scoped resources, and create from the graph
-	if err := h.restoreClusterScopedResources(ownerToDependentsList, &toRestore, numOwnerReferences, created, objFromBackupCR, crdsWithSubStatus); err != nil {
+	if err := h.restoreClusterScopedResources(ownerToDependentsList, &toRestore, numOwnerReferences, created, objFromBackupCR, crdsWithSubStatus, restore.Spec.BatchSize); err != nil {
 		h.scaleUpControllersFromResourceSet(objFromBackupCR)
 		if restore.Spec.IgnoreErrors {
 			logrus.Warnf("Skipping error when restoring cluster-scoped resources %v", err)
@@ -240,11 +335,16 @@ func (h *handler) OnRestoreChange(_ string, restore *v1.Restore) (*v1.Restore, e
 		}
 	}
 
+	if err := h.createMappedNamespaces(restore.Spec.NamespaceMapping); err != nil {
+		h.scaleUpControllersFromResourceSet(objFromBackupCR)
+		return h.setReconcilingCondition(restore, err)
+	}
+
 	logrus.Infof("Starting to restore namespaced resources for restore CR %v", restore.Name)
 	// now restore namespaced resources: generate adjacency lists for dependents and ownerRefs for namespaced resources
 	ownerToDependentsList = make(map[string][]restoreObj)
 	toRestore = []restoreObj{}
-	if err := h.restoreNamespacedResources(ownerToDependentsList, &toRestore, numOwnerReferences, created, objFromBackupCR, crdsWithSubStatus); err != nil {
+	if err := h.restoreNamespacedResources(ownerToDependentsList, &toRestore, numOwnerReferences, created, objFromBackupCR, crdsWithSubStatus, restore.Spec.BatchSize); err != nil {
 		h.scaleUpControllersFromResourceSet(objFromBackupCR)
 		if restore.Spec.IgnoreErrors {
 			logrus.Warnf("Skipping error when restoring namespaced resources %v", err)
@@ -255,7 +355,11 @@ func (h *handler) OnRestoreChange(_ string, restore *v1.Restore) (*v1.Restore, e
 	}
 
 	// prune by default
-	if restore.Spec.Prune == nil || *restore.Spec.Prune == true {
+	if restore.Spec.NamespaceBundle != "" {
+		logrus.Infof("Not pruning for restore CR %v, it only restores namespace %v", restore.Name, restore.Spec.NamespaceBundle)
+	} else if len(restore.Spec.NamespaceMapping) > 0 {
+		logrus.Infof("Not pruning for restore CR %v, it restores into mapped namespaces", restore.Name)
+	} else if restore.Spec.Prune == nil || *restore.Spec.Prune == true {
 		logrus.Infof("Pruning resources that are not part of the backup for restore CR %v", restore.Name)
 		if err := h.prune(objFromBackupCR.backupResourceSet.ResourceSelectors, transformerMap, objFromBackupCR, restore.Spec.DeleteTimeoutSeconds); err != nil {
 			h.scaleUpControllersFromResourceSet(objFromBackupCR)
@@ -278,6 +382,9 @@ func (h *handler) OnRestoreChange(_ string, restore *v1.Restore) (*v1.Restore, e
 		restore.Status.RestoreCompletionTS = time.Now().Format(time.RFC3339)
 		restore.Status.ObservedGeneration = restore.Generation
 		restore.Status.BackupSource = backupSource
+		restore.Status.ObjectCounts = objFromBackupCR.restoreCounts.get()
+		restore.Status.Conflicts = objFromBackupCR.conflicts.get()
+		restore.Status.MissingTrustRoots = missingTrustRoots
 		_, err = h.restores.UpdateStatus(restore)
 		return err
 	})
@@ -289,11 +396,20 @@ func (h *handler) OnRestoreChange(_ string, restore *v1.Restore) (*v1.Restore, e
 }
 
 func (h *handler) restoreCRDs(created map[string]bool, objFromBackupCR ObjectsFromBackupCR) (crdsWithStatus []string, err error) {
-	for crdInfo, crdData := range objFromBackupCR.crdInfoToData {
-		err := h.restoreResource(crdInfo, crdData, false)
+	var crdInfos []objInfo
+	for crdInfo := range objFromBackupCR.crdInfoToData {
+		crdInfos = append(crdInfos, crdInfo)
+	}
+	sort.Slice(crdInfos, func(i, j int) bool {
+		return crdInfos[i].ConfigPath < crdInfos[j].ConfigPath
+	})
+	for _, crdInfo := range crdInfos {
+		crdData := objFromBackupCR.crdInfoToData[crdInfo]
+		action, err := h.restoreResource(crdInfo, crdData, false, objFromBackupCR.incremental, objFromBackupCR.stamp, objFromBackupCR.conflicts)
 		if err != nil {
 			return crdsWithStatus, fmt.Errorf("restoreCRDs: %v", err)
 		}
+		objFromBackupCR.restoreCounts.add(action)
 		created[crdInfo.ConfigPath] = true
 		crds := getCRDsWithSubresourceStatus(crdData)
 		if len(crds) > 0 {
@@ -301,7 +417,7 @@ func (h *handler) restoreCRDs(created map[string]bool, objFromBackupCR ObjectsFr
 			crdsWithStatus = append(crdsWithStatus, crds...)
 		}
 	}
-	for crdInfo := range objFromBackupCR.crdInfoToData {
+	for _, crdInfo := range crdInfos {
 		if err := h.waitCRD(crdInfo.Name); err != nil {
 			return crdsWithStatus, err
 		}
@@ -341,21 +457,21 @@ func (h *handler) waitCRD(crdName string) error {
 }
 
 func (h *handler) restoreClusterScopedResources(ownerToDependentsList map[string][]restoreObj, toRestore *[]restoreObj,
-	numOwnerReferences map[string]int, created map[string]bool, objFromBackupCR ObjectsFromBackupCR, crdsWithSubStatus []string) error {
+	numOwnerReferences map[string]int, created map[string]bool, objFromBackupCR ObjectsFromBackupCR, crdsWithSubStatus []string, batchSize int) error {
 	// generate adjacency lists for dependents and ownerRefs first for clusterscoped resources
 	if err := h.generateDependencyGraph(ownerToDependentsList, toRestore, numOwnerReferences, objFromBackupCR, created, clusterScoped); err != nil {
 		return err
 	}
-	return h.createFromDependencyGraph(ownerToDependentsList, created, numOwnerReferences, objFromBackupCR, *toRestore, crdsWithSubStatus)
+	return h.createFromDependencyGraph(ownerToDependentsList, created, numOwnerReferences, objFromBackupCR, *toRestore, crdsWithSubStatus, batchSize)
 }
 
 func (h *handler) restoreNamespacedResources(ownerToDependentsList map[string][]restoreObj, toRestore *[]restoreObj,
-	numOwnerReferences map[string]int, created map[string]bool, objFromBackupCR ObjectsFromBackupCR, crdsWithSubStatus []string) error {
+	numOwnerReferences map[string]int, created map[string]bool, objFromBackupCR ObjectsFromBackupCR, crdsWithSubStatus []string, batchSize int) error {
 	// generate adjacency lists for dependents and ownerRefs for namespaced resources
 	if err := h.generateDependencyGraph(ownerToDependentsList, toRestore, numOwnerReferences, objFromBackupCR, created, namespaceScoped); err != nil {
 		return err
 	}
-	return h.createFromDependencyGraph(ownerToDependentsList, created, numOwnerReferences, objFromBackupCR, *toRestore, crdsWithSubStatus)
+	return h.createFromDependencyGraph(ownerToDependentsList, created, numOwnerReferences, objFromBackupCR, *toRestore, crdsWithSubStatus, batchSize)
 }
 
 // generateDependencyGraph creates a graph "ownerToDependentsList" to track objects with ownerReferences
@@ -439,22 +555,11 @@ func (h *handler) generateDependencyGraph(ownerToDependentsList map[string][]res
 				continue
 			}
 
-			var apiGroup, version string
-			split := strings.SplitN(groupVersion, "/", 2)
-			if len(split) == 1 {
-				// resources under v1 version
-				version = split[0]
-			} else {
-				apiGroup = split[0]
-				version = split[1]
-			}
-			// kind + "." + apigroup + "#" + version
-			ownerDirPath := fmt.Sprintf("%s.%s#%s", ownerGVR.Resource, apiGroup, version)
 			ownerName := ownerRefData["name"].(string)
 			// Store resourceConfigPath of owner Ref because that's what we check for in "Created" map
 			ownerObj := restoreObj{
 				Name:               ownerName,
-				ResourceConfigPath: filepath.Join(ownerDirPath, ownerName+".json"),
+				ResourceConfigPath: ownerResourceConfigPath(ownerGVR, groupVersion, "", ownerName),
 				GVR:                ownerGVR,
 			}
 			// If we are generating graph for the namespaced resources, and the ownerRef is clusterscoped, it should have been created by now
@@ -469,8 +574,11 @@ func (h *handler) generateDependencyGraph(ownerToDependentsList map[string][]res
 				ownerObj.Namespace = currRestoreObj.Namespace
 				// the owner object's resourceFile in backup would also have namespace in the filename, so update
 				// ownerObj.ResourceConfigPath to include namespace subdir before the filename for owner
-				ownerFilename := filepath.Join(currRestoreObj.Namespace, ownerName+".json")
-				ownerObj.ResourceConfigPath = filepath.Join(ownerDirPath, ownerFilename)
+				ownerObj.ResourceConfigPath = ownerResourceConfigPath(ownerGVR, groupVersion, currRestoreObj.Namespace, ownerName)
+				// namespaced owners are only in "created" already when restoring dependents alone, because they exist live
+				if created[ownerObj.ResourceConfigPath] {
+					continue
+				}
 			}
 			ownerObjDependents, ok := ownerToDependentsList[ownerObj.ResourceConfigPath]
 			if !ok {
@@ -499,9 +607,29 @@ func (h *handler) generateDependencyGraph(ownerToDependentsList map[string][]res
 	return nil
 }
 
+// ownerResourceConfigPath is the path of the owner's file in the backup, using the apiVersion of the ownerRef
+func ownerResourceConfigPath(ownerGVR schema.GroupVersionResource, groupVersion, namespace, name string) string {
+	var apiGroup, version string
+	split := strings.SplitN(groupVersion, "/", 2)
+	if len(split) == 1 {
+		// resources under v1 version
+		version = split[0]
+	} else {
+		apiGroup = split[0]
+		version = split[1]
+	}
+	// kind + "." + apigroup + "#" + version
+	ownerDirPath := fmt.Sprintf("%s.%s#%s", ownerGVR.Resource, apiGroup, version)
+	return filepath.Join(ownerDirPath, namespace, name+".json")
+}
+
 // customize provides customization of restored resource for edge cases
 func customize(obj *unstructured.Unstructured) {
 	switch obj.GetKind() {
+	case "Service":
+		if obj.GetAPIVersion() == "v1" {
+			customizeService(obj)
+		}
 	case "ServiceAccount":
 		// remove secrets section as referenced secrets will be removed by k8s Token Controller as they are considered orphaned
 		delete(obj.Object, secretsMapKey)
@@ -533,7 +661,10 @@ func customize(obj *unstructured.Unstructured) {
 }
 
 func (h *handler) createFromDependencyGraph(ownerToDependentsList map[string][]restoreObj, created map[string]bool,
-	numOwnerReferences map[string]int, objFromBackupCR ObjectsFromBackupCR, toRestore []restoreObj, crdsWithSubStatus []string) error {
+	numOwnerReferences map[string]int, objFromBackupCR ObjectsFromBackupCR, toRestore []restoreObj, crdsWithSubStatus []string, batchSize int) error {
+	if batchSize < 1 {
+		batchSize = 1
+	}
 	numTotalDependents := 0
 	for _, dependents := range ownerToDependentsList {
 		numTotalDependents += len(dependents)
@@ -541,47 +672,44 @@ func (h *handler) createFromDependencyGraph(ownerToDependentsList map[string][]r
 	countRestored := 0
 	var errList []error
 	for len(toRestore) > 0 {
-		curr := toRestore[0]
-		if len(toRestore) == 1 {
-			toRestore = []restoreObj{}
-		} else {
-			toRestore = toRestore[1:]
-		}
-		if created[curr.ResourceConfigPath] {
-			logrus.Infof("Resource %v is already created/updated", curr.ResourceConfigPath)
-			continue
-		}
-		currResourceInfo := objInfo{
-			Name:       curr.Name,
-			Namespace:  curr.Namespace,
-			GVR:        curr.GVR,
-			ConfigPath: curr.ResourceConfigPath,
-		}
-		var resourceData unstructured.Unstructured
-		if curr.Namespace != "" {
-			resourceData = objFromBackupCR.namespacedResourceInfoToData[currResourceInfo]
-		} else {
-			resourceData = objFromBackupCR.clusterscopedResourceInfoToData[currResourceInfo]
-		}
-		target := fmt.Sprintf("%s.%s", currResourceInfo.GVR.Resource, currResourceInfo.GVR.GroupVersion().String())
-		hasSubStatus := slice.ContainsString(crdsWithSubStatus, target)
-		if err := h.restoreResource(currResourceInfo, resourceData, hasSubStatus); err != nil {
-			logrus.Errorf("Error restoring resource %v of type %v: %v", currResourceInfo.Name, currResourceInfo.GVR.String(), err)
-			errList = append(errList, fmt.Errorf("error restoring %v of type %v: %v", currResourceInfo.Name, currResourceInfo.GVR.String(), err))
-			continue
-		}
-		for _, dependent := range ownerToDependentsList[curr.ResourceConfigPath] {
-			// example, curr = catTemplate, dependent=catTempVer
-			if numOwnerReferences[dependent.ResourceConfigPath] > 0 {
-				numOwnerReferences[dependent.ResourceConfigPath]--
+		// all owners of the objects in a wave were restored by previous waves, so a wave can be restored in any order.
+		// Dependents become ready once their last owner is restored and are restored in the next wave
+		var wave []restoreObj
+		inWave := make(map[string]bool)
+		for _, curr := range toRestore {
+			if created[curr.ResourceConfigPath] {
+				logrus.Infof("Resource %v is already created/updated", curr.ResourceConfigPath)
+				continue
+			}
+			if inWave[curr.ResourceConfigPath] {
+				continue
 			}
-			if numOwnerReferences[dependent.ResourceConfigPath] == 0 {
-				logrus.Infof("dependent %v is now ready to create", dependent.Name)
-				toRestore = append(toRestore, dependent)
+			inWave[curr.ResourceConfigPath] = true
+			wave = append(wave, curr)
+		}
+		toRestore = []restoreObj{}
+		sortByRestoreTier(wave)
+
+		batches := batchByGVR(wave, batchSize)
+		for i, batch := range batches {
+			restored, batchErrs := h.restoreBatch(batch, objFromBackupCR, crdsWithSubStatus)
+			errList = append(errList, batchErrs...)
+			logrus.Infof("Restored batch %v/%v of type %v: %v of %v objects", i+1, len(batches), batch[0].GVR.String(), len(restored), len(batch))
+			for _, curr := range restored {
+				for _, dependent := range ownerToDependentsList[curr.ResourceConfigPath] {
+					// example, curr = catTemplate, dependent=catTempVer
+					if numOwnerReferences[dependent.ResourceConfigPath] > 0 {
+						numOwnerReferences[dependent.ResourceConfigPath]--
+					}
+					if numOwnerReferences[dependent.ResourceConfigPath] == 0 {
+						logrus.Infof("dependent %v is now ready to create", dependent.Name)
+						toRestore = append(toRestore, dependent)
+					}
+				}
+				created[curr.ResourceConfigPath] = true
+				countRestored++
 			}
 		}
-		created[curr.ResourceConfigPath] = true
-		countRestored++
 	}
 
 	if len(toRestore) > 0 {
@@ -594,7 +722,35 @@ func (h *handler) createFromDependencyGraph(ownerToDependentsList map[string][]r
 	return util.ErrList(errList)
 }
 
-func (h *handler) restoreResource(restoreObjInfo objInfo, restoreObjData unstructured.Unstructured, hasStatusSubresource bool) error {
+func (h *handler) restoreFromGraph(curr restoreObj, objFromBackupCR ObjectsFromBackupCR, crdsWithSubStatus []string) error {
+	currResourceInfo := objInfo{
+		Name:       curr.Name,
+		Namespace:  curr.Namespace,
+		GVR:        curr.GVR,
+		ConfigPath: curr.ResourceConfigPath,
+	}
+	var resourceData unstructured.Unstructured
+	if curr.Namespace != "" {
+		resourceData = objFromBackupCR.namespacedResourceInfoToData[currResourceInfo]
+	} else {
+		resourceData = objFromBackupCR.clusterscopedResourceInfoToData[currResourceInfo]
+	}
+	target := fmt.Sprintf("%s.%s", currResourceInfo.GVR.Resource, currResourceInfo.GVR.GroupVersion().String())
+	hasSubStatus := slice.ContainsString(crdsWithSubStatus, target)
+	action, err := h.restoreResource(currResourceInfo, resourceData, hasSubStatus, objFromBackupCR.incremental, objFromBackupCR.stamp, objFromBackupCR.conflicts)
+	if err != nil {
+		logrus.Errorf("Error restoring resource %v of type %v: %v", currResourceInfo.Name, currResourceInfo.GVR.String(), err)
+		return fmt.Errorf("error restoring %v of type %v: %v", currResourceInfo.Name, currResourceInfo.GVR.String(), err)
+	}
+	objFromBackupCR.restoreCounts.add(action)
+	return nil
+}
+
+// restoreResource creates the object, or resolves the conflict with the live object following the conflict policy, and returns
+// the action it took. With incremental set, objects that already match the backup are left alone, all others get the stamp
+// if there is one
+func (h *handler) restoreResource(restoreObjInfo objInfo, restoreObjData unstructured.Unstructured, hasStatusSubresource, incremental bool,
+	stamp *restoreStamp, conflicts *conflictResolver) (string, error) {
 	logrus.Infof("restoreResource: Restoring %v of type %v", restoreObjInfo.Name, restoreObjInfo.GVR)
 
 	fileMap := restoreObjData.Object
@@ -603,6 +759,10 @@ func (h *handler) restoreResource(restoreObjInfo objInfo, restoreObjData unstruc
 	fileMapMetadata := fileMap[metadataMapKey].(map[string]interface{})
 	name := restoreObjInfo.Name
 	namespace := restoreObjInfo.Namespace
+	if remappedNamespace := restoreObjData.GetNamespace(); namespace != "" && remappedNamespace != "" {
+		// the object's own namespace differs from the one in the backup when namespaces are remapped
+		namespace = remappedNamespace
+	}
 	gvr := restoreObjInfo.GVR
 	var dr dynamic.ResourceInterface
 	dr = h.dynamicClient.Resource(gvr)
@@ -622,7 +782,7 @@ func (h *handler) restoreResource(restoreObjInfo objInfo, restoreObjData unstruc
 				delete(obj.Object[metadataMapKey].(map[string]interface{}), ownerRefsMapKey)
 				logrus.Warnf("Resource %v will be restored without ownerReferences, edit it to add required ownerReferences", name)
 			} else {
-				return err
+				return "", err
 			}
 		}
 	}
@@ -630,41 +790,65 @@ func (h *handler) restoreResource(restoreObjInfo objInfo, restoreObjData unstruc
 	res, err := dr.Get(h.ctx, name, k8sv1.GetOptions{})
 	if err != nil {
 		if !apierrors.IsNotFound(err) {
-			return fmt.Errorf("restoreResource: err getting resource %v", err)
+			return "", fmt.Errorf("restoreResource: err getting resource %v", err)
 		}
 		// create and return
+		stamp.apply(&obj)
 		createdObj, err := dr.Create(h.ctx, &obj, k8sv1.CreateOptions{})
 		if err != nil {
-			return err
+			return "", err
 		}
 		if hasStatusSubresource && obj.Object["status"] != nil {
 			logrus.Infof("Post-create: Updating status subresource for %#v of type %v", name, gvr)
 			createdObj.Object["status"] = obj.Object["status"]
 			_, err := dr.UpdateStatus(h.ctx, createdObj, k8sv1.UpdateOptions{})
 			if err != nil {
-				return fmt.Errorf("restoreResource: err updating status resource %v", err)
+				return "", fmt.Errorf("restoreResource: err updating status resource %v", err)
 			}
 		}
-		return nil
+		return restoreActionCreated, nil
 	}
+	if incremental {
+		unchanged, err := matchesLiveObject(&obj, res, hasStatusSubresource, stamp)
+		if err != nil {
+			return "", fmt.Errorf("restoreResource: err comparing with live resource %v", err)
+		}
+		if unchanged {
+			logrus.Infof("Skipping %v, it already matches the backup", name)
+			return restoreActionUnchanged, nil
+		}
+	}
+	switch conflicts.policy {
+	case ConflictPolicySkip:
+		conflicts.record(restoreObjInfo.ConfigPath, restoreActionSkipped)
+		return restoreActionSkipped, nil
+	case ConflictPolicyAdopt:
+		if err := conflicts.adopt(h.ctx, dr, &obj, res, hasStatusSubresource, stamp); err != nil {
+			return "", fmt.Errorf("restoreResource: err adopting resource %v", err)
+		}
+		conflicts.record(restoreObjInfo.ConfigPath, restoreActionAdopted)
+		return restoreActionAdopted, nil
+	}
+	stamp.apply(&obj)
 	resMetadata := res.Object[metadataMapKey].(map[string]interface{})
 	resourceVersion := resMetadata["resourceVersion"].(string)
 	obj.Object[metadataMapKey].(map[string]interface{})["resourceVersion"] = resourceVersion
 	updatedObj, err := dr.Update(h.ctx, &obj, k8sv1.UpdateOptions{})
 	if err != nil {
-		return fmt.Errorf("restoreResource: err updating resource %v", err)
+		return "", fmt.Errorf("restoreResource: err updating resource %v", err)
 	}
 	if hasStatusSubresource && obj.Object["status"] != nil {
 		logrus.Infof("Updating status subresource for %#v of type %v", name, gvr)
 		updatedObj.Object["status"] = obj.Object["status"]
 		_, err := dr.UpdateStatus(h.ctx, updatedObj, k8sv1.UpdateOptions{})
 		if err != nil {
-			return fmt.Errorf("restoreResource: err updating status resource %v", err)
+			return "", fmt.Errorf("restoreResource: err updating status resource %v", err)
 		}
 	}
 
+	conflicts.record(restoreObjInfo.ConfigPath, restoreActionUpdated)
 	logrus.Infof("Successfully restored %v", name)
-	return nil
+	return restoreActionUpdated, nil
 }
 
 func (h *handler) updateOwnerRefs(ownerReferences []interface{}, namespace string) error {
@@ -8,22 +8,25 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"strings"
 
 	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
 	"github.com/rancher/backup-restore-operator/pkg/objectstore"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/rancher/backup-restore-operator/pkg/util"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apiserver/pkg/storage/value"
 )
 
-func (h *handler) downloadFromS3(restore *v1.Restore, objStore *v1.S3ObjectStore) (string, error) {
+func (h *handler) downloadFromS3(backupFilename string, objStore *v1.S3ObjectStore) (string, error) {
 	s3Client, err := objectstore.GetS3Client(h.ctx, objStore, h.dynamicClient)
 	if err != nil {
 		return "", err
 	}
-	prefix := restore.Spec.BackupFilename
+	prefix := backupFilename
 	if len(prefix) == 0 {
 		return "", fmt.Errorf("empty backup name")
 	}
@@ -53,10 +56,14 @@ func (h *handler) LoadFromTarGzip(tarGzFilePath string, transformerMap map[schem
 	}
 	tarball := tar.NewReader(gz)
 
+	// the manifest can be anywhere in the tarball, so read all files first and load the objects once it is known
+	var tarContents []*tar.Header
+	tarData := make(map[string][]byte)
+	manifest := resourcesets.Manifest{}
 	for {
 		tarContent, err := tarball.Next()
 		if err == io.EOF {
-			return nil
+			break
 		}
 		if err != nil {
 			return err
@@ -76,21 +83,122 @@ func (h *handler) LoadFromTarGzip(tarGzFilePath string, transformerMap map[schem
 			}
 			continue
 		}
+		if tarContent.Name == resourcesets.OperatorConfigFileName {
+			cr.operatorConfig = &resourcesets.OperatorConfigBundle{}
+			if err := json.Unmarshal(readData, cr.operatorConfig); err != nil {
+				return fmt.Errorf("error unmarshaling backup operator config file: %v", err)
+			}
+			continue
+		}
+		if tarContent.Name == resourcesets.RBACSummaryFileName {
+			continue
+		}
+		if tarContent.Name == resourcesets.BackupMetadataFileName {
+			cr.backupMetadata = &resourcesets.BackupMetadata{}
+			if err := json.Unmarshal(readData, cr.backupMetadata); err != nil {
+				return fmt.Errorf("error unmarshaling backup metadata file: %v", err)
+			}
+			continue
+		}
+		if strings.HasPrefix(tarContent.Name, resourcesets.NamespaceBundlesDirName+"/") {
+			if cr.namespaceBundle != "" && tarContent.Name == resourcesets.NamespaceManifestPath(cr.namespaceBundle) {
+				cr.namespaceManifest = &resourcesets.NamespaceManifest{}
+				if err := json.Unmarshal(readData, cr.namespaceManifest); err != nil {
+					return fmt.Errorf("error unmarshaling manifest of namespace %v: %v", cr.namespaceBundle, err)
+				}
+			}
+			continue
+		}
+		if tarContent.Name == resourcesets.ManifestFileName {
+			if err := json.Unmarshal(readData, &manifest); err != nil {
+				return fmt.Errorf("error unmarshaling backup manifest file: %v", err)
+			}
+			continue
+		}
+		tarContents = append(tarContents, tarContent)
+		tarData[tarContent.Name] = readData
+	}
 
+	if err := manifest.Verify(tarData); err != nil {
+		return err
+	}
+	if manifest.BaseBackup != "" {
+		if tarContents, err = h.addBaseBackupFiles(&manifest, tarContents, tarData, cr); err != nil {
+			return err
+		}
+	}
+	if manifest.Unencrypted && len(transformerMap) > 0 {
+		logrus.Infof("Backup %v was taken without encryption, not decrypting its objects", tarGzFilePath)
+		transformerMap = nil
+	}
+	cr.trustBundles = manifest.TrustBundles
+	cr.includeNamespaces = manifest.IncludeNamespaces
+	cr.excludeNamespaces = manifest.ExcludeNamespaces
+	if manifest.SinceTime != nil {
+		cr.sinceTime = *manifest.SinceTime
+	}
+	nonRestorable := manifest.NonRestorablePaths()
+	shardPaths := manifest.ShardPaths()
+	loadedShards := make(map[string]bool)
+	for _, tarContent := range tarContents {
+		if shardPaths[tarContent.Name] {
+			if err := h.loadDataFromShard(tarContent.Name, tarData[tarContent.Name], nonRestorable, transformerMap, cr); err != nil {
+				return err
+			}
+			loadedShards[tarContent.Name] = true
+			continue
+		}
+		if objectPath := resourcesets.ObjectPath(tarContent.Name); nonRestorable[objectPath] {
+			logrus.Infof("Skipping %v, it is marked as non-restorable in the backup manifest", objectPath)
+			// it's still part of the backup, so it must not be pruned
+			cr.resourcesFromBackup[objectPath] = true
+			continue
+		}
 		// tarContent.Name = serviceaccounts.#v1/cattle-system/cattle.json OR users.management.cattle.io#v3/u-lqx8j.json
-		err = h.loadDataFromFile(tarContent, readData, transformerMap, cr)
+		err = h.loadDataFromFile(tarContent.Name, tarData[tarContent.Name], transformerMap, cr)
 		if err != nil {
 			return err
 		}
 	}
+	for shardPath := range shardPaths {
+		if !loadedShards[shardPath] {
+			return fmt.Errorf("shard %v listed in the backup manifest is missing from the backup", shardPath)
+		}
+	}
+	return nil
+}
+
+// loadDataFromShard loads every object in a shard file as if it was read from its own file in the resource dir
+// shardPath = workloads.example.com#v1/shard-3.json
+func (h *handler) loadDataFromShard(shardPath string, readData []byte, nonRestorable map[string]bool,
+	transformerMap map[schema.GroupResource]value.Transformer, cr *ObjectsFromBackupCR) error {
+	var shard []resourcesets.ShardedObject
+	if err := json.Unmarshal(readData, &shard); err != nil {
+		return fmt.Errorf("error unmarshaling backup shard %v: %v", shardPath, err)
+	}
+	resourceDir := path.Dir(shardPath)
+	for _, obj := range shard {
+		configPath := path.Join(resourceDir, obj.Namespace, obj.Name+".json")
+		if nonRestorable[configPath] {
+			logrus.Infof("Skipping %v from shard %v, it is marked as non-restorable in the backup manifest", configPath, shardPath)
+			cr.resourcesFromBackup[configPath] = true
+			continue
+		}
+		if err := h.loadDataFromFile(configPath, obj.Data, transformerMap, cr); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (h *handler) loadDataFromFile(tarContent *tar.Header, readData []byte,
+func (h *handler) loadDataFromFile(configPath string, readData []byte,
 	transformerMap map[schema.GroupResource]value.Transformer, cr *ObjectsFromBackupCR) error {
 	var name, namespace, additionalAuthenticatedData string
 
-	cr.resourcesFromBackup[tarContent.Name] = true
-	splitPath := strings.Split(tarContent.Name, "/")
+	compressed := strings.HasSuffix(configPath, ".json"+resourcesets.CompressedObjectSuffix)
+	configPath = resourcesets.ObjectPath(configPath)
+	cr.resourcesFromBackup[configPath] = true
+	splitPath := strings.Split(configPath, "/")
 	if len(splitPath) == 2 {
 		// cluster scoped resource, since no subdir for namespace
 		name = strings.TrimSuffix(splitPath[1], ".json")
@@ -111,13 +219,20 @@ func (h *handler) loadDataFromFile(tarContent *tar.Header, readData []byte,
 			logrus.Errorf("Error unmarshaling encrypted data for resource [%v]: %v", gvr.GroupResource(), err)
 			return fmt.Errorf("error unmarshaling encrypted data for resource [%v]: %v", gvr.GroupResource(), err)
 		}
-		decrypted, _, err := decryptionTransformer.TransformFromStorage(encryptedBytes, value.DefaultContext(additionalAuthenticatedData))
+		decrypted, err := util.TransformFromStorage(decryptionTransformer, encryptedBytes, value.DefaultContext(additionalAuthenticatedData))
 		if err != nil {
 			logrus.Errorf("Error decrypting encrypted resource [%v]: %v, provide same encryption config as used for backup", gvr.GroupResource(), err)
 			return fmt.Errorf("error decrypting encrypted resource [%v]: %v, provide same encryption config as used for backup", gvr.GroupResource(), err)
 		}
 		readData = decrypted
 	}
+	if compressed {
+		decompressed, err := resourcesets.DecompressObject(readData)
+		if err != nil {
+			return fmt.Errorf("error reading %v: %v", configPath, err)
+		}
+		readData = decompressed
+	}
 	fileMap := make(map[string]interface{})
 	err := json.Unmarshal(readData, &fileMap)
 	if err != nil {
@@ -131,7 +246,7 @@ func (h *handler) loadDataFromFile(tarContent *tar.Header, readData []byte,
 	info := objInfo{
 		Name:       name,
 		GVR:        gvr,
-		ConfigPath: tarContent.Name,
+		ConfigPath: configPath,
 	}
 	if strings.EqualFold(gvr.Resource, "customresourcedefinitions") {
 		cr.crdInfoToData[info] = unstructured.Unstructured{Object: fileMap}
@@ -0,0 +1,136 @@
+package restore
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// writeAndLoadTestArtifact writes the config maps with rh into an artifact and loads it like a restore
+func writeAndLoadTestArtifact(t *testing.T, rh *resourcesets.ResourceHandler, configMaps []unstructured.Unstructured) ObjectsFromBackupCR {
+	return writeAndLoadTestObjects(t, rh, map[resourcesets.GVResource][]unstructured.Unstructured{
+		{GroupVersion: schema.GroupVersion{Version: "v1"}, Name: "configmaps", Namespaced: true}: configMaps,
+	}, "")
+}
+
+// writeAndLoadTestObjects writes the objects of every resource with rh into an artifact and loads it like a restore.
+// With namespaceBundle set the artifact has namespace bundles, and the restore loads the bundle of that namespace
+func writeAndLoadTestObjects(t *testing.T, rh *resourcesets.ResourceHandler, objects map[resourcesets.GVResource][]unstructured.Unstructured,
+	namespaceBundle string) ObjectsFromBackupCR {
+	artifactPath := filepath.Join(t.TempDir(), "backup.tar.gz")
+	writer, err := resourcesets.NewArtifactWriter(artifactPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rh.Writer = writer
+	rh.GVResourceToObjects = objects
+	if err := rh.WriteBackupObjects(""); err != nil {
+		t.Fatalf("WriteBackupObjects() error: %v", err)
+	}
+	if namespaceBundle != "" {
+		if err := rh.WriteNamespaceBundles(""); err != nil {
+			t.Fatalf("WriteNamespaceBundles() error: %v", err)
+		}
+	}
+	if err := resourcesets.WriteManifest(writer, &rh.Manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cr := testObjectsFromBackup(nil, nil)
+	cr.crdInfoToData = make(map[objInfo]unstructured.Unstructured)
+	cr.namespaceBundle = namespaceBundle
+	if err := (&handler{}).LoadFromTarGzip(artifactPath, nil, &cr); err != nil {
+		t.Fatalf("LoadFromTarGzip() error: %v", err)
+	}
+	return cr
+}
+
+func TestLoadFromTarGzipCompressedObjects(t *testing.T) {
+	configMap := func(name string, size int) unstructured.Unstructured {
+		obj := unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"data":       map[string]interface{}{"values.yaml": strings.Repeat("replicas: 3\n", size)},
+		}}
+		obj.SetNamespace("default")
+		obj.SetName(name)
+		return obj
+	}
+	objects := []unstructured.Unstructured{configMap("large", 1024), configMap("small", 1)}
+
+	rh := &resourcesets.ResourceHandler{PerObjectCompression: 1024}
+	cr := writeAndLoadTestArtifact(t, rh, objects)
+	for _, entry := range rh.Manifest.Entries {
+		if entry.Compressed != (entry.Name == "large") {
+			t.Errorf("%v compressed = %v", entry.Name, entry.Compressed)
+		}
+	}
+	for _, obj := range objects {
+		info := objInfo{Name: obj.GetName(), Namespace: "default", GVR: configMapsGVR, ConfigPath: "configmaps.#v1/default/" + obj.GetName() + ".json"}
+		restored, ok := cr.namespacedResourceInfoToData[info]
+		if !ok {
+			t.Errorf("%v is missing from the restored objects %v", obj.GetName(), cr.namespacedResourceInfoToData)
+			continue
+		}
+		if !reflect.DeepEqual(restored.Object["data"], obj.Object["data"]) {
+			t.Errorf("data of %v changed by the round trip", obj.GetName())
+		}
+		if !cr.resourcesFromBackup[info.ConfigPath] {
+			t.Errorf("%v isn't recorded as part of the backup", info.ConfigPath)
+		}
+	}
+}
+
+func TestLoadFromTarGzipObjectsBeingDeleted(t *testing.T) {
+	configMap := func(name string, finalizers ...string) unstructured.Unstructured {
+		obj := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}}
+		obj.SetNamespace("default")
+		obj.SetName(name)
+		obj.SetFinalizers(finalizers)
+		deleted := metav1.NewTime(time.Date(2021, 5, 10, 12, 0, 0, 0, time.UTC))
+		obj.SetDeletionTimestamp(&deleted)
+		gracePeriod := int64(30)
+		obj.SetDeletionGracePeriodSeconds(&gracePeriod)
+		return obj
+	}
+	live := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}}
+	live.SetNamespace("default")
+	live.SetName("live")
+	objects := []unstructured.Unstructured{configMap("finalized", "example.com/cleanup"), configMap("gone"), live}
+
+	rh := &resourcesets.ResourceHandler{}
+	cr := writeAndLoadTestArtifact(t, rh, objects)
+	deleting := make(map[string]bool)
+	for _, entry := range rh.Manifest.Entries {
+		deleting[entry.Name] = entry.Deleting
+	}
+	if want := map[string]bool{"finalized": true, "live": false}; !reflect.DeepEqual(deleting, want) {
+		t.Errorf("deleting of the manifest entries = %v, want %v", deleting, want)
+	}
+
+	var restored []string
+	for info, obj := range cr.namespacedResourceInfoToData {
+		restored = append(restored, info.Name)
+		if obj.GetDeletionTimestamp() != nil || obj.GetDeletionGracePeriodSeconds() != nil {
+			t.Errorf("%v is restored with deletionTimestamp %v and grace period %v", info.Name, obj.GetDeletionTimestamp(), obj.GetDeletionGracePeriodSeconds())
+		}
+		if info.Name == "finalized" && !reflect.DeepEqual(obj.GetFinalizers(), []string{"example.com/cleanup"}) {
+			t.Errorf("finalizers of %v = %v, want them kept", info.Name, obj.GetFinalizers())
+		}
+	}
+	sort.Strings(restored)
+	if want := []string{"finalized", "live"}; !reflect.DeepEqual(restored, want) {
+		t.Errorf("restored objects = %v, want %v", restored, want)
+	}
+}
@@ -0,0 +1,80 @@
+package restore
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	restoreActionCreated   = "created"
+	restoreActionUpdated   = "updated"
+	restoreActionUnchanged = "unchanged"
+)
+
+// restoreCounts is the number of restored objects per action, objects of a batch are restored in parallel
+type restoreCounts struct {
+	sync.Mutex
+	counts map[string]int64
+}
+
+func newRestoreCounts() *restoreCounts {
+	return &restoreCounts{counts: make(map[string]int64)}
+}
+
+func (c *restoreCounts) add(action string) {
+	c.Lock()
+	defer c.Unlock()
+	c.counts[action]++
+}
+
+func (c *restoreCounts) get() map[string]int64 {
+	c.Lock()
+	defer c.Unlock()
+	counts := make(map[string]int64, len(c.counts))
+	for action, count := range c.counts {
+		counts[action] = count
+	}
+	return counts
+}
+
+// matchesLiveObject compares the object from the backup with the one in the cluster, ignoring the fields set by the apiserver.
+// The status is only compared for resources with a status subresource, for all others it's owned by the cluster. The stamp
+// of a previous restore doesn't count as a change
+func matchesLiveObject(backupObj, liveObj *unstructured.Unstructured, hasStatusSubresource bool, stamp *restoreStamp) (bool, error) {
+	backupNormalized, err := normalizeForComparison(backupObj, hasStatusSubresource)
+	if err != nil {
+		return false, err
+	}
+	liveNormalized, err := normalizeForComparison(liveObj, hasStatusSubresource)
+	if err != nil {
+		return false, err
+	}
+	stamp.remove(backupNormalized)
+	stamp.remove(liveNormalized)
+	return reflect.DeepEqual(backupNormalized, liveNormalized), nil
+}
+
+// normalizeForComparison returns a copy of the object without server fields. The copy goes through JSON, since objects read
+// from the backup file hold numbers as float64 and the ones from the apiserver as int64
+func normalizeForComparison(obj *unstructured.Unstructured, hasStatusSubresource bool) (map[string]interface{}, error) {
+	objBytes, err := json.Marshal(obj.Object)
+	if err != nil {
+		return nil, err
+	}
+	normalized := make(map[string]interface{})
+	if err := json.Unmarshal(objBytes, &normalized); err != nil {
+		return nil, err
+	}
+	if !hasStatusSubresource {
+		delete(normalized, "status")
+	}
+	if metadata, ok := normalized[metadataMapKey].(map[string]interface{}); ok {
+		for _, field := range []string{"uid", "creationTimestamp", "deletionTimestamp", "deletionGracePeriodSeconds", "selfLink", "resourceVersion", "generation", "managedFields"} {
+			delete(metadata, field)
+		}
+	}
+	return normalized, nil
+}
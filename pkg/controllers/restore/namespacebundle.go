@@ -0,0 +1,35 @@
+package restore
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// applyNamespaceBundle drops every object that isn't part of the namespace bundle of the restore, CRDs included.
+// Cluster scoped dependencies of the bundle are only logged, they must already exist or be restored separately
+func applyNamespaceBundle(cr *ObjectsFromBackupCR) error {
+	if cr.namespaceBundle == "" {
+		return nil
+	}
+	if cr.namespaceManifest == nil {
+		return fmt.Errorf("backup has no bundle for namespace %v, it must be taken with namespaceBundles set to true", cr.namespaceBundle)
+	}
+	inBundle := make(map[string]bool)
+	for _, entry := range cr.namespaceManifest.Entries {
+		inBundle[entry.Path] = true
+	}
+	for _, resourceInfoToData := range []map[objInfo]unstructured.Unstructured{cr.crdInfoToData, cr.clusterscopedResourceInfoToData, cr.namespacedResourceInfoToData} {
+		for info := range resourceInfoToData {
+			if !inBundle[info.ConfigPath] {
+				delete(resourceInfoToData, info)
+			}
+		}
+	}
+	for _, dependency := range cr.namespaceManifest.ClusterDependencies {
+		logrus.Infof("Namespace %v depends on %v %v for %v, it is not restored with the namespace", cr.namespaceBundle, dependency.Resource,
+			dependency.Name, dependency.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package restore
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestApplyNamespaceBundle(t *testing.T) {
+	object := func(apiVersion, kind, namespace, name string) unstructured.Unstructured {
+		obj := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": apiVersion, "kind": kind}}
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		return obj
+	}
+	roleBinding := object("rbac.authorization.k8s.io/v1", "RoleBinding", "team-a", "viewers")
+	roleBinding.Object["roleRef"] = map[string]interface{}{"apiGroup": "rbac.authorization.k8s.io", "kind": "ClusterRole", "name": "view"}
+	newObjects := func() map[resourcesets.GVResource][]unstructured.Unstructured {
+		return map[resourcesets.GVResource][]unstructured.Unstructured{
+			{GroupVersion: schema.GroupVersion{Version: "v1"}, Name: "configmaps", Namespaced: true}: {
+				object("v1", "ConfigMap", "team-a", "settings"), object("v1", "ConfigMap", "team-b", "settings"),
+			},
+			{GroupVersion: schema.GroupVersion{Version: "v1"}, Name: "namespaces"}: {
+				object("v1", "Namespace", "", "team-a"), object("v1", "Namespace", "", "team-b"),
+			},
+			{GroupVersion: schema.GroupVersion{Group: "rbac.authorization.k8s.io", Version: "v1"}, Name: "rolebindings", Namespaced: true}: {
+				*roleBinding.DeepCopy(),
+			},
+			{GroupVersion: schema.GroupVersion{Group: "rbac.authorization.k8s.io", Version: "v1"}, Name: "clusterroles"}: {
+				object("rbac.authorization.k8s.io/v1", "ClusterRole", "", "view"),
+			},
+		}
+	}
+	restored := func(cr ObjectsFromBackupCR) []string {
+		var paths []string
+		for _, resourceInfoToData := range []map[objInfo]unstructured.Unstructured{cr.crdInfoToData, cr.clusterscopedResourceInfoToData, cr.namespacedResourceInfoToData} {
+			for info := range resourceInfoToData {
+				paths = append(paths, info.ConfigPath)
+			}
+		}
+		sort.Strings(paths)
+		return paths
+	}
+
+	tests := []struct {
+		name            string
+		namespaceBundle string
+		want            []string
+		wantErr         string
+	}{
+		{
+			name:            "bundle of a namespace",
+			namespaceBundle: "team-a",
+			want: []string{
+				"configmaps.#v1/team-a/settings.json",
+				"namespaces.#v1/team-a.json",
+				"rolebindings.rbac.authorization.k8s.io#v1/team-a/viewers.json",
+			},
+		},
+		{
+			name:            "namespace without a bundle",
+			namespaceBundle: "team-c",
+			wantErr:         "backup has no bundle for namespace team-c",
+		},
+		{
+			name: "no bundle",
+			want: []string{
+				"clusterroles.rbac.authorization.k8s.io#v1/view.json",
+				"configmaps.#v1/team-a/settings.json",
+				"configmaps.#v1/team-b/settings.json",
+				"namespaces.#v1/team-a.json",
+				"namespaces.#v1/team-b.json",
+				"rolebindings.rbac.authorization.k8s.io#v1/team-a/viewers.json",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := writeAndLoadTestObjects(t, &resourcesets.ResourceHandler{}, newObjects(), tt.namespaceBundle)
+			err := applyNamespaceBundle(&cr)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyNamespaceBundle() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyNamespaceBundle() error: %v", err)
+			}
+			if got := restored(cr); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("objects restored = %v, want %v", got, tt.want)
+			}
+			if tt.namespaceBundle == "" {
+				return
+			}
+			want := []resourcesets.ClusterDependency{
+				{Resource: "clusterroles.rbac.authorization.k8s.io", Name: "view", Reason: "RoleBinding team-a/viewers", InBackup: true},
+			}
+			if !reflect.DeepEqual(cr.namespaceManifest.ClusterDependencies, want) {
+				t.Errorf("cluster dependencies of the bundle = %+v, want %+v", cr.namespaceManifest.ClusterDependencies, want)
+			}
+		})
+	}
+}
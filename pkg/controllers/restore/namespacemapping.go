@@ -0,0 +1,103 @@
+package restore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/validation"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// applyNamespaceMapping moves the namespaced objects of every mapped namespace to its target namespace. Objects of the same
+// resource and name that would end up in the same namespace collide, the restore fails listing them instead of letting one
+// overwrite the other. Namespace objects of the backup are renamed to their target, when several namespaces are mapped to
+// the same target only one of them is restored
+func applyNamespaceMapping(mapping map[string]string, cr ObjectsFromBackupCR) error {
+	if len(mapping) == 0 {
+		return nil
+	}
+	for source, target := range mapping {
+		if source == "" {
+			return fmt.Errorf("invalid namespaceMapping to %v: the namespace in the backup is empty", target)
+		}
+		if errs := validation.ValidateNamespaceName(target, false); len(errs) > 0 {
+			return fmt.Errorf("invalid namespaceMapping from %v to %v: %v", source, target, strings.Join(errs, ", "))
+		}
+	}
+
+	restoredAs := make(map[string][]string)
+	for info := range cr.namespacedResourceInfoToData {
+		namespace := info.Namespace
+		if target, ok := mapping[namespace]; ok {
+			namespace = target
+		}
+		key := fmt.Sprintf("%s %s/%s", info.GVR.String(), namespace, info.Name)
+		restoredAs[key] = append(restoredAs[key], info.ConfigPath)
+	}
+	var collisions []string
+	for key, configPaths := range restoredAs {
+		if len(configPaths) > 1 {
+			sort.Strings(configPaths)
+			collisions = append(collisions, fmt.Sprintf("%v from %v", key, strings.Join(configPaths, ", ")))
+		}
+	}
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return fmt.Errorf("namespaceMapping restores several objects of the backup as the same object: %v", strings.Join(collisions, "; "))
+	}
+
+	remapNamespaces(cr, func(namespace string) string {
+		return mapping[namespace]
+	})
+
+	// the Namespaces are moved once all of them are removed, so swapping two namespaces doesn't drop either
+	moved := make(map[objInfo]unstructured.Unstructured)
+	for info, data := range cr.clusterscopedResourceInfoToData {
+		target, ok := mapping[info.Name]
+		if !ok || info.GVR != namespaceGVR {
+			continue
+		}
+		newInfo := info
+		newInfo.Name = target
+		newInfo.ConfigPath = ownerResourceConfigPath(info.GVR, data.GetAPIVersion(), "", target)
+		moved[newInfo] = data
+		delete(cr.clusterscopedResourceInfoToData, info)
+	}
+	for newInfo, data := range moved {
+		if _, ok := cr.clusterscopedResourceInfoToData[newInfo]; ok {
+			logrus.Infof("Not restoring namespace %v, namespace %v is restored from the backup already", data.GetName(), newInfo.Name)
+			continue
+		}
+		logrus.Infof("Restoring namespace %v as %v", data.GetName(), newInfo.Name)
+		data.SetName(newInfo.Name)
+		cr.clusterscopedResourceInfoToData[newInfo] = data
+		cr.resourcesFromBackup[newInfo.ConfigPath] = true
+	}
+	return nil
+}
+
+// createMappedNamespaces creates the target namespaces of the namespaceMapping that neither exist nor were restored from the backup
+func (h *handler) createMappedNamespaces(mapping map[string]string) error {
+	for _, target := range mapping {
+		_, err := h.dynamicClient.Resource(namespaceGVR).Get(h.ctx, target, k8sv1.GetOptions{})
+		if err == nil {
+			continue
+		}
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error getting namespace %v of namespaceMapping: %v", target, err)
+		}
+		ns := &unstructured.Unstructured{}
+		ns.SetAPIVersion("v1")
+		ns.SetKind("Namespace")
+		ns.SetName(target)
+		logrus.Infof("Creating namespace %v of namespaceMapping", target)
+		if _, err := h.dynamicClient.Resource(namespaceGVR).Create(h.ctx, ns, k8sv1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("error creating namespace %v of namespaceMapping: %v", target, err)
+		}
+	}
+	return nil
+}
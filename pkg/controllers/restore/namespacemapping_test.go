@@ -0,0 +1,128 @@
+package restore
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var configMapsGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+// testObjectsFromBackup returns the backup objects of a config map for every namespace/name and of every namespace
+func testObjectsFromBackup(configMaps []string, namespaces []string) ObjectsFromBackupCR {
+	cr := ObjectsFromBackupCR{
+		clusterscopedResourceInfoToData: make(map[objInfo]unstructured.Unstructured),
+		namespacedResourceInfoToData:    make(map[objInfo]unstructured.Unstructured),
+		resourcesFromBackup:             make(map[string]bool),
+	}
+	for _, configMap := range configMaps {
+		parts := strings.SplitN(configMap, "/", 2)
+		obj := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}}
+		obj.SetNamespace(parts[0])
+		obj.SetName(parts[1])
+		info := objInfo{Name: parts[1], Namespace: parts[0], GVR: configMapsGVR, ConfigPath: "configmaps.#v1/" + configMap + ".json"}
+		cr.namespacedResourceInfoToData[info] = obj
+	}
+	for _, namespace := range namespaces {
+		obj := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Namespace"}}
+		obj.SetName(namespace)
+		info := objInfo{Name: namespace, GVR: namespaceGVR, ConfigPath: "namespaces.#v1/" + namespace + ".json"}
+		cr.clusterscopedResourceInfoToData[info] = obj
+	}
+	return cr
+}
+
+func TestApplyNamespaceMapping(t *testing.T) {
+	tests := []struct {
+		name           string
+		mapping        map[string]string
+		configMaps     []string
+		namespaces     []string
+		wantErr        string
+		wantConfigMaps []string
+		wantNamespaces []string
+	}{
+		{
+			name:           "move to a new namespace",
+			mapping:        map[string]string{"team-a": "team-a-copy"},
+			configMaps:     []string{"team-a/settings", "team-b/settings"},
+			namespaces:     []string{"team-a", "team-b"},
+			wantConfigMaps: []string{"team-a-copy/settings", "team-b/settings"},
+			wantNamespaces: []string{"team-a-copy", "team-b"},
+		},
+		{
+			name:           "swap two namespaces",
+			mapping:        map[string]string{"team-a": "team-b", "team-b": "team-a"},
+			configMaps:     []string{"team-a/settings", "team-b/settings"},
+			namespaces:     []string{"team-a", "team-b"},
+			wantConfigMaps: []string{"team-b/settings", "team-a/settings"},
+			wantNamespaces: []string{"team-a", "team-b"},
+		},
+		{
+			name:           "merge namespaces without collisions",
+			mapping:        map[string]string{"team-a": "shared", "team-b": "shared"},
+			configMaps:     []string{"team-a/a", "team-b/b"},
+			wantConfigMaps: []string{"shared/a", "shared/b"},
+		},
+		{
+			name:       "merge namespaces with the same object",
+			mapping:    map[string]string{"team-a": "shared", "team-b": "shared"},
+			configMaps: []string{"team-a/settings", "team-b/settings"},
+			wantErr:    "/v1, Resource=configmaps shared/settings from configmaps.#v1/team-a/settings.json, configmaps.#v1/team-b/settings.json",
+		},
+		{
+			name:       "move onto an object that isn't moved",
+			mapping:    map[string]string{"team-a": "team-b"},
+			configMaps: []string{"team-a/settings", "team-b/settings"},
+			wantErr:    "team-b/settings from configmaps.#v1/team-a/settings.json, configmaps.#v1/team-b/settings.json",
+		},
+		{
+			name:    "invalid target",
+			mapping: map[string]string{"team-a": "Team_A"},
+			wantErr: "invalid namespaceMapping from team-a to Team_A",
+		},
+		{
+			name:    "empty source",
+			mapping: map[string]string{"": "team-a"},
+			wantErr: "the namespace in the backup is empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := testObjectsFromBackup(tt.configMaps, tt.namespaces)
+			err := applyNamespaceMapping(tt.mapping, cr)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyNamespaceMapping() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyNamespaceMapping() error: %v", err)
+			}
+			for i, configMap := range tt.configMaps {
+				parts := strings.SplitN(configMap, "/", 2)
+				info := objInfo{Name: parts[1], Namespace: parts[0], GVR: configMapsGVR, ConfigPath: "configmaps.#v1/" + configMap + ".json"}
+				data := cr.namespacedResourceInfoToData[info]
+				if got := data.GetNamespace() + "/" + data.GetName(); got != tt.wantConfigMaps[i] {
+					t.Errorf("config map %v restored as %v, want %v", configMap, got, tt.wantConfigMaps[i])
+				}
+			}
+			var gotNamespaces []string
+			for info, data := range cr.clusterscopedResourceInfoToData {
+				if info.Name != data.GetName() {
+					t.Errorf("namespace %v is restored from an object named %v", info.Name, data.GetName())
+				}
+				gotNamespaces = append(gotNamespaces, info.Name)
+			}
+			sort.Strings(gotNamespaces)
+			if !reflect.DeepEqual(gotNamespaces, tt.wantNamespaces) {
+				t.Errorf("applyNamespaceMapping() namespaces = %v, want %v", gotNamespaces, tt.wantNamespaces)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	lasso "github.com/rancher/lasso/pkg/client"
+	"github.com/rancher/lasso/pkg/mapper"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage/value"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// OfflineRestoreOptions configure a restore that runs without the operator
+type OfflineRestoreOptions struct {
+	// BackupPath is the backup file, the full backup of an incremental backup is read from the same dir
+	BackupPath string
+	// EncryptionConfigPath is the encryption config the backup was encrypted with, empty for unencrypted backups
+	EncryptionConfigPath string
+	// BatchSize is the number of objects of the same resource restored at the same time, 0 restores them one by one
+	BatchSize int
+	// IgnoreErrors continues with the namespaced resources if restoring the CRDs or the cluster scoped resources failed
+	IgnoreErrors bool
+}
+
+// OfflineRestore restores a backup file into the cluster of restConfig without the operator or its CRDs, for example to
+// recover a cluster from scratch. The objects are restored in the order of a Restore CR: CRDs first, then cluster scoped
+// and namespaced resources, each after their owners. Nothing is pruned and no controllers are scaled down
+func OfflineRestore(ctx context.Context, restConfig *rest.Config, opts OfflineRestoreOptions) error {
+	h, err := newOfflineHandler(ctx, restConfig)
+	if err != nil {
+		return err
+	}
+	restore := &v1.Restore{Spec: v1.RestoreSpec{BackupFilename: filepath.Base(opts.BackupPath)}}
+	conflicts, err := newConflictResolver(restore)
+	if err != nil {
+		return err
+	}
+	objFromBackupCR := ObjectsFromBackupCR{
+		crdInfoToData:                   make(map[objInfo]unstructured.Unstructured),
+		clusterscopedResourceInfoToData: make(map[objInfo]unstructured.Unstructured),
+		namespacedResourceInfoToData:    make(map[objInfo]unstructured.Unstructured),
+		resourcesFromBackup:             make(map[string]bool),
+		backupResourceSet:               v1.ResourceSet{},
+		restoreCounts:                   newRestoreCounts(),
+		conflicts:                       conflicts,
+		fetchBackup: func(filename string) (string, func(), error) {
+			return filepath.Join(filepath.Dir(opts.BackupPath), filename), func() {}, nil
+		},
+	}
+
+	transformerMap := make(map[schema.GroupResource]value.Transformer)
+	if opts.EncryptionConfigPath != "" {
+		if transformerMap, err = util.GetEncryptionTransformersFromFile(opts.EncryptionConfigPath); err != nil {
+			return err
+		}
+	}
+	if err := h.LoadFromTarGzip(opts.BackupPath, transformerMap, &objFromBackupCR); err != nil {
+		return fmt.Errorf("error reading backup %v: %v", opts.BackupPath, err)
+	}
+	h.checkBackupMetadata(objFromBackupCR.backupMetadata)
+
+	created := make(map[string]bool)
+	numOwnerReferences := make(map[string]int)
+	logrus.Infof("Starting to restore CRDs from %v", opts.BackupPath)
+	crdsWithSubStatus, err := h.restoreCRDs(created, objFromBackupCR)
+	if err != nil {
+		if !opts.IgnoreErrors {
+			return fmt.Errorf("error restoring CRDs: %v", err)
+		}
+		logrus.Warnf("Skipping error when restoring CRDs %v", err)
+	}
+	logrus.Infof("Starting to restore clusterscoped resources from %v", opts.BackupPath)
+	var toRestore []restoreObj
+	if err := h.restoreClusterScopedResources(make(map[string][]restoreObj), &toRestore, numOwnerReferences, created, objFromBackupCR,
+		crdsWithSubStatus, opts.BatchSize); err != nil {
+		if !opts.IgnoreErrors {
+			return fmt.Errorf("error restoring cluster-scoped resources: %v", err)
+		}
+		logrus.Warnf("Skipping error when restoring cluster-scoped resources %v", err)
+	}
+	logrus.Infof("Starting to restore namespaced resources from %v", opts.BackupPath)
+	toRestore = []restoreObj{}
+	if err := h.restoreNamespacedResources(make(map[string][]restoreObj), &toRestore, numOwnerReferences, created, objFromBackupCR,
+		crdsWithSubStatus, opts.BatchSize); err != nil {
+		return fmt.Errorf("error restoring namespaced resources: %v", err)
+	}
+	logrus.Infof("Done restoring %v: %v", opts.BackupPath, objFromBackupCR.restoreCounts.get())
+	return nil
+}
+
+// newOfflineHandler builds a handler with the clients used to restore objects, the clients of the operator's own CRDs
+// are left nil, since they may not be installed yet
+func newOfflineHandler(ctx context.Context, restConfig *rest.Config) (*handler, error) {
+	restmapper, err := mapper.New(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error building rest mapper: %v", err)
+	}
+	clientSet, err := clientset.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error getting clientSet: %v", err)
+	}
+	dynamicInterface, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error generating dynamic client: %v", err)
+	}
+	sharedClientFactory, err := lasso.NewSharedClientFactoryForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error generating shared client factory: %v", err)
+	}
+	return &handler{
+		ctx:                 ctx,
+		dynamicClient:       dynamicInterface,
+		discoveryClient:     clientSet.Discovery(),
+		apiClient:           clientSet,
+		sharedClientFactory: sharedClientFactory,
+		restmapper:          restmapper,
+	}, nil
+}
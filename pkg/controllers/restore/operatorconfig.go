@@ -0,0 +1,84 @@
+package restore
+
+import (
+	"fmt"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage/value"
+)
+
+var resourceSetGVR = v1.SchemeGroupVersion.WithResource("resourcesets")
+
+// restoreOperatorConfig creates the encryption configs, ResourceSets and Backups from the operator config of a backup,
+// in that order so every Backup finds the objects it references. Objects that already exist are left unchanged
+func (h *handler) restoreOperatorConfig(bundle *resourcesets.OperatorConfigBundle, transformerMap map[schema.GroupResource]value.Transformer) error {
+	if bundle == nil {
+		return fmt.Errorf("backup has no operator config, it must be taken with includeOperatorConfig set to true")
+	}
+
+	if len(bundle.EncryptionConfigs) > 0 {
+		transformer := transformerMap[resourcesets.SecretsGroupResource]
+		if transformer == nil {
+			return fmt.Errorf("backup contains encryption configs, provide the encryption config used for backup to unwrap them")
+		}
+		for _, wrapped := range bundle.EncryptionConfigs {
+			secret, err := wrapped.Unwrap(transformer)
+			if err != nil {
+				return err
+			}
+			if _, err := h.secrets.Create(secret); err != nil {
+				if !apierrors.IsAlreadyExists(err) {
+					return fmt.Errorf("error restoring encryption config %v: %v", secret.Name, err)
+				}
+				logrus.Infof("Encryption config %v already exists, skipping it", secret.Name)
+				continue
+			}
+			logrus.Infof("Restored encryption config %v", secret.Name)
+		}
+	}
+
+	for _, rs := range bundle.ResourceSets {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&rs)
+		if err != nil {
+			return fmt.Errorf("error converting resourceSet %v: %v", rs.Name, err)
+		}
+		resourceSet := &unstructured.Unstructured{Object: obj}
+		resourceSet.SetAPIVersion(v1.SchemeGroupVersion.String())
+		resourceSet.SetKind("ResourceSet")
+		if _, err := h.dynamicClient.Resource(resourceSetGVR).Create(h.ctx, resourceSet, k8sv1.CreateOptions{}); err != nil {
+			if !apierrors.IsAlreadyExists(err) {
+				return fmt.Errorf("error restoring resourceSet %v: %v", rs.Name, err)
+			}
+			logrus.Infof("ResourceSet %v already exists, skipping it", rs.Name)
+			continue
+		}
+		logrus.Infof("Restored resourceSet %v", rs.Name)
+	}
+
+	for i := range bundle.Backups {
+		backup := bundle.Backups[i]
+		status := backup.Status
+		created, err := h.backups.Create(&backup)
+		if err != nil {
+			if !apierrors.IsAlreadyExists(err) {
+				return fmt.Errorf("error restoring backup %v: %v", backup.Name, err)
+			}
+			logrus.Infof("Backup %v already exists, skipping it", backup.Name)
+			continue
+		}
+		// without its status a one-time backup would be taken again
+		created.Status = status
+		if _, err := h.backups.UpdateStatus(created); err != nil {
+			logrus.Warnf("Error restoring status of backup %v: %v", backup.Name, err)
+		}
+		logrus.Infof("Restored backup %v", backup.Name)
+	}
+	return nil
+}
@@ -31,6 +31,11 @@ func (h *handler) prune(resourceSelectors []v1.ResourceSelector, transformerMap
 		DiscoveryClient: h.discoveryClient,
 		DynamicClient:   h.dynamicClient,
 		TransformerMap:  transformerMap,
+		// objects outside of the namespaces of the backup or created before its sinceTime were never backed up, they
+		// must not be pruned either
+		IncludeNamespaces: cr.includeNamespaces,
+		ExcludeNamespaces: cr.excludeNamespaces,
+		SinceTime:         cr.sinceTime,
 	}
 
 	if err := rh.GatherResources(h.ctx, resourceSelectors); err != nil {
@@ -0,0 +1,78 @@
+package restore
+
+import (
+	"fmt"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// remapGroupVersions moves the objects of every mapped group version to the group version the target cluster serves.
+// Only the apiVersion is rewritten, fields that differ between the versions are left to the apiserver. Owner references and the resource selectors used for pruning are
+// rewritten too, so dependents still find their owners and remapped objects aren't pruned
+func (h *handler) remapGroupVersions(mappings []v1.GroupVersionMapping, cr ObjectsFromBackupCR) error {
+	if len(mappings) == 0 {
+		return nil
+	}
+	remapped := make(map[string]schema.GroupVersion)
+	for _, mapping := range mappings {
+		from, err := schema.ParseGroupVersion(mapping.From)
+		if err != nil {
+			return fmt.Errorf("invalid groupVersionMapping from %v: %v", mapping.From, err)
+		}
+		to, err := schema.ParseGroupVersion(mapping.To)
+		if err != nil {
+			return fmt.Errorf("invalid groupVersionMapping to %v: %v", mapping.To, err)
+		}
+		remapped[from.String()] = to
+	}
+
+	for _, resourceInfoToData := range []map[objInfo]unstructured.Unstructured{cr.clusterscopedResourceInfoToData, cr.namespacedResourceInfoToData} {
+		moved := make(map[objInfo]objInfo)
+		for info, data := range resourceInfoToData {
+			remapOwnerReferences(data, remapped)
+			to, ok := remapped[info.GVR.GroupVersion().String()]
+			if !ok {
+				continue
+			}
+			gvr, _, err := h.sharedClientFactory.ResourceForGVK(to.WithKind(data.GetKind()))
+			if err != nil {
+				return fmt.Errorf("target cluster doesn't serve %v %v, can't remap %v: %v", to.String(), data.GetKind(), info.ConfigPath, err)
+			}
+			data.SetAPIVersion(to.String())
+			newInfo := info
+			newInfo.GVR = gvr
+			newInfo.ConfigPath = ownerResourceConfigPath(gvr, to.String(), info.Namespace, info.Name)
+			moved[info] = newInfo
+		}
+		for info, newInfo := range moved {
+			logrus.Infof("Restoring %v as %v", info.ConfigPath, newInfo.ConfigPath)
+			resourceInfoToData[newInfo] = resourceInfoToData[info]
+			delete(resourceInfoToData, info)
+			cr.resourcesFromBackup[newInfo.ConfigPath] = true
+		}
+	}
+
+	for i, selector := range cr.backupResourceSet.ResourceSelectors {
+		if to, ok := remapped[selector.APIVersion]; ok {
+			cr.backupResourceSet.ResourceSelectors[i].APIVersion = to.String()
+		}
+	}
+	return nil
+}
+
+func remapOwnerReferences(data unstructured.Unstructured, remapped map[string]schema.GroupVersion) {
+	ownerRefs := data.GetOwnerReferences()
+	var changed bool
+	for i, ownerRef := range ownerRefs {
+		if to, ok := remapped[ownerRef.APIVersion]; ok {
+			ownerRefs[i].APIVersion = to.String()
+			changed = true
+		}
+	}
+	if changed {
+		data.SetOwnerReferences(ownerRefs)
+	}
+}
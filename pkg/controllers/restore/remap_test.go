@@ -0,0 +1,119 @@
+package restore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	lasso "github.com/rancher/lasso/pkg/client"
+	"k8s.io/apimachinery/pkg/api/meta"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// fakeClientFactory resolves kinds with the mapper of the target cluster, it has none of the other methods
+type fakeClientFactory struct {
+	lasso.SharedClientFactory
+	mapper meta.RESTMapper
+}
+
+func (f *fakeClientFactory) ResourceForGVK(gvk schema.GroupVersionKind) (schema.GroupVersionResource, bool, error) {
+	mapping, err := f.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return schema.GroupVersionResource{}, false, err
+	}
+	return mapping.Resource, mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+func TestRemapGroupVersionsIngress(t *testing.T) {
+	v1beta1Ingresses := schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses"}
+	v1Ingresses := schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}
+	// the target cluster only serves networking.k8s.io/v1 Ingresses
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(v1Ingresses.GroupVersion().WithKind("Ingress"), meta.RESTScopeNamespace)
+
+	newBackupObjects := func() ObjectsFromBackupCR {
+		cr := testObjectsFromBackup([]string{"default/web-tls"}, nil)
+		ingress := unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1beta1",
+			"kind":       "Ingress",
+			"spec": map[string]interface{}{
+				"rules": []interface{}{map[string]interface{}{"host": "web.example.com"}},
+			},
+		}}
+		ingress.SetNamespace("default")
+		ingress.SetName("web")
+		cr.namespacedResourceInfoToData[objInfo{
+			Name:       "web",
+			Namespace:  "default",
+			GVR:        v1beta1Ingresses,
+			ConfigPath: "ingresses.networking.k8s.io#v1beta1/default/web.json",
+		}] = ingress
+		cr.resourcesFromBackup["ingresses.networking.k8s.io#v1beta1/default/web.json"] = true
+		for info, data := range cr.namespacedResourceInfoToData {
+			if info.GVR == configMapsGVR {
+				data.SetOwnerReferences([]k8sv1.OwnerReference{{APIVersion: "networking.k8s.io/v1beta1", Kind: "Ingress", Name: "web", UID: "1234"}})
+			}
+		}
+		cr.backupResourceSet.ResourceSelectors = []v1.ResourceSelector{
+			{APIVersion: "networking.k8s.io/v1beta1", Kinds: []string{"ingresses"}},
+			{APIVersion: "v1", Kinds: []string{"configmaps"}},
+		}
+		return cr
+	}
+	h := &handler{sharedClientFactory: &fakeClientFactory{mapper: mapper}}
+
+	cr := newBackupObjects()
+	mappings := []v1.GroupVersionMapping{{From: "networking.k8s.io/v1beta1", To: "networking.k8s.io/v1"}}
+	if err := h.remapGroupVersions(mappings, cr); err != nil {
+		t.Fatalf("remapGroupVersions() error: %v", err)
+	}
+	wantInfo := objInfo{Name: "web", Namespace: "default", GVR: v1Ingresses, ConfigPath: "ingresses.networking.k8s.io#v1/default/web.json"}
+	ingress, ok := cr.namespacedResourceInfoToData[wantInfo]
+	if !ok {
+		t.Fatalf("remapGroupVersions() objects = %v, want %v", cr.namespacedResourceInfoToData, wantInfo)
+	}
+	if len(cr.namespacedResourceInfoToData) != 2 {
+		t.Errorf("remapGroupVersions() left %v objects, want the Ingress and the config map", len(cr.namespacedResourceInfoToData))
+	}
+	if ingress.GetAPIVersion() != "networking.k8s.io/v1" || ingress.GetKind() != "Ingress" {
+		t.Errorf("remapped Ingress is %v %v, want networking.k8s.io/v1 Ingress", ingress.GetAPIVersion(), ingress.GetKind())
+	}
+	if rules, _, _ := unstructured.NestedSlice(ingress.Object, "spec", "rules"); len(rules) != 1 {
+		t.Errorf("remapped Ingress rules = %v, want them kept", rules)
+	}
+	if !cr.resourcesFromBackup[wantInfo.ConfigPath] {
+		t.Errorf("%v isn't in the resources from the backup, it would be pruned", wantInfo.ConfigPath)
+	}
+	for info, data := range cr.namespacedResourceInfoToData {
+		if info.GVR != configMapsGVR {
+			continue
+		}
+		if ownerRefs := data.GetOwnerReferences(); len(ownerRefs) != 1 || ownerRefs[0].APIVersion != "networking.k8s.io/v1" {
+			t.Errorf("owner references of %v = %v, want the owner remapped to networking.k8s.io/v1", info.ConfigPath, ownerRefs)
+		}
+	}
+	var selectorVersions []string
+	for _, selector := range cr.backupResourceSet.ResourceSelectors {
+		selectorVersions = append(selectorVersions, selector.APIVersion)
+	}
+	if want := []string{"networking.k8s.io/v1", "v1"}; !reflect.DeepEqual(selectorVersions, want) {
+		t.Errorf("resource selector apiVersions = %v, want %v", selectorVersions, want)
+	}
+
+	for _, tt := range []struct {
+		mapping v1.GroupVersionMapping
+		wantErr string
+	}{
+		{mapping: v1.GroupVersionMapping{From: "networking.k8s.io/v1beta1", To: "networking.k8s.io/v2"}, wantErr: "target cluster doesn't serve networking.k8s.io/v2 Ingress"},
+		{mapping: v1.GroupVersionMapping{From: "networking.k8s.io/v1/beta1", To: "networking.k8s.io/v1"}, wantErr: "invalid groupVersionMapping from"},
+		{mapping: v1.GroupVersionMapping{From: "networking.k8s.io/v1beta1", To: "networking/k8s/v1"}, wantErr: "invalid groupVersionMapping to"},
+	} {
+		err := h.remapGroupVersions([]v1.GroupVersionMapping{tt.mapping}, newBackupObjects())
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("remapGroupVersions(%v) error = %v, want %q", tt.mapping, err, tt.wantErr)
+		}
+	}
+}
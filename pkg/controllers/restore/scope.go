@@ -0,0 +1,89 @@
+package restore
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	RestoreScopeAll        = "all"
+	RestoreScopeOwners     = "owners"
+	RestoreScopeDependents = "dependents"
+)
+
+// applyRestoreScope drops the objects outside of the scope from the objects to restore. CRDs are always restored.
+// Like auto-generated objects, dropped objects are still part of the backup, so they don't get pruned
+func (h *handler) applyRestoreScope(scope string, objFromBackupCR ObjectsFromBackupCR, created map[string]bool) error {
+	switch scope {
+	case "", RestoreScopeAll:
+		return nil
+	case RestoreScopeOwners, RestoreScopeDependents:
+	default:
+		return fmt.Errorf("invalid restoreScope %v, must be %v, %v or %v", scope, RestoreScopeAll, RestoreScopeOwners, RestoreScopeDependents)
+	}
+
+	inBackup := make(map[string]bool)
+	for _, resourceInfoToData := range []map[objInfo]unstructured.Unstructured{objFromBackupCR.clusterscopedResourceInfoToData, objFromBackupCR.namespacedResourceInfoToData} {
+		for info, data := range resourceInfoToData {
+			isDependent := len(data.GetOwnerReferences()) > 0
+			if (scope == RestoreScopeOwners) == isDependent {
+				delete(resourceInfoToData, info)
+				continue
+			}
+			inBackup[info.ConfigPath] = true
+		}
+	}
+	if scope == RestoreScopeOwners {
+		return nil
+	}
+
+	for _, resourceInfoToData := range []map[objInfo]unstructured.Unstructured{objFromBackupCR.clusterscopedResourceInfoToData, objFromBackupCR.namespacedResourceInfoToData} {
+		for info, data := range resourceInfoToData {
+			ownersExist, err := h.ownersExist(info, data, inBackup, created)
+			if err != nil {
+				return err
+			}
+			if !ownersExist {
+				delete(resourceInfoToData, info)
+			}
+		}
+	}
+	return nil
+}
+
+// ownersExist checks that every owner of a dependent is either restored along with it, or exists in the cluster so its
+// new UID can be set on the ownerRef. Owners that exist are marked as created, so the dependency graph doesn't wait for them
+func (h *handler) ownersExist(info objInfo, data unstructured.Unstructured, inBackup, created map[string]bool) (bool, error) {
+	for _, ownerRef := range data.GetOwnerReferences() {
+		ownerGV, err := schema.ParseGroupVersion(ownerRef.APIVersion)
+		if err != nil {
+			return false, fmt.Errorf("err %v parsing apiversion %v of owner of %v", err, ownerRef.APIVersion, info.ConfigPath)
+		}
+		ownerGVR, isNamespaced, err := h.sharedClientFactory.ResourceForGVK(ownerGV.WithKind(ownerRef.Kind))
+		if err != nil {
+			logrus.Warnf("Skip restoring %v, error getting resource of owner %v %v: %v", info.ConfigPath, ownerRef.Kind, ownerRef.Name, err)
+			return false, nil
+		}
+		owner := &restoreObj{Name: ownerRef.Name, GVR: ownerGVR}
+		if isNamespaced {
+			owner.Namespace = info.Namespace
+		}
+		ownerConfigPath := ownerResourceConfigPath(ownerGVR, ownerRef.APIVersion, owner.Namespace, owner.Name)
+		if inBackup[ownerConfigPath] {
+			continue
+		}
+		if _, err := h.getOwnerNewUID(owner); err != nil {
+			if apierrors.IsNotFound(err) {
+				logrus.Warnf("Skip restoring %v, its owner %v %v doesn't exist", info.ConfigPath, ownerRef.Kind, ownerRef.Name)
+				return false, nil
+			}
+			return false, fmt.Errorf("error obtaining new UID for owner %v of %v: %v", ownerRef.Name, info.ConfigPath, err)
+		}
+		created[ownerConfigPath] = true
+	}
+	return true, nil
+}
@@ -0,0 +1,23 @@
+package restore
+
+import (
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// customizeService drops the fields of a Service the cluster assigns, so they are allocated again by the cluster it's restored to.
+// The cluster IP would fail validation on a cluster with another service CIDR, and on updates the apiserver keeps the allocated
+// values of the existing Service. Fields set by users like type, ports including nodePorts, sessionAffinity and
+// externalTrafficPolicy are restored as they are
+func customizeService(obj *unstructured.Unstructured) {
+	clusterIP, _, _ := unstructured.NestedString(obj.Object, specMapKey, "clusterIP")
+	// headless services have no allocated cluster IP, "None" is what makes them headless
+	if clusterIP != "None" {
+		unstructured.RemoveNestedField(obj.Object, specMapKey, "clusterIP")
+		unstructured.RemoveNestedField(obj.Object, specMapKey, "clusterIPs")
+	}
+	unstructured.RemoveNestedField(obj.Object, specMapKey, "healthCheckNodePort")
+	// the load balancer status belongs to the cloud provider of the cluster the backup was taken on
+	unstructured.RemoveNestedField(obj.Object, "status", "loadBalancer")
+	logrus.Debugf("Cluster assigned fields are regenerated for Service %s/%s", obj.GetNamespace(), obj.GetName())
+}
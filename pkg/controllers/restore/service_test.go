@@ -0,0 +1,121 @@
+package restore
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestServiceRoundTrip(t *testing.T) {
+	servicesGVResource := resourcesets.GVResource{GroupVersion: schema.GroupVersion{Version: "v1"}, Name: "services", Namespaced: true}
+	knativeGVResource := resourcesets.GVResource{GroupVersion: schema.GroupVersion{Group: "serving.knative.dev", Version: "v1"}, Name: "services", Namespaced: true}
+	ports := []interface{}{
+		map[string]interface{}{"name": "http", "protocol": "TCP", "port": int64(80), "targetPort": int64(8080), "nodePort": int64(30080)},
+		map[string]interface{}{"name": "https", "protocol": "TCP", "port": int64(443), "targetPort": "https", "nodePort": int64(30443)},
+	}
+	tests := []struct {
+		name       string
+		gvResource resourcesets.GVResource
+		apiVersion string
+		spec       map[string]interface{}
+		status     map[string]interface{}
+		wantSpec   map[string]interface{}
+		wantStatus map[string]interface{}
+	}{
+		{
+			name:       "load balancer",
+			gvResource: servicesGVResource,
+			apiVersion: "v1",
+			spec: map[string]interface{}{
+				"type":                     "LoadBalancer",
+				"clusterIP":                "10.43.12.7",
+				"clusterIPs":               []interface{}{"10.43.12.7"},
+				"ports":                    ports,
+				"selector":                 map[string]interface{}{"app": "web"},
+				"sessionAffinity":          "ClientIP",
+				"sessionAffinityConfig":    map[string]interface{}{"clientIP": map[string]interface{}{"timeoutSeconds": int64(600)}},
+				"externalTrafficPolicy":    "Local",
+				"healthCheckNodePort":      int64(31234),
+				"loadBalancerSourceRanges": []interface{}{"10.0.0.0/8"},
+			},
+			status: map[string]interface{}{"loadBalancer": map[string]interface{}{"ingress": []interface{}{map[string]interface{}{"ip": "203.0.113.10"}}}},
+			wantSpec: map[string]interface{}{
+				"type":                     "LoadBalancer",
+				"ports":                    ports,
+				"selector":                 map[string]interface{}{"app": "web"},
+				"sessionAffinity":          "ClientIP",
+				"sessionAffinityConfig":    map[string]interface{}{"clientIP": map[string]interface{}{"timeoutSeconds": int64(600)}},
+				"externalTrafficPolicy":    "Local",
+				"loadBalancerSourceRanges": []interface{}{"10.0.0.0/8"},
+			},
+			wantStatus: map[string]interface{}{},
+		},
+		{
+			name:       "headless",
+			gvResource: servicesGVResource,
+			apiVersion: "v1",
+			spec: map[string]interface{}{
+				"type":       "ClusterIP",
+				"clusterIP":  "None",
+				"clusterIPs": []interface{}{"None"},
+				"selector":   map[string]interface{}{"app": "db"},
+			},
+			wantSpec: map[string]interface{}{
+				"type":       "ClusterIP",
+				"clusterIP":  "None",
+				"clusterIPs": []interface{}{"None"},
+				"selector":   map[string]interface{}{"app": "db"},
+			},
+		},
+		{
+			name:       "service of another group",
+			gvResource: knativeGVResource,
+			apiVersion: "serving.knative.dev/v1",
+			spec:       map[string]interface{}{"clusterIP": "10.43.12.8", "healthCheckNodePort": int64(31235)},
+			wantSpec:   map[string]interface{}{"clusterIP": "10.43.12.8", "healthCheckNodePort": int64(31235)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": tt.apiVersion, "kind": "Service", "spec": tt.spec}}
+			if tt.status != nil {
+				service.Object["status"] = tt.status
+			}
+			service.SetNamespace("default")
+			service.SetName("web")
+			service.SetResourceVersion("42")
+			service.SetUID("0b7e1c2a-4d3f-4e5a-9b8c-7d6e5f4a3b2c")
+
+			cr := writeAndLoadTestObjects(t, &resourcesets.ResourceHandler{}, map[resourcesets.GVResource][]unstructured.Unstructured{
+				tt.gvResource: {*service.DeepCopy()},
+			}, "")
+			if len(cr.namespacedResourceInfoToData) != 1 {
+				t.Fatalf("loaded %v objects, want the service", len(cr.namespacedResourceInfoToData))
+			}
+			for info, obj := range cr.namespacedResourceInfoToData {
+				if info.Namespace != "default" || info.Name != "web" {
+					t.Errorf("loaded %v/%v, want default/web", info.Namespace, info.Name)
+				}
+				customize(&obj)
+				// the loaded numbers are float64, so fields are compared as JSON
+				for _, field := range []struct {
+					name string
+					want map[string]interface{}
+				}{{"spec", tt.wantSpec}, {"status", tt.wantStatus}} {
+					got, _, _ := unstructured.NestedFieldNoCopy(obj.Object, field.name)
+					gotJSON, _ := json.Marshal(got)
+					wantJSON, _ := json.Marshal(field.want)
+					if string(gotJSON) != string(wantJSON) {
+						t.Errorf("restored %v = %s, want %s", field.name, gotJSON, wantJSON)
+					}
+				}
+				if obj.GetResourceVersion() != "" || obj.GetUID() != "" {
+					t.Errorf("restored with resourceVersion %q and uid %q", obj.GetResourceVersion(), obj.GetUID())
+				}
+			}
+		})
+	}
+}
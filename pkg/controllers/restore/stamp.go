@@ -0,0 +1,99 @@
+package restore
+
+import (
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	defaultStampLabelKey               = "resources.cattle.io/restored-by"
+	defaultStampAnnotationKey          = "resources.cattle.io/restored-from"
+	defaultStampTimestampAnnotationKey = "resources.cattle.io/restored-at"
+)
+
+// restoreStamp holds the label and annotations set on restored objects, a nil restoreStamp stamps nothing
+type restoreStamp struct {
+	labels      map[string]string
+	annotations map[string]string
+}
+
+func newRestoreStamp(restore *v1.Restore) *restoreStamp {
+	spec := restore.Spec.Stamp
+	if spec == nil {
+		return nil
+	}
+	labelKey, annotationKey, timestampKey := spec.LabelKey, spec.AnnotationKey, spec.TimestampAnnotationKey
+	if labelKey == "" {
+		labelKey = defaultStampLabelKey
+	}
+	if annotationKey == "" {
+		annotationKey = defaultStampAnnotationKey
+	}
+	if timestampKey == "" {
+		timestampKey = defaultStampTimestampAnnotationKey
+	}
+	stamp := &restoreStamp{
+		labels: make(map[string]string),
+		annotations: map[string]string{
+			annotationKey: restore.Spec.BackupFilename,
+			timestampKey:  time.Now().Format(time.RFC3339),
+		},
+	}
+	// the backup filename is usually too long for a label value, and so are some names of Restore CRs.
+	// Those objects can still be found by the annotations
+	if len(validation.IsValidLabelValue(restore.Name)) == 0 {
+		stamp.labels[labelKey] = restore.Name
+	}
+	return stamp
+}
+
+func (s *restoreStamp) apply(obj *unstructured.Unstructured) {
+	if s == nil {
+		return
+	}
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	for key, value := range s.labels {
+		labels[key] = value
+	}
+	obj.SetLabels(labels)
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	for key, value := range s.annotations {
+		annotations[key] = value
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// remove drops the stamp from the metadata of an object map
+func (s *restoreStamp) remove(obj map[string]interface{}) {
+	if s == nil {
+		return
+	}
+	removeKeys(obj, "labels", s.labels)
+	removeKeys(obj, "annotations", s.annotations)
+}
+
+// removeKeys removes the keys from the labels or annotations, and the labels or annotations themselves if nothing is left,
+// so the object compares equal to one that never had them
+func removeKeys(obj map[string]interface{}, field string, keys map[string]string) {
+	values, ok, _ := unstructured.NestedMap(obj, metadataMapKey, field)
+	if !ok {
+		return
+	}
+	for key := range keys {
+		delete(values, key)
+	}
+	if len(values) == 0 {
+		unstructured.RemoveNestedField(obj, metadataMapKey, field)
+		return
+	}
+	unstructured.SetNestedMap(obj, values, metadataMapKey, field)
+}
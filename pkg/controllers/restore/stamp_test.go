@@ -0,0 +1,119 @@
+package restore
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestNewRestoreStamp(t *testing.T) {
+	before := time.Now().Add(-time.Second)
+	restore := &v1.Restore{
+		ObjectMeta: k8sv1.ObjectMeta{Name: "restore-nightly"},
+		Spec: v1.RestoreSpec{
+			BackupFilename: "nightly-c1d2e3f4-2020-09-15T21-27-06Z.tar.gz",
+			Stamp:          &v1.RestoreStamp{LabelKey: "example.com/restore"},
+		},
+	}
+	stamp := newRestoreStamp(restore)
+	if want := map[string]string{"example.com/restore": "restore-nightly"}; !reflect.DeepEqual(stamp.labels, want) {
+		t.Errorf("newRestoreStamp() labels = %v, want %v", stamp.labels, want)
+	}
+	if got := stamp.annotations[defaultStampAnnotationKey]; got != restore.Spec.BackupFilename {
+		t.Errorf("newRestoreStamp() annotation %v = %q, want the backup filename", defaultStampAnnotationKey, got)
+	}
+	timestamp, err := time.Parse(time.RFC3339, stamp.annotations[defaultStampTimestampAnnotationKey])
+	if err != nil || timestamp.Before(before) || timestamp.After(time.Now()) {
+		t.Errorf("newRestoreStamp() annotation %v = %q, want the time of the restore", defaultStampTimestampAnnotationKey,
+			stamp.annotations[defaultStampTimestampAnnotationKey])
+	}
+
+	restore.Name = strings.Repeat("r", 64)
+	if stamp := newRestoreStamp(restore); len(stamp.labels) != 0 || len(stamp.annotations) != 2 {
+		t.Errorf("newRestoreStamp() of a Restore CR named too long for a label = %v, want only the annotations", stamp)
+	}
+	restore.Spec.Stamp = nil
+	if stamp := newRestoreStamp(restore); stamp != nil {
+		t.Errorf("newRestoreStamp() without a stamp = %v, want nil", stamp)
+	}
+}
+
+func TestRestoreResourceStampsAppliedObjects(t *testing.T) {
+	stamp := newRestoreStamp(&v1.Restore{
+		ObjectMeta: k8sv1.ObjectMeta{Name: "restore-nightly"},
+		Spec:       v1.RestoreSpec{BackupFilename: "nightly.tar.gz", Stamp: &v1.RestoreStamp{}},
+	})
+	configMap := func(data string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"data":       map[string]interface{}{"value": data},
+		}}
+		obj.SetNamespace("default")
+		obj.SetName("settings")
+		obj.SetLabels(map[string]string{"app": "web"})
+		return obj
+	}
+	tests := []struct {
+		name        string
+		live        *unstructured.Unstructured
+		policy      string
+		incremental bool
+		wantAction  string
+		wantStamp   bool
+	}{
+		{name: "created", wantAction: restoreActionCreated, wantStamp: true},
+		{name: "overwritten", live: configMap("live"), policy: ConflictPolicyOverwrite, wantAction: restoreActionUpdated, wantStamp: true},
+		{name: "adopted", live: configMap("live"), policy: ConflictPolicyAdopt, wantAction: restoreActionAdopted, wantStamp: true},
+		{name: "skipped", live: configMap("live"), policy: ConflictPolicySkip, wantAction: restoreActionSkipped},
+		{name: "unchanged", live: configMap("backup"), policy: ConflictPolicyOverwrite, incremental: true, wantAction: restoreActionUnchanged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objs []runtime.Object
+			if tt.live != nil {
+				tt.live.SetResourceVersion("42")
+				objs = append(objs, tt.live)
+			}
+			dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objs...)
+			h := &handler{ctx: context.Background(), dynamicClient: dynamicClient}
+			info := objInfo{Name: "settings", Namespace: "default", GVR: configMapsGVR, ConfigPath: "configmaps.#v1/default/settings.json"}
+			conflicts := &conflictResolver{policy: tt.policy, restoreName: "restore-nightly"}
+
+			action, err := h.restoreResource(info, *configMap("backup"), false, tt.incremental, stamp, conflicts)
+			if err != nil || action != tt.wantAction {
+				t.Fatalf("restoreResource() = %v, %v, want %v", action, err, tt.wantAction)
+			}
+			applied, err := dynamicClient.Resource(configMapsGVR).Namespace("default").Get(context.Background(), "settings", k8sv1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value, _, _ := unstructured.NestedString(applied.Object, "data", "value"); (value == "backup") != (tt.wantAction != restoreActionSkipped) {
+				t.Errorf("data of the %v object = %q", tt.name, value)
+			}
+			wantLabels := map[string]string{"app": "web"}
+			var wantAnnotations map[string]string
+			if tt.wantStamp {
+				wantLabels[defaultStampLabelKey] = "restore-nightly"
+				wantAnnotations = stamp.annotations
+			}
+			if tt.policy == ConflictPolicyAdopt {
+				wantLabels[adoptedByLabel] = "restore-nightly"
+			}
+			if !reflect.DeepEqual(applied.GetLabels(), wantLabels) {
+				t.Errorf("labels of the %v object = %v, want %v", tt.name, applied.GetLabels(), wantLabels)
+			}
+			if !reflect.DeepEqual(applied.GetAnnotations(), wantAnnotations) {
+				t.Errorf("annotations of the %v object = %v, want %v", tt.name, applied.GetAnnotations(), wantAnnotations)
+			}
+		})
+	}
+}
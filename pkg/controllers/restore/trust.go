@@ -0,0 +1,25 @@
+package restore
+
+import (
+	"fmt"
+
+	"github.com/rancher/backup-restore-operator/pkg/resourcesets"
+	"github.com/sirupsen/logrus"
+)
+
+// checkTrustBundles warns about the trust roots recorded by the backup that the cluster doesn't have, objects of the backup
+// relying on them may not work. The restore goes on regardless
+func (h *handler) checkTrustBundles(recorded []resourcesets.TrustBundle) ([]string, error) {
+	if len(recorded) == 0 {
+		return nil, nil
+	}
+	current, err := resourcesets.GatherTrustBundles(h.ctx, h.discoveryClient, h.dynamicClient)
+	if err != nil {
+		return nil, fmt.Errorf("error gathering trust bundles of the cluster: %v", err)
+	}
+	missing := resourcesets.MissingTrustRoots(recorded, current)
+	for _, cert := range missing {
+		logrus.Warnf("Trust root %v of the backup is missing in this cluster", cert)
+	}
+	return missing, nil
+}
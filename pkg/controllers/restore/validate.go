@@ -0,0 +1,136 @@
+package restore
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/wrangler/pkg/condition"
+	"github.com/rancher/wrangler/pkg/genericcondition"
+	"github.com/sirupsen/logrus"
+
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+)
+
+const validationNamespacePrefix = "restore-validation-"
+
+var namespaceGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+// validateRestore restores the namespaced resources of a backup into a temporary namespace, checks that every object
+// was created and deletes the namespace again. CRDs and clusterscoped resources are expected to exist already, they are
+// neither restored nor pruned, so the validation doesn't change anything outside the temporary namespace
+func (h *handler) validateRestore(restore *v1.Restore, objFromBackupCR ObjectsFromBackupCR, backupSource string) (*v1.Restore, error) {
+	validationNamespace, err := h.createValidationNamespace(restore)
+	if err != nil {
+		return h.setReconcilingCondition(restore, fmt.Errorf("error creating namespace for restore validation: %v", err))
+	}
+	logrus.Infof("Validating restore CR %v by restoring namespaced resources into namespace %v", restore.Name, validationNamespace)
+	defer h.deleteValidationNamespace(validationNamespace)
+
+	remapNamespaces(objFromBackupCR, func(string) string {
+		return validationNamespace
+	})
+
+	created := make(map[string]bool)
+	// clusterscoped owners aren't restored during validation, so treat them as existing to unblock their dependents
+	for info := range objFromBackupCR.crdInfoToData {
+		created[info.ConfigPath] = true
+	}
+	for info := range objFromBackupCR.clusterscopedResourceInfoToData {
+		created[info.ConfigPath] = true
+	}
+	var toRestore []restoreObj
+	restoreErr := h.restoreNamespacedResources(make(map[string][]restoreObj), &toRestore, make(map[string]int), created, objFromBackupCR, nil, restore.Spec.BatchSize)
+	if restoreErr != nil {
+		logrus.Errorf("Error restoring namespaced resources for validation of restore CR %v: %v", restore.Name, restoreErr)
+	}
+
+	var missing []string
+	for info, data := range objFromBackupCR.namespacedResourceInfoToData {
+		if isSkippedForValidation(info, data) {
+			continue
+		}
+		dr := h.dynamicClient.Resource(info.GVR).Namespace(data.GetNamespace())
+		if _, err := dr.Get(h.ctx, info.Name, k8sv1.GetOptions{}); err != nil {
+			logrus.Errorf("Validation of restore CR %v: %v of type %v was not restored: %v", restore.Name, info.Name, info.GVR.String(), err)
+			missing = append(missing, fmt.Sprintf("%s/%s", info.GVR.Resource, info.Name))
+		}
+	}
+
+	validated := len(missing) == 0
+	summary := fmt.Sprintf("Validated %v namespaced resources from the backup", len(objFromBackupCR.namespacedResourceInfoToData))
+	if !validated {
+		summary = fmt.Sprintf("Validation failed, %v namespaced resources could not be restored: %v", len(missing), strings.Join(missing, ", "))
+	}
+	logrus.Infof("Restore CR %v: %v", restore.Name, summary)
+
+	updateErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		restore, err = h.restores.Get(restore.Name, k8sv1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		restore.Status.Conditions = []genericcondition.GenericCondition{}
+		condition.Cond(v1.RestoreConditionValidated).SetStatusBool(restore, validated)
+		condition.Cond(v1.RestoreConditionValidated).Message(restore, summary)
+		condition.Cond(v1.RestoreConditionReady).SetStatusBool(restore, true)
+		if validated {
+			condition.Cond(v1.RestoreConditionReady).Message(restore, "Validated")
+		} else {
+			condition.Cond(v1.RestoreConditionReady).Message(restore, "Validation failed")
+		}
+
+		restore.Status.RestoreCompletionTS = time.Now().Format(time.RFC3339)
+		restore.Status.ObservedGeneration = restore.Generation
+		restore.Status.BackupSource = backupSource
+		restore.Status.Summary = summary
+		_, err = h.restores.UpdateStatus(restore)
+		return err
+	})
+	if updateErr != nil {
+		return h.setReconcilingCondition(restore, updateErr)
+	}
+	return restore, nil
+}
+
+func (h *handler) createValidationNamespace(restore *v1.Restore) (string, error) {
+	ns := &unstructured.Unstructured{}
+	ns.SetAPIVersion("v1")
+	ns.SetKind("Namespace")
+	ns.SetGenerateName(validationNamespacePrefix)
+	ns.SetLabels(map[string]string{"resources.cattle.io/restore-validation": restore.Name})
+	createdNs, err := h.dynamicClient.Resource(namespaceGVR).Create(h.ctx, ns, k8sv1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+	return createdNs.GetName(), nil
+}
+
+func (h *handler) deleteValidationNamespace(namespace string) {
+	logrus.Infof("Deleting restore validation namespace %v", namespace)
+	if err := h.dynamicClient.Resource(namespaceGVR).Delete(h.ctx, namespace, k8sv1.DeleteOptions{}); err != nil {
+		logrus.Errorf("Error deleting restore validation namespace %v, delete it manually: %v", namespace, err)
+	}
+}
+
+// isSkippedForValidation returns true for objects that generateDependencyGraph never restores
+func isSkippedForValidation(info objInfo, data unstructured.Unstructured) bool {
+	if data.GetKind() != "Deployment" || info.Namespace != "cattle-system" {
+		return false
+	}
+	return strings.HasSuffix(info.Name, "rancher") || strings.HasSuffix(info.Name, "rancher-webhook")
+}
+
+// remapNamespaces changes the namespace of every namespaced object from the backup to the one returned by targetNamespace.
+// Objects stay keyed by their original namespace so the dependency graph can still be built from the paths in the backup
+func remapNamespaces(objFromBackupCR ObjectsFromBackupCR, targetNamespace func(string) string) {
+	for info, data := range objFromBackupCR.namespacedResourceInfoToData {
+		if target := targetNamespace(info.Namespace); target != "" && target != info.Namespace {
+			data.SetNamespace(target)
+		}
+	}
+}
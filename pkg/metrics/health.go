@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron"
+)
+
+// scheduledBackup is the schedule of a Backup CR and the time of its last successful run, or of its creation if it never ran
+type scheduledBackup struct {
+	schedule    cron.Schedule
+	lastSuccess time.Time
+}
+
+var scheduledBackups = struct {
+	sync.Mutex
+	backups map[string]scheduledBackup
+}{backups: make(map[string]scheduledBackup)}
+
+// SetScheduledBackup records the last successful run of a scheduled Backup CR for /readyz, an empty schedule stops tracking it
+func SetScheduledBackup(backup, schedule string, lastSuccess time.Time) error {
+	scheduledBackups.Lock()
+	defer scheduledBackups.Unlock()
+	if schedule == "" {
+		delete(scheduledBackups.backups, backup)
+		return nil
+	}
+	cronSchedule, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return err
+	}
+	scheduledBackups.backups[backup] = scheduledBackup{schedule: cronSchedule, lastSuccess: lastSuccess}
+	return nil
+}
+
+// staleBackups returns the scheduled backups whose last successful run is older than the run after the one that was due
+// next, so a run in progress or being retried doesn't count as stale
+func staleBackups(now time.Time) []string {
+	scheduledBackups.Lock()
+	defer scheduledBackups.Unlock()
+	var stale []string
+	for name, backup := range scheduledBackups.backups {
+		if now.After(backup.schedule.Next(backup.schedule.Next(backup.lastSuccess))) {
+			stale = append(stale, fmt.Sprintf("%v (last succeeded %v)", name, backup.lastSuccess.Format(time.RFC3339)))
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// healthz is OK as long as the operator is running
+func healthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// readyz is OK if every scheduled backup succeeded recently, see staleBackups
+func readyz(w http.ResponseWriter, r *http.Request) {
+	if stale := staleBackups(time.Now()); len(stale) > 0 {
+		http.Error(w, "scheduled backups are overdue: "+strings.Join(stale, ", "), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
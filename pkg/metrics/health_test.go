@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadyz(t *testing.T) {
+	defer func() {
+		scheduledBackups.Lock()
+		scheduledBackups.backups = make(map[string]scheduledBackup)
+		scheduledBackups.Unlock()
+	}()
+	readiness := func() (int, string) {
+		w := httptest.NewRecorder()
+		readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return w.Code, w.Body.String()
+	}
+	now := time.Now()
+	steps := []struct {
+		name      string
+		backup    string
+		schedule  string
+		lastRun   time.Duration
+		wantCode  int
+		wantStale string
+	}{
+		{name: "no scheduled backups", wantCode: http.StatusOK},
+		{name: "ran within its schedule", backup: "hourly", schedule: "@every 1h", lastRun: 30 * time.Minute, wantCode: http.StatusOK},
+		{name: "next run in progress", backup: "hourly", schedule: "@every 1h", lastRun: 90 * time.Minute, wantCode: http.StatusOK},
+		{name: "last two runs failed", backup: "hourly", schedule: "@every 1h", lastRun: 3 * time.Hour, wantCode: http.StatusServiceUnavailable, wantStale: "hourly"},
+		{name: "other backup ran recently", backup: "daily", schedule: "@every 24h", lastRun: 3 * time.Hour, wantCode: http.StatusServiceUnavailable, wantStale: "hourly"},
+		{name: "succeeded again", backup: "hourly", schedule: "@every 1h", wantCode: http.StatusOK},
+		{name: "schedule shortened", backup: "daily", schedule: "@every 1h", lastRun: 3 * time.Hour, wantCode: http.StatusServiceUnavailable, wantStale: "daily"},
+		{name: "schedule removed", backup: "daily", wantCode: http.StatusOK},
+	}
+	for _, step := range steps {
+		if step.backup != "" {
+			if err := SetScheduledBackup(step.backup, step.schedule, now.Add(-step.lastRun)); err != nil {
+				t.Fatalf("%v: SetScheduledBackup() error: %v", step.name, err)
+			}
+		}
+		code, body := readiness()
+		if code != step.wantCode {
+			t.Errorf("%v: /readyz code = %v, want %v", step.name, code, step.wantCode)
+		}
+		if step.wantStale != "" && !strings.Contains(body, step.wantStale+" (last succeeded") {
+			t.Errorf("%v: /readyz = %q, want it to name backup %v", step.name, body, step.wantStale)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	healthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("/healthz code = %v, want %v", w.Code, http.StatusOK)
+	}
+}
+
+func TestSetScheduledBackupInvalidSchedule(t *testing.T) {
+	if err := SetScheduledBackup("nightly", "not a schedule", time.Now()); err == nil {
+		t.Errorf("SetScheduledBackup() with an invalid schedule succeeded")
+	}
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+const namespace = "backup_restore_operator"
+
+var (
+	encryptionProviderDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "encryption_provider_duration_seconds",
+		Help:      "Latency of calls to the encryption provider, including KMS plugins",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+	}, []string{"operation"})
+	encryptionProviderFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "encryption_provider_failures_total",
+		Help:      "Number of failed calls to the encryption provider, by reason timeout or error",
+	}, []string{"operation", "reason"})
+	backupsWaiting = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backups_waiting",
+		Help:      "Number of backups waiting for one of the running backups to finish, see MAX_CONCURRENT_BACKUPS",
+	})
+	backupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "backup_duration_seconds",
+		Help:      "Duration of completed backups, from gathering the resources to storing the artifact",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"backup"})
+	backupObjectCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backup_object_count",
+		Help:      "Number of objects in the last completed backup",
+	}, []string{"backup"})
+	backupSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backup_size_bytes",
+		Help:      "Size of the artifact of the last completed backup",
+	}, []string{"backup"})
+	backupFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backup_failures_total",
+		Help:      "Number of failed runs of a backup",
+	}, []string{"backup"})
+)
+
+func init() {
+	prometheus.MustRegister(encryptionProviderDuration, encryptionProviderFailures, backupsWaiting, backupDuration, backupObjectCount,
+		backupSize, backupFailures)
+}
+
+func ObserveEncryptionProviderCall(operation string, duration time.Duration) {
+	encryptionProviderDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+func IncEncryptionProviderFailures(operation, reason string) {
+	encryptionProviderFailures.WithLabelValues(operation, reason).Inc()
+}
+
+func SetBackupsWaiting(count int) {
+	backupsWaiting.Set(float64(count))
+}
+
+func ObserveBackup(backup string, duration time.Duration, objectCount int, size int64) {
+	backupDuration.WithLabelValues(backup).Observe(duration.Seconds())
+	backupObjectCount.WithLabelValues(backup).Set(float64(objectCount))
+	backupSize.WithLabelValues(backup).Set(float64(size))
+}
+
+func IncBackupFailures(backup string) {
+	backupFailures.WithLabelValues(backup).Inc()
+}
+
+// DeleteBackup removes the metrics of a deleted Backup CR
+func DeleteBackup(backup string) {
+	backupDuration.DeleteLabelValues(backup)
+	backupObjectCount.DeleteLabelValues(backup)
+	backupSize.DeleteLabelValues(backup)
+	backupFailures.DeleteLabelValues(backup)
+	SetScheduledBackup(backup, "", time.Time{})
+}
+
+// Serve exposes all metrics on /metrics, and /healthz and /readyz for the probes of the deployment. It is meant to run
+// in its own goroutine
+func Serve(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", healthz)
+	mux.HandleFunc("/readyz", readyz)
+	logrus.Infof("Serving metrics on %v/metrics", address)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		logrus.Errorf("Error serving metrics: %v", err)
+	}
+}
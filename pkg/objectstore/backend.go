@@ -0,0 +1,25 @@
+package objectstore
+
+import (
+	"io"
+	"time"
+)
+
+// StorageBackend stores backup artifacts by key. Keys are relative to the root of the backend, like the folder of a bucket
+type StorageBackend interface {
+	// Put stores the content of r under key, an interrupted Put never leaves a partial object under key
+	Put(key string, r io.Reader) error
+	// Get returns the content stored under key, the caller closes it
+	Get(key string) (io.ReadCloser, error)
+	// List returns the keys starting with prefix, sorted
+	List(prefix string) ([]string, error)
+	// Stat returns the size and modification time of the object stored under key, retention ages objects by it
+	Stat(key string) (ObjectInfo, error)
+	Delete(key string) error
+}
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
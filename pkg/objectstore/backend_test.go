@@ -0,0 +1,129 @@
+package objectstore
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingReader returns part of an artifact and then fails, like a backup interrupted while it's stored
+type failingReader struct {
+	data io.Reader
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+// testStorageBackend checks the behaviour every StorageBackend has, backend must be empty
+func testStorageBackend(t *testing.T, backend StorageBackend) {
+	artifacts := map[string]string{
+		"nightly-2020-09-15.tar.gz": "first",
+		"nightly-2020-09-16.tar.gz": "second",
+		"weekly-2020-09-14.tar.gz":  "third",
+	}
+	for key, content := range artifacts {
+		if err := backend.Put(key, strings.NewReader(content)); err != nil {
+			t.Fatalf("Put(%v) error: %v", key, err)
+		}
+	}
+
+	for key, content := range artifacts {
+		r, err := backend.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%v) error: %v", key, err)
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || string(data) != content {
+			t.Errorf("Get(%v) = %q, %v, want %q", key, data, err, content)
+		}
+		info, err := backend.Stat(key)
+		if err != nil {
+			t.Fatalf("Stat(%v) error: %v", key, err)
+		}
+		if info.Key != key || info.Size != int64(len(content)) || time.Since(info.LastModified) > time.Hour {
+			t.Errorf("Stat(%v) = %+v, want the key, a size of %v and a recent modification", key, info, len(content))
+		}
+	}
+
+	listTests := []struct {
+		prefix string
+		want   []string
+	}{
+		{prefix: "", want: []string{"nightly-2020-09-15.tar.gz", "nightly-2020-09-16.tar.gz", "weekly-2020-09-14.tar.gz"}},
+		{prefix: "nightly-", want: []string{"nightly-2020-09-15.tar.gz", "nightly-2020-09-16.tar.gz"}},
+		{prefix: "monthly-"},
+	}
+	for _, tt := range listTests {
+		if got, err := backend.List(tt.prefix); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("List(%q) = %v, %v, want %v", tt.prefix, got, err, tt.want)
+		}
+	}
+
+	if err := backend.Put("nightly-2020-09-15.tar.gz", strings.NewReader("replaced")); err != nil {
+		t.Fatalf("Put() of an existing key error: %v", err)
+	}
+	if info, err := backend.Stat("nightly-2020-09-15.tar.gz"); err != nil || info.Size != int64(len("replaced")) {
+		t.Errorf("Stat() of a replaced object = %+v, %v, want the new size", info, err)
+	}
+
+	if err := backend.Put("nightly-2020-09-17.tar.gz", &failingReader{data: strings.NewReader("interrupted")}); err == nil {
+		t.Errorf("Put() of an interrupted artifact succeeded")
+	}
+	if _, err := backend.Stat("nightly-2020-09-17.tar.gz"); err == nil {
+		t.Errorf("interrupted Put() left an object")
+	}
+
+	if err := backend.Delete("nightly-2020-09-16.tar.gz"); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if _, err := backend.Get("nightly-2020-09-16.tar.gz"); err == nil {
+		t.Errorf("Get() of a deleted object succeeded")
+	}
+	want := []string{"nightly-2020-09-15.tar.gz", "weekly-2020-09-14.tar.gz"}
+	if got, err := backend.List(""); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("List() after Delete() = %v, %v, want %v", got, err, want)
+	}
+	if _, err := backend.Get("missing.tar.gz"); err == nil {
+		t.Errorf("Get() of a missing object succeeded")
+	}
+}
+
+func TestLocalBackend(t *testing.T) {
+	dir := t.TempDir()
+	testStorageBackend(t, NewLocalBackend(dir))
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), PartialFileSuffix) {
+			t.Errorf("partial file %v left in the backup dir", file.Name())
+		}
+	}
+}
+
+func TestLocalBackendListLeavesOutPartialFiles(t *testing.T) {
+	dir := t.TempDir()
+	backend := NewLocalBackend(dir)
+	if err := backend.Put("nightly-2020-09-15.tar.gz", strings.NewReader("complete")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(backend.Path("nightly-2020-09-16.tar.gz")+PartialFileSuffix, []byte("part"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"nightly-2020-09-15.tar.gz"}
+	if got, err := backend.List("nightly-"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %v, %v, want %v", got, err, want)
+	}
+}
@@ -0,0 +1,85 @@
+package objectstore
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rancher/backup-restore-operator/pkg/util"
+)
+
+// PartialFileSuffix is added to the files of a LocalBackend until they're complete
+const PartialFileSuffix = ".partial"
+
+// LocalBackend stores artifacts as files in a directory, like the persistent volume of the operator
+type LocalBackend struct {
+	Dir string
+}
+
+func NewLocalBackend(dir string) *LocalBackend {
+	return &LocalBackend{Dir: dir}
+}
+
+// Path is the file an artifact is stored in
+func (b *LocalBackend) Path(key string) string {
+	return filepath.Join(b.Dir, filepath.FromSlash(key))
+}
+
+// Put writes to a partial file and renames it once complete, so an interrupted backup never leaves a truncated file
+// that looks like a complete backup
+func (b *LocalBackend) Put(key string, r io.Reader) error {
+	partialPath := b.Path(key) + PartialFileSuffix
+	file, err := os.OpenFile(partialPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, util.BackupFileMode)
+	if err != nil {
+		return fmt.Errorf("error creating %v: %v", key, err)
+	}
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partialPath)
+		return fmt.Errorf("error writing %v: %v", key, err)
+	}
+	if err := os.Rename(partialPath, b.Path(key)); err != nil {
+		return fmt.Errorf("error completing %v: %v", key, err)
+	}
+	return nil
+}
+
+func (b *LocalBackend) Get(key string) (io.ReadCloser, error) {
+	return os.Open(b.Path(key))
+}
+
+// List returns the files of Dir starting with prefix, partial files are left out
+func (b *LocalBackend) List(prefix string) ([]string, error) {
+	files, err := ioutil.ReadDir(b.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), prefix) || strings.HasSuffix(file.Name(), PartialFileSuffix) {
+			continue
+		}
+		keys = append(keys, file.Name())
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (b *LocalBackend) Stat(key string) (ObjectInfo, error) {
+	fileInfo, err := os.Stat(b.Path(key))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, Size: fileInfo.Size(), LastModified: fileInfo.ModTime()}, nil
+}
+
+func (b *LocalBackend) Delete(key string) error {
+	return os.Remove(b.Path(key))
+}
@@ -21,7 +21,9 @@ import (
 
 	"github.com/minio/minio-go/v6"
 	"github.com/minio/minio-go/v6/pkg/credentials"
+	"github.com/minio/minio-go/v6/pkg/encrypt"
 	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/util"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -31,6 +33,9 @@ const (
 	s3ServerRetries = 3
 	s3Endpoint      = "s3.amazonaws.com"
 	contentType     = "application/gzip"
+
+	ServerSideEncryptionS3  = "SSE-S3"
+	ServerSideEncryptionKMS = "SSE-KMS"
 )
 
 func SetS3Service(bc *v1.S3ObjectStore, accessKey, secretKey string, useSSL bool) (*minio.Client, error) {
@@ -144,11 +149,38 @@ func getBucketLookupType(endpoint string) minio.BucketLookupType {
 	return minio.BucketLookupAuto
 }
 
-func UploadBackupFile(svc *minio.Client, bucketName, fileName, filePath string) error {
+// ServerSideEncryption returns the SSE headers for uploads to the object store, nil uploads without SSE
+func ServerSideEncryption(objectStore *v1.S3ObjectStore) (encrypt.ServerSide, error) {
+	switch objectStore.ServerSideEncryption {
+	case "":
+		if objectStore.KMSKeyID != "" {
+			return nil, fmt.Errorf("kmsKeyID requires serverSideEncryption %v", ServerSideEncryptionKMS)
+		}
+		return nil, nil
+	case ServerSideEncryptionS3:
+		if objectStore.KMSKeyID != "" {
+			return nil, fmt.Errorf("kmsKeyID requires serverSideEncryption %v", ServerSideEncryptionKMS)
+		}
+		return encrypt.NewSSE(), nil
+	case ServerSideEncryptionKMS:
+		if objectStore.KMSKeyID == "" {
+			return nil, fmt.Errorf("serverSideEncryption %v requires a kmsKeyID", ServerSideEncryptionKMS)
+		}
+		sse, err := encrypt.NewSSEKMS(objectStore.KMSKeyID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kmsKeyID %v: %v", objectStore.KMSKeyID, err)
+		}
+		return sse, nil
+	default:
+		return nil, fmt.Errorf("invalid serverSideEncryption %v, must be %v or %v", objectStore.ServerSideEncryption, ServerSideEncryptionS3, ServerSideEncryptionKMS)
+	}
+}
+
+func UploadBackupFile(svc *minio.Client, bucketName, fileName, filePath string, sse encrypt.ServerSide) error {
 	// Upload the zip file with FPutObject
 	log.Infof("invoking uploading backup file [%s] to s3", fileName)
 	for retries := 0; retries <= s3ServerRetries; retries++ {
-		n, err := svc.FPutObject(bucketName, fileName, filePath, minio.PutObjectOptions{ContentType: contentType})
+		n, err := svc.FPutObject(bucketName, fileName, filePath, minio.PutObjectOptions{ContentType: contentType, ServerSideEncryption: sse})
 		if err != nil {
 			log.Infof("failed to upload backup file: %v, retried %d times", err, retries)
 			if retries >= s3ServerRetries {
@@ -211,7 +243,7 @@ func DownloadFromS3WithPrefix(client *minio.Client, prefix, bucket string) (stri
 	if _, err = io.Copy(localFile, object); err != nil {
 		return "", fmt.Errorf("failed to copy retrieved object to local file [%s]: %v", targetFileLocation, err)
 	}
-	if err := os.Chmod(targetFileLocation, 0600); err != nil {
+	if err := os.Chmod(targetFileLocation, util.BackupFileMode); err != nil {
 		return "", fmt.Errorf("changing permission of the locally downloaded snapshot failed")
 	}
 
@@ -0,0 +1,169 @@
+package resourcesets
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher/backup-restore-operator/pkg/util"
+)
+
+// FileWriter writes a file of the backup, relativePath is the path of the file within the backup
+type FileWriter interface {
+	WriteFile(relativePath string, data []byte) error
+}
+
+// DirWriter writes the files of the backup into a directory, to be compressed once the backup is complete
+type DirWriter string
+
+// WriteFile writes the data to a .tmp sibling and renames it over the file once it's synced, so a crash or a full disk
+// never leaves a truncated file in the backup
+func (d DirWriter) WriteFile(relativePath string, data []byte) error {
+	path := filepath.Join(string(d), relativePath)
+	if err := os.MkdirAll(filepath.Dir(path), util.BackupDirMode); err != nil {
+		return fmt.Errorf("error creating temp dir: %v", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := writeAndSync(tmpPath, data); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error writing %v: %v", relativePath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error writing %v: %v", relativePath, err)
+	}
+	return nil
+}
+
+func writeAndSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, util.BackupFileMode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ArtifactWriter streams the files of the backup straight into the tar gzip artifact, so no loose files are written and
+// read again. Shards are written in parallel, so writes are serialized
+type ArtifactWriter struct {
+	sync.Mutex
+	out  io.WriteCloser
+	gw   *gzip.Writer
+	tw   *tar.Writer
+	dirs map[string]bool
+	// Reproducible sets the same time on every header, see ReproducibleModTime
+	Reproducible bool
+}
+
+// ReproducibleModTime is the time of every file in a reproducible artifact, so an artifact only changes with its content
+var ReproducibleModTime = time.Unix(0, 0)
+
+func (a *ArtifactWriter) modTime() time.Time {
+	if a.Reproducible {
+		return ReproducibleModTime
+	}
+	return time.Now()
+}
+
+func NewArtifactWriter(artifactPath string) (*ArtifactWriter, error) {
+	file, err := os.OpenFile(artifactPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, util.BackupFileMode)
+	if err != nil {
+		return nil, fmt.Errorf("error creating backup tar gzip file: %v", err)
+	}
+	return NewArtifactStreamWriter(file), nil
+}
+
+// NewArtifactStreamWriter writes the tar gzip artifact into out instead of a file, like os.Stdout or a named pipe, so the
+// backup can be piped into other tools. out is closed by Close
+func NewArtifactStreamWriter(out io.WriteCloser) *ArtifactWriter {
+	gw := gzip.NewWriter(out)
+	return &ArtifactWriter{
+		out:  out,
+		gw:   gw,
+		tw:   tar.NewWriter(gw),
+		dirs: make(map[string]bool),
+	}
+}
+
+func (a *ArtifactWriter) WriteFile(relativePath string, data []byte) error {
+	a.Lock()
+	defer a.Unlock()
+	if err := a.writeDirs(filepath.Dir(relativePath)); err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     relativePath,
+		Mode:     int64(util.BackupFileMode),
+		Size:     int64(len(data)),
+		ModTime:  a.modTime(),
+	}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("error writing header for %v: %v", relativePath, err)
+	}
+	if _, err := a.tw.Write(data); err != nil {
+		return fmt.Errorf("error writing %v: %v", relativePath, err)
+	}
+	return nil
+}
+
+// writeDirs adds headers for the parent directories of a file, like a tarball of the backup directory has them
+func (a *ArtifactWriter) writeDirs(dir string) error {
+	if dir == "." {
+		return nil
+	}
+	var path string
+	for _, part := range strings.Split(dir, string(filepath.Separator)) {
+		path = filepath.Join(path, part)
+		if a.dirs[path] {
+			continue
+		}
+		hdr := &tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     path,
+			Mode:     int64(util.BackupDirMode),
+			ModTime:  a.modTime(),
+		}
+		if err := a.tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("error writing header for %v: %v", path, err)
+		}
+		a.dirs[path] = true
+	}
+	return nil
+}
+
+// Close completes the artifact, it's only valid once Close returned without error
+func (a *ArtifactWriter) Close() error {
+	a.Lock()
+	defer a.Unlock()
+	if err := a.tw.Close(); err != nil {
+		a.out.Close()
+		return err
+	}
+	if err := a.gw.Close(); err != nil {
+		a.out.Close()
+		return err
+	}
+	return a.out.Close()
+}
+
+func (h *ResourceHandler) fileWriter(backupPath string) FileWriter {
+	if h.Writer != nil {
+		return h.Writer
+	}
+	return DirWriter(backupPath)
+}
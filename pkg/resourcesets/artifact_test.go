@@ -0,0 +1,227 @@
+package resourcesets
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDirWriterLeavesNoPartialFile(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("writes to /dev/full simulate a full disk, it doesn't exist here")
+	}
+	tests := []struct {
+		name     string
+		existing []byte
+	}{
+		{name: "new file"},
+		{name: "existing file", existing: []byte(`{"kind":"Secret"}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backupPath := t.TempDir()
+			relativePath := filepath.Join("secrets.#v1", "cattle-system", "creds.json")
+			path := filepath.Join(backupPath, relativePath)
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if tt.existing != nil {
+				if err := ioutil.WriteFile(path, tt.existing, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// every write to the temp file fails like on a full disk
+			if err := os.Symlink("/dev/full", path+".tmp"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := DirWriter(backupPath).WriteFile(relativePath, []byte(`{"kind":"Secret","data":{}}`)); err == nil {
+				t.Fatalf("WriteFile() to a full disk succeeded")
+			}
+			data, err := ioutil.ReadFile(path)
+			if tt.existing == nil && !os.IsNotExist(err) {
+				t.Errorf("failed write left %q behind, err %v", data, err)
+			}
+			if tt.existing != nil && string(data) != string(tt.existing) {
+				t.Errorf("failed write changed the file to %q, want %q", data, tt.existing)
+			}
+			if _, err := os.Lstat(path + ".tmp"); !os.IsNotExist(err) {
+				t.Errorf("failed write left the temp file behind: %v", err)
+			}
+		})
+	}
+}
+
+func TestDirWriter(t *testing.T) {
+	backupPath := t.TempDir()
+	relativePath := filepath.Join("secrets.#v1", "cattle-system", "creds.json")
+	for _, data := range []string{`{"kind":"Secret"}`, `{"kind":"Secret","data":{}}`} {
+		if err := DirWriter(backupPath).WriteFile(relativePath, []byte(data)); err != nil {
+			t.Fatalf("WriteFile() error: %v", err)
+		}
+		got, err := ioutil.ReadFile(filepath.Join(backupPath, relativePath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("WriteFile() wrote %q, want %q", got, data)
+		}
+	}
+	files, err := readBackupFiles(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("backup has files %v, want only %v", files, relativePath)
+	}
+}
+
+type closingBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closingBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestDirAndStreamWritersWriteTheSameFiles(t *testing.T) {
+	write := func(writer FileWriter, backupPath string) {
+		h := &ResourceHandler{
+			GVResourceToObjects: map[GVResource][]unstructured.Unstructured{
+				secretsGVResource:     testSecrets(6),
+				deploymentsGVResource: {*testObject("apps/v1", "Deployment", "default", "web")},
+			},
+			GVResourceToShards: map[GVResource]int{secretsGVResource: 2},
+			Writer:             writer,
+		}
+		if err := h.WriteBackupObjects(backupPath); err != nil {
+			t.Fatalf("WriteBackupObjects() error: %v", err)
+		}
+		if err := WriteManifest(h.fileWriter(backupPath), &h.Manifest); err != nil {
+			t.Fatalf("WriteManifest() error: %v", err)
+		}
+	}
+
+	dirPath := t.TempDir()
+	write(nil, dirPath)
+	dirFiles, err := readBackupFiles(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream := &closingBuffer{}
+	artifact := NewArtifactStreamWriter(stream)
+	write(artifact, "")
+	if err := artifact.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	if !stream.closed {
+		t.Errorf("Close() didn't close the stream")
+	}
+	artifactPath := filepath.Join(t.TempDir(), "backup.tar.gz")
+	if err := ioutil.WriteFile(artifactPath, stream.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	streamFiles, err := readBackupFiles(artifactPath)
+	if err != nil {
+		t.Fatalf("streamed backup isn't a tar gzip: %v", err)
+	}
+
+	if len(dirFiles) < 4 {
+		t.Fatalf("dir backup has files %v, want the shards, the deployment and the manifest", len(dirFiles))
+	}
+	for path, data := range dirFiles {
+		if streamed, ok := streamFiles[path]; !ok || !bytes.Equal(streamed, data) {
+			t.Errorf("streamed file %v = %q, want the file of the dir backup %q", path, streamed, data)
+		}
+	}
+	for path := range streamFiles {
+		if _, ok := dirFiles[path]; !ok {
+			t.Errorf("streamed backup has file %v the dir backup doesn't have", path)
+		}
+	}
+}
+
+func TestBackupPermissions(t *testing.T) {
+	objects := map[GVResource][]unstructured.Unstructured{
+		secretsGVResource:     testSecrets(3),
+		deploymentsGVResource: {*testObject("apps/v1", "Deployment", "default", "web")},
+	}
+	backupPath := t.TempDir()
+	h := &ResourceHandler{GVResourceToObjects: objects}
+	if err := h.WriteBackupObjects(backupPath); err != nil {
+		t.Fatalf("WriteBackupObjects() error: %v", err)
+	}
+	err := filepath.Walk(backupPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == backupPath {
+			return err
+		}
+		want := util.BackupFileMode
+		if info.IsDir() {
+			want = util.BackupDirMode
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%v has permissions %v, want %v", path, info.Mode().Perm(), want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	artifactPath := filepath.Join(t.TempDir(), "backup.tar.gz")
+	artifact, err := NewArtifactWriter(artifactPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h = &ResourceHandler{GVResourceToObjects: objects, Writer: artifact}
+	if err := h.WriteBackupObjects(""); err != nil {
+		t.Fatalf("WriteBackupObjects() to the artifact error: %v", err)
+	}
+	if err := artifact.Close(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(artifactPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != util.BackupFileMode {
+		t.Errorf("artifact has permissions %v, want %v", info.Mode().Perm(), util.BackupFileMode)
+	}
+	f, err := os.Open(artifactPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := util.BackupFileMode
+		if hdr.Typeflag == tar.TypeDir {
+			want = util.BackupDirMode
+		}
+		if os.FileMode(hdr.Mode) != want {
+			t.Errorf("%v in the artifact has permissions %v, want %v", hdr.Name, os.FileMode(hdr.Mode), want)
+		}
+	}
+}
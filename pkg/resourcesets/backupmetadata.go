@@ -0,0 +1,28 @@
+package resourcesets
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// BackupMetadataFileName is the file at the root of a backup recording what produced it, for restores into other clusters
+const BackupMetadataFileName = "backup-metadata.json"
+
+// BackupMetadata records the versions a backup was taken with. ResourceSetHash is the sha256 of the filters file, so
+// backups taken with the same ResourceSet can be told apart from others without comparing the filters
+type BackupMetadata struct {
+	KubernetesVersion string `json:"kubernetesVersion"`
+	OperatorVersion   string `json:"operatorVersion"`
+	StartedAt         string `json:"startedAt"`
+	CompletedAt       string `json:"completedAt"`
+	ResourceSetHash   string `json:"resourceSetHash"`
+	Encrypted         bool   `json:"encrypted"`
+}
+
+func WriteBackupMetadata(w FileWriter, metadata *BackupMetadata) error {
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("error converting backup metadata to JSON: %v", err)
+	}
+	return w.WriteFile(BackupMetadataFileName, metadataBytes)
+}
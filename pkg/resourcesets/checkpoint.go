@@ -0,0 +1,209 @@
+package resourcesets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"github.com/sirupsen/logrus"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage/value"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	checkpointProgressFileName = "progress.json"
+	// checkpointListMaxAge bounds how old a checkpointed list may be when it's used, older lists are listed again so
+	// retries of a backup failing for a long time don't keep writing objects as they were on the first attempt
+	checkpointListMaxAge = 15 * time.Minute
+)
+
+// Checkpoint keeps the list of every resource gathered by a backup in a working dir, so a backup interrupted by a crash
+// or restart of the operator doesn't list the completed resources again. Lists are encrypted like the objects of the backup
+type Checkpoint struct {
+	// lock guards the progress, lists of a selector are saved in parallel
+	lock         sync.Mutex
+	dir          string
+	transformers map[schema.GroupResource]value.Transformer
+	progress     checkpointProgress
+	resumed      bool
+}
+
+// checkpointProgress is persisted after every completed list. Lists maps the listKey of every completed list to its file
+type checkpointProgress struct {
+	Fingerprint string                    `json:"fingerprint"`
+	Lists       map[string]checkpointFile `json:"lists"`
+}
+
+// checkpointFile is the file a list was saved to and when
+type checkpointFile struct {
+	Name    string    `json:"name"`
+	SavedAt time.Time `json:"savedAt"`
+}
+
+// OpenCheckpoint opens the checkpoint in dir, one written for a different fingerprint, for example after the ResourceSet
+// or the Backup spec changed, is discarded and the gather starts over
+func OpenCheckpoint(dir, fingerprint string, transformers map[schema.GroupResource]value.Transformer) (*Checkpoint, error) {
+	c := &Checkpoint{
+		dir:          dir,
+		transformers: transformers,
+		progress:     checkpointProgress{Fingerprint: fingerprint, Lists: make(map[string]checkpointFile)},
+	}
+	progressBytes, err := ioutil.ReadFile(filepath.Join(dir, checkpointProgressFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading checkpoint %v: %v", dir, err)
+	}
+	if err == nil {
+		var progress checkpointProgress
+		if err := json.Unmarshal(progressBytes, &progress); err != nil || progress.Fingerprint != fingerprint {
+			logrus.Infof("Discarding checkpoint %v, it was written for a different backup spec", dir)
+		} else if len(progress.Lists) > 0 {
+			logrus.Infof("Resuming gather from checkpoint %v with %v completed lists", dir, len(progress.Lists))
+			c.progress.Lists = progress.Lists
+			c.resumed = true
+			return c, nil
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, fmt.Errorf("error discarding checkpoint %v: %v", dir, err)
+		}
+	}
+	if err := os.MkdirAll(dir, util.BackupDirMode); err != nil {
+		return nil, fmt.Errorf("error creating checkpoint dir %v: %v", dir, err)
+	}
+	return c, nil
+}
+
+// Resumed is true when lists of an earlier attempt were loaded from the checkpoint
+func (c *Checkpoint) Resumed() bool {
+	return c.resumed
+}
+
+// Discard removes the checkpoint, the next gather lists every resource again
+func (c *Checkpoint) Discard() error {
+	c.progress.Lists = make(map[string]checkpointFile)
+	c.resumed = false
+	return os.RemoveAll(c.dir)
+}
+
+func (key listKey) String() string {
+	return fmt.Sprintf("%s#%s#%s", key.gvr.String(), key.labelSelector, key.fieldSelector)
+}
+
+// load returns the list completed by an earlier attempt, nil if there is none or it's older than checkpointListMaxAge
+func (c *Checkpoint) load(key listKey) (*unstructured.UnstructuredList, error) {
+	c.lock.Lock()
+	file, ok := c.progress.Lists[key.String()]
+	c.lock.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	if age := time.Since(file.SavedAt); age > checkpointListMaxAge {
+		logrus.Infof("Listing %v again, its checkpointed list was saved %v ago", key.gvr.String(), age.Round(time.Second))
+		return nil, nil
+	}
+	fileName := file.Name
+	listBytes, err := ioutil.ReadFile(filepath.Join(c.dir, fileName))
+	if err != nil {
+		return nil, fmt.Errorf("error reading checkpointed list of %v: %v", key.gvr.String(), err)
+	}
+	if transformer := c.transformerFor(key.gvr); transformer != nil {
+		var encrypted []byte
+		if err := json.Unmarshal(listBytes, &encrypted); err != nil {
+			return nil, fmt.Errorf("error reading checkpointed list of %v: %v", key.gvr.String(), err)
+		}
+		listBytes, err = util.TransformFromStorage(transformer, encrypted, value.DefaultContext([]byte(checkpointAdditionalAuthenticatedData(fileName))))
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting checkpointed list of %v: %v", key.gvr.String(), err)
+		}
+	}
+	list := &unstructured.UnstructuredList{}
+	if err := list.UnmarshalJSON(listBytes); err != nil {
+		return nil, fmt.Errorf("error reading checkpointed list of %v: %v", key.gvr.String(), err)
+	}
+	logrus.Debugf("Using checkpointed list of %v at resource version %v", key.gvr.String(), list.GetResourceVersion())
+	return list, nil
+}
+
+// save writes the list and then the progress, both through a rename so a crash never leaves a partial file behind
+func (c *Checkpoint) save(key listKey, list *unstructured.UnstructuredList) error {
+	keyHash := sha256.Sum256([]byte(key.String()))
+	fileName := hex.EncodeToString(keyHash[:]) + ".json"
+	listBytes, err := list.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("error converting list of %v to JSON for checkpoint: %v", key.gvr.String(), err)
+	}
+	if transformer := c.transformerFor(key.gvr); transformer != nil {
+		encrypted, err := util.TransformToStorage(transformer, listBytes, value.DefaultContext([]byte(checkpointAdditionalAuthenticatedData(fileName))))
+		if err != nil {
+			return err
+		}
+		if listBytes, err = json.Marshal(encrypted); err != nil {
+			return fmt.Errorf("error converting encrypted list of %v to JSON for checkpoint: %v", key.gvr.String(), err)
+		}
+	}
+	if err := c.writeFile(fileName, listBytes); err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.progress.Lists[key.String()] = checkpointFile{Name: fileName, SavedAt: time.Now()}
+	progressBytes, err := json.Marshal(c.progress)
+	if err != nil {
+		return fmt.Errorf("error converting checkpoint progress to JSON: %v", err)
+	}
+	return c.writeFile(checkpointProgressFileName, progressBytes)
+}
+
+func (c *Checkpoint) writeFile(fileName string, data []byte) error {
+	tmpFile := filepath.Join(c.dir, fileName+".tmp")
+	if err := ioutil.WriteFile(tmpFile, data, util.BackupFileMode); err != nil {
+		return fmt.Errorf("error writing checkpoint file %v: %v", fileName, err)
+	}
+	if err := os.Rename(tmpFile, filepath.Join(c.dir, fileName)); err != nil {
+		return fmt.Errorf("error writing checkpoint file %v: %v", fileName, err)
+	}
+	return nil
+}
+
+func (c *Checkpoint) transformerFor(gvr schema.GroupVersionResource) value.Transformer {
+	return c.transformers[gvr.GroupResource()]
+}
+
+func checkpointAdditionalAuthenticatedData(fileName string) string {
+	return "checkpoint#" + fileName
+}
+
+// checkpointedList returns the list of an earlier attempt, or lists the resource and adds it to the checkpoint
+func (h *ResourceHandler) checkpointedList(ctx context.Context, dr dynamic.ResourceInterface, key listKey,
+	listOptions k8sv1.ListOptions) (*unstructured.UnstructuredList, error) {
+	listOptions.Limit = h.PageSize
+	if h.Checkpoint == nil {
+		return paginateListResults(ctx, dr, listOptions)
+	}
+	list, err := h.Checkpoint.load(key)
+	if err != nil {
+		// a damaged list is listed again instead of failing every retry of the backup
+		logrus.Warnf("Listing %v again: %v", key.gvr.String(), err)
+	} else if list != nil {
+		return list, nil
+	}
+	list, err = paginateListResults(ctx, dr, listOptions)
+	if err != nil {
+		return list, err
+	}
+	if err := h.Checkpoint.save(key, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
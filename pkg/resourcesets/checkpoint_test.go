@@ -0,0 +1,77 @@
+package resourcesets
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func testList(resourceVersion string) *unstructured.UnstructuredList {
+	list := &unstructured.UnstructuredList{Object: map[string]interface{}{"apiVersion": "v1", "kind": "SecretList"}}
+	list.SetResourceVersion(resourceVersion)
+	list.Items = []unstructured.Unstructured{testSecret()}
+	return list
+}
+
+func TestCheckpointLoad(t *testing.T) {
+	key := listKey{gvr: schema.GroupVersionResource{Version: "v1", Resource: "secrets"}}
+	tests := []struct {
+		name         string
+		transformers bool
+		savedAgo     time.Duration
+		fingerprint  string
+		wantList     bool
+	}{
+		{name: "fresh list", savedAgo: time.Minute, fingerprint: "spec", wantList: true},
+		{name: "fresh encrypted list", transformers: true, savedAgo: time.Minute, fingerprint: "spec", wantList: true},
+		{name: "list older than max age", savedAgo: checkpointListMaxAge + time.Minute, fingerprint: "spec"},
+		{name: "different fingerprint", savedAgo: time.Minute, fingerprint: "changed spec"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "checkpoint")
+			transformers := testTransformers(t)
+			if !tt.transformers {
+				transformers = nil
+			}
+			c, err := OpenCheckpoint(dir, "spec", transformers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.save(key, testList("42")); err != nil {
+				t.Fatalf("save() error: %v", err)
+			}
+			// persist the save time the test needs, the progress is rewritten by the next save
+			file := c.progress.Lists[key.String()]
+			file.SavedAt = time.Now().Add(-tt.savedAgo)
+			c.progress.Lists[key.String()] = file
+			if err := c.save(listKey{gvr: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}}, testList("43")); err != nil {
+				t.Fatalf("save() error: %v", err)
+			}
+
+			resumed, err := OpenCheckpoint(dir, tt.fingerprint, transformers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			list, err := resumed.load(key)
+			if err != nil {
+				t.Fatalf("load() error: %v", err)
+			}
+			if !tt.wantList {
+				if list != nil {
+					t.Errorf("load() = list at resource version %v, want none", list.GetResourceVersion())
+				}
+				return
+			}
+			if list == nil {
+				t.Fatal("load() = nil, want the saved list")
+			}
+			if list.GetResourceVersion() != "42" || len(list.Items) != 1 || list.Items[0].GetName() != "creds" {
+				t.Errorf("load() = list at resource version %v with %v items, want the saved list", list.GetResourceVersion(), len(list.Items))
+			}
+		})
+	}
+}
@@ -3,14 +3,18 @@ package resourcesets
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/util"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -18,9 +22,14 @@ import (
 	"k8s.io/apiserver/pkg/storage/value"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
 )
 
-const ListObjectsLimit = 200
+const (
+	ListObjectsLimit = 200
+	// DefaultParallelism is the number of resources of a selector gathered at the same time
+	DefaultParallelism = 5
+)
 
 type GVResource struct {
 	GroupVersion schema.GroupVersion
@@ -33,6 +42,59 @@ type ResourceHandler struct {
 	DynamicClient       dynamic.Interface
 	TransformerMap      map[schema.GroupResource]value.Transformer
 	GVResourceToObjects map[GVResource][]unstructured.Unstructured
+	GVResourceToShards  map[GVResource]int
+	FieldProjections    []v1.FieldProjection
+	Manifest            Manifest
+	ConsistencyMode     string
+	SkippedObjectCounts map[string]int64
+	snapshots           map[listKey]*snapshot
+	// SkipObjectsOnEncryptionFailure skips objects the encryption provider fails on instead of failing the backup
+	SkipObjectsOnEncryptionFailure bool
+	// ControllerManagers skips objects only managed by these field managers, see isControllerOwned
+	ControllerManagers []string
+	// MetadataClient lists metadata only where objects themselves aren't needed, nil always lists full objects
+	MetadataClient metadata.Interface
+	// Writer receives the files of the backup, nil writes them into the backupPath given to WriteBackupObjects
+	Writer FileWriter
+	// Exclusions skip the objects matching any of the rules, see ParseExclusions
+	Exclusions []ExclusionRule
+	// Checkpoint keeps the completed lists across attempts of the backup, nil lists every resource on every attempt
+	Checkpoint *Checkpoint
+	// Parallelism is the number of resources of a selector gathered at the same time, 0 uses DefaultParallelism
+	Parallelism int
+	// PageSize is the number of objects per list call, 0 uses ListObjectsLimit
+	PageSize int64
+	// ResourceTimeout limits the time spent gathering a single resource, 0 doesn't limit it
+	ResourceTimeout time.Duration
+	// FailurePolicy is FailurePolicyAbort or FailurePolicyContinue, empty aborts
+	FailurePolicy string
+	// FailedResources maps the resources that couldn't be gathered to their error, see FailurePolicyContinue
+	FailedResources map[string]string
+	// RemovedResources are the resources that were discovered but no longer served when listed, see skipRemovedResource
+	RemovedResources []string
+	// Base is the manifest of the full backup an incremental backup derives from, nil writes every object
+	Base                 *Manifest
+	baseResourceVersions map[string]string
+	// IncludeNamespaces and ExcludeNamespaces limit the objects of every selector to these namespaces, see inBackupNamespaces
+	IncludeNamespaces []string
+	ExcludeNamespaces []string
+	// PruneFields are removed from every object in addition to DefaultPruneFields, see pruneFieldsFor
+	PruneFields             []string
+	gvResourceToPruneFields map[GVResource][]string
+	// PerObjectCompression gzips the objects written to their own file when their JSON is larger, 0 never compresses them
+	PerObjectCompression int64
+	// SinceTime drops the objects created before it, the zero time keeps every object. See filterBySinceTime
+	SinceTime time.Time
+	// MaxObjectsPerResource and MaxTotalSizeBytes limit the backup, 0 doesn't limit it. See exceedsObjectLimit and reserveBytes
+	MaxObjectsPerResource int64
+	MaxTotalSizeBytes     int64
+	// TruncatedResources maps the resources left out or cut short by a limit to the reason, see FailurePolicyContinue
+	TruncatedResources map[string]string
+	writtenBytes       int64
+	truncatedObjects   map[string]int64
+	// lock guards the snapshots, GVResourceToShards, FailedResources, RemovedResources and the limits while resources are gathered and
+	// shards written in parallel
+	lock sync.Mutex
 }
 
 /*  GatherResources iterates over the ResourceSelectors in the given ResourceSet
@@ -51,65 +113,166 @@ type ResourceHandler struct {
 	All namespaces that match resourceNamesRegex, also local ns is backed up
 */
 func (h *ResourceHandler) GatherResources(ctx context.Context, resourceSelectors []v1.ResourceSelector) error {
-	h.GVResourceToObjects = make(map[GVResource][]unstructured.Unstructured)
+	if h.ConsistencyMode == ConsistencyModeWatch {
+		h.snapshots = make(map[listKey]*snapshot)
+		// the first pass only lists the objects, the second one filters them once all lists are at the same resource version
+		if err := h.gatherResources(ctx, resourceSelectors); err != nil {
+			return err
+		}
+		if err := h.catchUpSnapshots(ctx); err != nil {
+			if h.Checkpoint != nil && h.Checkpoint.Resumed() {
+				// the checkpointed lists may be what can't be brought to a consistent snapshot, the retry lists everything
+				if discardErr := h.Checkpoint.Discard(); discardErr != nil {
+					logrus.Warnf("Error discarding checkpoint: %v", discardErr)
+				}
+				return fmt.Errorf("checkpoint can't be brought to a consistent snapshot, starting over: %v", err)
+			}
+			return err
+		}
+	}
+	return h.gatherResources(ctx, resourceSelectors)
+}
 
+func (h *ResourceHandler) gatherResources(ctx context.Context, resourceSelectors []v1.ResourceSelector) error {
+	h.GVResourceToObjects = make(map[GVResource][]unstructured.Unstructured)
+	h.GVResourceToShards = make(map[GVResource]int)
+	h.gvResourceToPruneFields = make(map[GVResource][]string)
+	h.FailedResources = nil
+	h.RemovedResources = nil
+	h.TruncatedResources = nil
+	versions := make(gatheredVersions)
+
+	resourceSelectors, err := h.expandGroupSelectors(ctx, resourceSelectors)
+	if err != nil {
+		return err
+	}
 	for _, resourceSelector := range resourceSelectors {
-		resourceList, err := h.gatherResourcesForGroupVersion(resourceSelector)
+		resourceSelector, err := h.withSelectedVersion(ctx, resourceSelector)
 		if err != nil {
+			return err
+		}
+		resourceList, err := h.gatherResourcesForGroupVersion(ctx, resourceSelector)
+		if err != nil {
+			if h.continueOnFailure(resourceSelector.APIVersion, err) {
+				continue
+			}
 			return fmt.Errorf("error gathering resource for %v: %v", resourceSelector.APIVersion, err)
 		}
 		gv, err := schema.ParseGroupVersion(resourceSelector.APIVersion)
 		if err != nil {
 			return err
 		}
-		currGVResource := GVResource{GroupVersion: gv}
-		for _, res := range resourceList {
-			currGVResource.Name = res.Name
-			currGVResource.Namespaced = res.Namespaced
-
-			if strings.Contains(res.Name, "/") {
-				logrus.Debugf("Skipped backing up subresource: %s", res.Name)
+		gathered, err := h.gatherObjectsForResources(ctx, resourceList, gv, resourceSelector)
+		if err != nil {
+			return err
+		}
+		for i, res := range resourceList {
+			if gathered[i] == nil {
 				continue
 			}
-
+			// currGVResource contains GV for resource type, its name and if its namespaced or not,
+			// example: gv=v1, name=secrets, namespaced=true; filteredObjects are all the objects matching the resourceSelector
+			currGVResource := GVResource{GroupVersion: gv, Name: res.Name, Namespaced: res.Namespaced}
+			h.setPruneFields(currGVResource, h.pruneFieldsFor(currGVResource, resourceSelector))
+			h.recordVersion(currGVResource)
+			objects := versions.dropGatheredAtOtherVersions(currGVResource, gathered[i].objects)
 			if !canListResource(res.Verbs) {
-				if canGetResource(res.Verbs) {
-					filteredObjects, err := h.gatherObjectsForNonListResource(ctx, res, gv, resourceSelector)
-					if err != nil {
-						return err
-					}
-					h.GVResourceToObjects[currGVResource] = filteredObjects
-				} else {
-					logrus.Infof("Not collecting objects for resource %v since it does not have list or get verbs", res.Name)
-				}
+				h.GVResourceToObjects[currGVResource] = objects
 				continue
 			}
-
-			filteredObjects, err := h.gatherObjectsForResource(ctx, res, gv, resourceSelector)
-			if err != nil {
-				return err
-			}
-			// currGVResource contains GV for resource type, its name and if its namespaced or not,
-			// example: gv=v1, name=secrets, namespaced=true; filteredObjects are all the objects matching the resourceSelector
 			previouslyGatheredForGVR, ok := h.GVResourceToObjects[currGVResource]
 			if ok {
-				h.GVResourceToObjects[currGVResource] = append(previouslyGatheredForGVR, filteredObjects...)
+				h.GVResourceToObjects[currGVResource] = append(previouslyGatheredForGVR, objects...)
 			} else {
-				h.GVResourceToObjects[currGVResource] = filteredObjects
+				h.GVResourceToObjects[currGVResource] = objects
 			}
 		}
 	}
 	return nil
 }
 
-func (h *ResourceHandler) gatherResourcesForGroupVersion(filter v1.ResourceSelector) ([]k8sv1.APIResource, error) {
+// gatheredObjects are the objects of one resource of a selector
+type gatheredObjects struct {
+	objects []unstructured.Unstructured
+}
+
+// gatherObjectsForResources gathers the resources of a selector, Parallelism of them at the same time. The objects are
+// returned in the order of resourceList, nil for resources that aren't gathered, so the result doesn't depend on timing
+func (h *ResourceHandler) gatherObjectsForResources(ctx context.Context, resourceList []k8sv1.APIResource, gv schema.GroupVersion,
+	resourceSelector v1.ResourceSelector) ([]*gatheredObjects, error) {
+	parallelism := h.Parallelism
+	if parallelism <= 0 {
+		parallelism = DefaultParallelism
+	}
+	gathered := make([]*gatheredObjects, len(resourceList))
+	errgrp, ctx := errgroup.WithContext(ctx)
+	workers := make(chan struct{}, parallelism)
+	for i, res := range resourceList {
+		if strings.Contains(res.Name, "/") {
+			logrus.Debugf("Skipped backing up subresource: %s", res.Name)
+			continue
+		}
+		if !canListResource(res.Verbs) && !canGetResource(res.Verbs) {
+			logrus.Infof("Not collecting objects for resource %v since it does not have list or get verbs", res.Name)
+			continue
+		}
+		i, res := i, res
+		errgrp.Go(func() error {
+			select {
+			case workers <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			defer func() { <-workers }()
+			resourceCtx := ctx
+			if h.ResourceTimeout > 0 {
+				var cancel context.CancelFunc
+				resourceCtx, cancel = context.WithTimeout(ctx, h.ResourceTimeout)
+				defer cancel()
+			}
+			var filteredObjects []unstructured.Unstructured
+			var err error
+			if canListResource(res.Verbs) {
+				filteredObjects, err = h.gatherObjectsForResource(resourceCtx, res, gv, resourceSelector)
+			} else {
+				filteredObjects, err = h.gatherObjectsForNonListResource(resourceCtx, res, gv, resourceSelector)
+			}
+			if err != nil && resourceCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+				err = fmt.Errorf("timed out gathering %v after %v: %v", res.Name, h.ResourceTimeout, err)
+			}
+			if err != nil && canListResource(res.Verbs) && h.skipRemovedResource(res.Name+"."+gv.Group, err) {
+				return nil
+			}
+			if err != nil {
+				if h.continueOnFailure(res.Name+"."+gv.Group, err) {
+					return nil
+				}
+				return err
+			}
+			filteredObjects = h.filterByBackupNamespaces(gv.WithResource(res.Name), res.Namespaced, filteredObjects)
+			filteredObjects = h.filterBySinceTime(gv.WithResource(res.Name), filteredObjects)
+			if exceeded, err := h.exceedsObjectLimit(res.Name+"."+gv.Group, filteredObjects); exceeded {
+				return err
+			}
+			gathered[i] = &gatheredObjects{objects: filteredObjects}
+			return nil
+		})
+	}
+	return gathered, errgrp.Wait()
+}
+
+func (h *ResourceHandler) gatherResourcesForGroupVersion(ctx context.Context, filter v1.ResourceSelector) ([]k8sv1.APIResource, error) {
 	var resourceList, resourceListFromRegex, resourceListFromNames []k8sv1.APIResource
 
 	groupVersion := filter.APIVersion
 	logrus.Infof("Gathering resources for groupVersion: %v", groupVersion)
 
 	// first list all resources for given groupversion using discovery API
-	resources, err := h.DiscoveryClient.ServerResourcesForGroupVersion(groupVersion)
+	var resources *k8sv1.APIResourceList
+	err := retryAPICall(ctx, "discover resources of "+groupVersion, func() (err error) {
+		resources, err = h.DiscoveryClient.ServerResourcesForGroupVersion(groupVersion)
+		return err
+	})
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			logrus.Warnf("No resources found for groupVersion %v, skipping it", groupVersion)
@@ -139,11 +302,11 @@ func (h *ResourceHandler) gatherResourcesForGroupVersion(filter v1.ResourceSelec
 			if isKindExcluded(filter.ExcludeKinds, res) {
 				continue
 			}
-			kindMatched, err := regexp.MatchString(filter.KindsRegexp, res.Kind)
+			kindMatched, err := matchSelectorRegexp(filter.KindsRegexp, res.Kind)
 			if err != nil {
 				return resourceList, err
 			}
-			pluralNameMatched, err := regexp.MatchString(filter.KindsRegexp, res.Name)
+			pluralNameMatched, err := matchSelectorRegexp(filter.KindsRegexp, res.Name)
 			if err != nil {
 				return resourceList, err
 			}
@@ -151,7 +314,7 @@ func (h *ResourceHandler) gatherResourcesForGroupVersion(filter v1.ResourceSelec
 				continue
 			}
 
-			logrus.Infof("resource kind %v, matched regex %v", res.Name, filter.KindsRegexp)
+			logrus.WithFields(logrus.Fields{"groupVersion": filter.APIVersion, "resource": res.Name, "regex": filter.KindsRegexp}).Debug("Resource matched kinds regex")
 			resourceListFromRegex = append(resourceListFromRegex, res)
 		}
 	}
@@ -173,7 +336,7 @@ func (h *ResourceHandler) gatherResourcesForGroupVersion(filter v1.ResourceSelec
 			// comparing whatever is specified in the Kinds field with both, resource Name (plural) and Kind (singular)
 			if resourceTypesToInclude[res.Name] || resourceTypesToInclude[res.Kind] {
 				if !resourceListAfterRegexMatch[res.Name] && !resourceListAfterRegexMatch[res.Kind] {
-					logrus.Infof("resource kind %v found in list of resources to include", res.Name)
+					logrus.WithFields(logrus.Fields{"groupVersion": filter.APIVersion, "resource": res.Name}).Debug("Resource found in list of kinds to include")
 					resourceListFromNames = append(resourceListFromNames, res)
 				}
 			}
@@ -190,8 +353,12 @@ func (h *ResourceHandler) gatherObjectsForResource(ctx context.Context, res k8sv
 	var dr dynamic.ResourceInterface
 	dr = h.DynamicClient.Resource(gvr)
 
+	if filter.Shards > 1 {
+		h.setShards(GVResource{GroupVersion: gv, Name: res.Name, Namespaced: res.Namespaced}, filter.Shards)
+	}
+
 	// only resources that match name+namespace+label combination will be backed up, so we can filter in any order
-	filteredByName, err := h.filterByNameAndLabel(ctx, dr, filter)
+	filteredByName, err := h.filterByNameAndLabel(ctx, dr, gvr, res.Verbs, filter)
 	if err != nil {
 		return filteredObjects, err
 	}
@@ -210,7 +377,8 @@ func (h *ResourceHandler) gatherObjectsForResource(ctx context.Context, res k8sv
 	return filteredObjects, nil
 }
 
-func (h *ResourceHandler) filterByNameAndLabel(ctx context.Context, dr dynamic.ResourceInterface, filter v1.ResourceSelector) ([]unstructured.Unstructured, error) {
+func (h *ResourceHandler) filterByNameAndLabel(ctx context.Context, dr dynamic.ResourceInterface, gvr schema.GroupVersionResource, verbs k8sv1.Verbs,
+	filter v1.ResourceSelector) ([]unstructured.Unstructured, error) {
 	var filteredByName, filteredByResourceNames []unstructured.Unstructured
 	var labelSelector string
 
@@ -220,14 +388,22 @@ func (h *ResourceHandler) filterByNameAndLabel(ctx context.Context, dr dynamic.R
 			return filteredByName, err
 		}
 		labelSelector = selector.String()
-		logrus.Infof("Listing objects using label selector %v", labelSelector)
+		logrus.WithFields(logrus.Fields{"resource": gvr.String(), "labelSelector": labelSelector}).Debug("Listing objects using label selector")
+	}
+	fieldSelector := fieldSelectorFor(filter)
+	if fieldSelector != "" {
+		logrus.WithFields(logrus.Fields{"resource": gvr.String(), "fieldSelector": fieldSelector}).Debug("Listing objects using field selector")
 	}
 
-	resourceObjectsList, err := paginateListResults(ctx, dr, k8sv1.ListOptions{LabelSelector: labelSelector})
+	resourceObjectsList, err := h.listObjects(ctx, dr, gvr, verbs, k8sv1.ListOptions{LabelSelector: labelSelector, FieldSelector: fieldSelector})
+	if err != nil && fieldSelector != "" && apierrors.IsBadRequest(err) {
+		resourceObjectsList, err = h.listWithClientSideFieldSelector(ctx, dr, gvr, verbs, labelSelector, fieldSelector, err)
+	}
 	if err != nil {
 		return filteredByName, err
 	}
-	filteredByNameMap := make(map[*unstructured.Unstructured]bool)
+	// objects are keyed by namespace and name, the loop variable has the same address for every object
+	filteredByNameMap := make(map[string]bool)
 
 	if len(filter.ResourceNames) == 0 && filter.ResourceNameRegexp == "" {
 		// no filters for names of the resource, return all objects obtained from the list call
@@ -241,9 +417,8 @@ func (h *ResourceHandler) filterByNameAndLabel(ctx context.Context, dr dynamic.R
 		}
 
 		for _, resObj := range resourceObjectsList.Items {
-			metadata := resObj.Object["metadata"].(map[string]interface{})
-			name := metadata["name"].(string)
-			nameMatched, err := regexp.MatchString(filter.ResourceNameRegexp, name)
+			name := resObj.GetName()
+			nameMatched, err := matchSelectorRegexp(filter.ResourceNameRegexp, name)
 			if err != nil {
 				return filteredByName, err
 			}
@@ -251,14 +426,14 @@ func (h *ResourceHandler) filterByNameAndLabel(ctx context.Context, dr dynamic.R
 				continue
 			}
 			filteredByName = append(filteredByName, resObj)
-			filteredByNameMap[&resObj] = true
+			filteredByNameMap[objectKey(resObj)] = true
 		}
 	}
 
 	// filter by names as fieldSelector:
 	if len(filter.ResourceNames) > 0 {
 		// TODO: POST-preview-2: set resourceVersion later when it becomes clear how to use it
-		filteredObjectsList, err := paginateListResults(ctx, dr, k8sv1.ListOptions{LabelSelector: labelSelector})
+		filteredObjectsList, err := h.listObjects(ctx, dr, gvr, verbs, k8sv1.ListOptions{LabelSelector: labelSelector, FieldSelector: fieldSelector})
 		if err != nil {
 			return filteredByName, err
 		}
@@ -267,8 +442,7 @@ func (h *ResourceHandler) filterByNameAndLabel(ctx context.Context, dr dynamic.R
 			allowedNames[name] = true
 		}
 		for _, resObj := range filteredObjectsList.Items {
-			metadata := resObj.Object["metadata"].(map[string]interface{})
-			name := metadata["name"].(string)
+			name := resObj.GetName()
 			if allowedNames[name] {
 				filteredByResourceNames = append(filteredByResourceNames, resObj)
 			}
@@ -283,7 +457,7 @@ func (h *ResourceHandler) filterByNameAndLabel(ctx context.Context, dr dynamic.R
 		if len(filteredByNameMap) > 0 {
 			// avoid duplicates
 			for _, resObj := range filteredByResourceNames {
-				if !filteredByNameMap[&resObj] {
+				if !filteredByNameMap[objectKey(resObj)] {
 					filteredByName = append(filteredByName, resObj)
 				}
 			}
@@ -296,8 +470,8 @@ func (h *ResourceHandler) filterByNameAndLabel(ctx context.Context, dr dynamic.R
 }
 
 func (h *ResourceHandler) filterByNamespace(filter v1.ResourceSelector, filteredByName []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
-	var filteredByNamespace, filteredByNamespaceRegex, filteredObjects []unstructured.Unstructured
-	filteredByNsMap := make(map[*unstructured.Unstructured]bool)
+	var filteredByNamespace, filteredByNamespaceRegex []unstructured.Unstructured
+	filteredByNsMap := make(map[string]bool)
 
 	if len(filter.Namespaces) > 0 {
 		allowedNamespaces := make(map[string]bool)
@@ -305,11 +479,10 @@ func (h *ResourceHandler) filterByNamespace(filter v1.ResourceSelector, filtered
 			allowedNamespaces[ns] = true
 		}
 		for _, resObj := range filteredByName {
-			metadata := resObj.Object["metadata"].(map[string]interface{})
-			ns := metadata["namespace"].(string)
+			ns := resObj.GetNamespace()
 			if allowedNamespaces[ns] {
 				filteredByNamespace = append(filteredByNamespace, resObj)
-				filteredByNsMap[&resObj] = true
+				filteredByNsMap[objectKey(resObj)] = true
 			}
 		}
 	}
@@ -319,9 +492,8 @@ func (h *ResourceHandler) filterByNamespace(filter v1.ResourceSelector, filtered
 			return filteredByName, nil
 		}
 		for _, resObj := range filteredByName {
-			metadata := resObj.Object["metadata"].(map[string]interface{})
-			ns := metadata["namespace"].(string)
-			nsMatched, err := regexp.MatchString(filter.NamespaceRegexp, ns)
+			ns := resObj.GetNamespace()
+			nsMatched, err := matchSelectorRegexp(filter.NamespaceRegexp, ns)
 			if err != nil {
 				return filteredByNamespace, err
 			}
@@ -341,7 +513,7 @@ func (h *ResourceHandler) filterByNamespace(filter v1.ResourceSelector, filtered
 		if len(filteredByNsMap) > 0 {
 			// avoid duplicates
 			for _, resObj := range filteredByNamespaceRegex {
-				if !filteredByNsMap[&resObj] {
+				if !filteredByNsMap[objectKey(resObj)] {
 					filteredByNamespace = append(filteredByNamespace, resObj)
 				}
 			}
@@ -349,14 +521,29 @@ func (h *ResourceHandler) filterByNamespace(filter v1.ResourceSelector, filtered
 			filteredByNamespace = filteredByNamespaceRegex
 		}
 	}
-	filteredObjects = append(filteredByNamespace, filteredByNamespaceRegex...)
-	return filteredObjects, nil
+	// filteredByNamespace already holds the objects matching the regexp, appending them again would back them up twice
+	return filteredByNamespace, nil
+}
+
+func objectKey(obj unstructured.Unstructured) string {
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// fieldSelectorFor combines the field selectors of the filter, the apiserver requires all of them to match
+func fieldSelectorFor(filter v1.ResourceSelector) string {
+	return strings.Join(filter.FieldSelectors, ",")
 }
 
 func paginateListResults(ctx context.Context, dr dynamic.ResourceInterface, listOptions k8sv1.ListOptions) (*unstructured.UnstructuredList, error) {
 	var resourceObjectsList *unstructured.UnstructuredList
-	listOptions.Limit = ListObjectsLimit
-	resourceObjectsListFirst, err := dr.List(ctx, listOptions)
+	if listOptions.Limit == 0 {
+		listOptions.Limit = ListObjectsLimit
+	}
+	var resourceObjectsListFirst *unstructured.UnstructuredList
+	err := retryAPICall(ctx, "list objects", func() (err error) {
+		resourceObjectsListFirst, err = dr.List(ctx, listOptions)
+		return err
+	})
 	if err != nil {
 		return resourceObjectsList, err
 	}
@@ -364,7 +551,11 @@ func paginateListResults(ctx context.Context, dr dynamic.ResourceInterface, list
 	continueList := resourceObjectsListFirst.GetContinue()
 	for continueList != "" {
 		listOptions.Continue = continueList
-		resourceObjectsListCurr, err := dr.List(ctx, listOptions)
+		var resourceObjectsListCurr *unstructured.UnstructuredList
+		err := retryAPICall(ctx, "list objects", func() (err error) {
+			resourceObjectsListCurr, err = dr.List(ctx, listOptions)
+			return err
+		})
 		if err != nil {
 			return resourceObjectsList, err
 		}
@@ -377,6 +568,15 @@ func paginateListResults(ctx context.Context, dr dynamic.ResourceInterface, list
 // NOTE: Rancher types CollectionMethods or ResourceMethods verbs do not translate to verbs on k8sv1.APIResource
 // Resources that don't have list verb but do have get verb need to be gathered by GET calls. So the filter for them must
 // provide exact names and if needed namespaces. Regexp can't be matched in a GET call
+func getObject(ctx context.Context, dr dynamic.ResourceInterface, name string) (*unstructured.Unstructured, error) {
+	var obj *unstructured.Unstructured
+	err := retryAPICall(ctx, "get "+name, func() (err error) {
+		obj, err = dr.Get(ctx, name, k8sv1.GetOptions{})
+		return err
+	})
+	return obj, err
+}
+
 func (h *ResourceHandler) gatherObjectsForNonListResource(ctx context.Context, res k8sv1.APIResource, gv schema.GroupVersion, filter v1.ResourceSelector) ([]unstructured.Unstructured, error) {
 	var gatheredObjects []unstructured.Unstructured
 
@@ -398,7 +598,7 @@ func (h *ResourceHandler) gatherObjectsForNonListResource(ctx context.Context, r
 		for _, ns := range filter.Namespaces {
 			dr = h.DynamicClient.Resource(gvr).Namespace(ns)
 			for _, name := range filter.ResourceNames {
-				obj, err := dr.Get(ctx, name, k8sv1.GetOptions{})
+				obj, err := getObject(ctx, dr, name)
 				if err != nil {
 					return gatheredObjects, err
 				}
@@ -409,7 +609,7 @@ func (h *ResourceHandler) gatherObjectsForNonListResource(ctx context.Context, r
 	}
 
 	for _, name := range filter.ResourceNames {
-		obj, err := dr.Get(ctx, name, k8sv1.GetOptions{})
+		obj, err := getObject(ctx, dr, name)
 		if err != nil {
 			return gatheredObjects, err
 		}
@@ -420,104 +620,207 @@ func (h *ResourceHandler) gatherObjectsForNonListResource(ctx context.Context, r
 }
 
 func (h *ResourceHandler) WriteBackupObjects(backupPath string) error {
-	for gvResource, resObjects := range h.GVResourceToObjects {
+	h.writtenBytes = 0
+	h.truncatedObjects = make(map[string]int64)
+	defer h.recordTruncatedObjects()
+	for _, gvResource := range h.sortedGVResources() {
+		resObjects := h.GVResourceToObjects[gvResource]
+		sortObjects(resObjects)
+		if shards := h.GVResourceToShards[gvResource]; shards > 1 {
+			if err := h.writeShardedObjects(backupPath, gvResource, resObjects, shards); err != nil {
+				return err
+			}
+			continue
+		}
 		for _, resObj := range resObjects {
-			metadata := resObj.Object["metadata"].(map[string]interface{})
-			// if an object has deletiontimestamp and finalizers, back it up. If there are no finalizers, ignore
-			if _, deletionTs := metadata["deletionTimestamp"]; deletionTs {
-				// for v1/namespace we need to check spec.finalizers, otherwise check metadata.finalizers
-				if resObj.GetKind() != "Namespace" {
-					if _, finSet := metadata["finalizers"]; !finSet {
-						// no finalizers set, don't backup object
-						continue
-					}
-				} else {
-					// ignore error because if there is no finalizers and deletionTimestamp is set, namespace should already be deleted
-					fins, ok, _ := unstructured.NestedStringSlice(resObj.Object, "spec", "finalizers")
-					if !ok || len(fins) == 0 {
-						continue
-					}
-				}
+			if !hasValidMetadata(gvResource, resObj) {
+				h.countSkipped(gvResource, 1)
+				continue
 			}
-
-			objName := metadata["name"].(string)
+			if isDeletedWithoutFinalizers(resObj) || h.isIgnored(gvResource, resObj) {
+				continue
+			}
+			objName := resObj.GetName()
 			objFilename := objName
+			resourceVersion := resObj.GetResourceVersion()
+			deleting := resObj.GetDeletionTimestamp() != nil
 
-			// TODO: confirm-test deletionTimestamp needs to be dropped
-			for _, field := range []string{"uid", "creationTimestamp", "deletionTimestamp", "selfLink", "resourceVersion"} {
-				delete(metadata, field)
-			}
+			removeServerFields(resObj)
+			h.pruneFields(gvResource, resObj)
 			gv := gvResource.GroupVersion
-			resourcePath := backupPath + "/" + gvResource.Name + "." + gv.Group + "#" + gv.Version
-			if err := createResourceDir(resourcePath); err != nil {
-				return err
+			resourceDirName := gvResource.Name + "." + gv.Group + "#" + gv.Version
+			manifestEntry := ManifestEntry{
+				Path:            filepath.Join(resourceDirName, objFilename+".json"),
+				Group:           gv.Group,
+				Version:         gv.Version,
+				Resource:        gvResource.Name,
+				Name:            objName,
+				ResourceVersion: resourceVersion,
+				RestoreTier:     RestoreTier(gv.Group, gvResource.Name, gvResource.Namespaced, resObj),
+				Deleting:        deleting,
 			}
 
-			gr := schema.ParseGroupResource(gvResource.Name + "." + gv.Group)
+			gr := schema.GroupResource{Group: gv.Group, Resource: gvResource.Name}
 			encryptionTransformer := h.TransformerMap[gr]
 			additionalAuthenticatedData := objName
 			if gvResource.Namespaced {
-				additionalAuthenticatedData = fmt.Sprintf("%s#%s", metadata["namespace"].(string), additionalAuthenticatedData)
+				additionalAuthenticatedData = fmt.Sprintf("%s#%s", resObj.GetNamespace(), additionalAuthenticatedData)
 				/*Max length in k8s is 253 characters for names of resources, for instance for serviceaccount.
 				And max length of filename on UNIX is 255, so we risk going over max filename length by storing namespace in the filename,
 				hence create a separate subdir for namespaced resources*/
-				objNs := metadata["namespace"].(string)
-				resourcePath = filepath.Join(resourcePath, objNs)
-				if err := createResourceDir(resourcePath); err != nil {
-					return err
-				}
+				objNs := resObj.GetNamespace()
+				manifestEntry.Namespace = objNs
+				manifestEntry.Path = filepath.Join(resourceDirName, objNs, objFilename+".json")
+			}
+
+			objToWrite := resObj.Object
+			if projection := h.fieldProjectionFor(gv.Group, resObj.GetKind()); projection != nil {
+				// projected objects are incomplete, so they must never be applied by a restore
+				objToWrite = projectFields(resObj.Object, projection.Fields)
+				manifestEntry.NonRestorable = true
+				manifestEntry.Reason = "projected"
+			}
+			if h.inBase(manifestEntry) {
+				manifestEntry.InBase = true
+				h.Manifest.Entries = append(h.Manifest.Entries, manifestEntry)
+				continue
 			}
 
 			// TODO: POST-preview-2: collect all objects first and then write??
-			err := writeToBackup(resObj.Object, resourcePath, objFilename, encryptionTransformer, additionalAuthenticatedData)
+			data, compressed, err := h.encodeFileObject(objToWrite, encryptionTransformer, additionalAuthenticatedData)
 			if err != nil {
+				if h.skipOnEncryptionFailure(err) {
+					logrus.Errorf("Skipping %v of type %v: %v", objName, gvResource.Name, err)
+					h.countSkipped(gvResource, 1)
+					continue
+				}
 				return err
 			}
+			if reserved, err := h.reserveBytes(gvResource, len(data)); !reserved {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			manifestEntry.Compressed = compressed
+			if err := h.fileWriter(backupPath).WriteFile(manifestEntry.File(), data); err != nil {
+				return fmt.Errorf("error writing JSON to file: %v", err)
+			}
+			manifestEntry.SHA256 = fileChecksum(data)
+			h.Manifest.Entries = append(h.Manifest.Entries, manifestEntry)
 		}
 	}
 	return nil
 }
 
-func createResourceDir(path string) error {
-	_, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		err = os.MkdirAll(path, os.ModePerm)
-		if err != nil {
-			return fmt.Errorf("error creating temp dir: %v", err)
+// isDeletedWithoutFinalizers returns true for objects that will be gone before they could be restored.
+// If an object has deletiontimestamp and finalizers, back it up. If there are no finalizers, ignore
+func isDeletedWithoutFinalizers(resObj unstructured.Unstructured) bool {
+	metadata, _ := resObj.Object["metadata"].(map[string]interface{})
+	if _, deletionTs := metadata["deletionTimestamp"]; !deletionTs {
+		return false
+	}
+	// for v1/namespace we need to check spec.finalizers, otherwise check metadata.finalizers
+	if resObj.GetKind() != "Namespace" {
+		_, finSet := metadata["finalizers"]
+		return !finSet
+	}
+	// ignore error because if there is no finalizers and deletionTimestamp is set, namespace should already be deleted
+	fins, ok, _ := unstructured.NestedStringSlice(resObj.Object, "spec", "finalizers")
+	return !ok || len(fins) == 0
+}
+
+// isIgnored returns true if the object opted out of backups with the backup ignore annotation, is skipped as controller owned
+// or matches an exclusion rule, these are counted per resource
+func (h *ResourceHandler) isIgnored(gvResource GVResource, resObj unstructured.Unstructured) bool {
+	if resObj.GetAnnotations()[util.BackupIgnoreAnnotation] != "true" && !h.isControllerOwned(resObj) && !h.isExcluded(gvResource, resObj) {
+		return false
+	}
+	h.countSkipped(gvResource, 1)
+	return true
+}
+
+func (h *ResourceHandler) countSkipped(gvResource GVResource, count int64) {
+	if count == 0 {
+		return
+	}
+	if h.SkippedObjectCounts == nil {
+		h.SkippedObjectCounts = make(map[string]int64)
+	}
+	h.SkippedObjectCounts[gvResource.Name+"."+gvResource.GroupVersion.Group] += count
+}
+
+func (h *ResourceHandler) skipOnEncryptionFailure(err error) bool {
+	var providerErr *util.EncryptionProviderError
+	return h.SkipObjectsOnEncryptionFailure && errors.As(err, &providerErr)
+}
+
+// hasValidMetadata returns false for objects without metadata or a name, some aggregated apiservers return these.
+// They can't be written to the backup, so they are skipped instead of failing it
+func hasValidMetadata(gvResource GVResource, resObj unstructured.Unstructured) bool {
+	metadata, ok := resObj.Object["metadata"].(map[string]interface{})
+	if !ok {
+		logrus.Warnf("Skipping object of type %v without metadata", gvResource.Name)
+		return false
+	}
+	if name, ok := metadata["name"].(string); !ok || name == "" {
+		logrus.Warnf("Skipping object of type %v without a name", gvResource.Name)
+		return false
+	}
+	if namespace, ok := metadata["namespace"]; ok && gvResource.Namespaced {
+		if _, ok := namespace.(string); !ok {
+			logrus.Warnf("Skipping %v of type %v with an invalid namespace", metadata["name"], gvResource.Name)
+			return false
 		}
 	}
-	return nil
+	return true
+}
+
+func removeServerFields(resObj unstructured.Unstructured) {
+	metadata, ok := resObj.Object["metadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	// an object can't be created with a deletionTimestamp, objects backed up while being deleted are marked in the manifest
+	for _, field := range []string{"uid", "creationTimestamp", "deletionTimestamp", "deletionGracePeriodSeconds", "selfLink", "resourceVersion"} {
+		delete(metadata, field)
+	}
 }
 
-func writeToBackup(resource map[string]interface{}, backupPath, filename string, transformer value.Transformer, additionalAuthenticatedData string) error {
-	f, err := os.Create(filepath.Join(backupPath, filepath.Base(filename+".json")))
+// writeToBackup writes the object to relativePath and returns the checksum of the file for its manifest entry
+func writeToBackup(w FileWriter, resource map[string]interface{}, relativePath string, transformer value.Transformer, additionalAuthenticatedData string) (string, error) {
+	// encode first, so no empty file is left behind for an object that is skipped
+	resourceBytes, err := encodeObject(resource, transformer, additionalAuthenticatedData)
 	if err != nil {
-		return fmt.Errorf("error creating temp file: %v", err)
+		return "", err
+	}
+	if err := w.WriteFile(relativePath, resourceBytes); err != nil {
+		return "", fmt.Errorf("error writing JSON to file: %v", err)
 	}
-	defer f.Close()
+	return fileChecksum(resourceBytes), nil
+}
 
+func encodeObject(resource map[string]interface{}, transformer value.Transformer, additionalAuthenticatedData string) ([]byte, error) {
 	resourceBytes, err := json.Marshal(resource)
 	if err != nil {
-		return fmt.Errorf("error converting resource to JSON: %v", err)
+		return nil, fmt.Errorf("error converting resource to JSON: %v", err)
 	}
-	if transformer != nil {
-		encrypted, err := transformer.TransformToStorage(resourceBytes, value.DefaultContext([]byte(additionalAuthenticatedData)))
-		if err != nil {
-			return fmt.Errorf("error converting resource to JSON: %v", err)
-		}
-		resourceBytes, err = json.Marshal(encrypted)
-		if err != nil {
-			return fmt.Errorf("error converting encrypted resource to JSON: %v", err)
-		}
+	return encryptObject(resourceBytes, transformer, additionalAuthenticatedData)
+}
+
+func encryptObject(resourceBytes []byte, transformer value.Transformer, additionalAuthenticatedData string) ([]byte, error) {
+	if transformer == nil {
+		return resourceBytes, nil
 	}
-	if _, err := f.Write(resourceBytes); err != nil {
-		return fmt.Errorf("error writing JSON to file: %v", err)
+	encrypted, err := util.TransformToStorage(transformer, resourceBytes, value.DefaultContext([]byte(additionalAuthenticatedData)))
+	if err != nil {
+		return nil, err
 	}
-
-	if err := f.Close(); err != nil {
-		return fmt.Errorf("error closing file: %v", err)
+	resourceBytes, err = json.Marshal(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("error converting encrypted resource to JSON: %v", err)
 	}
-	return nil
+	return resourceBytes, nil
 }
 
 func canListResource(verbs k8sv1.Verbs) bool {
@@ -529,6 +832,15 @@ func canListResource(verbs k8sv1.Verbs) bool {
 	return false
 }
 
+func canWatchResource(verbs k8sv1.Verbs) bool {
+	for _, v := range verbs {
+		if v == "watch" {
+			return true
+		}
+	}
+	return false
+}
+
 func canGetResource(verbs k8sv1.Verbs) bool {
 	for _, v := range verbs {
 		if v == "get" {
@@ -547,3 +859,9 @@ func isKindExcluded(excludes []string, res k8sv1.APIResource) bool {
 
 	return false
 }
+
+// matchSelectorRegexp matches one of the regexps of a selector against the whole value, so "deployments" doesn't match
+// "deploymentconfigs". Expressions already anchored with ^ and $ keep working
+func matchSelectorRegexp(expr, value string) (bool, error) {
+	return regexp.MatchString("^(?:"+expr+")$", value)
+}
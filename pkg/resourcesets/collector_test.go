@@ -0,0 +1,757 @@
+package resourcesets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage/value"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testEncryptionConfig = `apiVersion: apiserver.config.k8s.io/v1
+kind: EncryptionConfiguration
+resources:
+  - resources:
+      - secrets
+    providers:
+      - aescbc:
+          keys:
+            - name: key1
+              secret: YmFja3VwLXJlc3RvcmUtb3BlcmF0b3ItdGVzdC1rZXk=
+`
+
+var secretsGVResource = GVResource{GroupVersion: schema.GroupVersion{Version: "v1"}, Name: "secrets", Namespaced: true}
+
+func testSecret() unstructured.Unstructured {
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":            "creds",
+			"namespace":       "cattle-system",
+			"resourceVersion": "42",
+		},
+		"data": map[string]interface{}{"password": "aHVudGVyMg=="},
+	}}
+}
+
+// testClusterResources are the resources served by the cluster of testResourceHandler unless a test gives its own
+var testClusterResources = []*k8sv1.APIResourceList{
+	{
+		GroupVersion: "v1",
+		APIResources: []k8sv1.APIResource{
+			{Name: "namespaces", Kind: "Namespace", Verbs: k8sv1.Verbs{"list", "get", "watch"}},
+			{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: k8sv1.Verbs{"list", "get", "watch"}},
+			{Name: "secrets", Kind: "Secret", Namespaced: true, Verbs: k8sv1.Verbs{"list", "get", "watch"}},
+		},
+	},
+	{
+		GroupVersion: "apps/v1",
+		APIResources: []k8sv1.APIResource{
+			{Name: "deployments", Kind: "Deployment", Namespaced: true, Verbs: k8sv1.Verbs{"list", "get", "watch"}},
+		},
+	},
+}
+
+// testResourceHandler returns a handler gathering from a fake cluster that serves the resources and holds the objects
+func testResourceHandler(resources []*k8sv1.APIResourceList, objs ...runtime.Object) (*ResourceHandler, *dynamicfake.FakeDynamicClient) {
+	listKinds := make(map[schema.GroupVersionResource]string)
+	kindResources := make(map[schema.GroupVersionKind]schema.GroupVersionResource)
+	for _, list := range resources {
+		gv, _ := schema.ParseGroupVersion(list.GroupVersion)
+		for _, res := range list.APIResources {
+			listKinds[gv.WithResource(res.Name)] = res.Kind + "List"
+			kindResources[gv.WithKind(res.Kind)] = gv.WithResource(res.Name)
+		}
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds)
+	// the objects are added to the resources served for their kind, the fake client would guess the resource from the kind
+	for _, obj := range objs {
+		u := obj.(*unstructured.Unstructured)
+		gvr := kindResources[u.GroupVersionKind()]
+		if _, err := dynamicClient.Resource(gvr).Namespace(u.GetNamespace()).Create(context.Background(), u, k8sv1.CreateOptions{}); err != nil {
+			panic(err)
+		}
+	}
+	h := &ResourceHandler{
+		DiscoveryClient: &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{Resources: resources}},
+		DynamicClient:   dynamicClient,
+	}
+	return h, dynamicClient
+}
+
+// slowDynamicClient delays every list call like a round trip to the apiserver, the fake client handles one call at a time
+type slowDynamicClient struct {
+	dynamic.Interface
+	delay time.Duration
+}
+
+func (c slowDynamicClient) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return slowResource{NamespaceableResourceInterface: c.Interface.Resource(gvr), delay: c.delay}
+}
+
+type slowResource struct {
+	dynamic.NamespaceableResourceInterface
+	delay time.Duration
+}
+
+func (r slowResource) List(ctx context.Context, opts k8sv1.ListOptions) (*unstructured.UnstructuredList, error) {
+	time.Sleep(r.delay)
+	return r.NamespaceableResourceInterface.List(ctx, opts)
+}
+
+// pagingDynamicClient serves lists in pages of the requested limit like the apiserver, the fake client ignores the limit.
+// Every list call is recorded in calls
+type pagingDynamicClient struct {
+	dynamic.Interface
+	lock  *sync.Mutex
+	calls *[]k8sv1.ListOptions
+}
+
+func newPagingDynamicClient(client dynamic.Interface) pagingDynamicClient {
+	return pagingDynamicClient{Interface: client, lock: &sync.Mutex{}, calls: &[]k8sv1.ListOptions{}}
+}
+
+func (c pagingDynamicClient) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return pagingResource{NamespaceableResourceInterface: c.Interface.Resource(gvr), client: c}
+}
+
+type pagingResource struct {
+	dynamic.NamespaceableResourceInterface
+	client pagingDynamicClient
+}
+
+func (r pagingResource) List(ctx context.Context, opts k8sv1.ListOptions) (*unstructured.UnstructuredList, error) {
+	r.client.lock.Lock()
+	*r.client.calls = append(*r.client.calls, opts)
+	r.client.lock.Unlock()
+	list, err := r.NamespaceableResourceInterface.List(ctx, opts)
+	if err != nil || opts.Limit <= 0 {
+		return list, err
+	}
+	sortObjects(list.Items)
+	start := 0
+	if opts.Continue != "" {
+		if start, err = strconv.Atoi(opts.Continue); err != nil {
+			return nil, apierrors.NewBadRequest("invalid continue token " + opts.Continue)
+		}
+	}
+	end := start + int(opts.Limit)
+	if end < len(list.Items) {
+		list.SetContinue(strconv.Itoa(end))
+	} else {
+		end = len(list.Items)
+	}
+	list.Items = list.Items[start:end]
+	return list, nil
+}
+
+// testObject returns an object of the kind, namespace may be empty for cluster scoped kinds
+func testObject(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": apiVersion, "kind": kind}}
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+// writtenObjects returns group/version/resource/namespace/name of every object in the manifest, in the order written
+func writtenObjects(manifest *Manifest) []string {
+	var written []string
+	for _, entry := range manifest.Entries {
+		written = append(written, filepath.ToSlash(filepath.Join(entry.Group, entry.Version, entry.Resource, entry.Namespace, entry.Name)))
+	}
+	return written
+}
+
+func testTransformers(t *testing.T) map[schema.GroupResource]value.Transformer {
+	return testTransformersFromConfig(t, testEncryptionConfig)
+}
+
+func testTransformersFromConfig(t *testing.T, config string) map[schema.GroupResource]value.Transformer {
+	configPath := filepath.Join(t.TempDir(), "encryption-provider-config.yaml")
+	if err := ioutil.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	transformers, err := util.GetEncryptionTransformersFromFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transformers
+}
+
+// writeTestObject writes obj alone with the transformers and returns the manifest entry and file contents of it
+func writeTestObject(t *testing.T, transformers map[schema.GroupResource]value.Transformer, obj unstructured.Unstructured) (ManifestEntry, []byte) {
+	backupPath := t.TempDir()
+	h := &ResourceHandler{
+		TransformerMap:      transformers,
+		GVResourceToObjects: map[GVResource][]unstructured.Unstructured{secretsGVResource: {obj}},
+	}
+	if err := h.WriteBackupObjects(backupPath); err != nil {
+		t.Fatalf("WriteBackupObjects() error: %v", err)
+	}
+	if len(h.Manifest.Entries) != 1 {
+		t.Fatalf("WriteBackupObjects() wrote %v manifest entries, want 1", len(h.Manifest.Entries))
+	}
+	entry := h.Manifest.Entries[0]
+	data, err := ioutil.ReadFile(filepath.Join(backupPath, entry.File()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry, data
+}
+
+func TestWriteBackupObjectsEncryption(t *testing.T) {
+	plainEntry, plainData := writeTestObject(t, nil, testSecret())
+	var plain map[string]interface{}
+	if err := json.Unmarshal(plainData, &plain); err != nil {
+		t.Fatalf("unencrypted object isn't JSON: %v", err)
+	}
+	if want := testSecret().Object["data"]; !reflect.DeepEqual(plain["data"], want) {
+		t.Errorf("unencrypted object data = %v, want %v", plain["data"], want)
+	}
+
+	encryptedEntry, encryptedData := writeTestObject(t, testTransformers(t), testSecret())
+	if encryptedEntry.Path != plainEntry.Path {
+		t.Errorf("encrypted object path = %v, unencrypted %v", encryptedEntry.Path, plainEntry.Path)
+	}
+	var encrypted []byte
+	if err := json.Unmarshal(encryptedData, &encrypted); err != nil {
+		t.Fatalf("encrypted object isn't a JSON string: %v", err)
+	}
+	transformer := testTransformers(t)[schema.GroupResource{Resource: "secrets"}]
+	decrypted, err := util.TransformFromStorage(transformer, encrypted, value.DefaultContext([]byte("cattle-system#creds")))
+	if err != nil {
+		t.Fatalf("decrypting object: %v", err)
+	}
+	var decryptedObj map[string]interface{}
+	if err := json.Unmarshal(decrypted, &decryptedObj); err != nil {
+		t.Fatalf("decrypted object isn't JSON: %v", err)
+	}
+	if !reflect.DeepEqual(decryptedObj, plain) {
+		t.Errorf("decrypted object = %v, want the unencrypted object %v", decryptedObj, plain)
+	}
+}
+
+func TestGatherResourcesForGroupVersionKindsRegexp(t *testing.T) {
+	discovery := &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{Resources: []*k8sv1.APIResourceList{{
+		GroupVersion: "apps.openshift.io/v1",
+		APIResources: []k8sv1.APIResource{
+			{Name: "deployments", Kind: "Deployment", Verbs: k8sv1.Verbs{"list"}},
+			{Name: "deploymentconfigs", Kind: "DeploymentConfig", Verbs: k8sv1.Verbs{"list"}},
+		},
+	}}}}
+	tests := []struct {
+		name     string
+		selector v1.ResourceSelector
+		want     []string
+	}{
+		{name: "deployment doesn't match deploymentconfigs", selector: v1.ResourceSelector{KindsRegexp: "deployment"}},
+		{name: "whole value", selector: v1.ResourceSelector{KindsRegexp: "deployments"}, want: []string{"deployments"}},
+		{name: "anchored in the regexp", selector: v1.ResourceSelector{KindsRegexp: "^deployments$"}, want: []string{"deployments"}},
+		{name: "kind", selector: v1.ResourceSelector{KindsRegexp: "DeploymentConfig"}, want: []string{"deploymentconfigs"}},
+		{name: "alternatives", selector: v1.ResourceSelector{KindsRegexp: "Deployment|deploymentconfigs"}, want: []string{"deployments", "deploymentconfigs"}},
+		{name: "prefix", selector: v1.ResourceSelector{KindsRegexp: "deployment.*"}, want: []string{"deployments", "deploymentconfigs"}},
+		{name: ".", selector: v1.ResourceSelector{KindsRegexp: "."}, want: []string{"deployments", "deploymentconfigs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.selector.APIVersion = "apps.openshift.io/v1"
+			h := &ResourceHandler{DiscoveryClient: discovery}
+			resources, err := h.gatherResourcesForGroupVersion(context.Background(), tt.selector)
+			if err != nil {
+				t.Fatalf("gatherResourcesForGroupVersion() error: %v", err)
+			}
+			var got []string
+			for _, res := range resources {
+				got = append(got, res.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("gatherResourcesForGroupVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchSelectorRegexp(t *testing.T) {
+	tests := []struct {
+		expr  string
+		value string
+		want  bool
+	}{
+		{expr: "deployment", value: "deploymentconfigs"},
+		{expr: "deploymentconfigs", value: "deploymentconfigs", want: true},
+		{expr: "^cattle-|^p-", value: "cattle-system"},
+		{expr: "cattle-.*|p-.*", value: "cattle-system", want: true},
+		{expr: "cattle-.*|p-.*", value: "p-x2kd8", want: true},
+		{expr: "cattle-.*|p-.*", value: "my-cattle-system"},
+		{expr: "eks.cattle.io$", value: "eksclusterconfigs.eks.cattle.io"},
+		{expr: ".*eks.cattle.io", value: "eksclusterconfigs.eks.cattle.io", want: true},
+		{expr: "^local$", value: "local", want: true},
+		{expr: "system", value: "kube-system"},
+	}
+	for _, tt := range tests {
+		got, err := matchSelectorRegexp(tt.expr, tt.value)
+		if err != nil {
+			t.Fatalf("matchSelectorRegexp(%q, %q) error: %v", tt.expr, tt.value, err)
+		}
+		if got != tt.want {
+			t.Errorf("matchSelectorRegexp(%q, %q) = %v, want %v", tt.expr, tt.value, got, tt.want)
+		}
+	}
+}
+
+// testWidgetResources serves widgets-0 to widgets-<count-1> plus a resource failing to list, one removed after discovery
+// and one with too many objects
+func testWidgetResources(count int) *k8sv1.APIResourceList {
+	list := &k8sv1.APIResourceList{GroupVersion: "example.com/v1"}
+	for i := 0; i < count; i++ {
+		list.APIResources = append(list.APIResources,
+			k8sv1.APIResource{Name: fmt.Sprintf("widgets-%d", i), Kind: fmt.Sprintf("Widget%d", i), Namespaced: true, Verbs: k8sv1.Verbs{"list"}})
+	}
+	return list
+}
+
+func testWidgets(count, perResource int) []runtime.Object {
+	var objs []runtime.Object
+	for i := 0; i < count; i++ {
+		for j := 0; j < perResource; j++ {
+			obj := testObject("example.com/v1", fmt.Sprintf("Widget%d", i), fmt.Sprintf("team-%d", j%3), fmt.Sprintf("widget-%d", j))
+			obj.Object["spec"] = map[string]interface{}{"size": strings.Repeat("x", 10*j)}
+			objs = append(objs, obj)
+		}
+	}
+	return objs
+}
+
+func TestGatherObjectsForResourcesParallelMatchesSerial(t *testing.T) {
+	const widgetResources, widgetsPerResource = 12, 10
+	widgets := testWidgetResources(widgetResources)
+	widgets.APIResources = append(widgets.APIResources,
+		k8sv1.APIResource{Name: "broken", Kind: "Broken", Namespaced: true, Verbs: k8sv1.Verbs{"list"}},
+		k8sv1.APIResource{Name: "removed", Kind: "Removed", Namespaced: true, Verbs: k8sv1.Verbs{"list"}},
+		k8sv1.APIResource{Name: "huge", Kind: "Huge", Namespaced: true, Verbs: k8sv1.Verbs{"list"}})
+	resources := append([]*k8sv1.APIResourceList{widgets}, testClusterResources...)
+	objs := testWidgets(widgetResources, widgetsPerResource)
+	for i := 0; i < widgetsPerResource+1; i++ {
+		objs = append(objs, testObject("example.com/v1", "Huge", "team-0", fmt.Sprintf("huge-%d", i)))
+	}
+	for i := 0; i < widgetsPerResource; i++ {
+		objs = append(objs, testObject("v1", "ConfigMap", fmt.Sprintf("team-%d", i%3), fmt.Sprintf("settings-%d", i)))
+	}
+	selectors := []v1.ResourceSelector{
+		{APIVersion: "example.com/v1", KindsRegexp: "."},
+		{APIVersion: "v1", Kinds: []string{"configmaps"}, Shards: 3},
+	}
+
+	backup := func(parallelism int, maxTotalSizeBytes int64) (*ResourceHandler, map[string][]byte) {
+		h, client := testResourceHandler(resources, objs...)
+		client.PrependReactor("list", "broken", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "example.com", Resource: "broken"}, "", errors.New("denied"))
+		})
+		client.PrependReactor("list", "removed", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewNotFound(schema.GroupResource{Group: "example.com", Resource: "removed"}, "")
+		})
+		h.Parallelism = parallelism
+		h.FailurePolicy = FailurePolicyContinue
+		h.MaxObjectsPerResource = widgetsPerResource
+		h.MaxTotalSizeBytes = maxTotalSizeBytes
+		if err := h.GatherResources(context.Background(), selectors); err != nil {
+			t.Fatalf("GatherResources() with parallelism %v error: %v", parallelism, err)
+		}
+		backupPath := t.TempDir()
+		if err := h.WriteBackupObjects(backupPath); err != nil {
+			t.Fatalf("WriteBackupObjects() with parallelism %v error: %v", parallelism, err)
+		}
+		if err := WriteManifest(DirWriter(backupPath), &h.Manifest); err != nil {
+			t.Fatal(err)
+		}
+		files, err := readBackupFiles(backupPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h, files
+	}
+
+	// limit the size so the last widgets are left out, the sharded config maps are written first and always fit
+	_, unlimited := backup(1, 0)
+	var totalSize int64
+	for path, data := range unlimited {
+		if path != ManifestFileName {
+			totalSize += int64(len(data))
+		}
+	}
+	maxTotalSizeBytes := totalSize * 3 / 4
+
+	serial, serialFiles := backup(1, maxTotalSizeBytes)
+	if len(serial.FailedResources) != 1 || len(serial.RemovedResources) != 1 || len(serial.TruncatedResources) < 2 || len(serial.GVResourceToShards) != 1 {
+		t.Fatalf("serial backup has failed resources %v, removed resources %v, truncated resources %v and shards %v, want one "+
+			"failed, removed and sharded resource and two truncated ones", serial.FailedResources, serial.RemovedResources,
+			serial.TruncatedResources, serial.GVResourceToShards)
+	}
+	for _, parallelism := range []int{2, 5, 16} {
+		t.Run(fmt.Sprintf("parallelism=%v", parallelism), func(t *testing.T) {
+			parallel, parallelFiles := backup(parallelism, maxTotalSizeBytes)
+			if !reflect.DeepEqual(parallel.GVResourceToObjects, serial.GVResourceToObjects) {
+				t.Errorf("gathered objects differ from the serial backup")
+			}
+			if !reflect.DeepEqual(parallel.GVResourceToShards, serial.GVResourceToShards) {
+				t.Errorf("shards = %v, want %v", parallel.GVResourceToShards, serial.GVResourceToShards)
+			}
+			if !reflect.DeepEqual(parallel.FailedResources, serial.FailedResources) {
+				t.Errorf("failed resources = %v, want %v", parallel.FailedResources, serial.FailedResources)
+			}
+			if !reflect.DeepEqual(parallel.RemovedResources, serial.RemovedResources) {
+				t.Errorf("removed resources = %v, want %v", parallel.RemovedResources, serial.RemovedResources)
+			}
+			if !reflect.DeepEqual(parallel.TruncatedResources, serial.TruncatedResources) {
+				t.Errorf("truncated resources = %v, want %v", parallel.TruncatedResources, serial.TruncatedResources)
+			}
+			if !reflect.DeepEqual(parallelFiles, serialFiles) {
+				t.Errorf("files written = %v, want the files of the serial backup %v", len(parallelFiles), len(serialFiles))
+			}
+		})
+	}
+}
+
+func BenchmarkGatherObjectsForResources(b *testing.B) {
+	const widgetResources, widgetsPerResource = 20, 50
+	widgets := testWidgetResources(widgetResources)
+	gv := schema.GroupVersion{Group: "example.com", Version: "v1"}
+	for _, parallelism := range []int{1, DefaultParallelism} {
+		b.Run(fmt.Sprintf("parallelism=%v", parallelism), func(b *testing.B) {
+			h, client := testResourceHandler([]*k8sv1.APIResourceList{widgets}, testWidgets(widgetResources, widgetsPerResource)...)
+			h.DynamicClient = slowDynamicClient{Interface: client, delay: 2 * time.Millisecond}
+			h.Parallelism = parallelism
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := h.gatherObjectsForResources(context.Background(), widgets.APIResources, gv, v1.ResourceSelector{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterByNamespace(t *testing.T) {
+	objs := []unstructured.Unstructured{
+		*testObject("v1", "ConfigMap", "team-a", "settings"),
+		*testObject("v1", "ConfigMap", "team-b", "settings"),
+		*testObject("v1", "ConfigMap", "team-b", "creds"),
+		*testObject("v1", "ConfigMap", "other", "settings"),
+	}
+	tests := []struct {
+		name     string
+		selector v1.ResourceSelector
+		want     []string
+	}{
+		{name: "namespaces", selector: v1.ResourceSelector{Namespaces: []string{"team-a"}}, want: []string{"team-a/settings"}},
+		{name: "duplicate namespaces", selector: v1.ResourceSelector{Namespaces: []string{"team-a", "team-a"}}, want: []string{"team-a/settings"}},
+		{name: "regexp", selector: v1.ResourceSelector{NamespaceRegexp: "team-.*"}, want: []string{"team-a/settings", "team-b/settings", "team-b/creds"}},
+		{
+			name:     "namespaces and regexp matching the same objects",
+			selector: v1.ResourceSelector{Namespaces: []string{"team-a", "team-b", "team-a"}, NamespaceRegexp: "team-.*"},
+			want:     []string{"team-a/settings", "team-b/settings", "team-b/creds"},
+		},
+		{
+			name:     "namespaces and regexp matching different objects",
+			selector: v1.ResourceSelector{Namespaces: []string{"other"}, NamespaceRegexp: "team-a"},
+			want:     []string{"other/settings", "team-a/settings"},
+		},
+		{name: "regexp matching nothing", selector: v1.ResourceSelector{Namespaces: []string{"team-a"}, NamespaceRegexp: "nothing"}, want: []string{"team-a/settings"}},
+		{name: ".", selector: v1.ResourceSelector{Namespaces: []string{"team-a"}, NamespaceRegexp: "."}, want: []string{"team-a/settings", "team-b/settings", "team-b/creds", "other/settings"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered, err := (&ResourceHandler{}).filterByNamespace(tt.selector, objs)
+			if err != nil {
+				t.Fatalf("filterByNamespace() error: %v", err)
+			}
+			var got []string
+			for _, obj := range filtered {
+				got = append(got, objectKey(obj))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterByNamespace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectMatchingNameAndNamespaceWrittenOnce(t *testing.T) {
+	h, _ := testResourceHandler(testClusterResources,
+		testObject("v1", "ConfigMap", "cattle-system", "cattle-settings"),
+		testObject("v1", "ConfigMap", "cattle-system", "other"),
+		testObject("v1", "ConfigMap", "default", "cattle-settings"))
+	selectors := []v1.ResourceSelector{{
+		APIVersion:         "v1",
+		Kinds:              []string{"configmaps"},
+		ResourceNames:      []string{"cattle-settings"},
+		ResourceNameRegexp: "cattle-.*",
+		Namespaces:         []string{"cattle-system"},
+		NamespaceRegexp:    "cattle-.*",
+	}}
+	if err := h.GatherResources(context.Background(), selectors); err != nil {
+		t.Fatalf("GatherResources() error: %v", err)
+	}
+	if err := h.WriteBackupObjects(t.TempDir()); err != nil {
+		t.Fatalf("WriteBackupObjects() error: %v", err)
+	}
+	if got, want := writtenObjects(&h.Manifest), []string{"v1/configmaps/cattle-system/cattle-settings"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("objects written = %v, want %v", got, want)
+	}
+}
+
+// testMalformedObjects are objects some aggregated apiservers return, none of them can be written to a backup
+func testMalformedObjects() []unstructured.Unstructured {
+	return []unstructured.Unstructured{
+		{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Secret"}},
+		{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Secret", "metadata": "creds"}},
+		{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Secret", "metadata": map[string]interface{}{}}},
+		{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Secret", "metadata": map[string]interface{}{"name": 42}}},
+		{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Secret", "metadata": map[string]interface{}{"name": ""}}},
+		{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Secret", "metadata": map[string]interface{}{"name": "creds", "namespace": 42}}},
+	}
+}
+
+func TestHasValidMetadata(t *testing.T) {
+	for i, obj := range testMalformedObjects() {
+		if hasValidMetadata(secretsGVResource, obj) {
+			t.Errorf("hasValidMetadata() of malformed object %v = true, want false", i)
+		}
+	}
+	valid := []struct {
+		gvResource GVResource
+		obj        unstructured.Unstructured
+	}{
+		{gvResource: secretsGVResource, obj: testSecret()},
+		{gvResource: secretsGVResource, obj: *testObject("v1", "Secret", "", "creds")},
+		{gvResource: GVResource{GroupVersion: schema.GroupVersion{Version: "v1"}, Name: "namespaces"}, obj: *testObject("v1", "Namespace", "", "default")},
+	}
+	for _, tt := range valid {
+		if !hasValidMetadata(tt.gvResource, tt.obj) {
+			t.Errorf("hasValidMetadata() of %v %v = false, want true", tt.gvResource.Name, tt.obj.Object)
+		}
+	}
+}
+
+func TestWriteBackupObjectsSkipsMalformedObjects(t *testing.T) {
+	for _, shards := range []int{0, 2} {
+		t.Run(fmt.Sprintf("shards=%v", shards), func(t *testing.T) {
+			objs := append(testMalformedObjects(), testSecret())
+			h := &ResourceHandler{
+				GVResourceToObjects: map[GVResource][]unstructured.Unstructured{secretsGVResource: objs},
+				GVResourceToShards:  map[GVResource]int{secretsGVResource: shards},
+			}
+			selector := v1.ResourceSelector{Namespaces: []string{"cattle-system"}, NamespaceRegexp: "cattle-.*"}
+			if filtered, err := h.filterByNamespace(selector, objs); err != nil || len(filtered) != 1 {
+				t.Errorf("filterByNamespace() of malformed objects = %v, %v, want only the valid object", filtered, err)
+			}
+			if err := h.WriteBackupObjects(t.TempDir()); err != nil {
+				t.Fatalf("WriteBackupObjects() error: %v", err)
+			}
+			if got, want := writtenObjects(&h.Manifest), []string{"v1/secrets/cattle-system/creds"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("objects written = %v, want %v", got, want)
+			}
+			if got, want := h.SkippedObjectCounts["secrets."], int64(len(testMalformedObjects())); got != want {
+				t.Errorf("skipped objects = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWriteBackupObjectsEncryptsConfiguredResources(t *testing.T) {
+	config := strings.Replace(testEncryptionConfig, "      - secrets\n", "      - secrets\n      - widgets-0.example.com\n", 1)
+	transformers := testTransformersFromConfig(t, config)
+	resources := append([]*k8sv1.APIResourceList{testWidgetResources(2)}, testClusterResources...)
+	secret := testSecret()
+	h, _ := testResourceHandler(resources,
+		&secret,
+		testObject("v1", "ConfigMap", "cattle-system", "settings"),
+		testObject("example.com/v1", "Widget0", "cattle-system", "widget"),
+		testObject("example.com/v1", "Widget1", "cattle-system", "widget"))
+	selectors := []v1.ResourceSelector{
+		{APIVersion: "v1", Kinds: []string{"secrets", "configmaps"}, Shards: 2},
+		{APIVersion: "example.com/v1", KindsRegexp: "."},
+	}
+	if err := h.GatherResources(context.Background(), selectors); err != nil {
+		t.Fatalf("GatherResources() error: %v", err)
+	}
+	h.TransformerMap = transformers
+	backupPath := t.TempDir()
+	if err := h.WriteBackupObjects(backupPath); err != nil {
+		t.Fatalf("WriteBackupObjects() error: %v", err)
+	}
+	files, err := readBackupFiles(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantEncrypted := map[string]schema.GroupResource{
+		"secrets":   {Resource: "secrets"},
+		"widgets-0": {Group: "example.com", Resource: "widgets-0"},
+	}
+	shardData := make(map[string]map[string][]byte)
+	for _, entry := range h.Manifest.Entries {
+		data, err := objectData(files, shardData, entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var encrypted []byte
+		isEncrypted := json.Unmarshal(data, &encrypted) == nil
+		gr, ok := wantEncrypted[entry.Resource]
+		if isEncrypted != ok {
+			t.Errorf("%v is encrypted: %v, want %v", entry.Path, isEncrypted, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		additionalAuthenticatedData := entry.Namespace + "#" + entry.Name
+		if _, err := util.TransformFromStorage(transformers[gr], encrypted, value.DefaultContext([]byte(additionalAuthenticatedData))); err != nil {
+			t.Errorf("decrypting %v with the transformer of %v: %v", entry.Path, gr, err)
+		}
+	}
+	if len(h.Manifest.Entries) != 4 {
+		t.Errorf("objects written = %v, want 4", writtenObjects(&h.Manifest))
+	}
+}
+
+func TestGatherResourcesPaginates(t *testing.T) {
+	const configMaps = 23
+	var objs []runtime.Object
+	for i := 0; i < configMaps; i++ {
+		objs = append(objs, testObject("v1", "ConfigMap", fmt.Sprintf("team-%d", i%2), fmt.Sprintf("settings-%d", i)))
+	}
+	h, client := testResourceHandler(testClusterResources, objs...)
+	paging := newPagingDynamicClient(client)
+	h.DynamicClient = paging
+	h.PageSize = 5
+	if err := h.GatherResources(context.Background(), []v1.ResourceSelector{{APIVersion: "v1", Kinds: []string{"configmaps"}}}); err != nil {
+		t.Fatalf("GatherResources() error: %v", err)
+	}
+	if err := h.WriteBackupObjects(t.TempDir()); err != nil {
+		t.Fatalf("WriteBackupObjects() error: %v", err)
+	}
+
+	if len(*paging.calls) != 5 {
+		t.Errorf("list calls = %v, want 5 pages of 5 objects", *paging.calls)
+	}
+	for _, call := range *paging.calls {
+		if call.Limit != 5 {
+			t.Errorf("list call with limit %v, want 5", call.Limit)
+		}
+	}
+	written := make(map[string]int)
+	for _, object := range writtenObjects(&h.Manifest) {
+		written[object]++
+	}
+	for _, obj := range objs {
+		u := obj.(*unstructured.Unstructured)
+		object := "v1/configmaps/" + u.GetNamespace() + "/" + u.GetName()
+		if written[object] != 1 {
+			t.Errorf("%v written %v times, want once", object, written[object])
+		}
+	}
+	if len(h.Manifest.Entries) != configMaps {
+		t.Errorf("objects written = %v, want %v", len(h.Manifest.Entries), configMaps)
+	}
+}
+
+// blockingDynamicClient never answers list calls of the resource blocked, like a stuck apiserver, until the context of
+// the call is done
+type blockingDynamicClient struct {
+	dynamic.Interface
+	blocked string
+}
+
+func (c blockingDynamicClient) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return blockingResource{NamespaceableResourceInterface: c.Interface.Resource(gvr), blocked: gvr.Resource == c.blocked}
+}
+
+type blockingResource struct {
+	dynamic.NamespaceableResourceInterface
+	blocked bool
+}
+
+func (r blockingResource) List(ctx context.Context, opts k8sv1.ListOptions) (*unstructured.UnstructuredList, error) {
+	if r.blocked {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return r.NamespaceableResourceInterface.List(ctx, opts)
+}
+
+func TestGatherReturnsAtDeadline(t *testing.T) {
+	objs := []runtime.Object{
+		testObject("v1", "ConfigMap", "default", "settings"),
+		testObject("v1", "Secret", "default", "token"),
+	}
+	selectors := []v1.ResourceSelector{{APIVersion: "v1", Kinds: []string{"configmaps", "secrets"}}}
+	tests := []struct {
+		name            string
+		resourceTimeout time.Duration
+		ctxTimeout      time.Duration
+		failurePolicy   string
+		wantErr         string
+	}{
+		{name: "resource timeout", resourceTimeout: 50 * time.Millisecond, wantErr: "timed out gathering secrets"},
+		{name: "context deadline", ctxTimeout: 50 * time.Millisecond, wantErr: context.DeadlineExceeded.Error()},
+		{name: "resource timeout with Continue", resourceTimeout: 50 * time.Millisecond, failurePolicy: FailurePolicyContinue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, client := testResourceHandler(testClusterResources, objs...)
+			h.DynamicClient = blockingDynamicClient{Interface: client, blocked: "secrets"}
+			h.ResourceTimeout = tt.resourceTimeout
+			h.FailurePolicy = tt.failurePolicy
+			ctx := context.Background()
+			if tt.ctxTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.ctxTimeout)
+				defer cancel()
+			}
+			done := make(chan error, 1)
+			go func() { done <- h.GatherResources(ctx, selectors) }()
+			var err error
+			select {
+			case err = <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatalf("GatherResources() didn't return after the deadline")
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("GatherResources() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GatherResources() error: %v", err)
+			}
+			if got := len(h.GVResourceToObjects[GVResource{GroupVersion: schema.GroupVersion{Version: "v1"}, Name: "configmaps", Namespaced: true}]); got != 1 {
+				t.Errorf("gathered %v config maps, want 1", got)
+			}
+			if failure := h.FailedResources["secrets."]; !strings.Contains(failure, "timed out") {
+				t.Errorf("failure of secrets = %q, want a timeout", failure)
+			}
+		})
+	}
+}
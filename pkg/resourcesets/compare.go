@@ -0,0 +1,281 @@
+package resourcesets
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Diff is the difference between two backups, objects are matched by group, resource, namespace and name
+type Diff struct {
+	Added    []ObjectRef    `json:"added"`
+	Removed  []ObjectRef    `json:"removed"`
+	Modified []ObjectChange `json:"modified"`
+}
+
+// ObjectRef identifies an object of a backup, Version is the version it was backed up at in the newer backup
+type ObjectRef struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version"`
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// ObjectChange is an object found in both backups with a different content. Fields is empty if the content of either
+// object can't be read, because it's encrypted or only stored in the base backup of an incremental backup, the object is
+// then modified if its resourceVersion changed
+type ObjectChange struct {
+	ObjectRef
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange is a field that differs between the two objects, Path is dot separated and lists are compared as a whole.
+// Old is unset for added fields and New for removed ones
+type FieldChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+func (r ObjectRef) key() string {
+	return strings.Join([]string{r.Group, r.Resource, r.Namespace, r.Name}, "/")
+}
+
+// CompareBackups returns the objects added, removed and modified in backup b since backup a. Both are either the dir a
+// backup was written to or a backup file, and must have a manifest. Encrypted objects aren't decrypted
+func CompareBackups(a, b string) (Diff, error) {
+	var diff Diff
+	objectsA, err := readBackupObjects(a)
+	if err != nil {
+		return diff, err
+	}
+	objectsB, err := readBackupObjects(b)
+	if err != nil {
+		return diff, err
+	}
+	for key, objB := range objectsB {
+		objA, ok := objectsA[key]
+		if !ok {
+			diff.Added = append(diff.Added, objB.ref)
+			continue
+		}
+		if objA.content == nil || objB.content == nil {
+			if objA.entry.ResourceVersion != objB.entry.ResourceVersion {
+				diff.Modified = append(diff.Modified, ObjectChange{ObjectRef: objB.ref})
+			}
+			continue
+		}
+		if fields := diffFields("", objA.content, objB.content); len(fields) > 0 {
+			diff.Modified = append(diff.Modified, ObjectChange{ObjectRef: objB.ref, Fields: fields})
+		}
+	}
+	for key, objA := range objectsA {
+		if _, ok := objectsB[key]; !ok {
+			diff.Removed = append(diff.Removed, objA.ref)
+		}
+	}
+	sortObjectRefs(diff.Added)
+	sortObjectRefs(diff.Removed)
+	sort.Slice(diff.Modified, func(i, j int) bool {
+		return diff.Modified[i].key() < diff.Modified[j].key()
+	})
+	return diff, nil
+}
+
+type backupObject struct {
+	ref     ObjectRef
+	entry   ManifestEntry
+	content map[string]interface{}
+}
+
+// readBackupObjects returns every object in the manifest of the backup by the key of its ObjectRef
+func readBackupObjects(backupPath string) (map[string]backupObject, error) {
+	files, err := readBackupFiles(backupPath)
+	if err != nil {
+		return nil, err
+	}
+	manifestBytes, ok := files[ManifestFileName]
+	if !ok {
+		return nil, fmt.Errorf("backup %v has no %v", backupPath, ManifestFileName)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("error unmarshaling manifest of backup %v: %v", backupPath, err)
+	}
+	shards := make(map[string]map[string][]byte)
+	objects := make(map[string]backupObject)
+	for _, entry := range manifest.Entries {
+		obj := backupObject{
+			ref: ObjectRef{
+				Group:     entry.Group,
+				Version:   entry.Version,
+				Resource:  entry.Resource,
+				Namespace: entry.Namespace,
+				Name:      entry.Name,
+			},
+			entry: entry,
+		}
+		if !entry.InBase {
+			data, err := objectData(files, shards, entry)
+			if err != nil {
+				return nil, fmt.Errorf("error reading %v of backup %v: %v", entry.Path, backupPath, err)
+			}
+			obj.content = decodeObjectContent(data)
+		}
+		objects[obj.ref.key()] = obj
+	}
+	return objects, nil
+}
+
+// objectData returns the contents of the file holding the object of the entry, decompressed
+func objectData(files map[string][]byte, shards map[string]map[string][]byte, entry ManifestEntry) ([]byte, error) {
+	if entry.Shard == "" {
+		data, ok := files[entry.File()]
+		if !ok {
+			return nil, fmt.Errorf("file %v listed in the backup manifest is missing from the backup", entry.File())
+		}
+		if entry.Compressed {
+			return DecompressObject(data)
+		}
+		return data, nil
+	}
+	shard, ok := shards[entry.Shard]
+	if !ok {
+		shardBytes, ok := files[entry.Shard]
+		if !ok {
+			return nil, fmt.Errorf("shard %v listed in the backup manifest is missing from the backup", entry.Shard)
+		}
+		var shardedObjects []ShardedObject
+		if err := json.Unmarshal(shardBytes, &shardedObjects); err != nil {
+			return nil, fmt.Errorf("error unmarshaling shard %v: %v", entry.Shard, err)
+		}
+		shard = make(map[string][]byte)
+		for _, obj := range shardedObjects {
+			shard[obj.Namespace+"/"+obj.Name] = obj.Data
+		}
+		shards[entry.Shard] = shard
+	}
+	data, ok := shard[entry.Namespace+"/"+entry.Name]
+	if !ok {
+		return nil, fmt.Errorf("object is missing from shard %v", entry.Shard)
+	}
+	return data, nil
+}
+
+// decodeObjectContent returns nil for encrypted objects, their JSON is a string
+func decodeObjectContent(data []byte) map[string]interface{} {
+	content := make(map[string]interface{})
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil
+	}
+	return content
+}
+
+// readBackupFiles returns the contents of every file in the backup by its path in the backup
+func readBackupFiles(backupPath string) (map[string][]byte, error) {
+	info, err := os.Stat(backupPath)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	if info.IsDir() {
+		err := filepath.Walk(backupPath, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			relativePath, err := filepath.Rel(backupPath, filePath)
+			if err != nil {
+				return err
+			}
+			data, err := ioutil.ReadFile(filePath)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(relativePath)] = data
+			return nil
+		})
+		return files, err
+	}
+	r, err := os.Open(backupPath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading backup %v: %v", backupPath, err)
+	}
+	tarball := tar.NewReader(gz)
+	for {
+		header, err := tarball.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading backup %v: %v", backupPath, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := ioutil.ReadAll(tarball)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %v of backup %v: %v", header.Name, backupPath, err)
+		}
+		files[path.Clean(header.Name)] = data
+	}
+}
+
+// diffFields returns the fields that differ between the two maps, nested maps are compared field by field
+func diffFields(prefix string, a, b map[string]interface{}) []FieldChange {
+	keys := make(map[string]bool)
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	var changes []FieldChange
+	for _, key := range sortedKeys {
+		fieldPath := key
+		if prefix != "" {
+			fieldPath = prefix + "." + key
+		}
+		valueA, inA := a[key]
+		valueB, inB := b[key]
+		mapA, isMapA := valueA.(map[string]interface{})
+		mapB, isMapB := valueB.(map[string]interface{})
+		switch {
+		case inA && inB && isMapA && isMapB:
+			changes = append(changes, diffFields(fieldPath, mapA, mapB)...)
+		case !inB:
+			changes = append(changes, FieldChange{Path: fieldPath, Old: valueA})
+		case !inA:
+			changes = append(changes, FieldChange{Path: fieldPath, New: valueB})
+		case !reflect.DeepEqual(valueA, valueB):
+			changes = append(changes, FieldChange{Path: fieldPath, Old: valueA, New: valueB})
+		}
+	}
+	return changes
+}
+
+func sortObjectRefs(refs []ObjectRef) {
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].key() < refs[j].key()
+	})
+}
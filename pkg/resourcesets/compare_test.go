@@ -0,0 +1,140 @@
+package resourcesets
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage/value"
+)
+
+var configMapsGVResource = GVResource{GroupVersion: schema.GroupVersion{Version: "v1"}, Name: "configmaps", Namespaced: true}
+
+func compareTestConfigMap(name, resourceVersion string, data map[string]interface{}) unstructured.Unstructured {
+	obj := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "data": data}}
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	obj.SetResourceVersion(resourceVersion)
+	return obj
+}
+
+// writeCompareBackup writes a backup of the objects with a manifest, into a dir or into an artifact
+func writeCompareBackup(t *testing.T, artifact bool, transformers map[schema.GroupResource]value.Transformer,
+	objects map[GVResource][]unstructured.Unstructured) string {
+	backupPath := t.TempDir()
+	// writing removes the server fields of the objects
+	h := &ResourceHandler{TransformerMap: transformers, GVResourceToObjects: make(map[GVResource][]unstructured.Unstructured)}
+	for gvResource, resObjects := range objects {
+		for _, obj := range resObjects {
+			h.GVResourceToObjects[gvResource] = append(h.GVResourceToObjects[gvResource], *obj.DeepCopy())
+		}
+	}
+	var w FileWriter = DirWriter(backupPath)
+	if artifact {
+		writer, err := NewArtifactWriter(filepath.Join(backupPath, "backup.tar.gz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer writer.Close()
+		h.Writer, w = writer, writer
+		backupPath = filepath.Join(backupPath, "backup.tar.gz")
+	}
+	if err := h.WriteBackupObjects(backupPath); err != nil {
+		t.Fatalf("WriteBackupObjects() error: %v", err)
+	}
+	if err := WriteManifest(w, &h.Manifest); err != nil {
+		t.Fatal(err)
+	}
+	return backupPath
+}
+
+func TestCompareBackups(t *testing.T) {
+	transformers := testTransformers(t)
+	secret := func(resourceVersion string) unstructured.Unstructured {
+		obj := testSecret()
+		obj.SetResourceVersion(resourceVersion)
+		return obj
+	}
+	before := map[GVResource][]unstructured.Unstructured{
+		configMapsGVResource: {
+			compareTestConfigMap("settings", "1", map[string]interface{}{"replicas": "3", "mode": "ha"}),
+			compareTestConfigMap("unchanged", "1", map[string]interface{}{"key": "value"}),
+			compareTestConfigMap("removed", "1", map[string]interface{}{"key": "value"}),
+		},
+		secretsGVResource: {secret("1")},
+	}
+	after := map[GVResource][]unstructured.Unstructured{
+		configMapsGVResource: {
+			compareTestConfigMap("settings", "2", map[string]interface{}{"replicas": "5", "debug": "true"}),
+			// a new resourceVersion without a change of fields isn't a modification
+			compareTestConfigMap("unchanged", "2", map[string]interface{}{"key": "value"}),
+			compareTestConfigMap("added", "1", map[string]interface{}{"key": "value"}),
+		},
+		secretsGVResource: {secret("2")},
+	}
+	want := Diff{
+		Added:   []ObjectRef{{Version: "v1", Resource: "configmaps", Namespace: "default", Name: "added"}},
+		Removed: []ObjectRef{{Version: "v1", Resource: "configmaps", Namespace: "default", Name: "removed"}},
+		Modified: []ObjectChange{
+			{
+				ObjectRef: ObjectRef{Version: "v1", Resource: "configmaps", Namespace: "default", Name: "settings"},
+				Fields: []FieldChange{
+					{Path: "data.debug", New: "true"},
+					{Path: "data.mode", Old: "ha"},
+					{Path: "data.replicas", Old: "3", New: "5"},
+				},
+			},
+			// encrypted objects are compared by resourceVersion
+			{ObjectRef: ObjectRef{Version: "v1", Resource: "secrets", Namespace: "cattle-system", Name: "creds"}},
+		},
+	}
+	for _, artifact := range []bool{false, true} {
+		a := writeCompareBackup(t, artifact, transformers, before)
+		b := writeCompareBackup(t, artifact, transformers, after)
+		diff, err := CompareBackups(a, b)
+		if err != nil {
+			t.Fatalf("CompareBackups() error: %v", err)
+		}
+		if !reflect.DeepEqual(diff, want) {
+			t.Errorf("CompareBackups() of artifacts %v = %+v, want %+v", artifact, diff, want)
+		}
+
+		reverse, err := CompareBackups(b, a)
+		if err != nil {
+			t.Fatalf("CompareBackups() error: %v", err)
+		}
+		if !reflect.DeepEqual(reverse.Added, want.Removed) || !reflect.DeepEqual(reverse.Removed, want.Added) {
+			t.Errorf("CompareBackups() the other way = %+v, want added and removed swapped", reverse)
+		}
+	}
+
+	diff, err := CompareBackups(writeCompareBackup(t, false, transformers, before), writeCompareBackup(t, true, transformers, before))
+	if err != nil {
+		t.Fatalf("CompareBackups() error: %v", err)
+	}
+	if len(diff.Added) != 0 || len(diff.Removed) != 0 || len(diff.Modified) != 0 {
+		t.Errorf("CompareBackups() of a dir and an artifact of the same objects = %+v, want no changes", diff)
+	}
+}
+
+func TestDiffJSON(t *testing.T) {
+	diff := Diff{
+		Added: []ObjectRef{{Version: "v1", Resource: "configmaps", Namespace: "default", Name: "added"}},
+		Modified: []ObjectChange{{
+			ObjectRef: ObjectRef{Group: "apps", Version: "v1", Resource: "deployments", Namespace: "default", Name: "web"},
+			Fields:    []FieldChange{{Path: "spec.replicas", Old: 1, New: 3}},
+		}},
+	}
+	data, err := json.Marshal(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"added":[{"version":"v1","resource":"configmaps","namespace":"default","name":"added"}],"removed":null,` +
+		`"modified":[{"group":"apps","version":"v1","resource":"deployments","namespace":"default","name":"web","fields":[{"path":"spec.replicas","old":1,"new":3}]}]}`
+	if string(data) != want {
+		t.Errorf("JSON of the diff = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,58 @@
+package resourcesets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"k8s.io/apiserver/pkg/storage/value"
+)
+
+// CompressedObjectSuffix is added to the file of an object compressed because of PerObjectCompression, the path of its
+// manifest entry keeps the .json name
+const CompressedObjectSuffix = ".gz"
+
+// encodeFileObject encodes an object for its own file, gzipped if its JSON is larger than PerObjectCompression. Objects
+// are compressed before they are encrypted, encrypted data doesn't compress
+func (h *ResourceHandler) encodeFileObject(resource map[string]interface{}, transformer value.Transformer, additionalAuthenticatedData string) ([]byte, bool, error) {
+	resourceBytes, err := json.Marshal(resource)
+	if err != nil {
+		return nil, false, fmt.Errorf("error converting resource to JSON: %v", err)
+	}
+	compressed := h.PerObjectCompression > 0 && int64(len(resourceBytes)) > h.PerObjectCompression
+	if compressed {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		if _, err := gw.Write(resourceBytes); err != nil {
+			return nil, false, fmt.Errorf("error compressing resource: %v", err)
+		}
+		if err := gw.Close(); err != nil {
+			return nil, false, fmt.Errorf("error compressing resource: %v", err)
+		}
+		resourceBytes = buf.Bytes()
+	}
+	resourceBytes, err = encryptObject(resourceBytes, transformer, additionalAuthenticatedData)
+	return resourceBytes, compressed, err
+}
+
+// ObjectPath returns the path of the manifest entry of an object file, the file name without CompressedObjectSuffix
+func ObjectPath(file string) string {
+	return strings.TrimSuffix(file, CompressedObjectSuffix)
+}
+
+// DecompressObject returns the JSON of an object read from a compressed file, after it was decrypted
+func DecompressObject(data []byte) ([]byte, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing resource: %v", err)
+	}
+	defer gr.Close()
+	decompressed, err := ioutil.ReadAll(gr)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing resource: %v", err)
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,88 @@
+package resourcesets
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage/value"
+)
+
+func TestPerObjectCompression(t *testing.T) {
+	const threshold = 1024
+	large := testSecret()
+	large.SetName("large")
+	large.Object["data"] = map[string]interface{}{"ca.crt": strings.Repeat("Q0VSVElGSUNBVEU=", 512)}
+	small := testSecret()
+	small.SetName("small")
+	for _, encrypted := range []bool{false, true} {
+		t.Run(fmt.Sprintf("encrypted=%v", encrypted), func(t *testing.T) {
+			var transformers map[schema.GroupResource]value.Transformer
+			if encrypted {
+				transformers = testTransformers(t)
+			}
+			backupPath := t.TempDir()
+			h := &ResourceHandler{
+				TransformerMap:       transformers,
+				PerObjectCompression: threshold,
+				GVResourceToObjects:  map[GVResource][]unstructured.Unstructured{secretsGVResource: {large, small}},
+			}
+			if err := h.WriteBackupObjects(backupPath); err != nil {
+				t.Fatalf("WriteBackupObjects() error: %v", err)
+			}
+			if err := WriteManifest(DirWriter(backupPath), &h.Manifest); err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyBackup(backupPath); err != nil {
+				t.Errorf("VerifyBackup() error: %v", err)
+			}
+
+			for _, entry := range h.Manifest.Entries {
+				wantCompressed := entry.Name == "large"
+				if entry.Compressed != wantCompressed {
+					t.Errorf("%v compressed = %v, want %v", entry.Name, entry.Compressed, wantCompressed)
+				}
+				if !strings.HasSuffix(entry.Path, ".json") || strings.HasSuffix(entry.File(), CompressedObjectSuffix) != wantCompressed {
+					t.Errorf("%v has path %v and is written to %v", entry.Name, entry.Path, entry.File())
+				}
+				data, err := ioutil.ReadFile(filepath.Join(backupPath, entry.File()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				// restore decrypts before it decompresses
+				if encrypted {
+					var encryptedData []byte
+					if err := json.Unmarshal(data, &encryptedData); err != nil {
+						t.Fatalf("encrypted object isn't a JSON string: %v", err)
+					}
+					additionalAuthenticatedData := entry.Namespace + "#" + entry.Name
+					if data, err = util.TransformFromStorage(transformers[schema.GroupResource{Resource: "secrets"}], encryptedData, value.DefaultContext([]byte(additionalAuthenticatedData))); err != nil {
+						t.Fatalf("decrypting %v: %v", entry.Name, err)
+					}
+				}
+				if entry.Compressed {
+					compressedSize := len(data)
+					if data, err = DecompressObject(data); err != nil {
+						t.Fatalf("DecompressObject() of %v error: %v", entry.Name, err)
+					}
+					if compressedSize >= len(data) {
+						t.Errorf("%v compressed to %v bytes from %v", entry.Name, compressedSize, len(data))
+					}
+				}
+				restored := unstructured.Unstructured{}
+				if err := restored.UnmarshalJSON(data); err != nil {
+					t.Fatalf("object of %v isn't JSON: %v", entry.Path, err)
+				}
+				if restored.GetName() != entry.Name {
+					t.Errorf("%v holds object %v", entry.File(), restored.GetName())
+				}
+			}
+		})
+	}
+}
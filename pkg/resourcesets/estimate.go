@@ -0,0 +1,125 @@
+package resourcesets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/sirupsen/logrus"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// resourceEstimate is the count of one resource and the size of the first object returned for it
+type resourceEstimate struct {
+	count      int64
+	objectSize int64
+}
+
+// EstimateBackup counts the objects of every resource matched by the selectors without gathering them. Most resources are
+// counted with a single list call of one object, using its remainingItemCount. With label selectors the apiserver doesn't
+// return remainingItemCount, so these are counted by paginating through the list
+func (h *ResourceHandler) EstimateBackup(ctx context.Context, resourceSelectors []v1.ResourceSelector) (*v1.BackupEstimate, error) {
+	estimates := make(map[string]resourceEstimate)
+	resourceSelectors, err := h.expandGroupSelectors(ctx, resourceSelectors)
+	if err != nil {
+		return nil, err
+	}
+	for _, resourceSelector := range resourceSelectors {
+		resourceSelector, err := h.withSelectedVersion(ctx, resourceSelector)
+		if err != nil {
+			return nil, err
+		}
+		resourceList, err := h.gatherResourcesForGroupVersion(ctx, resourceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("error gathering resource for %v: %v", resourceSelector.APIVersion, err)
+		}
+		gv, err := schema.ParseGroupVersion(resourceSelector.APIVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, res := range resourceList {
+			if strings.Contains(res.Name, "/") || !canListResource(res.Verbs) {
+				continue
+			}
+			estimate, err := h.estimateResource(ctx, gv.WithResource(res.Name), res.Namespaced, resourceSelector)
+			if err != nil {
+				return nil, fmt.Errorf("error counting %v: %v", gv.WithResource(res.Name).String(), err)
+			}
+			// a resource matched by several selectors is estimated by its largest count
+			key := res.Name + "." + gv.Group
+			if estimate.count > estimates[key].count {
+				estimates[key] = estimate
+			}
+		}
+	}
+
+	backupEstimate := &v1.BackupEstimate{ObjectCounts: make(map[string]int64)}
+	for key, estimate := range estimates {
+		backupEstimate.ObjectCounts[key] = estimate.count
+		backupEstimate.SizeBytes += estimate.count * estimate.objectSize
+	}
+	return backupEstimate, nil
+}
+
+func (h *ResourceHandler) estimateResource(ctx context.Context, gvr schema.GroupVersionResource, namespaced bool, filter v1.ResourceSelector) (resourceEstimate, error) {
+	listOptions := k8sv1.ListOptions{FieldSelector: fieldSelectorFor(filter)}
+	if filter.LabelSelectors != nil {
+		selector, err := k8sv1.LabelSelectorAsSelector(filter.LabelSelectors)
+		if err != nil {
+			return resourceEstimate{}, err
+		}
+		listOptions.LabelSelector = selector.String()
+	}
+	if !namespaced || len(filter.Namespaces) == 0 {
+		return h.countObjects(ctx, gvr, "", listOptions)
+	}
+	var total resourceEstimate
+	for _, namespace := range filter.Namespaces {
+		estimate, err := h.countObjects(ctx, gvr, namespace, listOptions)
+		if err != nil {
+			return total, err
+		}
+		total.count += estimate.count
+		if total.objectSize == 0 {
+			total.objectSize = estimate.objectSize
+		}
+	}
+	return total, nil
+}
+
+func (h *ResourceHandler) countObjects(ctx context.Context, gvr schema.GroupVersionResource, namespace string, listOptions k8sv1.ListOptions) (resourceEstimate, error) {
+	var estimate resourceEstimate
+	var dr dynamic.ResourceInterface
+	dr = h.DynamicClient.Resource(gvr)
+	if namespace != "" {
+		dr = h.DynamicClient.Resource(gvr).Namespace(namespace)
+	}
+	firstPage := listOptions
+	firstPage.Limit = 1
+	list, err := dr.List(ctx, firstPage)
+	if err != nil {
+		return estimate, err
+	}
+	if len(list.Items) > 0 {
+		objectBytes, err := json.Marshal(list.Items[0].Object)
+		if err != nil {
+			return estimate, err
+		}
+		estimate.objectSize = int64(len(objectBytes))
+	}
+	estimate.count = int64(len(list.Items))
+	if list.GetContinue() == "" {
+		return estimate, nil
+	}
+	if remaining := list.GetRemainingItemCount(); remaining != nil {
+		estimate.count += *remaining
+		return estimate, nil
+	}
+	logrus.Debugf("No remainingItemCount in the list of %v, paginating to count the objects", gvr.String())
+	estimate.count, err = h.paginateCount(ctx, gvr, namespace, listOptions)
+	return estimate, err
+}
@@ -0,0 +1,133 @@
+package resourcesets
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/sirupsen/logrus"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage/value"
+)
+
+const (
+	// EventsDirName is the dir of the backup holding captured events, example: events/cattle-system/rancher.16b2c1.json
+	EventsDirName = "events"
+	// DefaultMaxEventsPerObject is the number of events kept per object if the capture doesn't set one, the newest are kept
+	DefaultMaxEventsPerObject = 10
+)
+
+var eventsGVR = schema.GroupVersionResource{Version: "v1", Resource: "events"}
+
+// WriteEvents writes the events whose involvedObject is one of the gathered objects, for every namespace of the capture.
+// Events are for reference only, their manifest entries are non-restorable
+func (h *ResourceHandler) WriteEvents(ctx context.Context, backupPath string, capture *v1.EventCapture) error {
+	maxEvents := capture.MaxEventsPerObject
+	if maxEvents <= 0 {
+		maxEvents = DefaultMaxEventsPerObject
+	}
+	kinds := make(map[string]bool)
+	for _, kind := range capture.Kinds {
+		kinds[kind] = true
+	}
+	captured := make(map[string]bool)
+	for _, resObjects := range h.GVResourceToObjects {
+		for _, resObj := range resObjects {
+			if len(kinds) > 0 && !kinds[resObj.GetKind()] {
+				continue
+			}
+			captured[involvedObjectKey(resObj.GetKind(), resObj.GetNamespace(), resObj.GetName())] = true
+		}
+	}
+	if len(captured) == 0 {
+		return nil
+	}
+
+	w := h.fileWriter(backupPath)
+	encryptionTransformer := h.TransformerMap[eventsGVR.GroupResource()]
+	for _, namespace := range capture.Namespaces {
+		eventList, err := paginateListResults(ctx, h.DynamicClient.Resource(eventsGVR).Namespace(namespace), k8sv1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("error listing events in namespace %v: %v", namespace, err)
+		}
+		eventsByObject := make(map[string][]unstructured.Unstructured)
+		for _, event := range eventList.Items {
+			kind, _, _ := unstructured.NestedString(event.Object, "involvedObject", "kind")
+			objNs, _, _ := unstructured.NestedString(event.Object, "involvedObject", "namespace")
+			name, _, _ := unstructured.NestedString(event.Object, "involvedObject", "name")
+			key := involvedObjectKey(kind, objNs, name)
+			if captured[key] {
+				eventsByObject[key] = append(eventsByObject[key], event)
+			}
+		}
+		keys := make([]string, 0, len(eventsByObject))
+		for key := range eventsByObject {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			events := eventsByObject[key]
+			sortObjects(events)
+			if len(events) > maxEvents {
+				logrus.Infof("Capturing the newest %v of %v events of %v", maxEvents, len(events), key)
+				sort.Slice(events, func(i, j int) bool {
+					return eventTimestamp(events[i]).After(eventTimestamp(events[j]))
+				})
+				events = events[:maxEvents]
+			}
+			for _, event := range events {
+				if err := h.writeEvent(w, event, encryptionTransformer); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (h *ResourceHandler) writeEvent(w FileWriter, event unstructured.Unstructured, transformer value.Transformer) error {
+	name, namespace := event.GetName(), event.GetNamespace()
+	removeServerFields(event)
+	manifestEntry := ManifestEntry{
+		Path:          filepath.Join(EventsDirName, namespace, name+".json"),
+		Version:       eventsGVR.Version,
+		Resource:      eventsGVR.Resource,
+		Name:          name,
+		Namespace:     namespace,
+		NonRestorable: true,
+		Reason:        "event",
+	}
+	checksum, err := writeToBackup(w, event.Object, manifestEntry.Path, transformer, fmt.Sprintf("%s#%s", namespace, name))
+	if err != nil {
+		if h.skipOnEncryptionFailure(err) {
+			logrus.Errorf("Skipping event %v: %v", name, err)
+			h.countSkipped(GVResource{GroupVersion: eventsGVR.GroupVersion(), Name: eventsGVR.Resource, Namespaced: true}, 1)
+			return nil
+		}
+		return err
+	}
+	manifestEntry.SHA256 = checksum
+	h.Manifest.Entries = append(h.Manifest.Entries, manifestEntry)
+	return nil
+}
+
+func involvedObjectKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// eventTimestamp returns the time the event was last seen
+func eventTimestamp(event unstructured.Unstructured) time.Time {
+	for _, field := range []string{"lastTimestamp", "eventTime", "firstTimestamp"} {
+		if ts, _, _ := unstructured.NestedString(event.Object, field); ts != "" {
+			if parsed, err := time.Parse(time.RFC3339, ts); err == nil {
+				return parsed
+			}
+		}
+	}
+	return event.GetCreationTimestamp().Time
+}
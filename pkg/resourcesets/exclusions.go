@@ -0,0 +1,89 @@
+package resourcesets
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ExclusionRule is a line of an exclusion file, group/resource/namespace/name where every field is a glob pattern.
+// An empty group is the core group, and omitted trailing fields match everything, example: /secrets/cattle-system/*-token-*
+type ExclusionRule struct {
+	Source    string
+	Line      int
+	Group     string
+	Resource  string
+	Namespace string
+	Name      string
+}
+
+func (r ExclusionRule) String() string {
+	return fmt.Sprintf("%v/%v/%v/%v (%v line %v)", r.Group, r.Resource, r.Namespace, r.Name, r.Source, r.Line)
+}
+
+// ParseExclusions reads the rules of an exclusion file, one per line. Empty lines and lines starting with # are ignored
+func ParseExclusions(source string, data []byte) ([]ExclusionRule, error) {
+	var rules []ExclusionRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "/")
+		if len(fields) < 2 || len(fields) > 4 {
+			return nil, fmt.Errorf("%v line %v: %q must be group/resource[/namespace[/name]]", source, lineNumber, line)
+		}
+		for len(fields) < 4 {
+			fields = append(fields, "*")
+		}
+		for _, pattern := range fields {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%v line %v: invalid pattern %q: %v", source, lineNumber, pattern, err)
+			}
+		}
+		rules = append(rules, ExclusionRule{
+			Source:    source,
+			Line:      lineNumber,
+			Group:     fields[0],
+			Resource:  fields[1],
+			Namespace: fields[2],
+			Name:      fields[3],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", source, err)
+	}
+	return rules, nil
+}
+
+func (r ExclusionRule) matches(gvResource GVResource, resObj unstructured.Unstructured) bool {
+	// patterns were validated by ParseExclusions, so errors can't happen here
+	for _, field := range [][2]string{
+		{r.Group, gvResource.GroupVersion.Group},
+		{r.Resource, gvResource.Name},
+		{r.Namespace, resObj.GetNamespace()},
+		{r.Name, resObj.GetName()},
+	} {
+		if matched, _ := path.Match(field[0], field[1]); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// isExcluded returns true if one of the exclusion rules of the handler matches the object, and logs the rule
+func (h *ResourceHandler) isExcluded(gvResource GVResource, resObj unstructured.Unstructured) bool {
+	for _, rule := range h.Exclusions {
+		if rule.matches(gvResource, resObj) {
+			logrus.Infof("Excluding %v %v/%v from the backup by rule %v", gvResource.Name, resObj.GetNamespace(), resObj.GetName(), rule)
+			return true
+		}
+	}
+	return false
+}
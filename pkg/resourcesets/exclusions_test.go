@@ -0,0 +1,75 @@
+package resourcesets
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseExclusions(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []ExclusionRule
+		wantErr bool
+	}{
+		{
+			name: "comments and empty lines",
+			data: "# tokens\n\n/secrets/cattle-system/*-token-*\n",
+			want: []ExclusionRule{{Source: "test", Line: 3, Group: "", Resource: "secrets", Namespace: "cattle-system", Name: "*-token-*"}},
+		},
+		{
+			name: "omitted trailing fields match everything",
+			data: "management.cattle.io/tokens\n  apps/deployments/default  \n",
+			want: []ExclusionRule{
+				{Source: "test", Line: 1, Group: "management.cattle.io", Resource: "tokens", Namespace: "*", Name: "*"},
+				{Source: "test", Line: 2, Group: "apps", Resource: "deployments", Namespace: "default", Name: "*"},
+			},
+		},
+		{name: "empty file", data: "\n# nothing\n"},
+		{name: "too few fields", data: "secrets\n", wantErr: true},
+		{name: "too many fields", data: "/secrets/default/a/b\n", wantErr: true},
+		{name: "invalid pattern", data: "/secrets/[default\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseExclusions("test", []byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseExclusions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseExclusions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExclusionRuleMatches(t *testing.T) {
+	rules, err := ParseExclusions("test", []byte("/secrets/cattle-system/*-token-*\napps/deployments\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployments := GVResource{GroupVersion: schema.GroupVersion{Group: "apps", Version: "v1"}, Name: "deployments", Namespaced: true}
+	tests := []struct {
+		gvResource GVResource
+		namespace  string
+		name       string
+		want       bool
+	}{
+		{gvResource: secretsGVResource, namespace: "cattle-system", name: "user-token-abcde", want: true},
+		{gvResource: secretsGVResource, namespace: "cattle-system", name: "tls-rancher"},
+		{gvResource: secretsGVResource, namespace: "default", name: "user-token-abcde"},
+		{gvResource: deployments, namespace: "default", name: "web", want: true},
+	}
+	h := &ResourceHandler{Exclusions: rules}
+	for _, tt := range tests {
+		obj := unstructured.Unstructured{Object: map[string]interface{}{}}
+		obj.SetNamespace(tt.namespace)
+		obj.SetName(tt.name)
+		if got := h.isExcluded(tt.gvResource, obj); got != tt.want {
+			t.Errorf("isExcluded() of %v %v/%v = %v, want %v", tt.gvResource.Name, tt.namespace, tt.name, got, tt.want)
+		}
+	}
+}
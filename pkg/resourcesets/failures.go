@@ -0,0 +1,46 @@
+package resourcesets
+
+import (
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+const (
+	// FailurePolicyAbort fails the backup on the first resource that can't be gathered
+	FailurePolicyAbort = "Abort"
+	// FailurePolicyContinue gathers the other resources and records the failed ones in FailedResources
+	FailurePolicyContinue = "Continue"
+)
+
+// continueOnFailure records the error of a resource that couldn't be gathered and returns true if the gather goes on.
+// key is resource.group, or the groupVersion of a selector if its resources couldn't be discovered
+func (h *ResourceHandler) continueOnFailure(key string, err error) bool {
+	if h.FailurePolicy != FailurePolicyContinue {
+		return false
+	}
+	logrus.Errorf("Continuing backup without %v: %v", key, err)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.FailedResources == nil {
+		h.FailedResources = make(map[string]string)
+	}
+	h.FailedResources[key] = err.Error()
+	return true
+}
+
+// skipRemovedResource returns true if listing a resource failed because it was removed after it was discovered, like a CRD
+// deleted during the backup. The resource is recorded in RemovedResources and the gather goes on with any FailurePolicy
+func (h *ResourceHandler) skipRemovedResource(key string, err error) bool {
+	if !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+		return false
+	}
+	logrus.Warnf("Skipping %v, it was removed after discovery: %v", key, err)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.RemovedResources = append(h.RemovedResources, key)
+	sort.Strings(h.RemovedResources)
+	return true
+}
@@ -0,0 +1,109 @@
+package resourcesets
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestFailurePolicy(t *testing.T) {
+	objs := []runtime.Object{
+		testObject("v1", "ConfigMap", "default", "settings"),
+		testObject("v1", "Secret", "default", "token"),
+		testObject("apps/v1", "Deployment", "default", "web"),
+	}
+	selectors := []v1.ResourceSelector{
+		{APIVersion: "v1", Kinds: []string{"secrets", "configmaps"}},
+		{APIVersion: "apps/v1", Kinds: []string{"deployments"}},
+	}
+	tests := []struct {
+		policy  string
+		wantErr bool
+	}{
+		{policy: "", wantErr: true},
+		{policy: FailurePolicyAbort, wantErr: true},
+		{policy: FailurePolicyContinue},
+	}
+	for _, tt := range tests {
+		t.Run("policy="+tt.policy, func(t *testing.T) {
+			h, client := testResourceHandler(testClusterResources, objs...)
+			client.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", errors.New("denied"))
+			})
+			h.FailurePolicy = tt.policy
+			err := h.GatherResources(context.Background(), selectors)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "secrets") {
+					t.Errorf("GatherResources() error = %v, want the error listing secrets", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GatherResources() error: %v", err)
+			}
+			if err := h.WriteBackupObjects(t.TempDir()); err != nil {
+				t.Fatalf("WriteBackupObjects() error: %v", err)
+			}
+			want := []string{"v1/configmaps/default/settings", "apps/v1/deployments/default/web"}
+			if got := writtenObjects(&h.Manifest); !reflect.DeepEqual(got, want) {
+				t.Errorf("objects written = %v, want %v", got, want)
+			}
+			if _, ok := h.FailedResources["secrets."]; len(h.FailedResources) != 1 || !ok {
+				t.Errorf("FailedResources = %v, want only secrets", h.FailedResources)
+			}
+		})
+	}
+}
+
+func TestResourceRemovedAfterDiscovery(t *testing.T) {
+	objs := []runtime.Object{
+		testObject("v1", "ConfigMap", "default", "settings"),
+		testObject("v1", "Secret", "default", "token"),
+		testObject("apps/v1", "Deployment", "default", "web"),
+	}
+	selectors := []v1.ResourceSelector{
+		{APIVersion: "v1", Kinds: []string{"secrets", "configmaps"}},
+		{APIVersion: "apps/v1", Kinds: []string{"deployments"}},
+	}
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "not found", err: apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "")},
+		{name: "no match", err: &meta.NoResourceMatchError{PartialResource: schema.GroupVersionResource{Version: "v1", Resource: "secrets"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, client := testResourceHandler(testClusterResources, objs...)
+			client.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, tt.err
+			})
+			h.FailurePolicy = FailurePolicyAbort
+			if err := h.GatherResources(context.Background(), selectors); err != nil {
+				t.Fatalf("GatherResources() error: %v", err)
+			}
+			if err := h.WriteBackupObjects(t.TempDir()); err != nil {
+				t.Fatalf("WriteBackupObjects() error: %v", err)
+			}
+			want := []string{"v1/configmaps/default/settings", "apps/v1/deployments/default/web"}
+			if got := writtenObjects(&h.Manifest); !reflect.DeepEqual(got, want) {
+				t.Errorf("objects written = %v, want %v", got, want)
+			}
+			if want := []string{"secrets."}; !reflect.DeepEqual(h.RemovedResources, want) {
+				t.Errorf("RemovedResources = %v, want %v", h.RemovedResources, want)
+			}
+			if len(h.FailedResources) != 0 {
+				t.Errorf("FailedResources = %v, want none", h.FailedResources)
+			}
+		})
+	}
+}
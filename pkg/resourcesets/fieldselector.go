@@ -0,0 +1,47 @@
+package resourcesets
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// clientSideFields can be matched against any object after listing, some aggregated APIs reject field selectors on them
+var clientSideFields = map[string]bool{
+	"metadata.name":      true,
+	"metadata.namespace": true,
+}
+
+// listWithClientSideFieldSelector lists the objects without the field selector the server rejected with listErr and
+// matches them against it instead. Only field selectors on clientSideFields can be matched, for any other field listErr
+// is returned
+func (h *ResourceHandler) listWithClientSideFieldSelector(ctx context.Context, dr dynamic.ResourceInterface, gvr schema.GroupVersionResource,
+	verbs k8sv1.Verbs, labelSelector, fieldSelector string, listErr error) (*unstructured.UnstructuredList, error) {
+	selector, err := fields.ParseSelector(fieldSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid field selector %v: %v", fieldSelector, err)
+	}
+	for _, requirement := range selector.Requirements() {
+		if !clientSideFields[requirement.Field] {
+			return nil, fmt.Errorf("resource %v does not support field selector %v: %v", gvr.String(), fieldSelector, listErr)
+		}
+	}
+	logrus.Warnf("Resource %v does not support field selector %v, matching it after listing: %v", gvr.String(), fieldSelector, listErr)
+	list, err := h.listObjects(ctx, dr, gvr, verbs, k8sv1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+	matched := &unstructured.UnstructuredList{Object: list.Object}
+	for _, obj := range list.Items {
+		if selector.Matches(fields.Set{"metadata.name": obj.GetName(), "metadata.namespace": obj.GetNamespace()}) {
+			matched.Items = append(matched.Items, obj)
+		}
+	}
+	return matched, nil
+}
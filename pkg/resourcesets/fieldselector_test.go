@@ -0,0 +1,180 @@
+package resourcesets
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCustomFieldSelector(t *testing.T) {
+	phases := []string{"Running", "Pending", "Running", "Failed", "Running", "Running"}
+	var widgets []runtime.Object
+	for i, phase := range phases {
+		widget := testObject("example.com/v1", "Widget0", fmt.Sprintf("team-%d", i%2), fmt.Sprintf("widget-%d", i))
+		widget.Object["status"] = map[string]interface{}{"phase": phase}
+		widget.Object["spec"] = map[string]interface{}{"nodeName": fmt.Sprintf("node-%d", i%3)}
+		widgets = append(widgets, widget)
+	}
+	tests := []struct {
+		name     string
+		selector v1.ResourceSelector
+		want     []string
+	}{
+		{
+			name:     "status.phase",
+			selector: v1.ResourceSelector{FieldSelectors: []string{"status.phase=Running"}},
+			want: []string{
+				"example.com/v1/widgets-0/team-0/widget-0", "example.com/v1/widgets-0/team-0/widget-2",
+				"example.com/v1/widgets-0/team-0/widget-4", "example.com/v1/widgets-0/team-1/widget-5",
+			},
+		},
+		{
+			name:     "several fields",
+			selector: v1.ResourceSelector{FieldSelectors: []string{"status.phase=Running", "spec.nodeName!=node-0"}},
+			want:     []string{"example.com/v1/widgets-0/team-0/widget-2", "example.com/v1/widgets-0/team-0/widget-4", "example.com/v1/widgets-0/team-1/widget-5"},
+		},
+		{
+			name:     "with the namespaces of the selector",
+			selector: v1.ResourceSelector{FieldSelectors: []string{"status.phase!=Running"}, Namespaces: []string{"team-1"}},
+			want:     []string{"example.com/v1/widgets-0/team-1/widget-1", "example.com/v1/widgets-0/team-1/widget-3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, client := testResourceHandler([]*k8sv1.APIResourceList{testWidgetResources(1)}, widgets...)
+			var listed []string
+			// the fake client ignores field selectors, the widgets are filtered like an apiserver supporting their fields would
+			client.PrependReactor("list", "widgets-0", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				selector := action.(k8stesting.ListAction).GetListRestrictions().Fields
+				listed = append(listed, selector.String())
+				list := &unstructured.UnstructuredList{Object: map[string]interface{}{"apiVersion": "example.com/v1", "kind": "Widget0List"}}
+				for _, obj := range widgets {
+					widget := obj.(*unstructured.Unstructured)
+					phase, _, _ := unstructured.NestedString(widget.Object, "status", "phase")
+					nodeName, _, _ := unstructured.NestedString(widget.Object, "spec", "nodeName")
+					set := fields.Set{
+						"metadata.name":      widget.GetName(),
+						"metadata.namespace": widget.GetNamespace(),
+						"status.phase":       phase,
+						"spec.nodeName":      nodeName,
+					}
+					if (action.GetNamespace() == "" || action.GetNamespace() == widget.GetNamespace()) && selector.Matches(set) {
+						list.Items = append(list.Items, *widget.DeepCopy())
+					}
+				}
+				return true, list, nil
+			})
+			selector := tt.selector
+			selector.APIVersion = "example.com/v1"
+			selector.Kinds = []string{"widgets-0"}
+			if err := h.GatherResources(context.Background(), []v1.ResourceSelector{selector}); err != nil {
+				t.Fatalf("GatherResources() error: %v", err)
+			}
+			if want := strings.Join(selector.FieldSelectors, ","); len(listed) != 1 || !fieldSelectorsEqual(t, listed[0], want) {
+				t.Errorf("field selectors listed with = %q, want %q", listed, want)
+			}
+			if err := h.WriteBackupObjects(t.TempDir()); err != nil {
+				t.Fatalf("WriteBackupObjects() error: %v", err)
+			}
+			if got := writtenObjects(&h.Manifest); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("objects written = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fieldSelectorsEqual compares field selectors regardless of the order of their requirements
+func fieldSelectorsEqual(t *testing.T, got, want string) bool {
+	gotSelector, err := fields.ParseSelector(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSelector, err := fields.ParseSelector(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(gotSelector.Requirements(), wantSelector.Requirements())
+}
+
+func TestFieldSelectorRejectedByServer(t *testing.T) {
+	tests := []struct {
+		name       string
+		selector   v1.ResourceSelector
+		want       []string
+		wantErr    string
+		wantListed []string
+	}{
+		{
+			name:       "namespace",
+			selector:   v1.ResourceSelector{FieldSelectors: []string{"metadata.namespace=team-1"}},
+			want:       []string{"example.com/v1/widgets-0/team-1/widget-1", "example.com/v1/widgets-0/team-1/widget-4"},
+			wantListed: []string{"metadata.namespace=team-1", ""},
+		},
+		{
+			name:     "name and namespace",
+			selector: v1.ResourceSelector{FieldSelectors: []string{"metadata.namespace!=team-0", "metadata.name!=widget-4"}},
+			want: []string{
+				"example.com/v1/widgets-0/team-1/widget-1", "example.com/v1/widgets-0/team-2/widget-2", "example.com/v1/widgets-0/team-2/widget-5",
+			},
+			wantListed: []string{"metadata.name!=widget-4,metadata.namespace!=team-0", ""},
+		},
+		{
+			name:       "with the namespaces of the selector",
+			selector:   v1.ResourceSelector{FieldSelectors: []string{"metadata.namespace!=team-1"}, Namespaces: []string{"team-1", "team-2"}},
+			want:       []string{"example.com/v1/widgets-0/team-2/widget-2", "example.com/v1/widgets-0/team-2/widget-5"},
+			wantListed: []string{"metadata.namespace!=team-1", ""},
+		},
+		{
+			name:       "field that can't be matched after listing",
+			selector:   v1.ResourceSelector{FieldSelectors: []string{"status.phase=Running"}},
+			wantErr:    "does not support field selector status.phase=Running",
+			wantListed: []string{"status.phase=Running"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, client := testResourceHandler([]*k8sv1.APIResourceList{testWidgetResources(1)}, testWidgets(1, 6)...)
+			var listed []string
+			client.PrependReactor("list", "widgets-0", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				fieldSelector := action.(k8stesting.ListAction).GetListRestrictions().Fields.String()
+				listed = append(listed, fieldSelector)
+				if fieldSelector != "" {
+					return true, nil, apierrors.NewBadRequest("field selectors are not supported")
+				}
+				return false, nil, nil
+			})
+			selector := tt.selector
+			selector.APIVersion = "example.com/v1"
+			selector.Kinds = []string{"widgets-0"}
+			err := h.GatherResources(context.Background(), []v1.ResourceSelector{selector})
+			if !reflect.DeepEqual(listed, tt.wantListed) {
+				t.Errorf("field selectors listed with = %q, want %q", listed, tt.wantListed)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("GatherResources() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GatherResources() error: %v", err)
+			}
+			if err := h.WriteBackupObjects(t.TempDir()); err != nil {
+				t.Fatalf("WriteBackupObjects() error: %v", err)
+			}
+			if got := writtenObjects(&h.Manifest); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("objects written = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
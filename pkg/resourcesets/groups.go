@@ -0,0 +1,60 @@
+package resourcesets
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/sirupsen/logrus"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// expandGroupSelectors replaces every selector with an APIGroupRegexp by a copy for each group served by the cluster whose
+// name matches it, at the preferred version of the group or at its highest version with VersionPolicyHighest. The core
+// group has no name and is never matched
+func (h *ResourceHandler) expandGroupSelectors(ctx context.Context, selectors []v1.ResourceSelector) ([]v1.ResourceSelector, error) {
+	var groups *k8sv1.APIGroupList
+	var expanded []v1.ResourceSelector
+	for _, selector := range selectors {
+		if selector.APIGroupRegexp == "" {
+			expanded = append(expanded, selector)
+			continue
+		}
+		groupRegexp, err := regexp.Compile(selector.APIGroupRegexp)
+		if err != nil {
+			return nil, fmt.Errorf("apiGroupRegexp %v is an invalid regexp: %v", selector.APIGroupRegexp, err)
+		}
+		if groups == nil {
+			err := retryAPICall(ctx, "discover groups", func() (err error) {
+				groups, err = h.DiscoveryClient.ServerGroups()
+				return err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error getting groups for apiGroupRegexp %v: %v", selector.APIGroupRegexp, err)
+			}
+		}
+		var matched []string
+		for _, group := range groups.Groups {
+			if group.Name == "" || !groupRegexp.MatchString(group.Name) {
+				continue
+			}
+			groupVersion := group.PreferredVersion.GroupVersion
+			if versionPolicy(selector) == VersionPolicyHighest {
+				groupVersion = highestVersion(group)
+			}
+			if groupVersion == "" {
+				continue
+			}
+			groupSelector := selector
+			groupSelector.APIGroupRegexp = ""
+			groupSelector.APIVersion = groupVersion
+			groupSelector.VersionPolicy = VersionPolicyPinned
+			groupSelector.PreferredVersionOnly = false
+			expanded = append(expanded, groupSelector)
+			matched = append(matched, groupVersion)
+		}
+		logrus.Infof("apiGroupRegexp %v matched groupVersions %v", selector.APIGroupRegexp, matched)
+	}
+	return expanded, nil
+}
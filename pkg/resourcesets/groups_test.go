@@ -0,0 +1,116 @@
+package resourcesets
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// testGroupResources serve several groups under cattle.io, catalog.cattle.io at two versions with v1 preferred
+var testGroupResources = []*k8sv1.APIResourceList{
+	{GroupVersion: "v1", APIResources: []k8sv1.APIResource{{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: k8sv1.Verbs{"list"}}}},
+	{GroupVersion: "management.cattle.io/v3", APIResources: []k8sv1.APIResource{{Name: "users", Kind: "User", Verbs: k8sv1.Verbs{"list"}}}},
+	{GroupVersion: "fleet.cattle.io/v1alpha1", APIResources: []k8sv1.APIResource{{Name: "clusters", Kind: "Cluster", Namespaced: true, Verbs: k8sv1.Verbs{"list"}}}},
+	{GroupVersion: "catalog.cattle.io/v1", APIResources: []k8sv1.APIResource{{Name: "apps", Kind: "App", Namespaced: true, Verbs: k8sv1.Verbs{"list"}}}},
+	{GroupVersion: "catalog.cattle.io/v2", APIResources: []k8sv1.APIResource{{Name: "apps", Kind: "App", Namespaced: true, Verbs: k8sv1.Verbs{"list"}}}},
+	{GroupVersion: "example.com/v1", APIResources: []k8sv1.APIResource{{Name: "widgets", Kind: "Widget", Namespaced: true, Verbs: k8sv1.Verbs{"list"}}}},
+}
+
+func TestExpandGroupSelectors(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector v1.ResourceSelector
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "groups matching the regexp",
+			selector: v1.ResourceSelector{APIGroupRegexp: `\.cattle\.io$`},
+			want:     []string{"catalog.cattle.io/v1", "fleet.cattle.io/v1alpha1", "management.cattle.io/v3"},
+		},
+		{
+			name:     "highest versions",
+			selector: v1.ResourceSelector{APIGroupRegexp: `\.cattle\.io$`, VersionPolicy: VersionPolicyHighest},
+			want:     []string{"catalog.cattle.io/v2", "fleet.cattle.io/v1alpha1", "management.cattle.io/v3"},
+		},
+		{
+			name:     "every group but the core group",
+			selector: v1.ResourceSelector{APIGroupRegexp: "."},
+			want:     []string{"catalog.cattle.io/v1", "example.com/v1", "fleet.cattle.io/v1alpha1", "management.cattle.io/v3"},
+		},
+		{
+			name:     "no group",
+			selector: v1.ResourceSelector{APIGroupRegexp: `\.k8s\.io$`},
+		},
+		{
+			name:     "selector without a regexp",
+			selector: v1.ResourceSelector{APIVersion: "v1", Kinds: []string{"configmaps"}},
+			want:     []string{"v1"},
+		},
+		{
+			name:     "invalid regexp",
+			selector: v1.ResourceSelector{APIGroupRegexp: `cattle(`},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := testResourceHandler(testGroupResources)
+			selector := tt.selector
+			selector.KindsRegexp = "."
+			expanded, err := h.expandGroupSelectors(context.Background(), []v1.ResourceSelector{selector})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expandGroupSelectors() of apiGroupRegexp %v succeeded", tt.selector.APIGroupRegexp)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandGroupSelectors() error: %v", err)
+			}
+			var got []string
+			for _, s := range expanded {
+				if s.APIGroupRegexp != "" || s.KindsRegexp != "." {
+					t.Errorf("expanded selector %+v, want the regexp replaced and the rest of the selector kept", s)
+				}
+				got = append(got, s.APIVersion)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandGroupSelectors() apiVersions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatherResourcesWithAPIGroupRegexp(t *testing.T) {
+	objs := []runtime.Object{
+		testObject("v1", "ConfigMap", "default", "settings"),
+		testObject("management.cattle.io/v3", "User", "", "admin"),
+		testObject("fleet.cattle.io/v1alpha1", "Cluster", "fleet-local", "local"),
+		testObject("catalog.cattle.io/v1", "App", "cattle-system", "rancher"),
+		testObject("example.com/v1", "Widget", "default", "widget"),
+	}
+	h, _ := testResourceHandler(testGroupResources, objs...)
+	if err := h.GatherResources(context.Background(), []v1.ResourceSelector{{APIGroupRegexp: `\.cattle\.io$`, KindsRegexp: "."}}); err != nil {
+		t.Fatalf("GatherResources() error: %v", err)
+	}
+	if err := h.WriteBackupObjects(t.TempDir()); err != nil {
+		t.Fatalf("WriteBackupObjects() error: %v", err)
+	}
+	got := writtenObjects(&h.Manifest)
+	sort.Strings(got)
+	want := []string{
+		"catalog.cattle.io/v1/apps/cattle-system/rancher",
+		"fleet.cattle.io/v1alpha1/clusters/fleet-local/local",
+		"management.cattle.io/v3/users/admin",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("objects written = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,19 @@
+package resourcesets
+
+// inBase returns true if the object of the entry is unchanged since the Base backup, an incremental backup then only
+// records it in the manifest. Objects without a resourceVersion, like the ones of resources that can't be listed, are
+// always written
+func (h *ResourceHandler) inBase(entry ManifestEntry) bool {
+	if h.Base == nil || entry.ResourceVersion == "" {
+		return false
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.baseResourceVersions == nil {
+		h.baseResourceVersions = make(map[string]string)
+		for _, baseEntry := range h.Base.Entries {
+			h.baseResourceVersions[baseEntry.Path] = baseEntry.ResourceVersion
+		}
+	}
+	return h.baseResourceVersions[entry.Path] == entry.ResourceVersion
+}
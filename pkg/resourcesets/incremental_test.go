@@ -0,0 +1,61 @@
+package resourcesets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestIncrementalBackupWritesChangedObjects(t *testing.T) {
+	full := &ResourceHandler{GVResourceToObjects: map[GVResource][]unstructured.Unstructured{secretsGVResource: testSecrets(3)}}
+	if err := full.WriteBackupObjects(t.TempDir()); err != nil {
+		t.Fatalf("WriteBackupObjects() of the full backup error: %v", err)
+	}
+
+	// secret-0 changed, secret-1 is unchanged, secret-2 was deleted and secret-3 created since the full backup
+	secrets := testSecrets(4)
+	secrets[0].SetResourceVersion("43")
+	secrets = append(secrets[:2], secrets[3])
+	unversioned := testSecret()
+	unversioned.SetName("unversioned")
+	unversioned.SetResourceVersion("")
+	secrets = append(secrets, unversioned)
+	full.Manifest.Entries = append(full.Manifest.Entries, ManifestEntry{Path: "secrets.#v1/cattle-system/unversioned.json"})
+
+	backupPath := t.TempDir()
+	h := &ResourceHandler{
+		GVResourceToObjects: map[GVResource][]unstructured.Unstructured{secretsGVResource: secrets},
+		Base:                &full.Manifest,
+	}
+	if err := h.WriteBackupObjects(backupPath); err != nil {
+		t.Fatalf("WriteBackupObjects() of the incremental backup error: %v", err)
+	}
+	want := map[string]bool{
+		"secret-0":    false,
+		"secret-1":    true,
+		"secret-3":    false,
+		"unversioned": false,
+	}
+	if len(h.Manifest.Entries) != len(want) {
+		t.Fatalf("incremental manifest has %v entries, want %v", len(h.Manifest.Entries), len(want))
+	}
+	for _, entry := range h.Manifest.Entries {
+		wantInBase, ok := want[entry.Name]
+		if !ok {
+			t.Errorf("incremental manifest has an entry for %v", entry.Name)
+			continue
+		}
+		if entry.InBase != wantInBase {
+			t.Errorf("entry of %v has InBase %v, want %v", entry.Name, entry.InBase, wantInBase)
+		}
+		_, err := os.Stat(filepath.Join(backupPath, entry.File()))
+		if written := err == nil; written == wantInBase {
+			t.Errorf("object %v written to the incremental backup = %v, want %v", entry.Name, written, !wantInBase)
+		}
+		if entry.InBase && entry.SHA256 != "" {
+			t.Errorf("entry of %v stored in the base has checksum %v", entry.Name, entry.SHA256)
+		}
+	}
+}
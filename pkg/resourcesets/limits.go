@@ -0,0 +1,59 @@
+package resourcesets
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// exceedsObjectLimit checks the objects gathered for a resource against MaxObjectsPerResource. Past the limit the backup
+// fails, with FailurePolicyContinue the resource is left out and recorded in TruncatedResources instead
+func (h *ResourceHandler) exceedsObjectLimit(key string, objects []unstructured.Unstructured) (bool, error) {
+	if h.MaxObjectsPerResource <= 0 || int64(len(objects)) <= h.MaxObjectsPerResource {
+		return false, nil
+	}
+	reason := fmt.Sprintf("%v objects exceed maxObjectsPerResource %v", len(objects), h.MaxObjectsPerResource)
+	if h.FailurePolicy != FailurePolicyContinue {
+		return true, fmt.Errorf("error gathering %v: %v", key, reason)
+	}
+	h.recordTruncated(key, reason)
+	return true, nil
+}
+
+// reserveBytes adds the size of an object to the total written by the backup. An object that would take the total past
+// MaxTotalSizeBytes fails the backup, with FailurePolicyContinue it is left out, every later object that fits is still written
+func (h *ResourceHandler) reserveBytes(gvResource GVResource, size int) (bool, error) {
+	if h.MaxTotalSizeBytes <= 0 {
+		return true, nil
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.writtenBytes+int64(size) <= h.MaxTotalSizeBytes {
+		h.writtenBytes += int64(size)
+		return true, nil
+	}
+	key := gvResource.Name + "." + gvResource.GroupVersion.Group
+	if h.FailurePolicy != FailurePolicyContinue {
+		return false, fmt.Errorf("error writing %v: backup exceeds maxTotalSizeBytes %v", key, h.MaxTotalSizeBytes)
+	}
+	h.truncatedObjects[key]++
+	return false, nil
+}
+
+func (h *ResourceHandler) recordTruncated(key, reason string) {
+	logrus.Warnf("Continuing backup without %v: %v", key, reason)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.TruncatedResources == nil {
+		h.TruncatedResources = make(map[string]string)
+	}
+	h.TruncatedResources[key] = reason
+}
+
+// recordTruncatedObjects adds the resources with objects left out by reserveBytes to TruncatedResources
+func (h *ResourceHandler) recordTruncatedObjects() {
+	for key, count := range h.truncatedObjects {
+		h.recordTruncated(key, fmt.Sprintf("%v objects left out, the backup reached maxTotalSizeBytes %v", count, h.MaxTotalSizeBytes))
+	}
+}
@@ -0,0 +1,148 @@
+package resourcesets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var limitsTestSelectors = []v1.ResourceSelector{
+	{APIVersion: "v1", Kinds: []string{"configmaps"}},
+	{APIVersion: "apps/v1", Kinds: []string{"deployments"}},
+}
+
+func limitsTestObjects() []runtime.Object {
+	return []runtime.Object{
+		testObject("v1", "ConfigMap", "default", "settings-a"),
+		testObject("v1", "ConfigMap", "default", "settings-b"),
+		testObject("v1", "ConfigMap", "default", "settings-c"),
+		testObject("apps/v1", "Deployment", "default", "web"),
+	}
+}
+
+func TestMaxObjectsPerResource(t *testing.T) {
+	tests := []struct {
+		policy        string
+		limit         int64
+		wantErr       bool
+		wantWritten   []string
+		wantTruncated []string
+	}{
+		{
+			policy: FailurePolicyContinue,
+			wantWritten: []string{
+				"v1/configmaps/default/settings-a", "v1/configmaps/default/settings-b", "v1/configmaps/default/settings-c",
+				"apps/v1/deployments/default/web",
+			},
+		},
+		{policy: FailurePolicyContinue, limit: 3, wantWritten: []string{
+			"v1/configmaps/default/settings-a", "v1/configmaps/default/settings-b", "v1/configmaps/default/settings-c",
+			"apps/v1/deployments/default/web",
+		}},
+		{policy: FailurePolicyContinue, limit: 2, wantWritten: []string{"apps/v1/deployments/default/web"}, wantTruncated: []string{"configmaps."}},
+		{policy: FailurePolicyAbort, limit: 2, wantErr: true},
+		{limit: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		h, _ := testResourceHandler(testClusterResources, limitsTestObjects()...)
+		h.FailurePolicy = tt.policy
+		h.MaxObjectsPerResource = tt.limit
+		err := h.GatherResources(context.Background(), limitsTestSelectors)
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "maxObjectsPerResource 2") {
+				t.Errorf("GatherResources() with policy %q and limit %v error = %v, want the limit exceeded", tt.policy, tt.limit, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("GatherResources() with policy %q and limit %v error: %v", tt.policy, tt.limit, err)
+		}
+		if err := h.WriteBackupObjects(t.TempDir()); err != nil {
+			t.Fatalf("WriteBackupObjects() error: %v", err)
+		}
+		if got := writtenObjects(&h.Manifest); !reflect.DeepEqual(got, tt.wantWritten) {
+			t.Errorf("objects written with limit %v = %v, want %v", tt.limit, got, tt.wantWritten)
+		}
+		if got := truncatedResources(h); !reflect.DeepEqual(got, tt.wantTruncated) {
+			t.Errorf("TruncatedResources with limit %v = %v, want %v", tt.limit, h.TruncatedResources, tt.wantTruncated)
+		}
+	}
+}
+
+func TestMaxTotalSizeBytes(t *testing.T) {
+	// the limit fits the first two objects written
+	h, _ := testResourceHandler(testClusterResources, limitsTestObjects()...)
+	if err := h.GatherResources(context.Background(), limitsTestSelectors); err != nil {
+		t.Fatal(err)
+	}
+	backupPath := t.TempDir()
+	if err := h.WriteBackupObjects(backupPath); err != nil {
+		t.Fatal(err)
+	}
+	all := writtenObjects(&h.Manifest)
+	var limit int64
+	for _, entry := range h.Manifest.Entries[:2] {
+		info, err := os.Stat(filepath.Join(backupPath, entry.File()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		limit += info.Size()
+	}
+
+	tests := []struct {
+		policy        string
+		wantErr       bool
+		wantTruncated []string
+	}{
+		{policy: FailurePolicyContinue, wantTruncated: []string{"configmaps.", "deployments.apps"}},
+		{policy: FailurePolicyAbort, wantErr: true},
+		{wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run("policy="+tt.policy, func(t *testing.T) {
+			h, _ := testResourceHandler(testClusterResources, limitsTestObjects()...)
+			h.FailurePolicy = tt.policy
+			h.MaxTotalSizeBytes = limit
+			if err := h.GatherResources(context.Background(), limitsTestSelectors); err != nil {
+				t.Fatalf("GatherResources() error: %v", err)
+			}
+			err := h.WriteBackupObjects(t.TempDir())
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "maxTotalSizeBytes") {
+					t.Errorf("WriteBackupObjects() error = %v, want the limit exceeded", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WriteBackupObjects() error: %v", err)
+			}
+			if got, want := writtenObjects(&h.Manifest), all[:2]; !reflect.DeepEqual(got, want) {
+				t.Errorf("objects written = %v, want %v", got, want)
+			}
+			if got := truncatedResources(h); !reflect.DeepEqual(got, tt.wantTruncated) {
+				t.Errorf("TruncatedResources = %v, want %v", h.TruncatedResources, tt.wantTruncated)
+			}
+			for resource, reason := range h.TruncatedResources {
+				if !strings.Contains(reason, "1 objects left out") {
+					t.Errorf("%v truncated because %q, want one object left out", resource, reason)
+				}
+			}
+		})
+	}
+}
+
+func truncatedResources(h *ResourceHandler) []string {
+	var resources []string
+	for resource := range h.TruncatedResources {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	return resources
+}
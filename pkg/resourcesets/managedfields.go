@@ -0,0 +1,39 @@
+package resourcesets
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DefaultControllerManagers are the field managers of the kubernetes controllers, used when a backup skips controller owned
+// objects without naming its own managers
+var DefaultControllerManagers = []string{"kube-controller-manager", "kube-scheduler", "kubelet"}
+
+// isControllerOwned returns true if every field manager of the object is one of the configured controllers. This is a heuristic,
+// objects without managedFields are never controller owned, and fields set by a controller without a field manager of its own
+// are attributed to whatever manager the client library defaults to
+func (h *ResourceHandler) isControllerOwned(resObj unstructured.Unstructured) bool {
+	if len(h.ControllerManagers) == 0 {
+		return false
+	}
+	managedFields := resObj.GetManagedFields()
+	if len(managedFields) == 0 {
+		return false
+	}
+	for _, entry := range managedFields {
+		if !h.isControllerManager(entry.Manager) {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *ResourceHandler) isControllerManager(manager string) bool {
+	for _, controllerManager := range h.ControllerManagers {
+		if strings.HasPrefix(manager, controllerManager) {
+			return true
+		}
+	}
+	return false
+}
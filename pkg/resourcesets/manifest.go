@@ -0,0 +1,181 @@
+package resourcesets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ManifestFileName is the file at the root of a backup that describes every object file written to it
+const ManifestFileName = "manifest.json"
+
+// Changes of an object compared to the previous backup of the same Backup CR, see Manifest.ClassifyChanges
+const (
+	ChangeNew       = "new"
+	ChangeModified  = "changed"
+	ChangeUnchanged = "unchanged"
+)
+
+type Manifest struct {
+	Entries []ManifestEntry `json:"entries"`
+	// TrustBundles are the trust roots of the cluster at the time of the backup, if the backup recorded them
+	TrustBundles []TrustBundle `json:"trustBundles,omitempty"`
+	// BaseBackup is the filename of the full backup holding the objects of InBase entries, set for incremental backups
+	BaseBackup string `json:"baseBackup,omitempty"`
+	// IncludeNamespaces and ExcludeNamespaces are the namespaces of the Backup spec, a restore prunes with the same limits
+	IncludeNamespaces []string `json:"includeNamespaces,omitempty"`
+	ExcludeNamespaces []string `json:"excludeNamespaces,omitempty"`
+	// Versions maps every gathered resource.group to the version it was gathered at, see VersionPolicy
+	Versions map[string]string `json:"versions,omitempty"`
+	// SinceTime is the sinceTime of the Backup spec, a restore doesn't prune objects created before it
+	SinceTime *time.Time `json:"sinceTime,omitempty"`
+	// Unencrypted backups were taken without an encryption config, like backups with DisableEncryption. A restore doesn't
+	// decrypt their objects even if it has an encryption config
+	Unencrypted bool `json:"unencrypted,omitempty"`
+}
+
+// ManifestEntry describes a single file in the backup, Path is relative to the root of the backup
+// example: secrets.#v1/cattle-system/serving-cert.json
+type ManifestEntry struct {
+	Path      string `json:"path"`
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version"`
+	Resource  string `json:"resource"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// NonRestorable entries are part of the backup for reference only and must never be applied by a restore
+	NonRestorable bool   `json:"nonRestorable,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+	// Shard is the file holding the object if its resource was sharded, Path is then only used to identify the object
+	Shard string `json:"shard,omitempty"`
+	// ResourceVersion is the resourceVersion of the object when it was backed up, the object file itself doesn't contain it
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	// Change is set if the backup recorded changes, it's one of ChangeNew, ChangeModified or ChangeUnchanged
+	Change string `json:"change,omitempty"`
+	// SHA256 is the checksum of the file holding the object, the shard file if the resource was sharded
+	SHA256 string `json:"sha256,omitempty"`
+	// InBase entries are unchanged since the BaseBackup of the manifest, their object is only stored in the base backup
+	InBase bool `json:"inBase,omitempty"`
+	// RestoreTier is the tier the object is restored in, see RestoreTier
+	RestoreTier string `json:"restoreTier,omitempty"`
+	// Compressed objects are stored gzipped in Path with CompressedObjectSuffix, see PerObjectCompression
+	Compressed bool `json:"compressed,omitempty"`
+	// Deleting objects had a deletionTimestamp when they were backed up, it's removed so a restore creates them as live
+	// objects with their finalizers
+	Deleting bool `json:"deleting,omitempty"`
+}
+
+// File is the file in the backup that holds the object of the entry
+func (e ManifestEntry) File() string {
+	if e.Shard != "" {
+		return e.Shard
+	}
+	if e.Compressed {
+		return e.Path + CompressedObjectSuffix
+	}
+	return e.Path
+}
+
+func (m *Manifest) NonRestorablePaths() map[string]bool {
+	paths := make(map[string]bool)
+	for _, entry := range m.Entries {
+		if entry.NonRestorable {
+			paths[entry.Path] = true
+		}
+	}
+	return paths
+}
+
+// ShardPaths returns all shard files of the backup, a restore must read every one of them
+func (m *Manifest) ShardPaths() map[string]bool {
+	paths := make(map[string]bool)
+	for _, entry := range m.Entries {
+		if entry.Shard != "" {
+			paths[entry.Shard] = true
+		}
+	}
+	return paths
+}
+
+// ClassifyChanges sets the Change of every entry by comparing its resourceVersion with the entry for the same path
+// in the manifest of the previous backup
+func (m *Manifest) ClassifyChanges(previous *Manifest) {
+	previousResourceVersions := make(map[string]string)
+	for _, entry := range previous.Entries {
+		previousResourceVersions[entry.Path] = entry.ResourceVersion
+	}
+	for i, entry := range m.Entries {
+		previousResourceVersion, ok := previousResourceVersions[entry.Path]
+		switch {
+		case !ok:
+			m.Entries[i].Change = ChangeNew
+		case previousResourceVersion != entry.ResourceVersion:
+			m.Entries[i].Change = ChangeModified
+		default:
+			m.Entries[i].Change = ChangeUnchanged
+		}
+	}
+}
+
+// Verify compares the checksum of every entry with the file holding its object, files maps the path of every file in the
+// backup to its contents. Entries of backups taken before checksums were recorded aren't verified
+func (m *Manifest) Verify(files map[string][]byte) error {
+	for _, entry := range m.Entries {
+		if entry.SHA256 == "" {
+			continue
+		}
+		data, ok := files[entry.File()]
+		if !ok {
+			return fmt.Errorf("file %v listed in the backup manifest is missing from the backup", entry.File())
+		}
+		if checksum := fileChecksum(data); checksum != entry.SHA256 {
+			return fmt.Errorf("checksum %v of file %v doesn't match checksum %v in the backup manifest", checksum, entry.File(), entry.SHA256)
+		}
+	}
+	return nil
+}
+
+// VerifyBackup reads the manifest of the backup written to the dir backupPath and verifies every file listed in it
+func VerifyBackup(backupPath string) error {
+	manifestBytes, err := ioutil.ReadFile(filepath.Join(backupPath, ManifestFileName))
+	if err != nil {
+		return fmt.Errorf("error reading backup manifest: %v", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return fmt.Errorf("error unmarshaling backup manifest: %v", err)
+	}
+	files := make(map[string][]byte)
+	for _, entry := range manifest.Entries {
+		if entry.SHA256 == "" || files[entry.File()] != nil {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(backupPath, entry.File()))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("error reading %v: %v", entry.File(), err)
+		}
+		files[entry.File()] = data
+	}
+	return manifest.Verify(files)
+}
+
+func fileChecksum(data []byte) string {
+	checksum := sha256.Sum256(data)
+	return hex.EncodeToString(checksum[:])
+}
+
+func WriteManifest(w FileWriter, manifest *Manifest) error {
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("error converting manifest to JSON: %v", err)
+	}
+	return w.WriteFile(ManifestFileName, manifestBytes)
+}
@@ -0,0 +1,110 @@
+package resourcesets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var deploymentsGVResource = GVResource{GroupVersion: schema.GroupVersion{Group: "apps", Version: "v1"}, Name: "deployments", Namespaced: true}
+
+// writeTestBackup writes a secret and a deployment with their manifest to a new dir and returns the dir and manifest
+func writeTestBackup(t *testing.T) (string, *Manifest) {
+	backupPath := t.TempDir()
+	h := &ResourceHandler{GVResourceToObjects: map[GVResource][]unstructured.Unstructured{
+		secretsGVResource:     {testSecret()},
+		deploymentsGVResource: {*testObject("apps/v1", "Deployment", "default", "web")},
+	}}
+	if err := h.WriteBackupObjects(backupPath); err != nil {
+		t.Fatalf("WriteBackupObjects() error: %v", err)
+	}
+	if err := WriteManifest(DirWriter(backupPath), &h.Manifest); err != nil {
+		t.Fatalf("WriteManifest() error: %v", err)
+	}
+	return backupPath, &h.Manifest
+}
+
+func TestManifestGeneration(t *testing.T) {
+	backupPath, manifest := writeTestBackup(t)
+	want := map[string]ManifestEntry{
+		"secrets.#v1/cattle-system/creds.json": {Version: "v1", Resource: "secrets", Namespace: "cattle-system", Name: "creds"},
+		"deployments.apps#v1/default/web.json": {Group: "apps", Version: "v1", Resource: "deployments", Namespace: "default", Name: "web"},
+	}
+	if len(manifest.Entries) != len(want) {
+		t.Fatalf("manifest has %v entries, want %v", len(manifest.Entries), len(want))
+	}
+	for _, entry := range manifest.Entries {
+		wantEntry, ok := want[entry.Path]
+		if !ok {
+			t.Errorf("manifest has an entry for unexpected file %v", entry.Path)
+			continue
+		}
+		if entry.Group != wantEntry.Group || entry.Version != wantEntry.Version || entry.Resource != wantEntry.Resource ||
+			entry.Namespace != wantEntry.Namespace || entry.Name != wantEntry.Name {
+			t.Errorf("manifest entry of %v = %+v, want %+v", entry.Path, entry, wantEntry)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(backupPath, entry.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checksum := sha256.Sum256(data)
+		if want := hex.EncodeToString(checksum[:]); entry.SHA256 != want {
+			t.Errorf("checksum of %v in the manifest = %v, want %v", entry.Path, entry.SHA256, want)
+		}
+	}
+	if err := VerifyBackup(backupPath); err != nil {
+		t.Errorf("VerifyBackup() of an intact backup error: %v", err)
+	}
+}
+
+func TestVerifyBackupDetectsCorruption(t *testing.T) {
+	const secretPath = "secrets.#v1/cattle-system/creds.json"
+	tests := []struct {
+		name    string
+		corrupt func(path string) error
+		wantErr string
+	}{
+		{
+			name: "changed file",
+			corrupt: func(path string) error {
+				data, err := ioutil.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				return ioutil.WriteFile(path, []byte(strings.Replace(string(data), "creds", "CREDS", 1)), 0600)
+			},
+			wantErr: "doesn't match checksum",
+		},
+		{
+			name: "truncated file",
+			corrupt: func(path string) error {
+				return os.Truncate(path, 10)
+			},
+			wantErr: "doesn't match checksum",
+		},
+		{
+			name:    "missing file",
+			corrupt: os.Remove,
+			wantErr: "is missing from the backup",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backupPath, _ := writeTestBackup(t)
+			if err := tt.corrupt(filepath.Join(backupPath, secretPath)); err != nil {
+				t.Fatal(err)
+			}
+			err := VerifyBackup(backupPath)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), secretPath) {
+				t.Errorf("VerifyBackup() error = %v, want it to contain %q and %v", err, tt.wantErr, secretPath)
+			}
+		})
+	}
+}
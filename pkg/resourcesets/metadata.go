@@ -0,0 +1,67 @@
+package resourcesets
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
+)
+
+// paginateCount counts the objects of a resource, using metadata only lists if the handler has a MetadataClient
+func (h *ResourceHandler) paginateCount(ctx context.Context, gvr schema.GroupVersionResource, namespace string, listOptions k8sv1.ListOptions) (int64, error) {
+	listOptions.Limit = h.PageSize
+	if h.MetadataClient != nil {
+		list, err := paginateMetadataListResults(ctx, h.metadataResource(gvr, namespace), listOptions)
+		if err == nil {
+			return int64(len(list.Items)), nil
+		}
+		// aggregated apiservers and older servers can't convert their lists to PartialObjectMetadataList
+		if !apierrors.IsNotAcceptable(err) && !apierrors.IsUnsupportedMediaType(err) {
+			return 0, err
+		}
+		logrus.Debugf("Resource %v does not support metadata only lists, listing full objects: %v", gvr.String(), err)
+	}
+	var dr dynamic.ResourceInterface
+	dr = h.DynamicClient.Resource(gvr)
+	if namespace != "" {
+		dr = h.DynamicClient.Resource(gvr).Namespace(namespace)
+	}
+	list, err := paginateListResults(ctx, dr, listOptions)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(list.Items)), nil
+}
+
+func (h *ResourceHandler) metadataResource(gvr schema.GroupVersionResource, namespace string) metadata.ResourceInterface {
+	if namespace != "" {
+		return h.MetadataClient.Resource(gvr).Namespace(namespace)
+	}
+	return h.MetadataClient.Resource(gvr)
+}
+
+// paginateMetadataListResults is paginateListResults for metadata only lists
+func paginateMetadataListResults(ctx context.Context, mr metadata.ResourceInterface, listOptions k8sv1.ListOptions) (*k8sv1.PartialObjectMetadataList, error) {
+	if listOptions.Limit == 0 {
+		listOptions.Limit = ListObjectsLimit
+	}
+	list, err := mr.List(ctx, listOptions)
+	if err != nil {
+		return list, err
+	}
+	continueList := list.GetContinue()
+	for continueList != "" {
+		listOptions.Continue = continueList
+		listCurr, err := mr.List(ctx, listOptions)
+		if err != nil {
+			return list, err
+		}
+		continueList = listCurr.GetContinue()
+		list.Items = append(list.Items, listCurr.Items...)
+	}
+	return list, nil
+}
@@ -0,0 +1,140 @@
+package resourcesets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+)
+
+// listServer is an apiserver serving count config maps with size bytes of data each. Metadata only lists are rejected
+// like aggregated apiservers do unless metadataLists is set
+type listServer struct {
+	*httptest.Server
+	lock          sync.Mutex
+	fullLists     int
+	metadataLists int
+	bytesServed   int64
+}
+
+func newListServer(tb testing.TB, count, size int, metadataLists bool) *listServer {
+	fullList := map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMapList", "metadata": map[string]interface{}{}}
+	metadataList := map[string]interface{}{"apiVersion": "meta.k8s.io/v1", "kind": "PartialObjectMetadataList", "metadata": map[string]interface{}{}}
+	var items, metadataItems []interface{}
+	for i := 0; i < count; i++ {
+		objMetadata := map[string]interface{}{"name": fmt.Sprintf("config-%d", i), "namespace": "default", "resourceVersion": "42"}
+		items = append(items, map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   objMetadata,
+			"data":       map[string]interface{}{"bundle.pem": strings.Repeat("x", size)},
+		})
+		metadataItems = append(metadataItems, map[string]interface{}{"apiVersion": "meta.k8s.io/v1", "kind": "PartialObjectMetadata", "metadata": objMetadata})
+	}
+	fullList["items"], metadataList["items"] = items, metadataItems
+	fullBody, err := json.Marshal(fullList)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	metadataBody, err := json.Marshal(metadataList)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	notAcceptable := `{"apiVersion":"v1","kind":"Status","status":"Failure","reason":"NotAcceptable","code":406}`
+
+	s := &listServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/configmaps" {
+			http.NotFound(w, r)
+			return
+		}
+		body, status := fullBody, http.StatusOK
+		s.lock.Lock()
+		if strings.Contains(r.Header.Get("Accept"), "as=PartialObjectMetadataList") {
+			s.metadataLists++
+			body = metadataBody
+			if !metadataLists {
+				body, status = []byte(notAcceptable), http.StatusNotAcceptable
+			}
+		} else {
+			s.fullLists++
+		}
+		s.bytesServed += int64(len(body))
+		s.lock.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// testCountHandler returns a handler counting objects from the server, with a metadata client if withMetadataClient is set
+func testCountHandler(tb testing.TB, s *listServer, withMetadataClient bool) *ResourceHandler {
+	// a negative QPS turns off client side rate limiting, which would dominate the benchmark
+	config := &rest.Config{Host: s.URL, QPS: -1}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	h := &ResourceHandler{DynamicClient: dynamicClient}
+	if withMetadataClient {
+		if h.MetadataClient, err = metadata.NewForConfig(config); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return h
+}
+
+func TestPaginateCount(t *testing.T) {
+	tests := []struct {
+		name               string
+		metadataLists      bool
+		withMetadataClient bool
+		wantMetadataLists  int
+		wantFullLists      int
+	}{
+		{name: "metadata only lists", metadataLists: true, withMetadataClient: true, wantMetadataLists: 1},
+		{name: "metadata only lists rejected", withMetadataClient: true, wantMetadataLists: 1, wantFullLists: 1},
+		{name: "no metadata client", metadataLists: true, wantFullLists: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newListServer(t, 25, 1024, tt.metadataLists)
+			count, err := testCountHandler(t, s, tt.withMetadataClient).paginateCount(context.Background(), configMapsGVR, "", k8sv1.ListOptions{})
+			if err != nil || count != 25 {
+				t.Errorf("paginateCount() = %v, %v, want 25", count, err)
+			}
+			if s.metadataLists != tt.wantMetadataLists || s.fullLists != tt.wantFullLists {
+				t.Errorf("server listed %v metadata only and %v full lists, want %v and %v",
+					s.metadataLists, s.fullLists, tt.wantMetadataLists, tt.wantFullLists)
+			}
+		})
+	}
+}
+
+func BenchmarkPaginateCountLargeObjects(b *testing.B) {
+	const objects, objectSize = 200, 32 * 1024
+	for _, metadataOnly := range []bool{false, true} {
+		b.Run(fmt.Sprintf("metadataOnly=%v", metadataOnly), func(b *testing.B) {
+			s := newListServer(b, objects, objectSize, true)
+			h := testCountHandler(b, s, metadataOnly)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := h.paginateCount(context.Background(), configMapsGVR, "", k8sv1.ListOptions{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(s.bytesServed)/float64(b.N), "served-bytes/op")
+		})
+	}
+}
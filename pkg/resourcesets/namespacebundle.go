@@ -0,0 +1,124 @@
+package resourcesets
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// NamespaceBundlesDirName holds a manifest per namespace, example: namespaces/cattle-system/manifest.json
+const NamespaceBundlesDirName = "namespaces"
+
+// NamespaceManifest is the manifest of a namespace bundle, it lists the files of the namespace's objects and of the
+// Namespace itself, the files stay where they are in the backup
+type NamespaceManifest struct {
+	Namespace string          `json:"namespace"`
+	Entries   []ManifestEntry `json:"entries"`
+	// ClusterDependencies are cluster scoped objects the namespace's objects refer to, they aren't part of the bundle
+	ClusterDependencies []ClusterDependency `json:"clusterDependencies,omitempty"`
+}
+
+type ClusterDependency struct {
+	Resource string `json:"resource"`
+	Name     string `json:"name"`
+	// Reason is the object referring to the dependency
+	Reason string `json:"reason"`
+	// InBackup is true if the dependency is part of the backup outside of the bundle
+	InBackup bool `json:"inBackup"`
+}
+
+func NamespaceManifestPath(namespace string) string {
+	return filepath.Join(NamespaceBundlesDirName, namespace, ManifestFileName)
+}
+
+// WriteNamespaceBundles writes a manifest for every namespace with objects in the backup, from the entries of the
+// backup's manifest. It must run after WriteBackupObjects
+func (h *ResourceHandler) WriteNamespaceBundles(backupPath string) error {
+	bundles := make(map[string]*NamespaceManifest)
+	bundle := func(namespace string) *NamespaceManifest {
+		if bundles[namespace] == nil {
+			bundles[namespace] = &NamespaceManifest{Namespace: namespace}
+		}
+		return bundles[namespace]
+	}
+	clusterScoped := make(map[string]bool)
+	for _, entry := range h.Manifest.Entries {
+		if entry.NonRestorable {
+			continue
+		}
+		if entry.Namespace != "" {
+			b := bundle(entry.Namespace)
+			b.Entries = append(b.Entries, entry)
+			continue
+		}
+		clusterScoped[clusterDependencyKey(entry.Resource+"."+entry.Group, entry.Name)] = true
+	}
+	// the Namespace object goes into its own bundle, only for namespaces that have objects in the backup
+	for _, entry := range h.Manifest.Entries {
+		if entry.Group == "" && entry.Resource == "namespaces" && bundles[entry.Name] != nil {
+			bundles[entry.Name].Entries = append(bundles[entry.Name].Entries, entry)
+		}
+	}
+
+	for gvResource, resObjects := range h.GVResourceToObjects {
+		if !gvResource.Namespaced {
+			continue
+		}
+		for _, resObj := range resObjects {
+			b := bundles[resObj.GetNamespace()]
+			if b == nil {
+				continue
+			}
+			for _, dependency := range clusterDependencies(gvResource, resObj) {
+				dependency.InBackup = clusterScoped[clusterDependencyKey(dependency.Resource, dependency.Name)]
+				b.ClusterDependencies = append(b.ClusterDependencies, dependency)
+			}
+		}
+	}
+
+	w := h.fileWriter(backupPath)
+	for namespace, b := range bundles {
+		sort.Slice(b.ClusterDependencies, func(i, j int) bool {
+			return clusterDependencyKey(b.ClusterDependencies[i].Resource, b.ClusterDependencies[i].Name) <
+				clusterDependencyKey(b.ClusterDependencies[j].Resource, b.ClusterDependencies[j].Name)
+		})
+		bundleBytes, err := json.Marshal(b)
+		if err != nil {
+			return fmt.Errorf("error converting manifest of namespace %v to JSON: %v", namespace, err)
+		}
+		if err := w.WriteFile(NamespaceManifestPath(namespace), bundleBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clusterDependencies returns the cluster scoped objects an object refers to: ClusterRoles of RoleBindings, and
+// PersistentVolumes and StorageClasses of PersistentVolumeClaims
+func clusterDependencies(gvResource GVResource, resObj unstructured.Unstructured) []ClusterDependency {
+	reason := fmt.Sprintf("%v %v/%v", resObj.GetKind(), resObj.GetNamespace(), resObj.GetName())
+	var dependencies []ClusterDependency
+	switch {
+	case gvResource.GroupVersion.Group == rbacGroup && gvResource.Name == "rolebindings":
+		kind, _, _ := unstructured.NestedString(resObj.Object, "roleRef", "kind")
+		name, _, _ := unstructured.NestedString(resObj.Object, "roleRef", "name")
+		if kind == "ClusterRole" {
+			dependencies = append(dependencies, ClusterDependency{Resource: "clusterroles." + rbacGroup, Name: name, Reason: reason})
+		}
+	case gvResource.GroupVersion.Group == "" && gvResource.Name == "persistentvolumeclaims":
+		if volumeName, _, _ := unstructured.NestedString(resObj.Object, "spec", "volumeName"); volumeName != "" {
+			dependencies = append(dependencies, ClusterDependency{Resource: "persistentvolumes.", Name: volumeName, Reason: reason})
+		}
+		if storageClass, _, _ := unstructured.NestedString(resObj.Object, "spec", "storageClassName"); storageClass != "" {
+			dependencies = append(dependencies, ClusterDependency{Resource: "storageclasses.storage.k8s.io", Name: storageClass, Reason: reason})
+		}
+	}
+	return dependencies
+}
+
+func clusterDependencyKey(resource, name string) string {
+	return resource + "/" + name
+}
@@ -0,0 +1,126 @@
+package resourcesets
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestWriteNamespaceBundles(t *testing.T) {
+	rbac := schema.GroupVersion{Group: rbacGroup, Version: "v1"}
+	roleBinding := testObject("rbac.authorization.k8s.io/v1", "RoleBinding", "team-a", "viewers")
+	roleBinding.Object["roleRef"] = map[string]interface{}{"apiGroup": rbacGroup, "kind": "ClusterRole", "name": "view"}
+	localRoleBinding := testObject("rbac.authorization.k8s.io/v1", "RoleBinding", "team-a", "editors")
+	localRoleBinding.Object["roleRef"] = map[string]interface{}{"apiGroup": rbacGroup, "kind": "Role", "name": "editor"}
+	adminBinding := testObject("rbac.authorization.k8s.io/v1", "RoleBinding", "team-b", "admins")
+	adminBinding.Object["roleRef"] = map[string]interface{}{"apiGroup": rbacGroup, "kind": "ClusterRole", "name": "admin"}
+	claim := testObject("v1", "PersistentVolumeClaim", "team-b", "data")
+	claim.Object["spec"] = map[string]interface{}{"volumeName": "pv-1", "storageClassName": "local-path"}
+
+	h := &ResourceHandler{GVResourceToObjects: map[GVResource][]unstructured.Unstructured{
+		configMapsGVResource: {*testObject("v1", "ConfigMap", "team-a", "settings"), *testObject("v1", "ConfigMap", "team-b", "settings")},
+		{GroupVersion: schema.GroupVersion{Version: "v1"}, Name: "namespaces"}: {
+			*testObject("v1", "Namespace", "", "team-a"), *testObject("v1", "Namespace", "", "team-b"), *testObject("v1", "Namespace", "", "empty"),
+		},
+		{GroupVersion: schema.GroupVersion{Version: "v1"}, Name: "persistentvolumeclaims", Namespaced: true}: {*claim},
+		{GroupVersion: schema.GroupVersion{Version: "v1"}, Name: "persistentvolumes"}:                        {*testObject("v1", "PersistentVolume", "", "pv-1")},
+		{GroupVersion: rbac, Name: "rolebindings", Namespaced: true}:                                         {*roleBinding, *localRoleBinding, *adminBinding},
+		{GroupVersion: rbac, Name: "clusterroles"}:                                                           {*testObject("rbac.authorization.k8s.io/v1", "ClusterRole", "", "view")},
+	}}
+	backupPath := t.TempDir()
+	if err := h.WriteBackupObjects(backupPath); err != nil {
+		t.Fatalf("WriteBackupObjects() error: %v", err)
+	}
+	// objects that are never restored, like events, aren't part of a bundle
+	h.Manifest.Entries = append(h.Manifest.Entries, ManifestEntry{
+		Path: "events.#v1/team-a/settings.1.json", Version: "v1", Resource: "events", Namespace: "team-a", Name: "settings.1", NonRestorable: true,
+	})
+	if err := h.WriteNamespaceBundles(backupPath); err != nil {
+		t.Fatalf("WriteNamespaceBundles() error: %v", err)
+	}
+
+	namespaces, err := ioutil.ReadDir(filepath.Join(backupPath, NamespaceBundlesDirName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bundles []string
+	for _, namespace := range namespaces {
+		bundles = append(bundles, namespace.Name())
+	}
+	if want := []string{"team-a", "team-b"}; !reflect.DeepEqual(bundles, want) {
+		t.Errorf("namespace bundles = %v, want %v", bundles, want)
+	}
+
+	tests := []struct {
+		namespace        string
+		wantPaths        []string
+		wantDependencies []ClusterDependency
+	}{
+		{
+			namespace: "team-a",
+			wantPaths: []string{
+				"configmaps.#v1/team-a/settings.json",
+				"namespaces.#v1/team-a.json",
+				"rolebindings.rbac.authorization.k8s.io#v1/team-a/editors.json",
+				"rolebindings.rbac.authorization.k8s.io#v1/team-a/viewers.json",
+			},
+			wantDependencies: []ClusterDependency{
+				{Resource: "clusterroles.rbac.authorization.k8s.io", Name: "view", Reason: "RoleBinding team-a/viewers", InBackup: true},
+			},
+		},
+		{
+			namespace: "team-b",
+			wantPaths: []string{
+				"configmaps.#v1/team-b/settings.json",
+				"namespaces.#v1/team-b.json",
+				"persistentvolumeclaims.#v1/team-b/data.json",
+				"rolebindings.rbac.authorization.k8s.io#v1/team-b/admins.json",
+			},
+			wantDependencies: []ClusterDependency{
+				{Resource: "clusterroles.rbac.authorization.k8s.io", Name: "admin", Reason: "RoleBinding team-b/admins"},
+				{Resource: "persistentvolumes.", Name: "pv-1", Reason: "PersistentVolumeClaim team-b/data", InBackup: true},
+				{Resource: "storageclasses.storage.k8s.io", Name: "local-path", Reason: "PersistentVolumeClaim team-b/data"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join(backupPath, NamespaceManifestPath(tt.namespace)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var bundle NamespaceManifest
+			if err := json.Unmarshal(data, &bundle); err != nil {
+				t.Fatalf("manifest of namespace %v isn't JSON: %v", tt.namespace, err)
+			}
+			if bundle.Namespace != tt.namespace {
+				t.Errorf("manifest of namespace %v is for namespace %v", tt.namespace, bundle.Namespace)
+			}
+			var paths []string
+			for _, entry := range bundle.Entries {
+				paths = append(paths, entry.Path)
+				// the bundle refers to the files of the backup, there are no copies
+				if _, err := os.Stat(filepath.Join(backupPath, entry.Path)); err != nil {
+					t.Errorf("entry %v of namespace %v is not in the backup: %v", entry.Path, tt.namespace, err)
+				}
+				if entry.SHA256 == "" {
+					t.Errorf("entry %v of namespace %v has no checksum", entry.Path, tt.namespace)
+				}
+			}
+			sort.Strings(paths)
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("entries of namespace %v = %v, want %v", tt.namespace, paths, tt.wantPaths)
+			}
+			if !reflect.DeepEqual(bundle.ClusterDependencies, tt.wantDependencies) {
+				t.Errorf("cluster dependencies of namespace %v = %+v, want %+v", tt.namespace, bundle.ClusterDependencies, tt.wantDependencies)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package resourcesets
+
+import (
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var namespacesGroupResource = schema.GroupResource{Resource: "namespaces"}
+
+// inBackupNamespaces returns true for a namespace the backup includes. ExcludeNamespaces wins over IncludeNamespaces,
+// an empty IncludeNamespaces includes every namespace
+func (h *ResourceHandler) inBackupNamespaces(namespace string) bool {
+	for _, excluded := range h.ExcludeNamespaces {
+		if namespace == excluded {
+			return false
+		}
+	}
+	if len(h.IncludeNamespaces) == 0 {
+		return true
+	}
+	for _, included := range h.IncludeNamespaces {
+		if namespace == included {
+			return true
+		}
+	}
+	return false
+}
+
+// filterByBackupNamespaces drops the objects of the namespaces the backup doesn't include, and these Namespaces themselves,
+// whatever the selector matched
+func (h *ResourceHandler) filterByBackupNamespaces(gvr schema.GroupVersionResource, namespaced bool, objects []unstructured.Unstructured) []unstructured.Unstructured {
+	if len(h.IncludeNamespaces) == 0 && len(h.ExcludeNamespaces) == 0 {
+		return objects
+	}
+	if !namespaced && gvr.GroupResource() != namespacesGroupResource {
+		return objects
+	}
+	var kept []unstructured.Unstructured
+	for _, obj := range objects {
+		namespace := obj.GetNamespace()
+		if !namespaced {
+			namespace = obj.GetName()
+		}
+		if !h.inBackupNamespaces(namespace) {
+			logrus.WithFields(logrus.Fields{"resource": gvr.String(), "object": objectKey(obj)}).Debug("Skipping object outside of the namespaces of the backup")
+			continue
+		}
+		kept = append(kept, obj)
+	}
+	return kept
+}
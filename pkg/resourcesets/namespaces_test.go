@@ -0,0 +1,70 @@
+package resourcesets
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestBackupNamespacesWithNamespaceRegexp(t *testing.T) {
+	var objs []runtime.Object
+	for _, namespace := range []string{"cattle-system", "cattle-fleet-system", "kube-system", "default"} {
+		objs = append(objs, testObject("v1", "Namespace", "", namespace), testObject("v1", "ConfigMap", namespace, "settings"))
+	}
+	selectors := []v1.ResourceSelector{
+		{APIVersion: "v1", Kinds: []string{"configmaps"}, NamespaceRegexp: "cattle-.*|kube-system"},
+		{APIVersion: "v1", Kinds: []string{"namespaces"}},
+	}
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{
+			name: "selector only",
+			want: []string{
+				"v1/configmaps/cattle-fleet-system/settings", "v1/configmaps/cattle-system/settings", "v1/configmaps/kube-system/settings",
+				"v1/namespaces/cattle-fleet-system", "v1/namespaces/cattle-system", "v1/namespaces/default", "v1/namespaces/kube-system",
+			},
+		},
+		{
+			name:    "exclude a namespace the regexp matches",
+			exclude: []string{"kube-system", "cattle-fleet-system"},
+			want:    []string{"v1/configmaps/cattle-system/settings", "v1/namespaces/cattle-system", "v1/namespaces/default"},
+		},
+		{
+			name:    "include a namespace the regexp doesn't match",
+			include: []string{"cattle-system", "default"},
+			want:    []string{"v1/configmaps/cattle-system/settings", "v1/namespaces/cattle-system", "v1/namespaces/default"},
+		},
+		{
+			name:    "exclude wins over include",
+			include: []string{"cattle-system", "kube-system"},
+			exclude: []string{"kube-system"},
+			want:    []string{"v1/configmaps/cattle-system/settings", "v1/namespaces/cattle-system"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := testResourceHandler(testClusterResources, objs...)
+			h.IncludeNamespaces = tt.include
+			h.ExcludeNamespaces = tt.exclude
+			if err := h.GatherResources(context.Background(), selectors); err != nil {
+				t.Fatalf("GatherResources() error: %v", err)
+			}
+			if err := h.WriteBackupObjects(t.TempDir()); err != nil {
+				t.Fatalf("WriteBackupObjects() error: %v", err)
+			}
+			got := writtenObjects(&h.Manifest)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("objects written = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package resourcesets
+
+import (
+	"encoding/json"
+	"fmt"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage/value"
+)
+
+// OperatorConfigFileName is the file at the root of a backup holding the operator's own configuration
+const OperatorConfigFileName = "operator-config.json"
+
+// SecretsGroupResource selects the transformer used to wrap encryption config secrets
+var SecretsGroupResource = schema.GroupResource{Resource: "secrets"}
+
+// OperatorConfigBundle holds the Backup, ResourceSet and encryption config objects needed to set up the operator again
+// on a rebuilt cluster, so the restores of all other backups can proceed
+type OperatorConfigBundle struct {
+	Backups      []v1.Backup      `json:"backups,omitempty"`
+	ResourceSets []v1.ResourceSet `json:"resourceSets,omitempty"`
+	// EncryptionConfigs are never stored in plain text, they are only part of the bundle if they can be wrapped
+	EncryptionConfigs []WrappedSecret `json:"encryptionConfigs,omitempty"`
+}
+
+// WrappedSecret is a secret encrypted by the secrets transformer of the backup's encryption config
+type WrappedSecret struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Data      []byte `json:"data"`
+}
+
+func WrapSecret(secret *corev1.Secret, transformer value.Transformer) (WrappedSecret, error) {
+	wrapped := WrappedSecret{Name: secret.Name, Namespace: secret.Namespace}
+	secretBytes, err := json.Marshal(secret)
+	if err != nil {
+		return wrapped, fmt.Errorf("error converting secret %v to JSON: %v", secret.Name, err)
+	}
+	wrapped.Data, err = util.TransformToStorage(transformer, secretBytes, value.DefaultContext([]byte(wrapped.additionalAuthenticatedData())))
+	if err != nil {
+		return wrapped, fmt.Errorf("error wrapping secret %v: %v", secret.Name, err)
+	}
+	return wrapped, nil
+}
+
+func (w WrappedSecret) Unwrap(transformer value.Transformer) (*corev1.Secret, error) {
+	secretBytes, err := util.TransformFromStorage(transformer, w.Data, value.DefaultContext([]byte(w.additionalAuthenticatedData())))
+	if err != nil {
+		return nil, fmt.Errorf("error unwrapping secret %v: %v, provide same encryption config as used for backup", w.Name, err)
+	}
+	secret := &corev1.Secret{}
+	if err := json.Unmarshal(secretBytes, secret); err != nil {
+		return nil, fmt.Errorf("error unmarshaling secret %v: %v", w.Name, err)
+	}
+	return secret, nil
+}
+
+func (w WrappedSecret) additionalAuthenticatedData() string {
+	return fmt.Sprintf("%s#%s", w.Namespace, w.Name)
+}
+
+// CleanObjectMeta keeps only the fields of an object's metadata that can be set when creating it
+func CleanObjectMeta(meta k8sv1.ObjectMeta) k8sv1.ObjectMeta {
+	return k8sv1.ObjectMeta{
+		Name:        meta.Name,
+		Namespace:   meta.Namespace,
+		Labels:      meta.Labels,
+		Annotations: meta.Annotations,
+	}
+}
+
+func WriteOperatorConfig(w FileWriter, bundle *OperatorConfigBundle) error {
+	bundleBytes, err := json.Marshal(bundle)
+	if err != nil {
+		return fmt.Errorf("error converting operator config to JSON: %v", err)
+	}
+	return w.WriteFile(OperatorConfigFileName, bundleBytes)
+}
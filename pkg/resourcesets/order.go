@@ -0,0 +1,37 @@
+package resourcesets
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// sortedGVResources returns the gathered resources by group, version and name, so backups of an unchanged cluster
+// write the same files in the same order
+func (h *ResourceHandler) sortedGVResources() []GVResource {
+	gvResources := make([]GVResource, 0, len(h.GVResourceToObjects))
+	for gvResource := range h.GVResourceToObjects {
+		gvResources = append(gvResources, gvResource)
+	}
+	sort.Slice(gvResources, func(i, j int) bool {
+		a, b := gvResources[i], gvResources[j]
+		if a.GroupVersion.Group != b.GroupVersion.Group {
+			return a.GroupVersion.Group < b.GroupVersion.Group
+		}
+		if a.GroupVersion.Version != b.GroupVersion.Version {
+			return a.GroupVersion.Version < b.GroupVersion.Version
+		}
+		return a.Name < b.Name
+	})
+	return gvResources
+}
+
+// sortObjects orders objects by namespace and name, the order of a list isn't guaranteed by the apiserver
+func sortObjects(resObjects []unstructured.Unstructured) {
+	sort.SliceStable(resObjects, func(i, j int) bool {
+		if resObjects[i].GetNamespace() != resObjects[j].GetNamespace() {
+			return resObjects[i].GetNamespace() < resObjects[j].GetNamespace()
+		}
+		return resObjects[i].GetName() < resObjects[j].GetName()
+	})
+}
@@ -0,0 +1,166 @@
+package resourcesets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestBackupsOfUnchangedClusterAreIdentical(t *testing.T) {
+	var objs []runtime.Object
+	for i := 0; i < 5; i++ {
+		namespace := fmt.Sprintf("team-%d", i)
+		objs = append(objs, testObject("v1", "Namespace", "", namespace))
+		for j := 0; j < 5; j++ {
+			objs = append(objs,
+				testObject("v1", "ConfigMap", namespace, fmt.Sprintf("settings-%d", j)),
+				testObject("v1", "Secret", namespace, fmt.Sprintf("creds-%d", j)),
+				testObject("apps/v1", "Deployment", namespace, fmt.Sprintf("web-%d", j)))
+		}
+	}
+	selectors := []v1.ResourceSelector{
+		{APIVersion: "apps/v1", KindsRegexp: "."},
+		{APIVersion: "v1", KindsRegexp: "."},
+	}
+	h, _ := testResourceHandler(testClusterResources, objs...)
+
+	var backups []map[string][]byte
+	for i := 0; i < 2; i++ {
+		backup := &ResourceHandler{DiscoveryClient: h.DiscoveryClient, DynamicClient: h.DynamicClient}
+		if err := backup.GatherResources(context.Background(), selectors); err != nil {
+			t.Fatalf("GatherResources() error: %v", err)
+		}
+		backupPath := t.TempDir()
+		if err := backup.WriteBackupObjects(backupPath); err != nil {
+			t.Fatalf("WriteBackupObjects() error: %v", err)
+		}
+		if err := WriteManifest(DirWriter(backupPath), &backup.Manifest); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(backup.Manifest.Entries), len(objs); got != want {
+			t.Fatalf("backup %v wrote %v objects, want %v", i, got, want)
+		}
+		files, err := readBackupFiles(backupPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backups = append(backups, files)
+	}
+
+	for path, data := range backups[0] {
+		other, ok := backups[1][path]
+		if !ok {
+			t.Errorf("%v is only in the first backup", path)
+		} else if string(other) != string(data) {
+			t.Errorf("%v differs between the backups:\n%s\n%s", path, data, other)
+		}
+	}
+	for path := range backups[1] {
+		if _, ok := backups[0][path]; !ok {
+			t.Errorf("%v is only in the second backup", path)
+		}
+	}
+}
+
+func TestSortObjects(t *testing.T) {
+	objs := []unstructured.Unstructured{
+		*testObject("v1", "ConfigMap", "team-b", "a"),
+		*testObject("v1", "ConfigMap", "team-a", "b"),
+		*testObject("v1", "ConfigMap", "", "c"),
+		*testObject("v1", "ConfigMap", "team-a", "a"),
+	}
+	sortObjects(objs)
+	var got []string
+	for _, obj := range objs {
+		got = append(got, obj.GetNamespace()+"/"+obj.GetName())
+	}
+	if want := []string{"/c", "team-a/a", "team-a/b", "team-b/a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sortObjects() = %v, want %v", got, want)
+	}
+}
+
+func TestSortedGVResources(t *testing.T) {
+	h := &ResourceHandler{GVResourceToObjects: map[GVResource][]unstructured.Unstructured{
+		{GroupVersion: schema.GroupVersion{Group: "apps", Version: "v1"}, Name: "deployments"}:                      nil,
+		{GroupVersion: schema.GroupVersion{Version: "v1"}, Name: "secrets"}:                                         nil,
+		{GroupVersion: schema.GroupVersion{Group: "apps", Version: "v1"}, Name: "daemonsets"}:                       nil,
+		{GroupVersion: schema.GroupVersion{Version: "v1"}, Name: "configmaps"}:                                      nil,
+		{GroupVersion: schema.GroupVersion{Group: "management.cattle.io", Version: "v3"}, Name: "clusters"}:         nil,
+		{GroupVersion: schema.GroupVersion{Group: "apiextensions.k8s.io", Version: "v1beta1"}, Name: "crds"}:        nil,
+		{GroupVersion: schema.GroupVersion{Group: "apiextensions.k8s.io", Version: "v1"}, Name: "crds"}:             nil,
+		{GroupVersion: schema.GroupVersion{Group: "management.cattle.io", Version: "v3"}, Name: "globalroles"}:      nil,
+		{GroupVersion: schema.GroupVersion{Group: "management.cattle.io", Version: "v3"}, Name: "clustertemplates"}: nil,
+	}}
+	var got []string
+	for _, gvResource := range h.sortedGVResources() {
+		got = append(got, gvResource.GroupVersion.WithResource(gvResource.Name).String())
+	}
+	want := []string{
+		"/v1, Resource=configmaps",
+		"/v1, Resource=secrets",
+		"apiextensions.k8s.io/v1, Resource=crds",
+		"apiextensions.k8s.io/v1beta1, Resource=crds",
+		"apps/v1, Resource=daemonsets",
+		"apps/v1, Resource=deployments",
+		"management.cattle.io/v3, Resource=clusters",
+		"management.cattle.io/v3, Resource=clustertemplates",
+		"management.cattle.io/v3, Resource=globalroles",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortedGVResources() = %v, want %v", got, want)
+	}
+}
+
+func TestReproducibleArtifact(t *testing.T) {
+	var artifacts [][]byte
+	for i := 0; i < 2; i++ {
+		// the same objects gathered in a different order
+		secrets := testSecrets(10)
+		if i == 1 {
+			for j, k := 0, len(secrets)-1; j < k; j, k = j+1, k-1 {
+				secrets[j], secrets[k] = secrets[k], secrets[j]
+			}
+		}
+		artifactPath := filepath.Join(t.TempDir(), "backup.tar.gz")
+		w, err := NewArtifactWriter(artifactPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Reproducible = true
+		h := &ResourceHandler{
+			GVResourceToObjects: map[GVResource][]unstructured.Unstructured{secretsGVResource: secrets},
+			Writer:              w,
+		}
+		if err := h.WriteBackupObjects(""); err != nil {
+			t.Fatalf("WriteBackupObjects() error: %v", err)
+		}
+		if err := WriteManifest(w, &h.Manifest); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			// the second artifact is written in another second
+			time.Sleep(time.Second)
+		}
+		data, err := ioutil.ReadFile(artifactPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		artifacts = append(artifacts, data)
+	}
+	if !bytes.Equal(artifacts[0], artifacts[1]) {
+		t.Errorf("reproducible artifacts of the same objects differ")
+	}
+}
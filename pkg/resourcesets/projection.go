@@ -0,0 +1,37 @@
+package resourcesets
+
+import (
+	"strings"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// fields needed to identify an object, these are always kept in a projected object
+var projectionIdentityFields = []string{"apiVersion", "kind", "metadata.name", "metadata.namespace"}
+
+func (h *ResourceHandler) fieldProjectionFor(group, kind string) *v1.FieldProjection {
+	for i, projection := range h.FieldProjections {
+		if projection.Group == group && strings.EqualFold(projection.Kind, kind) {
+			return &h.FieldProjections[i]
+		}
+	}
+	return nil
+}
+
+// projectFields returns a copy of the object containing only the given dot separated field paths, example "spec.replicas",
+// paths that don't exist on the object are ignored
+func projectFields(obj map[string]interface{}, fields []string) map[string]interface{} {
+	projected := make(map[string]interface{})
+	for _, field := range append(projectionIdentityFields, fields...) {
+		path := strings.Split(strings.Trim(field, "."), ".")
+		val, found, err := unstructured.NestedFieldNoCopy(obj, path...)
+		if err != nil || !found {
+			continue
+		}
+		if err := unstructured.SetNestedField(projected, val, path...); err != nil {
+			continue
+		}
+	}
+	return projected
+}
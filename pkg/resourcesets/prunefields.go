@@ -0,0 +1,128 @@
+package resourcesets
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DefaultPruneFields are removed from every object before it's written, the apiserver sets them again for restored objects
+var DefaultPruneFields = []string{"metadata.managedFields"}
+
+// DefaultStatusPruneResources are the resources whose status is also removed by default, by group and resource name.
+// Their controllers compute the status again from the cluster, a restored status would only be outdated until they do.
+// Rancher resources keep their status, some of it isn't recorded anywhere else
+var DefaultStatusPruneResources = map[string][]string{
+	"":            {"pods", "replicationcontrollers"},
+	"apps":        {"daemonsets", "deployments", "replicasets", "statefulsets"},
+	"autoscaling": {"horizontalpodautoscalers"},
+	"batch":       {"cronjobs", "jobs"},
+}
+
+// ValidatePruneField returns an error for a path that can't be parsed or would remove a field needed to restore the object
+func ValidatePruneField(path string) error {
+	parts, err := parseFieldPath(path)
+	if err != nil {
+		return err
+	}
+	for _, identityField := range projectionIdentityFields {
+		if strings.Join(parts, ".") == identityField {
+			return fmt.Errorf("%v is needed to restore the object", identityField)
+		}
+	}
+	return nil
+}
+
+// pruneFieldsFor returns the fields removed from the objects of a resource gathered by a selector: DefaultPruneFields,
+// status for DefaultStatusPruneResources and the PruneFields of the backup and the selector, without the KeepFields of
+// the selector
+func (h *ResourceHandler) pruneFieldsFor(gvResource GVResource, selector v1.ResourceSelector) []string {
+	keep := make(map[string]bool)
+	for _, field := range selector.KeepFields {
+		keep[field] = true
+	}
+	defaults := append([]string{}, DefaultPruneFields...)
+	for _, resource := range DefaultStatusPruneResources[gvResource.GroupVersion.Group] {
+		if resource == gvResource.Name {
+			defaults = append(defaults, "status")
+		}
+	}
+	var fields []string
+	for _, field := range append(append(defaults, h.PruneFields...), selector.PruneFields...) {
+		if !keep[field] {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// setPruneFields records the fields removed from the objects of a resource. When several selectors match the same
+// resource, a field is only removed if all of them remove it
+func (h *ResourceHandler) setPruneFields(gvResource GVResource, fields []string) {
+	previous, ok := h.gvResourceToPruneFields[gvResource]
+	if !ok {
+		h.gvResourceToPruneFields[gvResource] = fields
+		return
+	}
+	pruned := make(map[string]bool)
+	for _, field := range fields {
+		pruned[field] = true
+	}
+	var common []string
+	for _, field := range previous {
+		if pruned[field] {
+			common = append(common, field)
+		}
+	}
+	h.gvResourceToPruneFields[gvResource] = common
+}
+
+// pruneFields removes the pruned fields of its resource from the object, paths that don't exist on the object are ignored
+func (h *ResourceHandler) pruneFields(gvResource GVResource, resObj unstructured.Unstructured) {
+	for _, field := range h.gvResourceToPruneFields[gvResource] {
+		parts, err := parseFieldPath(field)
+		if err != nil {
+			continue
+		}
+		unstructured.RemoveNestedField(resObj.Object, parts...)
+	}
+}
+
+// parseFieldPath splits a dot separated path like "spec.replicas", keys containing dots are written in brackets, example
+// "metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]"
+func parseFieldPath(path string) ([]string, error) {
+	var parts []string
+	rest := path
+	for rest != "" {
+		var part string
+		if rest[0] == '[' {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("field path %v is missing a ]", path)
+			}
+			part, rest = rest[1:end], rest[end+1:]
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			part, rest = rest[:end], rest[end:]
+		}
+		if part == "" {
+			return nil, fmt.Errorf("field path %v has an empty key", path)
+		}
+		parts = append(parts, part)
+		if strings.HasPrefix(rest, ".") {
+			rest = rest[1:]
+			if rest == "" {
+				return nil, fmt.Errorf("field path %v ends with a .", path)
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("field path is empty")
+	}
+	return parts, nil
+}
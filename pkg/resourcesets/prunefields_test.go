@@ -0,0 +1,140 @@
+package resourcesets
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{path: "status", want: []string{"status"}},
+		{path: "spec.replicas", want: []string{"spec", "replicas"}},
+		{path: "metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]", want: []string{"metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration"}},
+		{path: "[a.b].c", want: []string{"a.b", "c"}},
+		{path: "data[a.b][c.d]", want: []string{"data", "a.b", "c.d"}},
+		{path: "", wantErr: true},
+		{path: "spec.", wantErr: true},
+		{path: "spec..replicas", wantErr: true},
+		{path: ".spec", wantErr: true},
+		{path: "metadata.annotations[a.b", wantErr: true},
+		{path: "metadata.annotations[]", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseFieldPath(tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseFieldPath(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseFieldPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func testDeployment() unstructured.Unstructured {
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":          "web",
+			"namespace":     "default",
+			"managedFields": []interface{}{map[string]interface{}{"manager": "kubectl"}},
+			"annotations":   map[string]interface{}{"kubectl.kubernetes.io/last-applied-configuration": "{}", "team": "web"},
+		},
+		"spec":   map[string]interface{}{"replicas": int64(2)},
+		"status": map[string]interface{}{"readyReplicas": int64(2)},
+	}}
+}
+
+func TestPruneFields(t *testing.T) {
+	deployments := GVResource{GroupVersion: schema.GroupVersion{Group: "apps", Version: "v1"}, Name: "deployments", Namespaced: true}
+	configMaps := GVResource{GroupVersion: schema.GroupVersion{Version: "v1"}, Name: "configmaps", Namespaced: true}
+	tests := []struct {
+		name        string
+		gvResource  GVResource
+		backupPrune []string
+		selector    v1.ResourceSelector
+		wantRemoved []string
+		wantKept    []string
+	}{
+		{
+			name:        "defaults",
+			gvResource:  deployments,
+			wantRemoved: []string{"metadata.managedFields", "status"},
+			wantKept:    []string{"metadata.annotations", "spec.replicas"},
+		},
+		{
+			name:        "status of resources outside of the defaults",
+			gvResource:  configMaps,
+			wantRemoved: []string{"metadata.managedFields"},
+			wantKept:    []string{"status"},
+		},
+		{
+			name:        "custom paths of the backup and the selector",
+			gvResource:  deployments,
+			backupPrune: []string{"metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]"},
+			selector:    v1.ResourceSelector{PruneFields: []string{"spec.replicas"}},
+			wantRemoved: []string{"metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]", "spec.replicas"},
+			wantKept:    []string{"metadata.annotations[team]"},
+		},
+		{
+			name:        "keepFields override the defaults and the backup",
+			gvResource:  deployments,
+			backupPrune: []string{"spec.replicas"},
+			selector:    v1.ResourceSelector{KeepFields: []string{"metadata.managedFields", "status", "spec.replicas"}},
+			wantKept:    []string{"metadata.managedFields", "status", "spec.replicas"},
+		},
+		{
+			name:        "paths missing from the object",
+			gvResource:  deployments,
+			backupPrune: []string{"spec.template.spec.nodeName"},
+			wantKept:    []string{"spec.replicas"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &ResourceHandler{PruneFields: tt.backupPrune, gvResourceToPruneFields: make(map[GVResource][]string)}
+			h.setPruneFields(tt.gvResource, h.pruneFieldsFor(tt.gvResource, tt.selector))
+			obj := testDeployment()
+			h.pruneFields(tt.gvResource, obj)
+			for _, field := range tt.wantRemoved {
+				if hasField(t, obj, field) {
+					t.Errorf("pruneFields() kept %v", field)
+				}
+			}
+			for _, field := range tt.wantKept {
+				if !hasField(t, obj, field) {
+					t.Errorf("pruneFields() removed %v", field)
+				}
+			}
+		})
+	}
+}
+
+func TestSetPruneFieldsKeepsCommonFields(t *testing.T) {
+	secrets := GVResource{GroupVersion: schema.GroupVersion{Version: "v1"}, Name: "secrets", Namespaced: true}
+	h := &ResourceHandler{gvResourceToPruneFields: make(map[GVResource][]string)}
+	h.setPruneFields(secrets, []string{"metadata.managedFields", "data"})
+	h.setPruneFields(secrets, []string{"metadata.managedFields"})
+	if got, want := h.gvResourceToPruneFields[secrets], []string{"metadata.managedFields"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("setPruneFields() of two selectors = %v, want %v", got, want)
+	}
+}
+
+// hasField is true if the object has the field at the path, written like the paths of pruneFields
+func hasField(t *testing.T, obj unstructured.Unstructured, path string) bool {
+	parts, err := parseFieldPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, found, _ := unstructured.NestedFieldNoCopy(obj.Object, parts...)
+	return found
+}
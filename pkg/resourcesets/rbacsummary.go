@@ -0,0 +1,165 @@
+package resourcesets
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// RBACSummaryFileName is the file at the root of a backup listing the permissions of every subject of the captured bindings
+const RBACSummaryFileName = "rbac-summary.txt"
+
+const rbacGroup = "rbac.authorization.k8s.io"
+
+type rbacRule struct {
+	Verbs           []string `json:"verbs"`
+	APIGroups       []string `json:"apiGroups,omitempty"`
+	Resources       []string `json:"resources,omitempty"`
+	ResourceNames   []string `json:"resourceNames,omitempty"`
+	NonResourceURLs []string `json:"nonResourceURLs,omitempty"`
+}
+
+func (r rbacRule) String() string {
+	verbs := strings.Join(r.Verbs, ",")
+	if len(r.NonResourceURLs) > 0 {
+		return fmt.Sprintf("%v on urls %v", verbs, strings.Join(r.NonResourceURLs, ","))
+	}
+	apiGroups := make([]string, 0, len(r.APIGroups))
+	for _, apiGroup := range r.APIGroups {
+		if apiGroup == "" {
+			apiGroup = "core"
+		}
+		apiGroups = append(apiGroups, apiGroup)
+	}
+	rule := fmt.Sprintf("%v on %v (apiGroups %v)", verbs, strings.Join(r.Resources, ","), strings.Join(apiGroups, ","))
+	if len(r.ResourceNames) > 0 {
+		rule += fmt.Sprintf(" named %v", strings.Join(r.ResourceNames, ","))
+	}
+	return rule
+}
+
+// grant is a role bound to a subject by a single binding
+type grant struct {
+	binding string
+	role    string
+	scope   string
+	rules   []rbacRule
+	found   bool
+}
+
+// WriteRBACSummary writes a summary of what every subject of the captured RoleBindings and ClusterRoleBindings can do,
+// based on the captured Roles and ClusterRoles. Bindings to roles that aren't part of the backup are listed without rules
+func (h *ResourceHandler) WriteRBACSummary(backupPath string) error {
+	roles := make(map[string][]rbacRule)
+	// objects matched by several resource selectors are gathered more than once
+	bindings := make(map[string]unstructured.Unstructured)
+	for gvResource, resObjects := range h.GVResourceToObjects {
+		if gvResource.GroupVersion.Group != rbacGroup {
+			continue
+		}
+		for _, resObj := range resObjects {
+			switch resObj.GetKind() {
+			case "Role", "ClusterRole":
+				rules, err := rulesOf(resObj)
+				if err != nil {
+					return fmt.Errorf("error reading rules of %v %v: %v", resObj.GetKind(), resObj.GetName(), err)
+				}
+				roles[roleKey(resObj.GetKind(), resObj.GetNamespace(), resObj.GetName())] = rules
+			case "RoleBinding", "ClusterRoleBinding":
+				bindings[roleKey(resObj.GetKind(), resObj.GetNamespace(), resObj.GetName())] = resObj
+			}
+		}
+	}
+
+	grants := make(map[string][]grant)
+	for _, binding := range bindings {
+		roleKind, _, _ := unstructured.NestedString(binding.Object, "roleRef", "kind")
+		roleName, _, _ := unstructured.NestedString(binding.Object, "roleRef", "name")
+		g := grant{
+			binding: fmt.Sprintf("%v %v", binding.GetKind(), binding.GetName()),
+			role:    fmt.Sprintf("%v %v", roleKind, roleName),
+			scope:   "cluster-wide",
+		}
+		roleNamespace := ""
+		if binding.GetKind() == "RoleBinding" {
+			g.binding = fmt.Sprintf("%v %v/%v", binding.GetKind(), binding.GetNamespace(), binding.GetName())
+			g.scope = "in namespace " + binding.GetNamespace()
+			if roleKind == "Role" {
+				roleNamespace = binding.GetNamespace()
+			}
+		}
+		g.rules, g.found = roles[roleKey(roleKind, roleNamespace, roleName)]
+
+		subjects, _, _ := unstructured.NestedSlice(binding.Object, "subjects")
+		for _, s := range subjects {
+			subject, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			kind, _ := subject["kind"].(string)
+			name, _ := subject["name"].(string)
+			if namespace, _ := subject["namespace"].(string); namespace != "" {
+				name = namespace + "/" + name
+			}
+			subjectKey := kind + " " + name
+			grants[subjectKey] = append(grants[subjectKey], g)
+		}
+	}
+
+	return h.fileWriter(backupPath).WriteFile(RBACSummaryFileName, []byte(formatRBACSummary(grants)))
+}
+
+func formatRBACSummary(grants map[string][]grant) string {
+	subjects := make([]string, 0, len(grants))
+	for subject := range grants {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+
+	var summary strings.Builder
+	for _, subject := range subjects {
+		fmt.Fprintf(&summary, "%v\n", subject)
+		subjectGrants := grants[subject]
+		sort.Slice(subjectGrants, func(i, j int) bool {
+			return subjectGrants[i].binding < subjectGrants[j].binding
+		})
+		for _, g := range subjectGrants {
+			fmt.Fprintf(&summary, "  %v %v, bound by %v\n", g.role, g.scope, g.binding)
+			if !g.found {
+				summary.WriteString("    (role is not part of the backup)\n")
+				continue
+			}
+			for _, rule := range g.rules {
+				fmt.Fprintf(&summary, "    - %v\n", rule)
+			}
+		}
+	}
+	return summary.String()
+}
+
+func rulesOf(role unstructured.Unstructured) ([]rbacRule, error) {
+	var rules []rbacRule
+	rawRules, _, err := unstructured.NestedSlice(role.Object, "rules")
+	if err != nil {
+		return nil, err
+	}
+	for _, rawRule := range rawRules {
+		ruleMap, ok := rawRule.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("rule is not an object")
+		}
+		var rule rbacRule
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(ruleMap, &rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func roleKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
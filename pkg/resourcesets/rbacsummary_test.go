@@ -0,0 +1,180 @@
+package resourcesets
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// testRBACFixture has cluster wide and namespaced grants, a role with the same name in two namespaces, a binding to a
+// ClusterRole inside a namespace and a binding to a role that isn't backed up
+const testRBACFixture = `apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: cluster-admin
+rules:
+- apiGroups: ["*"]
+  resources: ["*"]
+  verbs: ["*"]
+- nonResourceURLs: ["*"]
+  verbs: ["*"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: view-pods
+rules:
+- apiGroups: [""]
+  resources: ["pods", "pods/log"]
+  verbs: ["get", "list", "watch"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: config-editor
+  namespace: team-a
+rules:
+- apiGroups: [""]
+  resources: ["configmaps"]
+  resourceNames: ["settings"]
+  verbs: ["get", "update"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: config-editor
+  namespace: team-b
+rules:
+- apiGroups: ["", "apps"]
+  resources: ["configmaps", "deployments"]
+  verbs: ["*"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: admins
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-admin
+subjects:
+- apiGroup: rbac.authorization.k8s.io
+  kind: Group
+  name: system:masters
+- apiGroup: rbac.authorization.k8s.io
+  kind: User
+  name: alice
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: monitoring
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: prometheus
+subjects:
+- kind: ServiceAccount
+  name: prometheus
+  namespace: monitoring
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: editors
+  namespace: team-a
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: config-editor
+subjects:
+- apiGroup: rbac.authorization.k8s.io
+  kind: User
+  name: bob
+- kind: ServiceAccount
+  name: deployer
+  namespace: team-a
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: viewers
+  namespace: team-a
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: view-pods
+subjects:
+- apiGroup: rbac.authorization.k8s.io
+  kind: User
+  name: bob
+`
+
+const testRBACSummary = `Group system:masters
+  ClusterRole cluster-admin cluster-wide, bound by ClusterRoleBinding admins
+    - * on * (apiGroups *)
+    - * on urls *
+ServiceAccount monitoring/prometheus
+  ClusterRole prometheus cluster-wide, bound by ClusterRoleBinding monitoring
+    (role is not part of the backup)
+ServiceAccount team-a/deployer
+  Role config-editor in namespace team-a, bound by RoleBinding team-a/editors
+    - get,update on configmaps (apiGroups core) named settings
+User alice
+  ClusterRole cluster-admin cluster-wide, bound by ClusterRoleBinding admins
+    - * on * (apiGroups *)
+    - * on urls *
+User bob
+  Role config-editor in namespace team-a, bound by RoleBinding team-a/editors
+    - get,update on configmaps (apiGroups core) named settings
+  ClusterRole view-pods in namespace team-a, bound by RoleBinding team-a/viewers
+    - get,list,watch on pods,pods/log (apiGroups core)
+`
+
+// testRBACObjects returns the objects of testRBACFixture by resource, like they are gathered
+func testRBACObjects(t *testing.T) map[GVResource][]unstructured.Unstructured {
+	resources := map[string]string{"ClusterRole": "clusterroles", "Role": "roles", "ClusterRoleBinding": "clusterrolebindings", "RoleBinding": "rolebindings"}
+	objects := make(map[GVResource][]unstructured.Unstructured)
+	decoder := yaml.NewYAMLOrJSONDecoder(strings.NewReader(testRBACFixture), 4096)
+	for {
+		var obj unstructured.Unstructured
+		if err := decoder.Decode(&obj.Object); err == io.EOF {
+			return objects
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		gvResource := GVResource{
+			GroupVersion: schema.GroupVersion{Group: rbacGroup, Version: "v1"},
+			Name:         resources[obj.GetKind()],
+			Namespaced:   obj.GetNamespace() != "",
+		}
+		objects[gvResource] = append(objects[gvResource], obj)
+	}
+}
+
+func TestWriteRBACSummary(t *testing.T) {
+	objects := testRBACObjects(t)
+	// the admins binding is gathered twice by overlapping resource selectors, and other groups aren't part of the summary
+	clusterRoleBindings := GVResource{GroupVersion: schema.GroupVersion{Group: rbacGroup, Version: "v1"}, Name: "clusterrolebindings"}
+	objects[clusterRoleBindings] = append(objects[clusterRoleBindings], objects[clusterRoleBindings][0])
+	objects[configMapsGVResource] = []unstructured.Unstructured{*testObject("v1", "ConfigMap", "team-a", "settings")}
+
+	backupPath := t.TempDir()
+	h := &ResourceHandler{GVResourceToObjects: objects}
+	if err := h.WriteRBACSummary(backupPath); err != nil {
+		t.Fatalf("WriteRBACSummary() error: %v", err)
+	}
+	summary, err := ioutil.ReadFile(filepath.Join(backupPath, RBACSummaryFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(summary) != testRBACSummary {
+		t.Errorf("WriteRBACSummary() wrote\n%s\nwant\n%s", summary, testRBACSummary)
+	}
+}
@@ -0,0 +1,45 @@
+package resourcesets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+// isRetryableAPIError returns true for errors the apiserver may not return on the next attempt: timeouts, throttling and
+// server errors. A missing group or resource, a denied request or an expired continue token fail right away
+func isRetryableAPIError(err error) bool {
+	if apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err) {
+		return true
+	}
+	var status apierrors.APIStatus
+	return errors.As(err, &status) && status.Status().Code >= http.StatusInternalServerError
+}
+
+// retryAPICall makes up to util.APIRetries attempts of a call to the apiserver that failed with a retryable error, with an
+// exponential backoff starting at util.APIRetryDelay. The call isn't retried once ctx is done
+func retryAPICall(ctx context.Context, description string, call func() error) error {
+	backoff := wait.Backoff{
+		Steps:    util.APIRetries,
+		Duration: util.APIRetryDelay,
+		Factor:   2.0,
+		Jitter:   0.1,
+	}
+	attempt := 0
+	return retry.OnError(backoff, func(err error) bool {
+		if ctx.Err() != nil || !isRetryableAPIError(err) {
+			return false
+		}
+		logrus.Warnf("Attempt %v of %v to %v failed: %v", attempt, util.APIRetries, description, err)
+		return true
+	}, func() error {
+		attempt++
+		return call()
+	})
+}
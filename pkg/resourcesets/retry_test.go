@@ -0,0 +1,92 @@
+package resourcesets
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var secretsGroupResource = schema.GroupResource{Resource: "secrets"}
+
+func TestIsRetryableAPIError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: apierrors.NewServerTimeout(secretsGroupResource, "list", 1), want: true},
+		{err: apierrors.NewTimeoutError("list", 1), want: true},
+		{err: apierrors.NewTooManyRequests("throttled", 1), want: true},
+		{err: apierrors.NewInternalError(errors.New("etcd unavailable")), want: true},
+		{err: apierrors.NewServiceUnavailable("restarting"), want: true},
+		{err: apierrors.NewNotFound(secretsGroupResource, "")},
+		{err: apierrors.NewForbidden(secretsGroupResource, "", errors.New("denied"))},
+		{err: apierrors.NewResourceExpired("continue token expired")},
+		{err: errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		if got := isRetryableAPIError(tt.err); got != tt.want {
+			t.Errorf("isRetryableAPIError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryListCalls(t *testing.T) {
+	retries, delay := util.APIRetries, util.APIRetryDelay
+	util.APIRetries, util.APIRetryDelay = 3, time.Millisecond
+	defer func() { util.APIRetries, util.APIRetryDelay = retries, delay }()
+
+	tests := []struct {
+		name         string
+		err          error
+		failures     int
+		wantErr      bool
+		wantAttempts int
+	}{
+		{name: "server timeout twice", err: apierrors.NewServerTimeout(secretsGroupResource, "list", 1), failures: 2, wantAttempts: 3},
+		{name: "throttled twice", err: apierrors.NewTooManyRequests("throttled", 1), failures: 2, wantAttempts: 3},
+		{name: "internal error twice", err: apierrors.NewInternalError(errors.New("etcd unavailable")), failures: 2, wantAttempts: 3},
+		{name: "server timeout on every attempt", err: apierrors.NewServerTimeout(secretsGroupResource, "list", 1), failures: 3, wantErr: true, wantAttempts: 3},
+		{name: "forbidden", err: apierrors.NewForbidden(secretsGroupResource, "", errors.New("denied")), failures: 1, wantErr: true, wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, client := testResourceHandler(testClusterResources, testObject("v1", "Secret", "default", "token"))
+			attempts := 0
+			client.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				attempts++
+				if attempts <= tt.failures {
+					return true, nil, tt.err
+				}
+				return false, nil, nil
+			})
+			err := h.GatherResources(context.Background(), []v1.ResourceSelector{{APIVersion: "v1", Kinds: []string{"secrets"}}})
+			if attempts != tt.wantAttempts {
+				t.Errorf("secrets listed %v times, want %v", attempts, tt.wantAttempts)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("GatherResources() succeeded after %v failures of %v attempts", tt.failures, util.APIRetries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GatherResources() error: %v", err)
+			}
+			if err := h.WriteBackupObjects(t.TempDir()); err != nil {
+				t.Fatalf("WriteBackupObjects() error: %v", err)
+			}
+			if got, want := writtenObjects(&h.Manifest), []string{"v1/secrets/default/token"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("objects written = %v, want %v", got, want)
+			}
+		})
+	}
+}
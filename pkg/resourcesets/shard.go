@@ -0,0 +1,169 @@
+package resourcesets
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage/value"
+)
+
+// ShardedObject is a single object in a shard file, a shard file holds a JSON array of these.
+// Data is the object as it would be written to its own file, so encrypted objects use the same additionalAuthenticatedData
+type ShardedObject struct {
+	Name      string          `json:"name"`
+	Namespace string          `json:"namespace,omitempty"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func (h *ResourceHandler) setShards(gvResource GVResource, shards int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	// with multiple selectors matching the same resource, use the highest shard count
+	if shards > h.GVResourceToShards[gvResource] {
+		h.GVResourceToShards[gvResource] = shards
+	}
+}
+
+func shardFileName(shard int) string {
+	return fmt.Sprintf("shard-%d.json", shard)
+}
+
+func shardIndex(namespace, name string, shards int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(namespace + "/" + name))
+	return int(hash.Sum32() % uint32(shards))
+}
+
+// writeShardedObjects distributes the objects of a resource into shard-<i>.json files in the resource dir, each shard is
+// written by its own goroutine. Every object gets a manifest entry pointing to its shard
+func (h *ResourceHandler) writeShardedObjects(backupPath string, gvResource GVResource, resObjects []unstructured.Unstructured, shards int) error {
+	gv := gvResource.GroupVersion
+	resourceDirName := gvResource.Name + "." + gv.Group + "#" + gv.Version
+	w := h.fileWriter(backupPath)
+	gr := schema.GroupResource{Group: gv.Group, Resource: gvResource.Name}
+	encryptionTransformer := h.TransformerMap[gr]
+
+	shardedObjects := make([][]unstructured.Unstructured, shards)
+	for _, resObj := range resObjects {
+		if !hasValidMetadata(gvResource, resObj) {
+			h.countSkipped(gvResource, 1)
+			continue
+		}
+		if isDeletedWithoutFinalizers(resObj) || h.isIgnored(gvResource, resObj) {
+			continue
+		}
+		i := shardIndex(resObj.GetNamespace(), resObj.GetName(), shards)
+		shardedObjects[i] = append(shardedObjects[i], resObj)
+	}
+
+	manifestEntries := make([][]ManifestEntry, shards)
+	skipped := make([]int64, shards)
+	var errgrp errgroup.Group
+	for i := range shardedObjects {
+		if len(shardedObjects[i]) == 0 {
+			continue
+		}
+		i := i
+		errgrp.Go(func() error {
+			entries, skippedObjects, err := h.writeShard(w, resourceDirName, shardFileName(i), gvResource, shardedObjects[i], encryptionTransformer)
+			manifestEntries[i] = entries
+			skipped[i] = skippedObjects
+			return err
+		})
+	}
+	if err := errgrp.Wait(); err != nil {
+		return err
+	}
+	for i, entries := range manifestEntries {
+		h.Manifest.Entries = append(h.Manifest.Entries, entries...)
+		h.countSkipped(gvResource, skipped[i])
+	}
+	return nil
+}
+
+func (h *ResourceHandler) writeShard(w FileWriter, resourceDirName, shardName string, gvResource GVResource, resObjects []unstructured.Unstructured,
+	transformer value.Transformer) ([]ManifestEntry, int64, error) {
+	gv := gvResource.GroupVersion
+	var skipped int64
+	var entries []ManifestEntry
+	var shard []ShardedObject
+	for _, resObj := range resObjects {
+		resourceVersion := resObj.GetResourceVersion()
+		deleting := resObj.GetDeletionTimestamp() != nil
+		removeServerFields(resObj)
+		h.pruneFields(gvResource, resObj)
+		objName := resObj.GetName()
+		manifestEntry := ManifestEntry{
+			Path:            filepath.Join(resourceDirName, objName+".json"),
+			Group:           gv.Group,
+			Version:         gv.Version,
+			Resource:        gvResource.Name,
+			Name:            objName,
+			Shard:           filepath.Join(resourceDirName, shardName),
+			ResourceVersion: resourceVersion,
+			RestoreTier:     RestoreTier(gv.Group, gvResource.Name, gvResource.Namespaced, resObj),
+			Deleting:        deleting,
+		}
+		additionalAuthenticatedData := objName
+		var objNs string
+		if gvResource.Namespaced {
+			objNs = resObj.GetNamespace()
+			additionalAuthenticatedData = fmt.Sprintf("%s#%s", objNs, additionalAuthenticatedData)
+			manifestEntry.Namespace = objNs
+			manifestEntry.Path = filepath.Join(resourceDirName, objNs, objName+".json")
+		}
+
+		objToWrite := resObj.Object
+		if projection := h.fieldProjectionFor(gv.Group, resObj.GetKind()); projection != nil {
+			objToWrite = projectFields(resObj.Object, projection.Fields)
+			manifestEntry.NonRestorable = true
+			manifestEntry.Reason = "projected"
+		}
+		if h.inBase(manifestEntry) {
+			manifestEntry.Shard = ""
+			manifestEntry.InBase = true
+			entries = append(entries, manifestEntry)
+			continue
+		}
+		data, err := encodeObject(objToWrite, transformer, additionalAuthenticatedData)
+		if err != nil {
+			if h.skipOnEncryptionFailure(err) {
+				logrus.Errorf("Skipping %v of type %v: %v", objName, gvResource.Name, err)
+				skipped++
+				continue
+			}
+			return entries, skipped, err
+		}
+		if reserved, err := h.reserveBytes(gvResource, len(data)); !reserved {
+			if err != nil {
+				return entries, skipped, err
+			}
+			continue
+		}
+		shard = append(shard, ShardedObject{Name: objName, Namespace: objNs, Data: data})
+		entries = append(entries, manifestEntry)
+	}
+
+	if len(shard) == 0 {
+		// every object of the shard is stored in the base backup
+		return entries, skipped, nil
+	}
+	shardBytes, err := json.Marshal(shard)
+	if err != nil {
+		return entries, skipped, fmt.Errorf("error converting shard %v to JSON: %v", shardName, err)
+	}
+	if err := w.WriteFile(filepath.Join(resourceDirName, shardName), shardBytes); err != nil {
+		return entries, skipped, fmt.Errorf("error writing shard %v: %v", shardName, err)
+	}
+	checksum := fileChecksum(shardBytes)
+	for i := range entries {
+		entries[i].SHA256 = checksum
+	}
+	return entries, skipped, nil
+}
@@ -0,0 +1,114 @@
+package resourcesets
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/backup-restore-operator/pkg/util"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage/value"
+)
+
+func testSecrets(count int) []unstructured.Unstructured {
+	var secrets []unstructured.Unstructured
+	for i := 0; i < count; i++ {
+		secret := testSecret()
+		secret.SetNamespace(fmt.Sprintf("ns-%d", i%3))
+		secret.SetName(fmt.Sprintf("secret-%d", i))
+		secrets = append(secrets, secret)
+	}
+	return secrets
+}
+
+func TestShardedBackupRoundTrip(t *testing.T) {
+	const objects, shards = 20, 4
+	for _, encrypted := range []bool{false, true} {
+		t.Run(fmt.Sprintf("encrypted=%v", encrypted), func(t *testing.T) {
+			var transformers map[schema.GroupResource]value.Transformer
+			if encrypted {
+				transformers = testTransformers(t)
+			}
+			backupPath := t.TempDir()
+			h := &ResourceHandler{
+				TransformerMap:      transformers,
+				GVResourceToObjects: map[GVResource][]unstructured.Unstructured{secretsGVResource: testSecrets(objects)},
+				GVResourceToShards:  map[GVResource]int{secretsGVResource: shards},
+			}
+			if err := h.WriteBackupObjects(backupPath); err != nil {
+				t.Fatalf("WriteBackupObjects() error: %v", err)
+			}
+			if err := WriteManifest(DirWriter(backupPath), &h.Manifest); err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyBackup(backupPath); err != nil {
+				t.Errorf("VerifyBackup() error: %v", err)
+			}
+
+			if len(h.Manifest.Entries) != objects {
+				t.Fatalf("manifest has %v entries, want %v", len(h.Manifest.Entries), objects)
+			}
+			for _, entry := range h.Manifest.Entries {
+				want := filepath.Join("secrets.#v1", shardFileName(shardIndex(entry.Namespace, entry.Name, shards)))
+				if entry.Shard != want {
+					t.Errorf("%v is in shard %v, want %v", entry.Path, entry.Shard, want)
+				}
+				if entry.SHA256 == "" {
+					t.Errorf("%v has no checksum", entry.Path)
+				}
+				if entry.Path != filepath.Join("secrets.#v1", entry.Namespace, entry.Name+".json") {
+					t.Errorf("%v/%v has path %v", entry.Namespace, entry.Name, entry.Path)
+				}
+			}
+			if got := len(h.Manifest.ShardPaths()); got > shards || got < 2 {
+				t.Errorf("objects written to %v shards, want 2 to %v", got, shards)
+			}
+
+			backupObjects, err := readBackupObjects(backupPath)
+			if err != nil {
+				t.Fatalf("readBackupObjects() error: %v", err)
+			}
+			files, err := readBackupFiles(backupPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			shardData := make(map[string]map[string][]byte)
+			for _, secret := range testSecrets(objects) {
+				ref := ObjectRef{Version: "v1", Resource: "secrets", Namespace: secret.GetNamespace(), Name: secret.GetName()}
+				obj, ok := backupObjects[ref.key()]
+				if !ok {
+					t.Errorf("%v/%v is missing from the backup", secret.GetNamespace(), secret.GetName())
+					continue
+				}
+				data, err := objectData(files, shardData, obj.entry)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if encrypted {
+					var encryptedData []byte
+					if err := json.Unmarshal(data, &encryptedData); err != nil {
+						t.Fatalf("encrypted object isn't a JSON string: %v", err)
+					}
+					additionalAuthenticatedData := secret.GetNamespace() + "#" + secret.GetName()
+					transformer := transformers[schema.GroupResource{Resource: "secrets"}]
+					if data, err = util.TransformFromStorage(transformer, encryptedData, value.DefaultContext([]byte(additionalAuthenticatedData))); err != nil {
+						t.Fatalf("decrypting %v: %v", additionalAuthenticatedData, err)
+					}
+				}
+				restored := unstructured.Unstructured{}
+				if err := restored.UnmarshalJSON(data); err != nil {
+					t.Fatalf("object of %v isn't JSON: %v", obj.entry.Path, err)
+				}
+				if restored.GetNamespace() != secret.GetNamespace() || restored.GetName() != secret.GetName() {
+					t.Errorf("entry %v holds object %v/%v", obj.entry.Path, restored.GetNamespace(), restored.GetName())
+				}
+				if restored.GetResourceVersion() != "" || obj.entry.ResourceVersion != "42" {
+					t.Errorf("resource version of %v is %q in the object and %q in the manifest, want it only in the manifest",
+						obj.entry.Path, restored.GetResourceVersion(), obj.entry.ResourceVersion)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package resourcesets
+
+import (
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var crdsGroupResource = schema.GroupResource{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}
+
+// filterBySinceTime drops the objects created before SinceTime. CRDs and Namespaces are always kept, a restore needs them
+// for the objects they hold. Objects without a creationTimestamp are kept as well
+func (h *ResourceHandler) filterBySinceTime(gvr schema.GroupVersionResource, objects []unstructured.Unstructured) []unstructured.Unstructured {
+	if h.SinceTime.IsZero() || gvr.GroupResource() == crdsGroupResource || gvr.GroupResource() == namespacesGroupResource {
+		return objects
+	}
+	var kept []unstructured.Unstructured
+	for _, obj := range objects {
+		if created := obj.GetCreationTimestamp(); !created.IsZero() && created.Time.Before(h.SinceTime) {
+			logrus.WithFields(logrus.Fields{"resource": gvr.String(), "object": objectKey(obj)}).Debug("Skipping object created before sinceTime")
+			continue
+		}
+		kept = append(kept, obj)
+	}
+	return kept
+}
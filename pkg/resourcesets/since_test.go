@@ -0,0 +1,71 @@
+package resourcesets
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestSinceTime(t *testing.T) {
+	cutoff := time.Date(2021, 5, 10, 12, 0, 0, 0, time.UTC)
+	created := func(obj runtime.Object, at time.Time) runtime.Object {
+		obj.(k8sv1.Object).SetCreationTimestamp(k8sv1.NewTime(at))
+		return obj
+	}
+	objs := []runtime.Object{
+		created(testObject("v1", "Namespace", "", "default"), cutoff.Add(-24*time.Hour)),
+		created(testObject("v1", "ConfigMap", "default", "before"), cutoff.Add(-time.Second)),
+		created(testObject("v1", "ConfigMap", "default", "at"), cutoff),
+		created(testObject("v1", "ConfigMap", "default", "after"), cutoff.Add(time.Second)),
+		testObject("v1", "ConfigMap", "default", "without-timestamp"),
+		created(testObject("apps/v1", "Deployment", "default", "old"), cutoff.Add(-time.Hour)),
+		created(testObject("apps/v1", "Deployment", "default", "new"), cutoff.Add(time.Hour)),
+	}
+	selectors := []v1.ResourceSelector{
+		{APIVersion: "v1", Kinds: []string{"namespaces", "configmaps"}},
+		{APIVersion: "apps/v1", Kinds: []string{"deployments"}},
+	}
+	tests := []struct {
+		name      string
+		sinceTime time.Time
+		want      []string
+	}{
+		{
+			name: "no sinceTime",
+			want: []string{
+				"v1/configmaps/default/after", "v1/configmaps/default/at", "v1/configmaps/default/before", "v1/configmaps/default/without-timestamp",
+				"v1/namespaces/default",
+				"apps/v1/deployments/default/new", "apps/v1/deployments/default/old",
+			},
+		},
+		{
+			name:      "objects straddling the cutoff",
+			sinceTime: cutoff,
+			want: []string{
+				"v1/configmaps/default/after", "v1/configmaps/default/at", "v1/configmaps/default/without-timestamp",
+				"v1/namespaces/default",
+				"apps/v1/deployments/default/new",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := testResourceHandler(testClusterResources, objs...)
+			h.SinceTime = tt.sinceTime
+			if err := h.GatherResources(context.Background(), selectors); err != nil {
+				t.Fatalf("GatherResources() error: %v", err)
+			}
+			if err := h.WriteBackupObjects(t.TempDir()); err != nil {
+				t.Fatalf("WriteBackupObjects() error: %v", err)
+			}
+			if got := writtenObjects(&h.Manifest); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("objects written = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
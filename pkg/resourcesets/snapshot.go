@@ -0,0 +1,193 @@
+package resourcesets
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// ConsistencyModeList lists every resource separately, each resource is consistent on its own
+	ConsistencyModeList = "list"
+	// ConsistencyModeWatch brings the lists of all resources to the same resource version by replaying their watch events
+	ConsistencyModeWatch = "watch"
+
+	watchCatchUpWorkers = 10
+)
+
+// watchCatchUpTimeoutSeconds is the longest a resource without changes waits. The events up to the target resource
+// version already happened when the watch starts, so the apiserver replays them right away and a watch that runs into
+// its timeout without reaching the target has seen all of them
+var watchCatchUpTimeoutSeconds int64 = 10
+
+type listKey struct {
+	gvr           schema.GroupVersionResource
+	labelSelector string
+	fieldSelector string
+}
+
+// snapshot is the list of a resource, kept between the two passes of GatherResources in ConsistencyModeWatch
+type snapshot struct {
+	dr       dynamic.ResourceInterface
+	list     *unstructured.UnstructuredList
+	canWatch bool
+}
+
+func (h *ResourceHandler) listObjects(ctx context.Context, dr dynamic.ResourceInterface, gvr schema.GroupVersionResource, verbs k8sv1.Verbs,
+	listOptions k8sv1.ListOptions) (*unstructured.UnstructuredList, error) {
+	key := listKey{gvr: gvr, labelSelector: listOptions.LabelSelector, fieldSelector: listOptions.FieldSelector}
+	if h.ConsistencyMode != ConsistencyModeWatch {
+		return h.checkpointedList(ctx, dr, key, listOptions)
+	}
+	h.lock.Lock()
+	s, ok := h.snapshots[key]
+	h.lock.Unlock()
+	if ok {
+		return s.list, nil
+	}
+	list, err := h.checkpointedList(ctx, dr, key, listOptions)
+	if err != nil {
+		return list, err
+	}
+	h.lock.Lock()
+	h.snapshots[key] = &snapshot{dr: dr, list: list, canWatch: canWatchResource(verbs)}
+	h.lock.Unlock()
+	return list, nil
+}
+
+// catchUpSnapshots replays the watch events of every listed resource up to the resource version of the cluster after
+// all resources were listed, so the backup is a consistent cut of the cluster at that resource version
+func (h *ResourceHandler) catchUpSnapshots(ctx context.Context) error {
+	namespaces, err := h.DynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}).List(ctx, k8sv1.ListOptions{Limit: 1})
+	if err != nil {
+		return fmt.Errorf("error getting current resource version for consistent snapshot: %v", err)
+	}
+	targetResourceVersion, err := strconv.ParseUint(namespaces.GetResourceVersion(), 10, 64)
+	if err != nil {
+		return fmt.Errorf("error parsing current resource version %v for consistent snapshot: %v", namespaces.GetResourceVersion(), err)
+	}
+	logrus.Infof("Bringing all resources to resource version %v for a consistent snapshot", targetResourceVersion)
+
+	var errgrp errgroup.Group
+	workers := make(chan struct{}, watchCatchUpWorkers)
+	for key, s := range h.snapshots {
+		key, s := key, s
+		errgrp.Go(func() error {
+			workers <- struct{}{}
+			defer func() { <-workers }()
+			return s.catchUp(ctx, key, targetResourceVersion)
+		})
+	}
+	return errgrp.Wait()
+}
+
+func (s *snapshot) catchUp(ctx context.Context, key listKey, targetResourceVersion uint64) error {
+	if !s.canWatch {
+		logrus.Infof("Resource %v does not support watch, using its paginated list for the snapshot", key.gvr.String())
+		return nil
+	}
+	listResourceVersion, err := strconv.ParseUint(s.list.GetResourceVersion(), 10, 64)
+	if err != nil {
+		// resources served by aggregated apiservers don't share the resource versions of the kube-apiserver
+		logrus.Warnf("Resource %v has a non numeric resource version %v, using its paginated list for the snapshot", key.gvr.String(), s.list.GetResourceVersion())
+		return nil
+	}
+	if listResourceVersion >= targetResourceVersion {
+		return nil
+	}
+
+	timeout := watchCatchUpTimeoutSeconds
+	watchStarted := time.Now()
+	watcher, err := s.dr.Watch(ctx, k8sv1.ListOptions{
+		LabelSelector:       key.labelSelector,
+		FieldSelector:       key.fieldSelector,
+		ResourceVersion:     s.list.GetResourceVersion(),
+		AllowWatchBookmarks: true,
+		TimeoutSeconds:      &timeout,
+	})
+	if err != nil {
+		if apierrors.IsMethodNotSupported(err) {
+			logrus.Infof("Resource %v does not support watch, using its paginated list for the snapshot", key.gvr.String())
+			return nil
+		}
+		return fmt.Errorf("error watching %v for consistent snapshot: %v", key.gvr.String(), err)
+	}
+	defer watcher.Stop()
+
+	objects := make(map[string]unstructured.Unstructured)
+	for _, obj := range s.list.Items {
+		objects[obj.GetNamespace()+"/"+obj.GetName()] = obj
+	}
+	reachedTarget := false
+	for event := range watcher.ResultChan() {
+		if event.Type == watch.Error {
+			err := apierrors.FromObject(event.Object)
+			if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+				// the events since the list were compacted, the resource is listed again at the target instead
+				logrus.Infof("Resource version %v of %v expired, listing it at resource version %v for the snapshot", s.list.GetResourceVersion(), key.gvr.String(), targetResourceVersion)
+				return s.listAt(ctx, key, targetResourceVersion)
+			}
+			return fmt.Errorf("error watching %v for consistent snapshot: %v", key.gvr.String(), err)
+		}
+		obj, ok := event.Object.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		resourceVersion, err := strconv.ParseUint(obj.GetResourceVersion(), 10, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing resource version %v of %v for consistent snapshot: %v", obj.GetResourceVersion(), key.gvr.String(), err)
+		}
+		if resourceVersion > targetResourceVersion {
+			reachedTarget = true
+			break
+		}
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			objects[obj.GetNamespace()+"/"+obj.GetName()] = *obj
+		case watch.Deleted:
+			delete(objects, obj.GetNamespace()+"/"+obj.GetName())
+		}
+		if resourceVersion == targetResourceVersion {
+			reachedTarget = true
+			break
+		}
+	}
+	if !reachedTarget && time.Since(watchStarted) < time.Duration(timeout)*time.Second {
+		// the watch was closed before its timeout, so it may not have replayed every event up to the target
+		logrus.Infof("Watch of %v closed before reaching resource version %v, listing it at that resource version for the snapshot", key.gvr.String(), targetResourceVersion)
+		return s.listAt(ctx, key, targetResourceVersion)
+	}
+
+	s.list.Items = make([]unstructured.Unstructured, 0, len(objects))
+	for _, obj := range objects {
+		s.list.Items = append(s.list.Items, obj)
+	}
+	s.list.SetResourceVersion(strconv.FormatUint(targetResourceVersion, 10))
+	return nil
+}
+
+// listAt replaces the list of the snapshot by a list of the resource at exactly the target resource version
+func (s *snapshot) listAt(ctx context.Context, key listKey, targetResourceVersion uint64) error {
+	list, err := paginateListResults(ctx, s.dr, k8sv1.ListOptions{
+		LabelSelector:        key.labelSelector,
+		FieldSelector:        key.fieldSelector,
+		ResourceVersion:      strconv.FormatUint(targetResourceVersion, 10),
+		ResourceVersionMatch: k8sv1.ResourceVersionMatchExact,
+	})
+	if err != nil {
+		return fmt.Errorf("error listing %v at resource version %v for consistent snapshot: %v", key.gvr.String(), targetResourceVersion, err)
+	}
+	s.list.Items = list.Items
+	s.list.SetResourceVersion(strconv.FormatUint(targetResourceVersion, 10))
+	return nil
+}
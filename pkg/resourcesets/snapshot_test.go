@@ -0,0 +1,166 @@
+package resourcesets
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var configMapsGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+func testConfigMap(name, resourceVersion string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}}
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	obj.SetResourceVersion(resourceVersion)
+	return obj
+}
+
+func testBookmark(resourceVersion string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}}
+	obj.SetResourceVersion(resourceVersion)
+	return obj
+}
+
+func TestSnapshotCatchUp(t *testing.T) {
+	const target = 20
+	tests := []struct {
+		name string
+		// events are sent on the watch, it's closed after closeAfter
+		events     []watch.Event
+		closeAfter time.Duration
+		// listed are the objects of the cluster at the target resource version
+		listed     []string
+		want       []string
+		wantRelist bool
+	}{
+		{
+			name:       "no events until the watch timeout",
+			closeAfter: 1100 * time.Millisecond,
+			want:       []string{"a", "b"},
+		},
+		{
+			name:       "no events and watch closed early",
+			listed:     []string{"a", "c"},
+			want:       []string{"a", "c"},
+			wantRelist: true,
+		},
+		{
+			name: "bookmark at the target",
+			events: []watch.Event{
+				{Type: watch.Modified, Object: testConfigMap("a", "15")},
+				{Type: watch.Bookmark, Object: testBookmark("20")},
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "bookmark past the target",
+			events: []watch.Event{
+				{Type: watch.Added, Object: testConfigMap("c", "12")},
+				{Type: watch.Bookmark, Object: testBookmark("25")},
+				{Type: watch.Added, Object: testConfigMap("d", "26")},
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "delete at the target",
+			events: []watch.Event{
+				{Type: watch.Deleted, Object: testConfigMap("b", "20")},
+			},
+			want: []string{"a"},
+		},
+		{
+			name: "changes after the target are ignored",
+			events: []watch.Event{
+				{Type: watch.Deleted, Object: testConfigMap("a", "18")},
+				{Type: watch.Deleted, Object: testConfigMap("b", "21")},
+			},
+			want: []string{"b"},
+		},
+		{
+			name: "expired resource version",
+			events: []watch.Event{
+				{Type: watch.Error, Object: &apierrors.NewResourceExpired("too old resource version: 10 (15)").ErrStatus},
+			},
+			listed:     []string{"c"},
+			want:       []string{"c"},
+			wantRelist: true,
+		},
+	}
+	defer func(timeout int64) { watchCatchUpTimeoutSeconds = timeout }(watchCatchUpTimeoutSeconds)
+	watchCatchUpTimeoutSeconds = 1
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			for _, name := range tt.listed {
+				objects = append(objects, testConfigMap(name, "19"))
+			}
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+				map[schema.GroupVersionResource]string{configMapsGVR: "ConfigMapList"}, objects...)
+			watcher := watch.NewFakeWithChanSize(len(tt.events), false)
+			for _, event := range tt.events {
+				watcher.Action(event.Type, event.Object)
+			}
+			time.AfterFunc(tt.closeAfter, watcher.Stop)
+			client.PrependWatchReactor("configmaps", k8stesting.DefaultWatchReactor(watcher, nil))
+
+			list := &unstructured.UnstructuredList{Items: []unstructured.Unstructured{*testConfigMap("a", "5"), *testConfigMap("b", "8")}}
+			list.SetResourceVersion("10")
+			s := &snapshot{dr: client.Resource(configMapsGVR), list: list, canWatch: true}
+			if err := s.catchUp(context.Background(), listKey{gvr: configMapsGVR}, target); err != nil {
+				t.Fatalf("catchUp() error: %v", err)
+			}
+
+			var got []string
+			for _, obj := range s.list.Items {
+				got = append(got, obj.GetName())
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("catchUp() objects = %v, want %v", got, tt.want)
+			}
+			if s.list.GetResourceVersion() != "20" {
+				t.Errorf("catchUp() resource version = %v, want 20", s.list.GetResourceVersion())
+			}
+			relisted := false
+			for _, action := range client.Actions() {
+				switch action := action.(type) {
+				case k8stesting.WatchAction:
+					if rv := action.GetWatchRestrictions().ResourceVersion; rv != "10" {
+						t.Errorf("catchUp() watched from resource version %v, want 10", rv)
+					}
+				case k8stesting.ListAction:
+					relisted = true
+				}
+			}
+			if relisted != tt.wantRelist {
+				t.Errorf("catchUp() listed again = %v, want %v", relisted, tt.wantRelist)
+			}
+		})
+	}
+}
+
+func TestSnapshotCatchUpFails(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{configMapsGVR: "ConfigMapList"})
+	watcher := watch.NewFakeWithChanSize(1, false)
+	watcher.Error(&apierrors.NewForbidden(configMapsGVR.GroupResource(), "", nil).ErrStatus)
+	client.PrependWatchReactor("configmaps", k8stesting.DefaultWatchReactor(watcher, nil))
+
+	list := &unstructured.UnstructuredList{}
+	list.SetResourceVersion("10")
+	s := &snapshot{dr: client.Resource(configMapsGVR), list: list, canWatch: true}
+	if err := s.catchUp(context.Background(), listKey{gvr: configMapsGVR}, 20); err == nil {
+		t.Error("catchUp() of a watch failing with forbidden succeeded")
+	}
+}
@@ -0,0 +1,48 @@
+package resourcesets
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Restore tiers are recorded in the manifest, a restore orders the objects it restores at the same time by tier. Dependents
+// are still restored once all their owners are
+const (
+	RestoreTierCRDs          = "crds"
+	RestoreTierNamespaces    = "namespaces"
+	RestoreTierClusterScoped = "clusterScoped"
+	RestoreTierNamespaced    = "namespaced"
+	RestoreTierDependents    = "dependents"
+)
+
+var restoreTierOrder = map[string]int{
+	RestoreTierCRDs:          0,
+	RestoreTierNamespaces:    1,
+	RestoreTierClusterScoped: 2,
+	RestoreTierNamespaced:    3,
+	RestoreTierDependents:    4,
+}
+
+// RestoreTier returns the tier of an object: CRDs, then Namespaces, then the other cluster scoped and the namespaced
+// objects without owners, then the objects with ownerReferences
+func RestoreTier(group, resource string, namespaced bool, obj unstructured.Unstructured) string {
+	switch {
+	case group == "apiextensions.k8s.io" && resource == "customresourcedefinitions":
+		return RestoreTierCRDs
+	case group == "" && resource == "namespaces":
+		return RestoreTierNamespaces
+	case len(obj.GetOwnerReferences()) > 0:
+		return RestoreTierDependents
+	case namespaced:
+		return RestoreTierNamespaced
+	default:
+		return RestoreTierClusterScoped
+	}
+}
+
+// RestoreTierOrder is the position of a tier in the restore, unknown tiers go last
+func RestoreTierOrder(tier string) int {
+	if order, ok := restoreTierOrder[tier]; ok {
+		return order
+	}
+	return len(restoreTierOrder)
+}
@@ -0,0 +1,50 @@
+package resourcesets
+
+import (
+	"sort"
+	"testing"
+
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRestoreTier(t *testing.T) {
+	owned := unstructured.Unstructured{Object: map[string]interface{}{}}
+	owned.SetOwnerReferences([]k8sv1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "web", UID: "1234"}})
+	unowned := unstructured.Unstructured{Object: map[string]interface{}{}}
+	tests := []struct {
+		group      string
+		resource   string
+		namespaced bool
+		obj        unstructured.Unstructured
+		want       string
+	}{
+		{group: "apiextensions.k8s.io", resource: "customresourcedefinitions", obj: unowned, want: RestoreTierCRDs},
+		{group: "apiextensions.k8s.io", resource: "customresourcedefinitions", obj: owned, want: RestoreTierCRDs},
+		{resource: "namespaces", obj: unowned, want: RestoreTierNamespaces},
+		{resource: "namespaces", obj: owned, want: RestoreTierNamespaces},
+		{group: "example.com", resource: "namespaces", obj: unowned, want: RestoreTierClusterScoped},
+		{group: "rbac.authorization.k8s.io", resource: "clusterroles", obj: unowned, want: RestoreTierClusterScoped},
+		{resource: "secrets", namespaced: true, obj: unowned, want: RestoreTierNamespaced},
+		{group: "apps", resource: "replicasets", namespaced: true, obj: owned, want: RestoreTierDependents},
+		{group: "management.cattle.io", resource: "globalrolebindings", obj: owned, want: RestoreTierDependents},
+	}
+	for _, tt := range tests {
+		if got := RestoreTier(tt.group, tt.resource, tt.namespaced, tt.obj); got != tt.want {
+			t.Errorf("RestoreTier(%q, %q, %v) = %v, want %v", tt.group, tt.resource, tt.namespaced, got, tt.want)
+		}
+	}
+}
+
+func TestRestoreTierOrder(t *testing.T) {
+	tiers := []string{"unknown", RestoreTierDependents, RestoreTierNamespaced, RestoreTierClusterScoped, RestoreTierNamespaces, RestoreTierCRDs, ""}
+	sort.SliceStable(tiers, func(i, j int) bool {
+		return RestoreTierOrder(tiers[i]) < RestoreTierOrder(tiers[j])
+	})
+	want := []string{RestoreTierCRDs, RestoreTierNamespaces, RestoreTierClusterScoped, RestoreTierNamespaced, RestoreTierDependents, "unknown", ""}
+	for i := range want {
+		if tiers[i] != want[i] {
+			t.Fatalf("tiers ordered by RestoreTierOrder = %q, want %q", tiers, want)
+		}
+	}
+}
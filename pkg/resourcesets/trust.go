@@ -0,0 +1,127 @@
+package resourcesets
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+// the CA ConfigMap kubernetes publishes into every namespace, the one of kube-system stands for all of them
+const (
+	rootCAConfigMapNamespace = "kube-system"
+	rootCAConfigMapName      = "kube-root-ca.crt"
+	rootCAConfigMapKey       = "ca.crt"
+)
+
+// versions of ClusterTrustBundles, newest first
+var clusterTrustBundleGroupVersions = []schema.GroupVersion{
+	{Group: "certificates.k8s.io", Version: "v1beta1"},
+	{Group: "certificates.k8s.io", Version: "v1alpha1"},
+}
+
+// TrustBundle describes a source of trust roots of the cluster. Only the SHA-256 fingerprints of the certificates
+// are recorded, never the bundle itself
+type TrustBundle struct {
+	Kind         string               `json:"kind"`
+	Namespace    string               `json:"namespace,omitempty"`
+	Name         string               `json:"name"`
+	Certificates []TrustedCertificate `json:"certificates"`
+}
+
+type TrustedCertificate struct {
+	Fingerprint string `json:"fingerprint"`
+	Subject     string `json:"subject"`
+	NotAfter    string `json:"notAfter"`
+}
+
+// GatherTrustBundles lists the ClusterTrustBundles, if the cluster serves them, and the root CA ConfigMap
+func GatherTrustBundles(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface) ([]TrustBundle, error) {
+	var bundles []TrustBundle
+	for _, gv := range clusterTrustBundleGroupVersions {
+		if _, err := discoveryClient.ServerResourcesForGroupVersion(gv.String()); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		list, err := paginateListResults(ctx, dynamicClient.Resource(gv.WithResource("clustertrustbundles")), k8sv1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error listing clusterTrustBundles: %v", err)
+		}
+		for _, item := range list.Items {
+			pemData, _, _ := unstructured.NestedString(item.Object, "spec", "trustBundle")
+			bundles = append(bundles, TrustBundle{Kind: "ClusterTrustBundle", Name: item.GetName(), Certificates: trustedCertificates(pemData)})
+		}
+		break
+	}
+
+	configMap, err := dynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).
+		Namespace(rootCAConfigMapNamespace).Get(ctx, rootCAConfigMapName, k8sv1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("error getting configMap %v/%v: %v", rootCAConfigMapNamespace, rootCAConfigMapName, err)
+	}
+	if err == nil {
+		pemData, _, _ := unstructured.NestedString(configMap.Object, "data", rootCAConfigMapKey)
+		bundles = append(bundles, TrustBundle{Kind: "ConfigMap", Namespace: rootCAConfigMapNamespace, Name: rootCAConfigMapName,
+			Certificates: trustedCertificates(pemData)})
+	}
+	return bundles, nil
+}
+
+// trustedCertificates parses every certificate of a PEM bundle, blocks that aren't valid certificates are skipped
+func trustedCertificates(pemData string) []TrustedCertificate {
+	var certificates []TrustedCertificate
+	rest := []byte(pemData)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return certificates
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		fingerprint := sha256.Sum256(cert.Raw)
+		certificates = append(certificates, TrustedCertificate{
+			Fingerprint: hex.EncodeToString(fingerprint[:]),
+			Subject:     cert.Subject.String(),
+			NotAfter:    cert.NotAfter.UTC().Format("2006-01-02T15:04:05Z"),
+		})
+	}
+}
+
+// MissingTrustRoots returns the certificates of the bundles that the current bundles don't have, as subject and fingerprint
+func MissingTrustRoots(recorded, current []TrustBundle) []string {
+	present := make(map[string]bool)
+	for _, bundle := range current {
+		for _, cert := range bundle.Certificates {
+			present[cert.Fingerprint] = true
+		}
+	}
+	var missing []string
+	reported := make(map[string]bool)
+	for _, bundle := range recorded {
+		for _, cert := range bundle.Certificates {
+			if present[cert.Fingerprint] || reported[cert.Fingerprint] {
+				continue
+			}
+			reported[cert.Fingerprint] = true
+			missing = append(missing, fmt.Sprintf("%v (sha256 %v) from %v %v", cert.Subject, cert.Fingerprint, bundle.Kind, bundle.Name))
+		}
+	}
+	return missing
+}
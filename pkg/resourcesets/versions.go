@@ -0,0 +1,147 @@
+package resourcesets
+
+import (
+	"context"
+	"fmt"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	"github.com/sirupsen/logrus"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+// NormalizeAPIVersion returns the groupVersion discovery serves for the apiVersion of a selector. The core group is
+// accepted as v1, /v1 and core/v1, all of them are gathered as v1
+func NormalizeAPIVersion(apiVersion string) (string, error) {
+	if apiVersion == "" {
+		return "", fmt.Errorf("apiVersion is empty, use v1 for the core group or group/version for all others")
+	}
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return "", fmt.Errorf("apiVersion %v is invalid, use v1 for the core group or group/version for all others: %v", apiVersion, err)
+	}
+	if gv.Version == "" {
+		return "", fmt.Errorf("apiVersion %v has no version, use v1 for the core group or group/version for all others", apiVersion)
+	}
+	if gv.Group == "core" {
+		gv.Group = ""
+	}
+	return gv.String(), nil
+}
+
+// Version policies of a selector, see withSelectedVersion
+const (
+	VersionPolicyPinned    = "Pinned"
+	VersionPolicyPreferred = "Preferred"
+	VersionPolicyHighest   = "Highest"
+)
+
+// ValidateVersionPolicy returns an error for anything but the VersionPolicy constants, empty is VersionPolicyPinned
+func ValidateVersionPolicy(policy string) error {
+	switch policy {
+	case "", VersionPolicyPinned, VersionPolicyPreferred, VersionPolicyHighest:
+		return nil
+	}
+	return fmt.Errorf("invalid versionPolicy %v, must be %v, %v or %v", policy, VersionPolicyPinned, VersionPolicyPreferred, VersionPolicyHighest)
+}
+
+func versionPolicy(selector v1.ResourceSelector) string {
+	if selector.VersionPolicy == "" && selector.PreferredVersionOnly {
+		return VersionPolicyPreferred
+	}
+	return selector.VersionPolicy
+}
+
+// withSelectedVersion returns the selector with its apiVersion normalized. With VersionPolicyPreferred it's replaced by
+// the preferred version discovery reports for its group, with VersionPolicyHighest by the highest served version, ordered
+// like kubernetes versions so v2 is above v1 and v1 above v1beta1. A group that isn't served keeps the apiVersion, it's
+// skipped when gathered
+func (h *ResourceHandler) withSelectedVersion(ctx context.Context, selector v1.ResourceSelector) (v1.ResourceSelector, error) {
+	apiVersion, err := NormalizeAPIVersion(selector.APIVersion)
+	if err != nil {
+		return selector, err
+	}
+	selector.APIVersion = apiVersion
+	policy := versionPolicy(selector)
+	if policy == "" || policy == VersionPolicyPinned {
+		return selector, nil
+	}
+	gv, err := schema.ParseGroupVersion(selector.APIVersion)
+	if err != nil {
+		return selector, err
+	}
+	var groups *k8sv1.APIGroupList
+	err = retryAPICall(ctx, "discover groups", func() (err error) {
+		groups, err = h.DiscoveryClient.ServerGroups()
+		return err
+	})
+	if err != nil {
+		return selector, fmt.Errorf("error getting versions of group %v: %v", gv.Group, err)
+	}
+	for _, group := range groups.Groups {
+		if group.Name != gv.Group {
+			continue
+		}
+		selected := group.PreferredVersion.GroupVersion
+		if policy == VersionPolicyHighest {
+			selected = highestVersion(group)
+		}
+		if selected == "" {
+			break
+		}
+		if selected != selector.APIVersion {
+			logrus.Infof("Gathering %v at version %v, following versionPolicy %v", selector.APIVersion, selected, policy)
+		}
+		selector.APIVersion = selected
+		break
+	}
+	return selector, nil
+}
+
+func highestVersion(group k8sv1.APIGroup) string {
+	var highest k8sv1.GroupVersionForDiscovery
+	for _, v := range group.Versions {
+		if highest.Version == "" || version.CompareKubeAwareVersionStrings(v.Version, highest.Version) > 0 {
+			highest = v
+		}
+	}
+	return highest.GroupVersion
+}
+
+// recordVersion records the version a resource is gathered at in the manifest, the first one if selectors gather it at
+// several versions
+func (h *ResourceHandler) recordVersion(gvResource GVResource) {
+	if h.Manifest.Versions == nil {
+		h.Manifest.Versions = make(map[string]string)
+	}
+	key := gvResource.Name + "." + gvResource.GroupVersion.Group
+	if _, ok := h.Manifest.Versions[key]; !ok {
+		h.Manifest.Versions[key] = gvResource.GroupVersion.Version
+	}
+}
+
+// gatheredVersions holds the version every object was gathered at, by group resource and objectKey. A resource served at
+// several versions returns the same objects for each of them, an object is only backed up at the first version gathered
+type gatheredVersions map[schema.GroupResource]map[string]string
+
+func (g gatheredVersions) dropGatheredAtOtherVersions(gvResource GVResource, objects []unstructured.Unstructured) []unstructured.Unstructured {
+	gr := schema.GroupResource{Group: gvResource.GroupVersion.Group, Resource: gvResource.Name}
+	versions, ok := g[gr]
+	if !ok {
+		versions = make(map[string]string)
+		g[gr] = versions
+	}
+	var kept []unstructured.Unstructured
+	for _, obj := range objects {
+		key := objectKey(obj)
+		if version, ok := versions[key]; ok && version != gvResource.GroupVersion.Version {
+			logrus.WithFields(logrus.Fields{"resource": gr.String(), "object": key, "version": version}).Debug("Skipping object already gathered at another version")
+			continue
+		}
+		versions[key] = gvResource.GroupVersion.Version
+		kept = append(kept, obj)
+	}
+	return kept
+}
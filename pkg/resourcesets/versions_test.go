@@ -0,0 +1,179 @@
+package resourcesets
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// testVersionedWidgets serves widgets at each of the versions, with the same objects at every version. Discovery
+// reports the first version as the preferred one
+func testVersionedWidgets(versions ...string) ([]*k8sv1.APIResourceList, []runtime.Object) {
+	var resources []*k8sv1.APIResourceList
+	var objs []runtime.Object
+	for _, version := range versions {
+		resources = append(resources, &k8sv1.APIResourceList{
+			GroupVersion: "example.com/" + version,
+			APIResources: []k8sv1.APIResource{{Name: "widgets", Kind: "Widget", Namespaced: true, Verbs: k8sv1.Verbs{"list"}}},
+		})
+		for i := 0; i < 3; i++ {
+			objs = append(objs, testObject("example.com/"+version, "Widget", "default", fmt.Sprintf("widget-%d", i)))
+		}
+	}
+	return resources, objs
+}
+
+func TestObjectsServedAtSeveralVersionsWrittenOnce(t *testing.T) {
+	tests := []struct {
+		name        string
+		selectors   []v1.ResourceSelector
+		wantVersion string
+	}{
+		{
+			name: "selectors for both versions",
+			selectors: []v1.ResourceSelector{
+				{APIVersion: "example.com/v1", Kinds: []string{"widgets"}},
+				{APIVersion: "example.com/v1beta1", Kinds: []string{"widgets"}},
+			},
+			wantVersion: "v1",
+		},
+		{
+			name: "older version first",
+			selectors: []v1.ResourceSelector{
+				{APIVersion: "example.com/v1beta1", KindsRegexp: "."},
+				{APIVersion: "example.com/v1", KindsRegexp: "."},
+			},
+			wantVersion: "v1beta1",
+		},
+		{
+			name: "preferredVersionOnly",
+			selectors: []v1.ResourceSelector{
+				{APIVersion: "example.com/v1beta1", Kinds: []string{"widgets"}, PreferredVersionOnly: true},
+				{APIVersion: "example.com/v1beta1", Kinds: []string{"widgets"}},
+			},
+			wantVersion: "v1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources, objs := testVersionedWidgets("v1", "v1beta1")
+			h, _ := testResourceHandler(resources, objs...)
+			if err := h.GatherResources(context.Background(), tt.selectors); err != nil {
+				t.Fatalf("GatherResources() error: %v", err)
+			}
+			if err := h.WriteBackupObjects(t.TempDir()); err != nil {
+				t.Fatalf("WriteBackupObjects() error: %v", err)
+			}
+			var want []string
+			for i := 0; i < 3; i++ {
+				want = append(want, fmt.Sprintf("example.com/%v/widgets/default/widget-%d", tt.wantVersion, i))
+			}
+			if got := writtenObjects(&h.Manifest); !reflect.DeepEqual(got, want) {
+				t.Errorf("objects written = %v, want %v", got, want)
+			}
+			if got := h.Manifest.Versions["widgets.example.com"]; got != tt.wantVersion {
+				t.Errorf("manifest version of widgets = %v, want %v", got, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestNormalizeAPIVersion(t *testing.T) {
+	tests := []struct {
+		apiVersion string
+		want       string
+		wantErr    bool
+	}{
+		{apiVersion: "v1", want: "v1"},
+		{apiVersion: "/v1", want: "v1"},
+		{apiVersion: "core/v1", want: "v1"},
+		{apiVersion: "apps/v1", want: "apps/v1"},
+		{apiVersion: "", wantErr: true},
+		{apiVersion: "apps/", wantErr: true},
+		{apiVersion: "apps/v1/deployments", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeAPIVersion(tt.apiVersion)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeAPIVersion(%q) error = %v, wantErr %v", tt.apiVersion, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeAPIVersion(%q) = %q, want %q", tt.apiVersion, got, tt.want)
+		}
+	}
+}
+
+func TestCoreGroupSpellingsGatherTheSameResources(t *testing.T) {
+	objs := []runtime.Object{
+		testObject("v1", "ConfigMap", "default", "settings"),
+		testObject("v1", "Secret", "default", "token"),
+		testObject("apps/v1", "Deployment", "default", "web"),
+	}
+	want := []string{"v1/configmaps/default/settings", "v1/secrets/default/token"}
+	for _, apiVersion := range []string{"v1", "/v1", "core/v1"} {
+		t.Run(apiVersion, func(t *testing.T) {
+			h, _ := testResourceHandler(testClusterResources, objs...)
+			selectors := []v1.ResourceSelector{{APIVersion: apiVersion, Kinds: []string{"configmaps", "secrets"}}}
+			if err := h.GatherResources(context.Background(), selectors); err != nil {
+				t.Fatalf("GatherResources() error: %v", err)
+			}
+			if err := h.WriteBackupObjects(t.TempDir()); err != nil {
+				t.Fatalf("WriteBackupObjects() error: %v", err)
+			}
+			if got := writtenObjects(&h.Manifest); !reflect.DeepEqual(got, want) {
+				t.Errorf("objects written for apiVersion %q = %v, want %v", apiVersion, got, want)
+			}
+		})
+	}
+}
+
+func TestOnlySelectedVersionIsListed(t *testing.T) {
+	tests := []struct {
+		name        string
+		apiVersion  string
+		policy      string
+		wantVersion string
+	}{
+		{name: "pinned v1", apiVersion: "example.com/v1", wantVersion: "v1"},
+		{name: "pinned v2", apiVersion: "example.com/v2", policy: VersionPolicyPinned, wantVersion: "v2"},
+		{name: "preferred", apiVersion: "example.com/v2", policy: VersionPolicyPreferred, wantVersion: "v1"},
+		{name: "highest", apiVersion: "example.com/v1", policy: VersionPolicyHighest, wantVersion: "v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources, objs := testVersionedWidgets("v1", "v2")
+			h, client := testResourceHandler(resources, objs...)
+			selector := v1.ResourceSelector{APIVersion: tt.apiVersion, Kinds: []string{"widgets"}, VersionPolicy: tt.policy}
+			selected, err := h.withSelectedVersion(context.Background(), selector)
+			if err != nil {
+				t.Fatalf("withSelectedVersion() error: %v", err)
+			}
+			if want := "example.com/" + tt.wantVersion; selected.APIVersion != want {
+				t.Errorf("withSelectedVersion() apiVersion = %v, want %v", selected.APIVersion, want)
+			}
+
+			client.ClearActions()
+			if err := h.GatherResources(context.Background(), []v1.ResourceSelector{selector}); err != nil {
+				t.Fatalf("GatherResources() error: %v", err)
+			}
+			var listed []string
+			for _, action := range client.Actions() {
+				if action.GetVerb() == "list" {
+					listed = append(listed, action.GetResource().Version)
+				}
+			}
+			if want := []string{tt.wantVersion}; !reflect.DeepEqual(listed, want) {
+				t.Errorf("widgets listed at versions %v, want %v", listed, want)
+			}
+			if got := h.Manifest.Versions["widgets.example.com"]; got != tt.wantVersion {
+				t.Errorf("manifest version of widgets = %v, want %v", got, tt.wantVersion)
+			}
+		})
+	}
+}
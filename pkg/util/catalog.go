@@ -0,0 +1,55 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	v1 "github.com/rancher/backup-restore-operator/pkg/apis/resources.cattle.io/v1"
+)
+
+// CatalogConfigMapName is the ConfigMap in the chart namespace listing every artifact the operator created, one key per
+// entry with the CatalogEntry as JSON
+const CatalogConfigMapName = "rancher-backup-catalog"
+
+// CatalogEntry is a restore point, a Restore can reference it by ID instead of naming the file and its storage location
+type CatalogEntry struct {
+	ID         string `json:"id"`
+	BackupName string `json:"backupName"`
+	Filename   string `json:"filename"`
+	Timestamp  string `json:"timestamp"`
+	Size       int64  `json:"size"`
+	// Checksum is the sha256 of the artifact
+	Checksum        string `json:"checksum"`
+	Encrypted       bool   `json:"encrypted"`
+	StorageLocation string `json:"storageLocation"`
+	// S3 is the object store of artifacts stored in S3, it references the credential secret and doesn't hold credentials
+	S3 *v1.S3ObjectStore `json:"s3,omitempty"`
+}
+
+// CatalogEntryID is the key of an artifact in the catalog, it is also a valid ConfigMap key
+func CatalogEntryID(storageLocation string, s3 *v1.S3ObjectStore, filename string) string {
+	location := storageLocation
+	if s3 != nil {
+		location = fmt.Sprintf("%s/%s/%s/%s", storageLocation, s3.Endpoint, s3.BucketName, s3.Folder)
+	}
+	hash := sha256.Sum256([]byte(location + "/" + filename))
+	return hex.EncodeToString(hash[:8])
+}
+
+// FileChecksum returns the size and the sha256 of a file
+func FileChecksum(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
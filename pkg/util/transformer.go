@@ -0,0 +1,92 @@
+package util
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rancher/backup-restore-operator/pkg/metrics"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/storage/value"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	encryptOperation = "encrypt"
+	decryptOperation = "decrypt"
+)
+
+var (
+	// EncryptionProviderTimeout is the longest a single call to the encryption provider can take
+	EncryptionProviderTimeout = 10 * time.Second
+	// EncryptionProviderRetries is the number of attempts for every call to the encryption provider
+	EncryptionProviderRetries = 3
+)
+
+// EncryptionProviderError is returned when the encryption provider, usually an external KMS, timed out or failed on every attempt
+type EncryptionProviderError struct {
+	Operation string
+	Err       error
+}
+
+func (e *EncryptionProviderError) Error() string {
+	return fmt.Sprintf("encryption provider failed to %v after %v attempts, check that the KMS is available: %v", e.Operation, EncryptionProviderRetries, e.Err)
+}
+
+func TransformToStorage(transformer value.Transformer, data []byte, context value.Context) ([]byte, error) {
+	return callEncryptionProvider(encryptOperation, func() ([]byte, error) {
+		return transformer.TransformToStorage(data, context)
+	})
+}
+
+func TransformFromStorage(transformer value.Transformer, data []byte, context value.Context) ([]byte, error) {
+	return callEncryptionProvider(decryptOperation, func() ([]byte, error) {
+		out, _, err := transformer.TransformFromStorage(data, context)
+		return out, err
+	})
+}
+
+type transformResult struct {
+	out []byte
+	err error
+}
+
+func callEncryptionProvider(operation string, call func() ([]byte, error)) ([]byte, error) {
+	backoff := wait.Backoff{
+		Steps:    EncryptionProviderRetries,
+		Duration: 500 * time.Millisecond,
+		Factor:   2.0,
+		Jitter:   0.1,
+	}
+	var out []byte
+	err := retry.OnError(backoff, func(error) bool { return true }, func() error {
+		result := callWithTimeout(operation, call)
+		out = result.out
+		return result.err
+	})
+	if err != nil {
+		return nil, &EncryptionProviderError{Operation: operation, Err: err}
+	}
+	return out, nil
+}
+
+// callWithTimeout stops waiting for a call that doesn't return in time. The transformers take no context,
+// so a hanging call keeps its goroutine until the provider answers
+func callWithTimeout(operation string, call func() ([]byte, error)) transformResult {
+	start := time.Now()
+	results := make(chan transformResult, 1)
+	go func() {
+		out, err := call()
+		results <- transformResult{out: out, err: err}
+	}()
+	select {
+	case result := <-results:
+		metrics.ObserveEncryptionProviderCall(operation, time.Since(start))
+		if result.err != nil {
+			metrics.IncEncryptionProviderFailures(operation, "error")
+		}
+		return result
+	case <-time.After(EncryptionProviderTimeout):
+		metrics.IncEncryptionProviderFailures(operation, "timeout")
+		return transformResult{err: fmt.Errorf("timed out after %v", EncryptionProviderTimeout)}
+	}
+}
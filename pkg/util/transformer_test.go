@@ -0,0 +1,146 @@
+package util
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apiserver/pkg/storage/value"
+)
+
+// fakeTransformer stands in for a KMS, the first failures calls fail and the first delayed calls take delay
+type fakeTransformer struct {
+	lock     sync.Mutex
+	calls    int
+	failures int
+	delayed  int
+	delay    time.Duration
+}
+
+func (f *fakeTransformer) call() error {
+	f.lock.Lock()
+	f.calls++
+	calls := f.calls
+	f.lock.Unlock()
+	if calls <= f.delayed {
+		time.Sleep(f.delay)
+	}
+	if calls <= f.failures {
+		return errors.New("kms unavailable")
+	}
+	return nil
+}
+
+func (f *fakeTransformer) TransformFromStorage(data []byte, context value.Context) ([]byte, bool, error) {
+	if err := f.call(); err != nil {
+		return nil, false, err
+	}
+	return []byte(strings.TrimPrefix(string(data), "enc:")), false, nil
+}
+
+func (f *fakeTransformer) TransformToStorage(data []byte, context value.Context) ([]byte, error) {
+	if err := f.call(); err != nil {
+		return nil, err
+	}
+	return append([]byte("enc:"), data...), nil
+}
+
+// encryptionProviderFailures returns the failures of the operation counted with reason
+func encryptionProviderFailures(t *testing.T, operation, reason string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "backup_restore_operator_encryption_provider_failures_total" {
+			continue
+		}
+		for _, metric := range family.Metric {
+			labels := make(map[string]string)
+			for _, label := range metric.Label {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["operation"] == operation && labels["reason"] == reason {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestEncryptionProviderRetries(t *testing.T) {
+	defer func(timeout time.Duration, retries int) {
+		EncryptionProviderTimeout, EncryptionProviderRetries = timeout, retries
+	}(EncryptionProviderTimeout, EncryptionProviderRetries)
+	EncryptionProviderTimeout = 100 * time.Millisecond
+	EncryptionProviderRetries = 2
+
+	tests := []struct {
+		name             string
+		transformer      *fakeTransformer
+		wantErr          string
+		wantCalls        int
+		wantErrors       float64
+		wantTimeouts     float64
+		decryptToo       bool
+		wantDecryptCalls int
+	}{
+		{name: "no failure", transformer: &fakeTransformer{}, wantCalls: 1, decryptToo: true, wantDecryptCalls: 2},
+		{name: "transient error", transformer: &fakeTransformer{failures: 1}, wantCalls: 2, wantErrors: 1},
+		{name: "transient timeout", transformer: &fakeTransformer{delayed: 1, delay: time.Second}, wantCalls: 2, wantTimeouts: 1},
+		{
+			name:        "provider failing",
+			transformer: &fakeTransformer{failures: 10},
+			wantErr:     "encryption provider failed to encrypt after 2 attempts, check that the KMS is available: kms unavailable",
+			wantCalls:   2,
+			wantErrors:  2,
+		},
+		{
+			name:         "provider hanging",
+			transformer:  &fakeTransformer{delayed: 10, delay: time.Second},
+			wantErr:      "encryption provider failed to encrypt after 2 attempts, check that the KMS is available: timed out after 100ms",
+			wantCalls:    2,
+			wantTimeouts: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errorsBefore := encryptionProviderFailures(t, encryptOperation, "error")
+			timeoutsBefore := encryptionProviderFailures(t, encryptOperation, "timeout")
+			start := time.Now()
+			out, err := TransformToStorage(tt.transformer, []byte("secret"), value.DefaultContext("default#creds"))
+			if time.Since(start) > 5*time.Second {
+				t.Errorf("TransformToStorage() returned after %v, want calls bounded by the timeout", time.Since(start))
+			}
+			if tt.wantErr != "" {
+				var providerErr *EncryptionProviderError
+				if !errors.As(err, &providerErr) || providerErr.Operation != encryptOperation || err.Error() != tt.wantErr {
+					t.Errorf("TransformToStorage() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil || string(out) != "enc:secret" {
+				t.Errorf("TransformToStorage() = %q, %v, want the encrypted data", out, err)
+			}
+			tt.transformer.lock.Lock()
+			calls := tt.transformer.calls
+			tt.transformer.lock.Unlock()
+			if calls != tt.wantCalls {
+				t.Errorf("encryption provider called %v times, want %v", calls, tt.wantCalls)
+			}
+			if got := encryptionProviderFailures(t, encryptOperation, "error") - errorsBefore; got != tt.wantErrors {
+				t.Errorf("errors counted = %v, want %v", got, tt.wantErrors)
+			}
+			if got := encryptionProviderFailures(t, encryptOperation, "timeout") - timeoutsBefore; got != tt.wantTimeouts {
+				t.Errorf("timeouts counted = %v, want %v", got, tt.wantTimeouts)
+			}
+			if tt.decryptToo {
+				decrypted, err := TransformFromStorage(tt.transformer, out, value.DefaultContext("default#creds"))
+				if err != nil || string(decrypted) != "secret" || tt.transformer.calls != tt.wantDecryptCalls {
+					t.Errorf("TransformFromStorage() = %q, %v after %v calls, want the data decrypted", decrypted, err, tt.transformer.calls)
+				}
+			}
+		})
+	}
+}
@@ -3,10 +3,14 @@ package util
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"reflect"
+	"time"
 
 	v1core "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
 	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	k8sv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apiserver/pkg/server/options/encryptionconfig"
@@ -20,8 +24,35 @@ const (
 	encryptionProviderConfigKey = "encryption-provider-config.yaml"
 )
 
+// BackupDirMode and BackupFileMode are the permissions of the dirs and files the operator writes, backups hold secrets
+const (
+	BackupDirMode  os.FileMode = 0700
+	BackupFileMode os.FileMode = 0600
+)
+
 var ChartNamespace string
 
+// OperatorVersion is recorded in the metadata of every backup
+var OperatorVersion string
+
+// DefaultEncryptionConfigSecretName is the encryption config of backups that don't name their own, empty means these aren't encrypted
+var DefaultEncryptionConfigSecretName string
+
+// MaxConcurrentBackups is the number of backups that can run at the same time, 0 doesn't limit them
+var MaxConcurrentBackups int
+
+// CheckpointDir holds the checkpoints of backups with checkpoint set, empty uses os.TempDir
+var CheckpointDir string
+
+// APIRetries is the number of attempts for calls to the apiserver that fail with a timeout, throttling or a server error
+var APIRetries = 3
+
+// APIRetryDelay is the wait before the second attempt of a call to the apiserver, it doubles with every attempt after that
+var APIRetryDelay = time.Second
+
+// BackupIgnoreAnnotation is the annotation that opts an object out of all backups when set to "true"
+var BackupIgnoreAnnotation = "backup.rancher.io/ignore"
+
 func GetEncryptionTransformers(encryptionConfigSecretName string, secrets v1core.SecretController) (map[schema.GroupResource]value.Transformer, error) {
 	var transformerMap map[schema.GroupResource]value.Transformer
 	// EncryptionConfig secret ns is hardcoded to ns of controller in chart's ns
@@ -29,13 +60,54 @@ func GetEncryptionTransformers(encryptionConfigSecretName string, secrets v1core
 	logrus.Infof("Get encryption config from namespace %v", ChartNamespace)
 	encryptionConfigSecret, err := secrets.Get(ChartNamespace, encryptionConfigSecretName, k8sv1.GetOptions{})
 	if err != nil {
-		return transformerMap, err
+		if apierrors.IsNotFound(err) {
+			return transformerMap, fmt.Errorf("encryption config secret %v not found, it must be created in the namespace %v of the operator", encryptionConfigSecretName, ChartNamespace)
+		}
+		return transformerMap, fmt.Errorf("error getting encryption config secret %v: %v", encryptionConfigSecretName, err)
 	}
 	encryptionConfigBytes, ok := encryptionConfigSecret.Data[encryptionProviderConfigKey]
 	if !ok {
-		return transformerMap, fmt.Errorf("no encryptionConfig provided")
+		return transformerMap, fmt.Errorf("encryption config secret %v has no key %v", encryptionConfigSecretName, encryptionProviderConfigKey)
+	}
+	transformerMap, err = encryptionconfig.ParseEncryptionConfiguration(bytes.NewReader(encryptionConfigBytes))
+	if err != nil {
+		return transformerMap, fmt.Errorf("invalid encryption config in secret %v: %v", encryptionConfigSecretName, err)
+	}
+	return transformerMap, nil
+}
+
+// GetEncryptionTransformersFromFile parses an encryption config file, for restores that run without the operator
+func GetEncryptionTransformersFromFile(path string) (map[schema.GroupResource]value.Transformer, error) {
+	encryptionConfigBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading encryption config %v: %v", path, err)
 	}
-	return encryptionconfig.ParseEncryptionConfiguration(bytes.NewReader(encryptionConfigBytes))
+	transformerMap, err := encryptionconfig.ParseEncryptionConfiguration(bytes.NewReader(encryptionConfigBytes))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption config in %v: %v", path, err)
+	}
+	return transformerMap, nil
+}
+
+// ProbeEncryptionTransformers encrypts and decrypts a probe with the transformer of every resource, so a backup fails
+// before gathering anything if a provider like a KMS plugin is unreachable
+func ProbeEncryptionTransformers(transformerMap map[schema.GroupResource]value.Transformer) error {
+	probe := []byte("backup-restore-operator-probe")
+	for gr, transformer := range transformerMap {
+		ctx := value.DefaultContext([]byte("probe#" + gr.String()))
+		encrypted, err := TransformToStorage(transformer, probe, ctx)
+		if err != nil {
+			return fmt.Errorf("encryption provider for %v is unavailable: %v", gr.String(), err)
+		}
+		decrypted, err := TransformFromStorage(transformer, encrypted, ctx)
+		if err != nil {
+			return fmt.Errorf("encryption provider for %v is unavailable: %v", gr.String(), err)
+		}
+		if !bytes.Equal(decrypted, probe) {
+			return fmt.Errorf("encryption provider for %v doesn't decrypt what it encrypted", gr.String())
+		}
+	}
+	return nil
 }
 
 func GetObjectQueue(l interface{}, capacity int) chan interface{} {
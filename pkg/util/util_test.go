@@ -0,0 +1,99 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage/value"
+	kmstesting "k8s.io/apiserver/pkg/storage/value/encrypt/envelope/testing"
+)
+
+const testKMSEncryptionConfig = `apiVersion: apiserver.config.k8s.io/v1
+kind: EncryptionConfiguration
+resources:
+  - resources:
+      - secrets
+    providers:
+      - kms:
+          name: fake
+          endpoint: unix://%v
+          cachesize: 10
+          timeout: 1s
+`
+
+// startFakeKMSPlugin serves a KMS plugin that base64 encodes the keys it encrypts on a unix socket in dir
+func startFakeKMSPlugin(t *testing.T, dir string) (*kmstesting.Base64Plugin, string) {
+	socketPath := filepath.Join(dir, "kms.sock")
+	plugin, err := kmstesting.NewBase64Plugin(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plugin.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(plugin.CleanUp)
+	if err := kmstesting.WaitForBase64PluginToBeUp(plugin); err != nil {
+		t.Fatal(err)
+	}
+	return plugin, socketPath
+}
+
+func TestKMSEncryptionProvider(t *testing.T) {
+	retries := EncryptionProviderRetries
+	EncryptionProviderRetries = 1
+	defer func() { EncryptionProviderRetries = retries }()
+
+	dir := t.TempDir()
+	plugin, socketPath := startFakeKMSPlugin(t, dir)
+	configPath := filepath.Join(dir, "encryption-provider-config.yaml")
+	if err := ioutil.WriteFile(configPath, []byte(fmt.Sprintf(testKMSEncryptionConfig, socketPath)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	transformers, err := GetEncryptionTransformersFromFile(configPath)
+	if err != nil {
+		t.Fatalf("GetEncryptionTransformersFromFile() error: %v", err)
+	}
+	if err := ProbeEncryptionTransformers(transformers); err != nil {
+		t.Fatalf("ProbeEncryptionTransformers() with a running KMS plugin error: %v", err)
+	}
+
+	transformer := transformers[schema.GroupResource{Resource: "secrets"}]
+	plain := []byte(`{"data":{"password":"aHVudGVyMg=="}}`)
+	ctx := value.DefaultContext([]byte("cattle-system#creds"))
+	encrypted, err := TransformToStorage(transformer, plain, ctx)
+	if err != nil {
+		t.Fatalf("TransformToStorage() error: %v", err)
+	}
+	if !bytes.HasPrefix(encrypted, []byte("k8s:enc:kms:v1:fake:")) || bytes.Contains(encrypted, plain) {
+		t.Errorf("TransformToStorage() = %q, want it encrypted by the KMS provider", encrypted)
+	}
+	if plugin.LastEncryptRequest() == nil {
+		t.Errorf("the data encryption key wasn't encrypted by the KMS plugin")
+	}
+	decrypted, err := TransformFromStorage(transformer, encrypted, ctx)
+	if err != nil {
+		t.Fatalf("TransformFromStorage() error: %v", err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Errorf("TransformFromStorage() = %q, want %q", decrypted, plain)
+	}
+
+	plugin.EnterFailedState()
+	err = ProbeEncryptionTransformers(transformers)
+	if err == nil || !strings.Contains(err.Error(), "encryption provider for secrets is unavailable") {
+		t.Errorf("ProbeEncryptionTransformers() with a failing KMS plugin error = %v, want the provider unavailable", err)
+	}
+	if _, err := TransformToStorage(transformer, plain, ctx); err == nil {
+		t.Errorf("TransformToStorage() with a failing KMS plugin wrote %q", plain)
+	}
+
+	plugin.CleanUp()
+	if err := ProbeEncryptionTransformers(transformers); err == nil {
+		t.Errorf("ProbeEncryptionTransformers() with an unreachable KMS plugin succeeded")
+	}
+}